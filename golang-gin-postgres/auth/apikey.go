@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+	"example-server/repos"
+)
+
+const (
+	apiKeyScheme = "ek"
+	// Bound the lookup cache, which also holds misses
+	apiKeyCacheMaxEntries = 10000
+)
+
+// API keys look like ek_<prefix>_<secret>; the prefix is stored in clear for lookup
+var apiKeyPattern = regexp.MustCompile(`^` + apiKeyScheme + `_([0-9a-f]{8})_[A-Za-z0-9_-]{43}$`)
+
+// GenerateAPIKey returns a new key along with its prefix and hash
+func GenerateAPIKey() (key string, prefix string, keyHash []byte, err error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", nil, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", nil, err
+	}
+	prefix = hex.EncodeToString(prefixBytes)
+	key = apiKeyScheme + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes a high-entropy key for storage
+func HashAPIKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// APIKeyCacheTTLFromEnv reads AUTH_API_KEY_CACHE_TTL (default 30s, 0 disables caching)
+func APIKeyCacheTTLFromEnv() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("AUTH_API_KEY_CACHE_TTL"))
+	if err != nil {
+		return 30 * time.Second
+	}
+	return ttl
+}
+
+type cachedAPIKey struct {
+	apiKey    *models.APIKey
+	expiresAt time.Time
+}
+
+// APIKeyAuthenticator checks API keys against the api_keys table, caching
+// lookups by prefix for a short TTL
+type APIKeyAuthenticator struct {
+	dbPool database.PgxPoolIface
+	ttl    time.Duration
+	mu     sync.Mutex
+	cache  map[string]cachedAPIKey
+}
+
+func NewAPIKeyAuthenticator(dbPool database.PgxPoolIface, ttl time.Duration) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		dbPool: dbPool,
+		ttl:    ttl,
+		cache:  map[string]cachedAPIKey{},
+	}
+}
+
+// Authenticate returns the principal of a valid, unexpired and unrevoked key
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	match := apiKeyPattern.FindStringSubmatch(key)
+	if match == nil {
+		return nil, errors.Wrap(ErrorInvalidAPIKey, "malformed key")
+	}
+	prefix := match[1]
+	apiKey, err := a.lookup(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey == nil || subtle.ConstantTimeCompare(HashAPIKey(key), apiKey.KeyHash) != 1 {
+		return nil, errors.Wrap(ErrorInvalidAPIKey, "unknown key")
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, errors.Wrap(ErrorInvalidAPIKey, "revoked key")
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, errors.Wrap(ErrorInvalidAPIKey, "expired key")
+	}
+	return &Principal{
+		Method:    MethodAPIKey,
+		Subject:   apiKey.Owner,
+		Scopes:    apiKey.Scopes,
+		TenantID:  apiKey.TenantID,
+		ExpiresAt: timeOrZero(apiKey.ExpiresAt),
+		Claims: map[string]interface{}{
+			"api_key_id":     apiKey.ID,
+			"api_key_prefix": apiKey.Prefix,
+		},
+	}, nil
+}
+
+// Invalidate drops a cached lookup, e.g. after revoking the key
+func (a *APIKeyAuthenticator) Invalidate(prefix string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cache, prefix)
+}
+
+// lookup returns the key for prefix, or nil if there is none; last use is
+// recorded on cache misses so it is written at most once per TTL
+func (a *APIKeyAuthenticator) lookup(ctx context.Context, prefix string) (*models.APIKey, error) {
+	a.mu.Lock()
+	cached, ok := a.cache[prefix]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.apiKey, nil
+	}
+	apiKey, err := repos.FetchAPIKeyByPrefix(ctx, a.dbPool, prefix)
+	if err != nil && !errors.Is(err, repos.ErrorAPIKeyNotFound) {
+		return nil, err
+	}
+	if apiKey != nil {
+		if err := repos.TouchAPIKey(ctx, a.dbPool, apiKey.ID); err != nil {
+			logger.FromContext(ctx).Warn().Err(err).Str("prefix", prefix).Msg("Failed to record API key use")
+		}
+	}
+	if a.ttl > 0 {
+		a.mu.Lock()
+		if len(a.cache) >= apiKeyCacheMaxEntries {
+			a.cache = map[string]cachedAPIKey{}
+		}
+		a.cache[prefix] = cachedAPIKey{apiKey: apiKey, expiresAt: time.Now().Add(a.ttl)}
+		a.mu.Unlock()
+	}
+	return apiKey, nil
+}
+
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrorMissingToken   = errors.New("missing bearer token")
+	ErrorInvalidToken   = errors.New("invalid token")
+	ErrorNotConfigured  = errors.New("no token verification keys configured")
+	ErrorUnknownKey     = errors.New("unknown signing key")
+	ErrorInvalidKeySet  = errors.New("invalid JWKS")
+	ErrorKeySetNotFound = errors.New("JWKS not found")
+	ErrorInvalidAPIKey  = errors.New("invalid API key")
+)
+
+// Authentication methods recorded on the Principal
+const (
+	MethodJWT        = "jwt"
+	MethodAPIKey     = "api_key"
+	MethodClientCert = "client_cert"
+)
+
+// TenantClaim binds a token to a tenant
+const TenantClaim = "tenant_id"
+
+// CrossTenantScope lets credentials bound to no tenant pick one with the
+// X-Tenant-ID header; other tenant-less credentials are rejected
+const CrossTenantScope = "tenants:admin"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Method    string
+	Subject   string
+	Issuer    string
+	Audience  []string
+	Scopes    []string
+	TenantID  string
+	ExpiresAt time.Time
+	Claims    map[string]interface{}
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the authenticated principal, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// Config selects the accepted keys and the registered claims to check
+type Config struct {
+	// HMACSecret enables HS256 tokens
+	HMACSecret []byte
+	// JWKSFile and JWKSURL provide RS256/ES256 public keys
+	JWKSFile string
+	JWKSURL  string
+	// JWKSRefreshInterval is how often keys are reloaded from JWKSURL
+	JWKSRefreshInterval time.Duration
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew on exp and nbf
+	Leeway time.Duration
+}
+
+// ConfigFromEnv reads the AUTH_JWT_* and AUTH_JWKS_* environment variables
+func ConfigFromEnv() Config {
+	leeway, err := time.ParseDuration(os.Getenv("AUTH_JWT_LEEWAY"))
+	if err != nil {
+		leeway = 30 * time.Second
+	}
+	refreshInterval, err := time.ParseDuration(os.Getenv("AUTH_JWKS_REFRESH_INTERVAL"))
+	if err != nil || refreshInterval <= 0 {
+		refreshInterval = jwksPollInterval
+	}
+	return Config{
+		HMACSecret:          []byte(os.Getenv("AUTH_JWT_HS256_SECRET")),
+		JWKSFile:            os.Getenv("AUTH_JWKS_FILE"),
+		JWKSURL:             os.Getenv("AUTH_JWKS_URL"),
+		JWKSRefreshInterval: refreshInterval,
+		Issuer:              os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:            os.Getenv("AUTH_JWT_AUDIENCE"),
+		Leeway:              leeway,
+	}
+}
+
+// BearerToken extracts the token from an Authorization header value
+func BearerToken(header string) (string, error) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrorMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
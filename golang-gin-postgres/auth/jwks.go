@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"maps"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// Unknown kids trigger a JWKS URL refresh at most this often
+const jwksRefreshInterval = time.Minute
+
+// jwksPollInterval is how often the JWKS URL is reloaded by default
+const jwksPollInterval = 15 * time.Minute
+
+// keyAlgorithms is the algorithm Verifier accepts for each key type
+var keyAlgorithms = map[string]string{"RSA": "RS256", "EC": "ES256"}
+
+// errorUnsupportedKey marks keys parseKeySet skips rather than rejecting the
+// whole set, as identity providers publish keys of other algorithms alongside
+var errorUnsupportedKey = errors.New("unsupported key")
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// keySet holds RSA and EC public keys by kid. Keys from the URL are reloaded
+// every poll interval and on misses, replacing the previous ones so keys the
+// identity provider removed stop being trusted.
+type keySet struct {
+	mu          sync.RWMutex
+	fileKeys    map[string]crypto.PublicKey
+	keys        map[string]crypto.PublicKey
+	url         string
+	client      *http.Client
+	group       singleflight.Group
+	lastAttempt time.Time
+}
+
+func newKeySet(ctx context.Context, file, url string, pollInterval time.Duration) (*keySet, error) {
+	ks := &keySet{
+		fileKeys: map[string]crypto.PublicKey{},
+		keys:     map[string]crypto.PublicKey{},
+		url:      url,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(ErrorKeySetNotFound, err.Error())
+		}
+		keys, err := parseKeySet(data)
+		if err != nil {
+			return nil, err
+		}
+		ks.fileKeys = keys
+		ks.keys = keys
+	}
+	if url != "" {
+		if err := ks.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if pollInterval <= 0 {
+			pollInterval = jwksPollInterval
+		}
+		go ks.poll(ctx, pollInterval)
+	}
+	return ks, nil
+}
+
+// Key returns the public key for kid, refreshing from the URL if unknown
+func (ks *keySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	canRefresh := ks.url != "" && time.Since(ks.lastAttempt) > jwksRefreshInterval
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if canRefresh {
+		if err := ks.refresh(ctx); err != nil {
+			return nil, err
+		}
+		ks.mu.RLock()
+		key, ok = ks.keys[kid]
+		ks.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, ErrorUnknownKey
+}
+
+// poll refreshes the keys every interval until ctx is done, keeping the
+// current ones when that fails
+func (ks *keySet) poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := ks.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("url", ks.url).Msg("Failed to refresh JWKS")
+		}
+	}
+}
+
+// refresh replaces the URL's keys with the ones it serves now. Concurrent
+// refreshes share one fetch, and failed ones count towards
+// jwksRefreshInterval so an unreachable URL isn't hit on every miss.
+func (ks *keySet) refresh(ctx context.Context) error {
+	_, err, _ := ks.group.Do(ks.url, func() (interface{}, error) {
+		ks.mu.Lock()
+		ks.lastAttempt = time.Now()
+		ks.mu.Unlock()
+		keys, err := ks.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(keys, ks.fileKeys)
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		ks.keys = keys
+		return nil, nil
+	})
+	return err
+}
+
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching JWKS")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrorKeySetNotFound, "fetching JWKS: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading JWKS")
+	}
+	return parseKeySet(data)
+}
+
+// parseKeySet decodes the signing keys of a JWKS document, skipping
+// encryption keys and keys of unsupported types, algorithms or curves.
+// Malformed keys of supported types fail the whole set.
+func parseKeySet(data []byte) (map[string]crypto.PublicKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(ErrorInvalidKeySet, err.Error())
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch alg, ok := keyAlgorithms[jwk.Kty]; {
+		case !ok:
+			err = errors.Wrapf(errorUnsupportedKey, "key type %q", jwk.Kty)
+		case jwk.Alg != "" && jwk.Alg != alg:
+			err = errors.Wrapf(errorUnsupportedKey, "algorithm %q", jwk.Alg)
+		case jwk.Kty == "RSA":
+			key, err = parseRSAKey(jwk)
+		default:
+			key, err = parseECKey(jwk)
+		}
+		if errors.Is(err, errorUnsupportedKey) {
+			log.Debug().Str("kid", jwk.Kid).Err(err).Msg("Skipping JWKS key")
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(ErrorInvalidKeySet, "key %q: %s", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+func parseECKey(jwk jsonWebKey) (*ecdsa.PublicKey, error) {
+	if jwk.Crv != "P-256" {
+		return nil, errors.Wrapf(errorUnsupportedKey, "curve %q", jwk.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, err
+	}
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if _, err := key.ECDH(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+// Verifier checks JWT bearer tokens and turns their claims into a Principal
+type Verifier struct {
+	config  Config
+	keySet  *keySet
+	methods []string
+}
+
+// NewVerifier loads the configured keys. Keys from JWKSURL are reloaded until
+// ctx is done.
+func NewVerifier(ctx context.Context, config Config) (*Verifier, error) {
+	v := &Verifier{config: config}
+	if len(config.HMACSecret) > 0 {
+		v.methods = append(v.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if config.JWKSFile != "" || config.JWKSURL != "" {
+		keySet, err := newKeySet(ctx, config.JWKSFile, config.JWKSURL, config.JWKSRefreshInterval)
+		if err != nil {
+			return nil, err
+		}
+		v.keySet = keySet
+		v.methods = append(v.methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(v.methods) == 0 {
+		return nil, ErrorNotConfigured
+	}
+	return v, nil
+}
+
+// Verify validates the token signature and exp/nbf/aud/iss claims
+func (v *Verifier) Verify(ctx context.Context, tokenStr string) (*Principal, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(v.config.Leeway),
+	}
+	if v.config.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.config.Issuer))
+	}
+	if v.config.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.config.Audience))
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	}, opts...)
+	if err != nil {
+		return nil, errors.Wrap(ErrorInvalidToken, err.Error())
+	}
+	return newPrincipal(claims), nil
+}
+
+func (v *Verifier) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		return v.config.HMACSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.Wrap(ErrorUnknownKey, "missing kid")
+	}
+	return v.keySet.Key(ctx, kid)
+}
+
+func newPrincipal(claims jwt.MapClaims) *Principal {
+	principal := &Principal{Method: MethodJWT, Claims: claims}
+	principal.Subject, _ = claims.GetSubject()
+	principal.Issuer, _ = claims.GetIssuer()
+	principal.Audience, _ = claims.GetAudience()
+	principal.TenantID, _ = claims[TenantClaim].(string)
+	if exp, _ := claims.GetExpirationTime(); exp != nil {
+		principal.ExpiresAt = exp.Time.UTC().Truncate(time.Second)
+	}
+	// Scopes come as a space-separated "scope" or a "scp" list
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	} else if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				principal.Scopes = append(principal.Scopes, s)
+			}
+		}
+	}
+	return principal
+}
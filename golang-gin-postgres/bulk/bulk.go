@@ -0,0 +1,370 @@
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"example-server/models"
+)
+
+var (
+	ErrorUnsupportedFormat = errors.New("unsupported format")
+	ErrorInvalidOnConflict = errors.New("invalid on_conflict, expected update or skip")
+	ErrorInvalidHeader     = errors.New("CSV header must name the name and price columns")
+)
+
+// Format is a bulk file format for Items
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	// FormatJSON is the {"data": [...], "meta": {}} envelope of the Items API,
+	// only used for streamed responses
+	FormatJSON Format = "json"
+)
+
+const DefaultStreamMaxRows = 10000
+
+// StreamMaxRowsFromEnv reads STREAM_MAX_ROWS, the most Items one streamed
+// response may hold, defaulting to 10000
+func StreamMaxRowsFromEnv() int {
+	maxRows, err := strconv.Atoi(os.Getenv("STREAM_MAX_ROWS"))
+	if err != nil || maxRows <= 0 {
+		return DefaultStreamMaxRows
+	}
+	return maxRows
+}
+
+// OnConflict decides what an import does with names that already exist
+type OnConflict string
+
+const (
+	OnConflictUpdate OnConflict = "update"
+	OnConflictSkip   OnConflict = "skip"
+)
+
+// Column limits of the item table, checked before rows reach COPY
+const (
+	maxNameLength = 50
+	// maxPrice is the largest float32 within NUMERIC(10, 2): prices are
+	// float32, which rounds 99999999.99 up to 1e8
+	maxPrice float32 = 99999992
+)
+
+var csvHeader = []string{"id", "uuid", "created_at", "name", "price"}
+
+func ParseFormat(format string) (Format, error) {
+	switch Format(strings.ToLower(format)) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON:
+		return FormatNDJSON, nil
+	}
+	return "", ErrorUnsupportedFormat
+}
+
+// FormatFromContentType maps text/csv and application/x-ndjson (or
+// application/ndjson) to a Format
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ErrorUnsupportedFormat
+	}
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson", "application/ndjson":
+		return FormatNDJSON, nil
+	}
+	return "", ErrorUnsupportedFormat
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func ParseOnConflict(onConflict string) (OnConflict, error) {
+	switch OnConflict(strings.ToLower(onConflict)) {
+	case OnConflictUpdate:
+		return OnConflictUpdate, nil
+	case OnConflictSkip:
+		return OnConflictSkip, nil
+	}
+	return "", ErrorInvalidOnConflict
+}
+
+// WRITING
+
+// Writer encodes Items one at a time. Flush sends what is buffered so far;
+// Close must be called once done to finish the document.
+type Writer interface {
+	Write(item *models.Item) error
+	Flush() error
+	Close() error
+}
+
+func NewWriter(w io.Writer, format Format) Writer {
+	switch format {
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}
+	case FormatJSON:
+		return &jsonWriter{buffered: bufio.NewWriter(w)}
+	}
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+type csvWriter struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	return c.writer.Write(csvHeader)
+}
+
+func (c *csvWriter) Write(item *models.Item) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.writer.Write([]string{
+		strconv.Itoa(item.ID),
+		item.UUID,
+		item.CreatedAt.UTC().Format(time.RFC3339),
+		item.Name,
+		strconv.FormatFloat(float64(item.Price), 'f', -1, 32),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// Close writes the header too when there were no Items
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	return c.Flush()
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(item *models.Item) error {
+	return n.encoder.Encode(item)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.buffered.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.Flush()
+}
+
+// jsonWriter opens the data array on the first Write, so nothing is sent
+// before there is an Item or the stream is closed
+type jsonWriter struct {
+	buffered *bufio.Writer
+	opened   bool
+}
+
+func (j *jsonWriter) open() error {
+	if j.opened {
+		_, err := j.buffered.WriteString(",")
+		return err
+	}
+	j.opened = true
+	_, err := j.buffered.WriteString(`{"data":[`)
+	return err
+}
+
+func (j *jsonWriter) Write(item *models.Item) error {
+	encoded, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := j.open(); err != nil {
+		return err
+	}
+	_, err = j.buffered.Write(encoded)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.buffered.Flush()
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.opened {
+		j.opened = true
+		if _, err := j.buffered.WriteString(`{"data":[`); err != nil {
+			return err
+		}
+	}
+	if _, err := j.buffered.WriteString(`],"meta":{}}`); err != nil {
+		return err
+	}
+	return j.Flush()
+}
+
+// READING
+
+// Row is a valid Item read from line Line of an import file
+type Row struct {
+	Line int
+	Item models.ItemIn
+}
+
+// ReadItems reads every row of an import file. Invalid rows and repeated
+// names are reported by line and left out; the error is only set when the
+// file itself cannot be read, e.g. a body over the size limit or a CSV
+// without name and price columns.
+func ReadItems(r io.Reader, format Format) ([]Row, []models.ImportRowError, error) {
+	reader := &rowReader{rowErrors: []models.ImportRowError{}, seen: map[string]int{}}
+	var err error
+	if format == FormatNDJSON {
+		err = reader.readNDJSON(r)
+	} else {
+		err = reader.readCSV(r)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader.rows, reader.rowErrors, nil
+}
+
+type rowReader struct {
+	rows      []Row
+	rowErrors []models.ImportRowError
+	// seen maps names to the line they were first read on
+	seen map[string]int
+}
+
+func (r *rowReader) add(line int, item models.ItemIn) {
+	if err := validate(item); err != nil {
+		r.fail(line, err.Error())
+		return
+	}
+	if first, ok := r.seen[item.Name]; ok {
+		r.fail(line, "duplicate name, first seen on line "+strconv.Itoa(first))
+		return
+	}
+	r.seen[item.Name] = line
+	r.rows = append(r.rows, Row{Line: line, Item: item})
+}
+
+func (r *rowReader) fail(line int, errMsg string) {
+	r.rowErrors = append(r.rowErrors, models.ImportRowError{Line: line, Error: errMsg})
+}
+
+func (r *rowReader) readCSV(in io.Reader) error {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrorInvalidHeader
+		}
+		return err
+	}
+	nameColumn, priceColumn := -1, -1
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "name":
+			nameColumn = i
+		case "price":
+			priceColumn = i
+		}
+	}
+	if nameColumn < 0 || priceColumn < 0 {
+		return ErrorInvalidHeader
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.fail(parseErr.StartLine, parseErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) <= nameColumn || len(record) <= priceColumn {
+			r.fail(line, "missing name or price")
+			continue
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(record[priceColumn]), 32)
+		if err != nil {
+			r.fail(line, "invalid price")
+			continue
+		}
+		r.add(line, models.ItemIn{Name: strings.TrimSpace(record[nameColumn]), Price: float32(price)})
+	}
+}
+
+func (r *rowReader) readNDJSON(in io.Reader) error {
+	reader := bufio.NewReader(in)
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			var item models.ItemIn
+			if jsonErr := json.Unmarshal(raw, &item); jsonErr != nil {
+				r.fail(line, "invalid JSON")
+			} else {
+				r.add(line, item)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func validate(item models.ItemIn) error {
+	switch {
+	case item.Name == "":
+		return errors.New("name is required")
+	case utf8.RuneCountInString(item.Name) > maxNameLength:
+		return errors.New("name is longer than " + strconv.Itoa(maxNameLength) + " characters")
+	case item.Price < 0:
+		return errors.New("price must not be negative")
+	case item.Price > maxPrice:
+		return errors.New("price is too large")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrorInvalidBackend = errors.New("invalid cache backend, expected memory, redis or none")
+
+// Cache backends
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+	BackendNone   = "none"
+)
+
+const (
+	DefaultTTL        = time.Minute
+	DefaultMaxEntries = 10000
+)
+
+// Cache stores encoded values under string keys for a TTL. A value that is
+// missing or expired is reported with ok false rather than an error.
+type Cache interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
+
+type Config struct {
+	Backend    string
+	TTL        time.Duration
+	MaxEntries int
+	RedisURL   string
+}
+
+// ConfigFromEnv reads CACHE_BACKEND (default memory), CACHE_TTL (default 1m),
+// CACHE_MAX_ENTRIES (default 10000, memory only) and REDIS_URL
+func ConfigFromEnv() Config {
+	config := Config{
+		Backend:    strings.ToLower(strings.TrimSpace(os.Getenv("CACHE_BACKEND"))),
+		TTL:        DefaultTTL,
+		MaxEntries: DefaultMaxEntries,
+		RedisURL:   os.Getenv("REDIS_URL"),
+	}
+	if config.Backend == "" {
+		config.Backend = BackendMemory
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_TTL")); err == nil && ttl > 0 {
+		config.TTL = ttl
+	}
+	if maxEntries, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil && maxEntries > 0 {
+		config.MaxEntries = maxEntries
+	}
+	return config
+}
+
+// New returns the Cache config asks for, or nil for BackendNone
+func New(config Config) (Cache, error) {
+	switch config.Backend {
+	case BackendMemory:
+		return NewMemoryCache(config.MaxEntries, config.TTL), nil
+	case BackendRedis:
+		options, err := redis.ParseURL(config.RedisURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid REDIS_URL")
+		}
+		return NewRedisCache(redis.NewClient(options), config.TTL), nil
+	case BackendNone:
+		return nil, nil
+	}
+	return nil, errors.Wrapf(ErrorInvalidBackend, "%q", config.Backend)
+}
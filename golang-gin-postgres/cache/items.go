@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+	"example-server/tenant"
+)
+
+// Cache lookup result labels
+const (
+	ResultHit   = "hit"
+	ResultMiss  = "miss"
+	ResultError = "error"
+)
+
+type Metrics struct {
+	requests *prometheus.CounterVec
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_requests_total",
+				Help: "Number of cache lookups by cache and result.",
+			},
+			[]string{"cache", "result"},
+		),
+	}
+	reg.MustRegister(m.requests)
+	return m
+}
+
+func (m *Metrics) record(name, result string) {
+	if m != nil {
+		m.requests.WithLabelValues(name, result).Inc()
+	}
+}
+
+// ItemCache reads Items through a Cache, keyed by tenant and id. Concurrent
+// misses for the same Item share one load. Cache errors are logged and
+// counted, and fall back to the load.
+type ItemCache struct {
+	cache   Cache
+	metrics *Metrics
+	group   singleflight.Group
+	mu      sync.Mutex
+	fills   map[string]*fill
+}
+
+// fill is a load in flight, marked stale when its Item is invalidated before
+// the load stores what it read, which may predate the update
+type fill struct {
+	mu    sync.Mutex
+	stale bool
+}
+
+// NewItemCache returns nil when cache is nil, which disables caching
+func NewItemCache(cache Cache, metrics *Metrics) *ItemCache {
+	if cache == nil {
+		return nil
+	}
+	return &ItemCache{cache: cache, metrics: metrics, fills: map[string]*fill{}}
+}
+
+func itemKey(tenantID string, itemId int) string {
+	return "item:" + tenantID + ":" + strconv.Itoa(itemId)
+}
+
+// Fetch returns the cached Item or stores what load returns, unless the Item
+// was invalidated while loading. Errors from load, such as the Item not being
+// found, are not cached.
+func (c *ItemCache) Fetch(
+	ctx context.Context,
+	itemId int,
+	load func(ctx context.Context) (*models.Item, error),
+) (*models.Item, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return load(ctx)
+	}
+	key := itemKey(tenantID, itemId)
+	if item := c.get(ctx, key); item != nil {
+		return item, nil
+	}
+	// The shared load must not fail for everyone when its caller goes away
+	sharedCtx := context.WithoutCancel(ctx)
+	shared, err, _ := c.group.Do(key, func() (interface{}, error) {
+		f := c.startFill(key)
+		defer c.endFill(key, f)
+		item, err := load(sharedCtx)
+		if err != nil {
+			return nil, err
+		}
+		// Invalidate waits for the Item to be stored before marking the fill
+		// stale, and deletes it after
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.stale {
+			c.set(sharedCtx, key, item)
+		}
+		return item, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	item := *shared.(*models.Item)
+	return &item, nil
+}
+
+// Invalidate drops the tenant's cached Items, e.g. after updating them.
+// Loads in flight don't store what they read, and later Fetches load anew.
+// Loads in other replicas sharing the cache are only bounded by its TTL.
+func (c *ItemCache) Invalidate(ctx context.Context, itemIds ...int) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok || len(itemIds) == 0 {
+		return
+	}
+	keys := make([]string, len(itemIds))
+	for i, itemId := range itemIds {
+		keys[i] = itemKey(tenantID, itemId)
+		c.markStale(keys[i])
+	}
+	if err := c.cache.Delete(ctx, keys...); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Ints("itemIds", itemIds).Msg("Error invalidating cached Items")
+	}
+}
+
+func (c *ItemCache) startFill(key string) *fill {
+	f := &fill{}
+	c.mu.Lock()
+	c.fills[key] = f
+	c.mu.Unlock()
+	return f
+}
+
+func (c *ItemCache) endFill(key string, f *fill) {
+	c.mu.Lock()
+	if c.fills[key] == f {
+		delete(c.fills, key)
+	}
+	c.mu.Unlock()
+}
+
+func (c *ItemCache) markStale(key string) {
+	c.mu.Lock()
+	f := c.fills[key]
+	c.mu.Unlock()
+	// Callers arriving from now on start a load of their own
+	c.group.Forget(key)
+	if f != nil {
+		f.mu.Lock()
+		f.stale = true
+		f.mu.Unlock()
+	}
+}
+
+func (c *ItemCache) Close() error {
+	return c.cache.Close()
+}
+
+func (c *ItemCache) get(ctx context.Context, key string) *models.Item {
+	value, ok, err := c.cache.Get(ctx, key)
+	if err == nil && ok {
+		var item models.Item
+		if err = json.Unmarshal(value, &item); err == nil {
+			c.metrics.record("item", ResultHit)
+			return &item
+		}
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("Error reading cached Item")
+		c.metrics.record("item", ResultError)
+		return nil
+	}
+	c.metrics.record("item", ResultMiss)
+	return nil
+}
+
+func (c *ItemCache) set(ctx context.Context, key string, item *models.Item) {
+	value, err := json.Marshal(item)
+	if err == nil {
+		err = c.cache.Set(ctx, key, value)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Str("key", key).Msg("Error caching Item")
+	}
+}
+
+// Pool decorates a PgxPoolIface with an ItemCache, which repos pick up via
+// ItemsFromPool, so routes keep passing the pool around as before
+type Pool struct {
+	database.PgxPoolIface
+	items *ItemCache
+}
+
+func NewPool(pool database.PgxPoolIface, items *ItemCache) *Pool {
+	return &Pool{PgxPoolIface: pool, items: items}
+}
+
+func (p *Pool) Unwrap() database.PgxPoolIface {
+	return p.PgxPoolIface
+}
+
+// ItemsFromPool returns the ItemCache of a Pool, or nil for other pools
+func ItemsFromPool(pool database.PgxPoolIface) *ItemCache {
+	if p, ok := pool.(*Pool); ok {
+		return p.items
+	}
+	return nil
+}
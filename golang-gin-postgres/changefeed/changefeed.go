@@ -0,0 +1,300 @@
+package changefeed
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrorSlowSubscriber  = errors.New("subscriber fell behind on item changes")
+	ErrorListenerStopped = errors.New("item change listener stopped")
+)
+
+// Channel is the notification channel of the item_change_notify trigger
+const Channel = "item_changes"
+
+// BufferSize is how many events a subscriber may fall behind by before it is
+// dropped
+const BufferSize = 64
+
+// ReplaySize is how many recent events are kept for SubscribeAfter
+const ReplaySize = 1024
+
+// Reconnect delays double from minBackoff up to maxBackoff
+const (
+	minBackoff = 250 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Op is the kind of change made to an Item
+type Op string
+
+const (
+	OpCreated Op = "created"
+	OpUpdated Op = "updated"
+	OpDeleted Op = "deleted"
+)
+
+// Event is an Item change as published by the item_change_notify trigger
+type Event struct {
+	// Seq numbers events in the order this process received them, from 1
+	Seq      uint64 `json:"-"`
+	Op       Op     `json:"op"`
+	ID       int    `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+// Conn is the part of *pgx.Conn the Listener uses
+type Conn interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+type ConnectFunc func(ctx context.Context) (Conn, error)
+
+// Connect dials databaseURL outside the pool, as LISTEN holds on to its
+// connection for as long as it runs
+func Connect(databaseURL string) ConnectFunc {
+	return func(ctx context.Context) (Conn, error) {
+		return pgx.Connect(ctx, databaseURL)
+	}
+}
+
+// Listener LISTENs for Item changes on a dedicated connection and fans them
+// out to in-process subscribers. Changes made while it is reconnecting are
+// lost, the last ReplaySize events received are kept for SubscribeAfter,
+// which tells resuming subscribers about the gap.
+type Listener struct {
+	connect     ConnectFunc
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	stopped     bool
+	// epoch tells this process' Seq apart from other processes' and restarts
+	epoch  string
+	seq    uint64
+	replay []Event
+	// gapSeq is the Seq of the first event after the connection was last
+	// lost, earlier events may be followed by changes that were never received
+	gapSeq uint64
+}
+
+func NewListener(connect ConnectFunc) *Listener {
+	return &Listener{connect: connect, subscribers: map[*Subscription]struct{}{}, epoch: newEpoch()}
+}
+
+func newEpoch() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// EventID is the id of event to hand out to subscribers, its Seq prefixed
+// with the epoch of this Listener
+func (l *Listener) EventID(event Event) string {
+	return l.epoch + "-" + strconv.FormatUint(event.Seq, 10)
+}
+
+// ParseEventID returns the Seq of an id made by EventID. ok is false when id
+// is malformed or was made by another Listener, e.g. on another replica or
+// before a restart, as its Seq then means nothing here.
+func (l *Listener) ParseEventID(id string) (seq uint64, ok bool) {
+	epoch, seqStr, found := strings.Cut(id, "-")
+	if !found || epoch != l.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	return seq, err == nil
+}
+
+// Run listens until ctx is done, reconnecting with exponential backoff, then
+// closes all subscriptions with ErrorListenerStopped
+func (l *Listener) Run(ctx context.Context) {
+	defer l.stop()
+	backoff := minBackoff
+	for {
+		err := l.listen(ctx, func() { backoff = minBackoff })
+		if ctx.Err() != nil {
+			return
+		}
+		l.markGap()
+		log.Warn().Err(err).Dur("backoff", backoff).Msg("Item change listener disconnected, reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context, connected func()) error {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	connected()
+	log.Info().Str("channel", Channel).Msg("Listening for item changes")
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Warn().Err(err).Str("payload", notification.Payload).Msg("Invalid item change notification")
+			continue
+		}
+		l.Publish(event)
+	}
+}
+
+// markGap records that changes after the events so far may have been missed
+func (l *Listener) markGap() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.gapSeq = l.seq + 1
+}
+
+// Publish numbers event and sends it to the subscribers of its tenant.
+// Subscribers whose buffer is full are closed with ErrorSlowSubscriber rather
+// than blocking everyone else.
+func (l *Listener) Publish(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	event.Seq = l.seq
+	if len(l.replay) == ReplaySize {
+		l.replay = l.replay[1:]
+	}
+	l.replay = append(l.replay, event)
+	for s := range l.subscribers {
+		if s.tenantID != "" && s.tenantID != event.TenantID {
+			continue
+		}
+		select {
+		case s.events <- event:
+		default:
+			log.Warn().Str("tenant_id", s.tenantID).Msg("Dropping slow item change subscriber")
+			l.unsubscribe(s, ErrorSlowSubscriber)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the changes of tenantID, or of every
+// tenant when it is empty. It must be closed once done.
+func (l *Listener) Subscribe(tenantID string) *Subscription {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.subscribe(tenantID, nil)
+}
+
+// SubscribeAfter is Subscribe, starting with the buffered events after seq.
+// complete is false when some of those are no longer buffered, seq was not
+// handed out by this Listener, or the connection was lost since, so the
+// subscriber may have missed changes.
+func (l *Listener) SubscribeAfter(tenantID string, seq uint64) (s *Subscription, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	oldest := l.seq + 1 - uint64(len(l.replay))
+	complete = seq <= l.seq && seq+1 >= oldest && seq >= l.gapSeq
+	var replayed []Event
+	for _, event := range l.replay {
+		if event.Seq > seq && (tenantID == "" || tenantID == event.TenantID) {
+			replayed = append(replayed, event)
+		}
+	}
+	return l.subscribe(tenantID, replayed), complete
+}
+
+// subscribe must be called with l.mu held
+func (l *Listener) subscribe(tenantID string, replayed []Event) *Subscription {
+	s := &Subscription{listener: l, tenantID: tenantID, events: make(chan Event, BufferSize+len(replayed))}
+	if l.stopped {
+		s.err = ErrorListenerStopped
+		close(s.events)
+		return s
+	}
+	for _, event := range replayed {
+		s.events <- event
+	}
+	l.subscribers[s] = struct{}{}
+	return s
+}
+
+func (l *Listener) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	for s := range l.subscribers {
+		l.unsubscribe(s, ErrorListenerStopped)
+	}
+}
+
+// unsubscribe must be called with l.mu held
+func (l *Listener) unsubscribe(s *Subscription, err error) {
+	if _, ok := l.subscribers[s]; !ok {
+		return
+	}
+	delete(l.subscribers, s)
+	s.err = err
+	close(s.events)
+}
+
+// Subscription receives Item change events until it is closed
+type Subscription struct {
+	listener *Listener
+	tenantID string
+	events   chan Event
+	// err is set under listener.mu before events is closed
+	err error
+}
+
+// Events is closed when the subscription ends, see Err
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Err tells why Events was closed: ErrorSlowSubscriber,
+// ErrorListenerStopped, or nil after Close
+func (s *Subscription) Err() error {
+	s.listener.mu.Lock()
+	defer s.listener.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.listener.mu.Lock()
+	defer s.listener.mu.Unlock()
+	s.listener.unsubscribe(s, nil)
+}
+
+// DefaultHeartbeat is how often idle event streams send a keep-alive
+const DefaultHeartbeat = 15 * time.Second
+
+// HeartbeatFromEnv reads EVENTS_HEARTBEAT_INTERVAL (default 15s)
+func HeartbeatFromEnv() time.Duration {
+	heartbeat, err := time.ParseDuration(os.Getenv("EVENTS_HEARTBEAT_INTERVAL"))
+	if err != nil || heartbeat <= 0 {
+		return DefaultHeartbeat
+	}
+	return heartbeat
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 )
 
 type PgxPoolIface interface {
@@ -22,7 +23,14 @@ type PgxPoolIface interface {
 func SetupDB() (PgxPoolIface, error) {
 	var dbpool *pgxpool.Pool
 	var err error
-	dbpool, err = pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	config, err := pgxpool.ParseConfig(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse database config")
+		os.Exit(1)
+	}
+	// Trace queries with the global tracer provider
+	config.ConnConfig.Tracer = NewQueryTracer(otel.GetTracerProvider())
+	dbpool, err = pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 		os.Exit(1)
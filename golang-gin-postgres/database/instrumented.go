@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// InstrumentedPool decorates a PgxPoolIface and records query duration and
+// error metrics labelled by the logical query name found in the context.
+type InstrumentedPool struct {
+	pool    PgxPoolIface
+	metrics *QueryMetrics
+}
+
+func NewInstrumentedPool(pool PgxPoolIface, metrics *QueryMetrics) *InstrumentedPool {
+	return &InstrumentedPool{
+		pool:    pool,
+		metrics: metrics,
+	}
+}
+
+func (p *InstrumentedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, metrics: p.metrics}, nil
+}
+
+func (p *InstrumentedPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := p.pool.Exec(ctx, sql, args...)
+	p.metrics.observeQuery(ctx, start, err)
+	return tag, err
+}
+
+func (p *InstrumentedPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	start := time.Now()
+	row := p.pool.QueryRow(ctx, sql, args...)
+	return &instrumentedRow{row: row, done: func(err error) {
+		p.metrics.observeQuery(ctx, start, err)
+	}}
+}
+
+func (p *InstrumentedPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	start := time.Now()
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		p.metrics.observeQuery(ctx, start, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, done: func(err error) {
+		p.metrics.observeQuery(ctx, start, err)
+	}}, nil
+}
+
+func (p *InstrumentedPool) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+func (p *InstrumentedPool) Close() {
+	p.pool.Close()
+}
+
+// instrumentedTx records metrics for queries run inside a transaction
+type instrumentedTx struct {
+	pgx.Tx
+	metrics *QueryMetrics
+}
+
+func (tx *instrumentedTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	start := time.Now()
+	tag, err := tx.Tx.Exec(ctx, sql, args...)
+	tx.metrics.observeQuery(ctx, start, err)
+	return tag, err
+}
+
+func (tx *instrumentedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	start := time.Now()
+	row := tx.Tx.QueryRow(ctx, sql, args...)
+	return &instrumentedRow{row: row, done: func(err error) {
+		tx.metrics.observeQuery(ctx, start, err)
+	}}
+}
+
+func (tx *instrumentedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	start := time.Now()
+	rows, err := tx.Tx.Query(ctx, sql, args...)
+	if err != nil {
+		tx.metrics.observeQuery(ctx, start, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, done: func(err error) {
+		tx.metrics.observeQuery(ctx, start, err)
+	}}, nil
+}
+
+// instrumentedRow defers recording until Scan, where pgx surfaces the query error
+type instrumentedRow struct {
+	row  pgx.Row
+	done func(error)
+}
+
+func (r *instrumentedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	r.done(err)
+	return err
+}
+
+// instrumentedRows records once the result set is closed
+type instrumentedRows struct {
+	pgx.Rows
+	done func(error)
+	once sync.Once
+}
+
+func (r *instrumentedRows) Close() {
+	r.Rows.Close()
+	r.once.Do(func() {
+		r.done(r.Rows.Err())
+	})
+}
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Advisory lock keys, one per job that must only run in one replica at a time
+const (
+	// LockOutboxRelay keeps outbox events in order by having a single relay
+	LockOutboxRelay int64 = 0x6f7574626f78
+)
+
+// TryAdvisoryXactLock takes the advisory lock key until tx ends, reporting
+// false without waiting when another transaction holds it
+func TryAdvisoryXactLock(ctx context.Context, tx pgx.Tx, key int64) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(
+		WithQueryName(ctx, "advisory_lock.try"),
+		"SELECT pg_try_advisory_xact_lock($1)",
+		key,
+	).Scan(&locked)
+	return locked, err
+}
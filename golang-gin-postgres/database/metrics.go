@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Query outcome labels
+const (
+	OutcomeOK       = "ok"
+	OutcomeNotFound = "not_found"
+	OutcomeConflict = "conflict"
+	OutcomeError    = "error"
+)
+
+const unnamedQuery = "unnamed"
+
+type queryNameKey struct{}
+
+// WithQueryName attaches a logical query name (e.g. "item.fetch_by_id") to the
+// context so the instrumented pool can label its metrics.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+func queryNameFromContext(ctx context.Context) string {
+	if name, ok := ctx.Value(queryNameKey{}).(string); ok && name != "" {
+		return name
+	}
+	return unnamedQuery
+}
+
+type QueryMetrics struct {
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+	domainEvents  *prometheus.CounterVec
+}
+
+func NewQueryMetrics(reg prometheus.Registerer) *QueryMetrics {
+	m := &QueryMetrics{
+		queryDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "db_query_duration_seconds",
+				Help:    "Duration of database queries by logical query name and outcome.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"query", "outcome"},
+		),
+		queryErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "db_query_errors_total",
+				Help: "Number of database queries that did not succeed, by logical query name and outcome.",
+			},
+			[]string{"query", "outcome"},
+		),
+		domainEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "domain_events_total",
+				Help: "Number of business events, such as Items created, by entity and event.",
+			},
+			[]string{"entity", "event"},
+		),
+	}
+	reg.MustRegister(m.queryDuration, m.queryErrors, m.domainEvents)
+	return m
+}
+
+func (m *QueryMetrics) observeQuery(ctx context.Context, start time.Time, err error) {
+	name := queryNameFromContext(ctx)
+	outcome := queryOutcome(err)
+	m.queryDuration.WithLabelValues(name, outcome).Observe(time.Since(start).Seconds())
+	if outcome != OutcomeOK {
+		m.queryErrors.WithLabelValues(name, outcome).Inc()
+	}
+}
+
+func queryOutcome(err error) string {
+	if err == nil {
+		return OutcomeOK
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OutcomeNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return OutcomeConflict
+	}
+	return OutcomeError
+}
+
+// RecordDomainEvent counts a business event (e.g. "item", "created") when the
+// pool is instrumented, and is a no-op otherwise. Decorators that wrap the
+// instrumented pool are looked through with Unwrap.
+func RecordDomainEvent(pool PgxPoolIface, entity, event string) {
+	for {
+		switch p := pool.(type) {
+		case *InstrumentedPool:
+			p.metrics.domainEvents.WithLabelValues(entity, event).Inc()
+			return
+		case interface{ Unwrap() PgxPoolIface }:
+			pool = p.Unwrap()
+		default:
+			return
+		}
+	}
+}
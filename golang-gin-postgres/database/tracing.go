@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "example-server/database"
+
+// QueryTracer implements pgx.QueryTracer and starts a client span per query,
+// named after the logical query name when one is set on the context.
+type QueryTracer struct {
+	tracer trace.Tracer
+}
+
+func NewQueryTracer(tp trace.TracerProvider) *QueryTracer {
+	return &QueryTracer{
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	spanName := queryNameFromContext(ctx)
+	if spanName == unnamedQuery {
+		spanName = "postgres.query"
+	}
+	ctx, _ = t.tracer.Start(
+		ctx,
+		spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+var _ pgx.QueryTracer = (*QueryTracer)(nil)
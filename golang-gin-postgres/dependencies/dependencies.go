@@ -3,24 +3,47 @@ package dependencies
 import (
 	"github.com/go-playground/validator/v10"
 
+	"example-server/auth"
+	"example-server/cache"
+	"example-server/changefeed"
 	"example-server/database"
 )
 
 type Dependencies struct {
 	Validator *validator.Validate
 	DBPool    database.PgxPoolIface
+	APIKeys   *auth.APIKeyAuthenticator
+	// Items is nil when caching is disabled
+	Items *cache.ItemCache
+	// Changes is set once the Item change listener is started
+	Changes *changefeed.Listener
 }
 
 func NewDependencies(
 	validator *validator.Validate,
 	pgxPool database.PgxPoolIface,
+	queryMetrics *database.QueryMetrics,
+	itemCache *cache.ItemCache,
 ) *Dependencies {
+	// Instrument DB queries if metrics are enabled
+	if queryMetrics != nil {
+		pgxPool = database.NewInstrumentedPool(pgxPool, queryMetrics)
+	}
+	// Read Items through the cache if enabled
+	if itemCache != nil {
+		pgxPool = cache.NewPool(pgxPool, itemCache)
+	}
 	return &Dependencies{
 		Validator: validator,
 		DBPool:    pgxPool,
+		APIKeys:   auth.NewAPIKeyAuthenticator(pgxPool, auth.APIKeyCacheTTLFromEnv()),
+		Items:     itemCache,
 	}
 }
 
 func (deps *Dependencies) CleanupDependencies() {
 	deps.DBPool.Close()
+	if deps.Items != nil {
+		deps.Items.Close()
+	}
 }
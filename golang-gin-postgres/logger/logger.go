@@ -1,38 +1,155 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats accepted by LOG_FORMAT
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
 )
 
 func SetupGlobalLogger() {
-	l := getLoggingLevel()
-	w := getWriter()
+	l, levelErr := getLoggingLevel()
 	zerolog.SetGlobalLevel(l)
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
-	log.Logger = log.Output(w)
-	log.Info().Msg("Logger setup complete")
+	zerolog.InterfaceMarshalFunc = MarshalRedacted
+	log.Logger = NewLogger(os.Stderr)
+	if levelErr != nil {
+		log.Warn().Err(levelErr).Msg("Ignoring LOG_LEVEL")
+	}
+	log.Info().Str("level", l.String()).Msg("Logger setup complete")
+}
+
+// NewLogger builds a logger writing redacted lines to out in the LOG_FORMAT
+// format, sampling info lines when LOG_SAMPLE_INFO_BURST is set
+func NewLogger(out io.Writer) zerolog.Logger {
+	l := zerolog.New(NewRedactWriter(getWriter(out))).With().Timestamp().Logger().Hook(TraceHook{})
+	if sampler := getSampler(); sampler != nil {
+		l = l.Sample(sampler)
+	}
+	return l
 }
 
-func LogErrorWithStacktrace(err error, errMsg string) {
-	log.Error().Stack().Err(errors.Wrap(err, errMsg)).Msg(errMsg)
+// ParseLevel parses a level name such as "debug" or "warn"
+func ParseLevel(levelStr string) (zerolog.Level, error) {
+	level, err := zerolog.ParseLevel(levelStr)
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q", levelStr)
+	}
+	return level, nil
 }
 
-func getWriter() io.Writer {
-	if os.Getenv("IS_PROD") == "true" {
-		return os.Stderr
+// SetLevel changes the global log level at runtime and returns the previous one
+func SetLevel(level zerolog.Level) zerolog.Level {
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(level)
+	// Log without a level so the change is always visible
+	log.Log().
+		Str("level", level.String()).
+		Str("previous", previous.String()).
+		Msg("Log level changed")
+	return previous
+}
+
+func LogErrorWithStacktrace(ctx context.Context, err error, errMsg string) {
+	FromContext(ctx).Error().Stack().Err(errors.Wrap(err, errMsg)).Msg(errMsg)
+}
+
+type requestIdKey struct{}
+
+// NewRequestContext stores the request ID on the context along with a
+// request-scoped logger that adds it to every line
+func NewRequestContext(ctx context.Context, requestId string) context.Context {
+	ctx = context.WithValue(ctx, requestIdKey{}, requestId)
+	l := log.Logger.With().Str("request_id", requestId).Logger()
+	return l.WithContext(ctx)
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// FromContext returns the request-scoped logger, falling back to the global
+// logger, bound to ctx so TraceHook can add the active span
+func FromContext(ctx context.Context) *zerolog.Logger {
+	l := zerolog.Ctx(ctx)
+	if l.GetLevel() == zerolog.Disabled {
+		l = &log.Logger
+	}
+	ctxLogger := l.With().Ctx(ctx).Logger()
+	return &ctxLogger
+}
+
+// TraceHook adds trace_id and span_id to events logged with a context that
+// carries a recording span, e.g. log.Info().Ctx(ctx).Msg("...")
+type TraceHook struct{}
+
+func (h TraceHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	spanCtx := trace.SpanContextFromContext(e.GetCtx())
+	if !spanCtx.IsValid() {
+		return
+	}
+	e.Str("trace_id", spanCtx.TraceID().String()).
+		Str("span_id", spanCtx.SpanID().String())
+}
+
+func getWriter(out io.Writer) io.Writer {
+	format := os.Getenv("LOG_FORMAT")
+	if format == "" && os.Getenv("IS_PROD") == "true" {
+		format = FormatJSON
 	}
-	return zerolog.ConsoleWriter{Out: os.Stderr}
+	if format == FormatJSON {
+		return out
+	}
+	return zerolog.ConsoleWriter{Out: out}
 }
 
-func getLoggingLevel() zerolog.Level {
+func getLoggingLevel() (zerolog.Level, error) {
+	defaultLevel := zerolog.TraceLevel
 	if os.Getenv("IS_PROD") == "true" {
-		return zerolog.InfoLevel
+		defaultLevel = zerolog.InfoLevel
+	}
+	levelStr := os.Getenv("LOG_LEVEL")
+	if levelStr == "" {
+		return defaultLevel, nil
+	}
+	level, err := ParseLevel(levelStr)
+	if err != nil {
+		return defaultLevel, err
+	}
+	return level, nil
+}
+
+// getSampler keeps the first LOG_SAMPLE_INFO_BURST info lines each second and
+// then 1 in LOG_SAMPLE_INFO_EVERY (none if unset)
+func getSampler() zerolog.Sampler {
+	burst, _ := strconv.Atoi(os.Getenv("LOG_SAMPLE_INFO_BURST"))
+	if burst <= 0 {
+		return nil
+	}
+	var next zerolog.Sampler
+	if every, _ := strconv.Atoi(os.Getenv("LOG_SAMPLE_INFO_EVERY")); every > 0 {
+		next = &zerolog.BasicSampler{N: uint32(every)}
+	}
+	return zerolog.LevelSampler{
+		InfoSampler: &zerolog.BurstSampler{
+			Burst:       uint32(burst),
+			Period:      time.Second,
+			NextSampler: next,
+		},
 	}
-	return zerolog.TraceLevel
 }
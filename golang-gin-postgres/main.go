@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"net/http"
 	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"example-server/auth"
+	"example-server/cache"
+	"example-server/changefeed"
 	"example-server/database"
 	"example-server/dependencies"
 	_ "example-server/docs"
 	"example-server/logger"
+	"example-server/middleware"
+	"example-server/outbox"
+	"example-server/ratelimit"
 	"example-server/routes"
+	"example-server/tlsconfig"
+	"example-server/tracing"
+	"example-server/webhook"
 )
 
 func init() {
@@ -30,16 +43,85 @@ func init() {
 // @host localhost:8000
 // @BasePath /
 // @schemes http
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description Admin token as "Bearer <token>".
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT as "Bearer <token>".
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key created through the admin API.
 func main() {
+	// Setup tracing
+	shutdownTracing, err := tracing.SetupTracing(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+	defer shutdownTracing(context.Background())
 	// Setup dependencies
 	dbPool, _ := database.SetupDB()
+	itemCache, err := cache.New(cache.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup cache")
+	}
 	deps := dependencies.NewDependencies(
 		validator.New(),
 		dbPool,
+		database.NewQueryMetrics(prometheus.DefaultRegisterer),
+		cache.NewItemCache(itemCache, cache.NewMetrics(prometheus.DefaultRegisterer)),
 	)
 	defer deps.CleanupDependencies()
+	// Listen for Item changes on a connection of its own
+	deps.Changes = changefeed.NewListener(changefeed.Connect(os.Getenv("DATABASE_URL")))
+	go deps.Changes.Run(context.Background())
+	// Send webhooks written along with Item changes
+	go webhook.NewDispatcher(deps.DBPool, webhook.ConfigFromEnv()).Run(context.Background())
+	// Publish Item events written to the outbox along with Item changes
+	outboxConfig := outbox.ConfigFromEnv()
+	publisher, err := outbox.NewPublisher(outboxConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup outbox publisher")
+	}
+	defer publisher.Close()
+	go outbox.NewRelay(deps.DBPool, publisher, outboxConfig, outbox.NewMetrics(prometheus.DefaultRegisterer)).Run(context.Background())
+	// Setup JWT verification
+	verifier, err := auth.NewVerifier(context.Background(), auth.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup authentication")
+	}
+	// Setup authorization policy
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load authorization policy")
+	}
+	// Setup rate limiting
+	rateLimits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load rate limits")
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), rateLimits)
 	// Setup Gin router
-	r := gin.Default()
+	maxBodyBytes, importMaxBodyBytes := middleware.MaxBodyBytesFromEnv(), middleware.ImportMaxBodyBytesFromEnv()
+	r := gin.New()
+	// Only believe X-Forwarded-For from TRUSTED_PROXIES
+	if err := r.SetTrustedProxies(ratelimit.TrustedProxiesFromEnv()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to set trusted proxies")
+	}
+	r.Use(
+		gin.Recovery(),
+		otelgin.Middleware(tracing.ServiceName()),
+		middleware.RequestID(),
+		middleware.AccessLog(),
+		middleware.SecurityHeaders(middleware.HSTSMaxAgeFromEnv()),
+		middleware.CORS(middleware.CORSConfigFromEnv()),
+		middleware.ForImports(middleware.MaxBodySize(importMaxBodyBytes), middleware.MaxBodySize(maxBodyBytes)),
+		middleware.ForImports(middleware.Decompress(importMaxBodyBytes), middleware.Decompress(maxBodyBytes)),
+		middleware.Compress(middleware.CompressionConfigFromEnv()),
+	)
 	// Status
 	r.GET("/status", routes.HandleStatus)
 	// Prometheus metrics
@@ -47,10 +129,33 @@ func main() {
 	// Swagger docs
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	// Setup API routes
-	routes.SetupItemsAPIRoutes(r, deps)
-	// Run server
-	log.Info().Msg("Starting server")
-	err := r.Run(":8000")
+	apiMiddlewares := []gin.HandlerFunc{
+		middleware.ClientIPRateLimit(limiter),
+		middleware.Authenticate(verifier, deps.APIKeys),
+		middleware.RateLimit(limiter),
+		middleware.Authorize(policy),
+		middleware.Tenant(),
+	}
+	routes.SetupItemsAPIRoutes(r, deps, apiMiddlewares...)
+	routes.SetupWebSocketRoutes(r, deps, apiMiddlewares...)
+	routes.SetupWebhooksAPIRoutes(r, deps, apiMiddlewares...)
+	// Setup admin routes, enabled when ADMIN_TOKEN is set
+	routes.SetupAdminRoutes(r, deps, os.Getenv("ADMIN_TOKEN"))
+	// Run server, with TLS when TLS_CERT_FILE and TLS_KEY_FILE are set
+	server := &http.Server{Addr: ":8000", Handler: r}
+	if tlsConfig := tlsconfig.ConfigFromEnv(); tlsConfig.Enabled() {
+		reloader, err := tlsconfig.NewReloader(tlsConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load TLS certificates")
+		}
+		go reloader.Watch(context.Background())
+		server.TLSConfig = reloader.TLSConfig()
+		log.Info().Bool("mtls", tlsConfig.ClientCAFile != "").Msg("Starting server with TLS")
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Info().Msg("Starting server")
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start server")
 	}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+
+	"example-server/logger"
+)
+
+// AccessLog writes one structured line per request once it has been served.
+func AccessLog() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		start := time.Now()
+		g.Next()
+		status := g.Writer.Status()
+		l := logger.FromContext(g.Request.Context())
+		var e *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			e = l.Error()
+		case status >= http.StatusBadRequest:
+			e = l.Warn()
+		default:
+			e = l.Info()
+		}
+		e.Str("method", g.Request.Method).
+			Str("route", g.FullPath()).
+			Str("path", g.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", g.Writer.Size()).
+			Str("client_ip", g.ClientIP()).
+			Msg("Request served")
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/logger"
+)
+
+// AdminAuth requires the configured admin token as a bearer token
+func AdminAuth(adminToken string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		token, ok := strings.CutPrefix(g.GetHeader("Authorization"), "Bearer ")
+		if !ok || adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			logger.FromContext(g.Request.Context()).Warn().
+				Str("path", g.Request.URL.Path).
+				Msg("Unauthorized admin request")
+			g.Header("WWW-Authenticate", "Bearer")
+			abortWithError(g, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		g.Next()
+	}
+}
+
+// abortWithError stops the chain with an error body, including the request ID when set
+func abortWithError(g *gin.Context, code int, errMsg string) {
+	body := gin.H{"error": errMsg}
+	if requestId := logger.RequestIdFromContext(g.Request.Context()); requestId != "" {
+		body["request_id"] = requestId
+	}
+	g.AbortWithStatusJSON(code, body)
+}
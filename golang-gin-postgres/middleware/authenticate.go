@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/auth"
+	"example-server/logger"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Authenticate requires a valid X-API-Key, JWT bearer token or, without
+// either, a client certificate verified by mTLS and stores its principal on
+// the request context
+func Authenticate(verifier *auth.Verifier, apiKeys *auth.APIKeyAuthenticator) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		var principal *auth.Principal
+		var err error
+		if apiKey := g.GetHeader(APIKeyHeader); apiKey != "" && apiKeys != nil {
+			principal, err = apiKeys.Authenticate(ctx, apiKey)
+		} else if cert, ok := auth.ClientCertificate(g.Request.TLS); ok && g.GetHeader("Authorization") == "" {
+			principal = auth.PrincipalFromCertificate(cert)
+		} else {
+			var token string
+			if token, err = auth.BearerToken(g.GetHeader("Authorization")); err == nil {
+				principal, err = verifier.Verify(ctx, token)
+			}
+		}
+		if err != nil {
+			logger.FromContext(ctx).Warn().Err(err).
+				Str("path", g.Request.URL.Path).
+				Msg("Unauthenticated request")
+			g.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			abortWithError(g, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		g.Request = g.Request.WithContext(auth.NewContext(ctx, principal))
+		g.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/auth"
+	"example-server/logger"
+)
+
+// Authorize requires the authenticated principal to hold the scopes the
+// policy lists for the matched route, e.g. "GET /api/items/:id"
+func Authorize(policy *auth.Policy) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		principal, ok := auth.FromContext(ctx)
+		if !ok {
+			abortWithError(g, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		operation := g.Request.Method + " " + g.FullPath()
+		if err := policy.Authorize(principal, operation); err != nil {
+			logger.FromContext(ctx).Warn().Err(err).
+				Str("operation", operation).
+				Str("subject", principal.Subject).
+				Msg("Forbidden request")
+			abortWithProblem(g, http.StatusForbidden, err)
+			return
+		}
+		g.Next()
+	}
+}
+
+// abortWithProblem stops the chain with an RFC 7807 problem body that also
+// carries the usual error and request ID fields
+func abortWithProblem(g *gin.Context, code int, err error) {
+	body := gin.H{
+		"type":     "about:blank",
+		"title":    http.StatusText(code),
+		"status":   code,
+		"detail":   err.Error(),
+		"instance": g.Request.URL.Path,
+		"error":    http.StatusText(code),
+	}
+	var forbiddenErr *auth.ForbiddenError
+	if errors.As(err, &forbiddenErr) && len(forbiddenErr.MissingScopes) > 0 {
+		body["missing_scopes"] = forbiddenErr.MissingScopes
+	}
+	if requestId := logger.RequestIdFromContext(g.Request.Context()); requestId != "" {
+		body["request_id"] = requestId
+	}
+	g.Header("Content-Type", "application/problem+json")
+	g.AbortWithStatusJSON(code, body)
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+
+	"example-server/logger"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressionConfig lists the response encodings in order of preference and
+// the smallest body worth compressing
+type CompressionConfig struct {
+	Encodings []string
+	MinBytes  int
+}
+
+// CompressionConfigFromEnv reads COMPRESSION_ENCODINGS (default "zstd,gzip",
+// "none" disables compression) and COMPRESSION_MIN_BYTES (default 1024)
+func CompressionConfigFromEnv() CompressionConfig {
+	config := CompressionConfig{Encodings: []string{EncodingZstd, EncodingGzip}, MinBytes: 1024}
+	if encodings, ok := os.LookupEnv("COMPRESSION_ENCODINGS"); ok {
+		config.Encodings = nil
+		for _, encoding := range splitList(strings.ToLower(encodings)) {
+			if encoding == EncodingGzip || encoding == EncodingZstd {
+				config.Encodings = append(config.Encodings, encoding)
+			}
+		}
+	}
+	if minBytes, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_BYTES")); err == nil && minBytes >= 0 {
+		config.MinBytes = minBytes
+	}
+	return config
+}
+
+// Compress encodes responses with the preferred encoding the client accepts.
+// Bodies are buffered up to MinBytes, so small responses go out unencoded.
+func Compress(config CompressionConfig) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		if len(config.Encodings) == 0 || g.Request.Method == http.MethodHead {
+			g.Next()
+			return
+		}
+		g.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(g.GetHeader("Accept-Encoding"), config.Encodings)
+		if encoding == "" {
+			g.Next()
+			return
+		}
+		writer := &compressWriter{ResponseWriter: g.Writer, encoding: encoding, minBytes: config.MinBytes}
+		g.Writer = writer
+		defer func() {
+			writer.close(g)
+			g.Writer = writer.ResponseWriter
+		}()
+		g.Next()
+	}
+}
+
+// Decompress decodes gzip and zstd request bodies, limiting the decoded size
+// to maxBytes so a small compressed body cannot expand without bound. Other
+// encodings are rejected with 415.
+func Decompress(maxBytes int64) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		encoding := strings.ToLower(strings.TrimSpace(g.GetHeader("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || g.Request.Body == nil {
+			g.Next()
+			return
+		}
+		body, err := newDecoder(encoding, g.Request.Body)
+		if err != nil {
+			logger.FromContext(g.Request.Context()).Warn().
+				Str("content_encoding", encoding).
+				Msg("Unsupported request encoding")
+			g.Header("Accept-Encoding", "gzip, zstd")
+			abortWithError(g, http.StatusUnsupportedMediaType, "Unsupported content encoding")
+			return
+		}
+		g.Request.Header.Del("Content-Encoding")
+		g.Request.Header.Del("Content-Length")
+		g.Request.ContentLength = -1
+		g.Request.Body = http.MaxBytesReader(g.Writer, body, maxBytes)
+		g.Next()
+	}
+}
+
+// negotiateEncoding picks the highest weighted encoding from Accept-Encoding,
+// breaking ties by the order of supported
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				weight = parsed
+			}
+		}
+		weights[name] = weight
+	}
+	best, bestWeight := "", 0.0
+	for _, encoding := range supported {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+		if ok && weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		writer, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return writer
+	}}
+)
+
+func getEncoder(encoding string, w io.Writer) encoder {
+	if encoding == EncodingZstd {
+		writer := zstdWriters.Get().(*zstd.Encoder)
+		writer.Reset(w)
+		return writer
+	}
+	writer := gzipWriters.Get().(*gzip.Writer)
+	writer.Reset(w)
+	return writer
+}
+
+func putEncoder(e encoder) {
+	switch writer := e.(type) {
+	case *zstd.Encoder:
+		writer.Reset(nil)
+		zstdWriters.Put(writer)
+	case *gzip.Writer:
+		writer.Reset(nil)
+		gzipWriters.Put(writer)
+	}
+}
+
+func newDecoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		return &decodingBody{body: body, open: func() (io.Reader, func(), error) {
+			reader, err := gzip.NewReader(body)
+			return reader, func() {}, err
+		}}, nil
+	case EncodingZstd:
+		return &decodingBody{body: body, open: func() (io.Reader, func(), error) {
+			reader, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, nil, err
+			}
+			return reader, reader.Close, nil
+		}}, nil
+	}
+	return nil, http.ErrNotSupported
+}
+
+// decodingBody starts decoding on the first read, so a corrupt header shows
+// up as a read error in the handler rather than in the middleware
+type decodingBody struct {
+	body    io.ReadCloser
+	open    func() (io.Reader, func(), error)
+	reader  io.Reader
+	release func()
+	err     error
+}
+
+func (d *decodingBody) Read(p []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		d.reader, d.release, d.err = d.open()
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decodingBody) Close() error {
+	if d.release != nil {
+		d.release()
+	}
+	return d.body.Close()
+}
+
+// compressWriter holds back the first minBytes of the body, then either
+// encodes everything or, when the handler wrote less, sends it as is
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minBytes int
+	buffer   []byte
+	encoder  encoder
+	bypass   bool
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.bypass {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= w.minBytes {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what has been written so far, compressing it when possible,
+// so streamed responses are not held back by the threshold
+func (w *compressWriter) Flush() {
+	if !w.bypass && w.encoder == nil {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start decides on the encoding once the body is known to be large enough
+func (w *compressWriter) start() error {
+	buffer := w.buffer
+	w.buffer = nil
+	header := w.Header()
+	status := w.Status()
+	if header.Get("Content-Encoding") != "" || status < http.StatusOK ||
+		status == http.StatusNoContent || status == http.StatusNotModified {
+		w.bypass = true
+		_, err := w.ResponseWriter.Write(buffer)
+		return err
+	}
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.encoder = getEncoder(w.encoding, w.ResponseWriter)
+	_, err := w.encoder.Write(buffer)
+	return err
+}
+
+func (w *compressWriter) close(g *gin.Context) {
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			logger.FromContext(g.Request.Context()).Warn().Err(err).Msg("Failed to finish compressed response")
+		}
+		putEncoder(w.encoder)
+		w.encoder = nil
+		return
+	}
+	if len(w.buffer) > 0 {
+		w.bypass = true
+		_, _ = w.ResponseWriter.Write(w.buffer)
+		w.buffer = nil
+	}
+}
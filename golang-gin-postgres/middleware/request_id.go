@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"example-server/logger"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// Accept caller-provided IDs only if they are short and log-safe
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID accepts or generates an X-Request-ID, echoes it on the response
+// and attaches a request-scoped logger to the request context.
+func RequestID() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		requestId := g.GetHeader(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuid.NewString()
+		}
+		g.Header(RequestIdHeader, requestId)
+		ctx := logger.NewRequestContext(g.Request.Context(), requestId)
+		g.Request = g.Request.WithContext(ctx)
+		g.Next()
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/auth"
+	"example-server/logger"
+	"example-server/tenant"
+)
+
+// Tenant resolves the request tenant from the principal's tenant, or the
+// X-Tenant-ID header for cross-tenant principals, and stores it on the
+// request context
+func Tenant() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		var credentialTenant string
+		var crossTenant bool
+		if principal, ok := auth.FromContext(ctx); ok {
+			credentialTenant = principal.TenantID
+			crossTenant = principal.HasScope(auth.CrossTenantScope)
+		}
+		tenantID, err := tenant.Resolve(credentialTenant, g.GetHeader(tenant.Header), crossTenant)
+		if err != nil {
+			logger.FromContext(ctx).Warn().Err(err).
+				Str("path", g.Request.URL.Path).
+				Msg("Rejected tenant")
+			switch {
+			case errors.Is(err, tenant.ErrorTenantMismatch):
+				abortWithError(g, http.StatusForbidden, "Tenant does not match credentials")
+			case errors.Is(err, tenant.ErrorTenantRequired):
+				abortWithError(g, http.StatusForbidden, "Credentials are not bound to a tenant")
+			case errors.Is(err, tenant.ErrorInvalidTenant):
+				abortWithError(g, http.StatusBadRequest, "Invalid tenant")
+			default:
+				abortWithError(g, http.StatusBadRequest, "Missing tenant")
+			}
+			return
+		}
+		g.Request = g.Request.WithContext(tenant.NewContext(ctx, tenantID))
+		g.Next()
+	}
+}
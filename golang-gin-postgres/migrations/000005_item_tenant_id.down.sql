@@ -0,0 +1,6 @@
+DROP POLICY IF EXISTS item_tenant_isolation ON item;
+ALTER TABLE item NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE item DISABLE ROW LEVEL SECURITY;
+ALTER TABLE item DROP CONSTRAINT item_name_unique;
+ALTER TABLE item ADD CONSTRAINT item_name_unique UNIQUE (name);
+ALTER TABLE item DROP COLUMN tenant_id;
@@ -0,0 +1,24 @@
+-- Publish item changes on the item_changes channel as
+-- {"op": "created" | "updated" | "deleted", "id": ..., "tenant_id": ...};
+-- notifications are delivered on commit and dropped when no one listens
+CREATE FUNCTION notify_item_change() RETURNS trigger AS $$
+DECLARE
+    changed item;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+    PERFORM pg_notify('item_changes', json_build_object(
+        'op', CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+        'id', changed.id,
+        'tenant_id', changed.tenant_id
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER item_change_notify
+    AFTER INSERT OR UPDATE OR DELETE ON item
+    FOR EACH ROW EXECUTE FUNCTION notify_item_change();
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Resource Entity Models
 
@@ -17,6 +20,105 @@ type Item struct {
 	Price     float32   `json:"price" example:"3.14" format:"float64"`
 }
 
+type APIKeyIn struct {
+	Owner     string     `json:"owner" example:"billing-service" validate:"required,max=100"`
+	TenantID  string     `json:"tenant_id" example:"acme" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" example:"items:read"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2030-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id" example:"1" format:"int64"`
+	Prefix     string     `json:"prefix" example:"3f9a1c2b"`
+	KeyHash    []byte     `json:"-" log:"redact"`
+	Owner      string     `json:"owner" example:"billing-service"`
+	TenantID   string     `json:"tenant_id" example:"acme"`
+	Scopes     []string   `json:"scopes" example:"items:read"`
+	CreatedAt  time.Time  `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastUsedAt *time.Time `json:"last_used_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	ExpiresAt  *time.Time `json:"expires_at" example:"2030-01-01T00:00:00.000Z" format:"date-time"`
+	RevokedAt  *time.Time `json:"revoked_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+// Item events, named after the change, sent to webhooks and through the
+// outbox
+const (
+	WebhookEventItemCreated = "item.created"
+	WebhookEventItemUpdated = "item.updated"
+	WebhookEventItemDeleted = "item.deleted"
+)
+
+// Webhook delivery statuses: pending until delivered, or dead once out of
+// attempts
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+type WebhookSubscriptionIn struct {
+	URL string `json:"url" example:"https://example.com/hooks/items" validate:"required,http_url,max=2048"`
+	// Events to send, all when empty
+	Events []string `json:"events" example:"item.created" validate:"dive,oneof=item.created item.updated item.deleted"`
+	// Active defaults to true, inactive subscriptions get no deliveries
+	Active *bool `json:"active,omitempty" example:"true"`
+}
+
+type WebhookSubscription struct {
+	ID        int       `json:"id" example:"1" format:"int64"`
+	URL       string    `json:"url" example:"https://example.com/hooks/items"`
+	Secret    string    `json:"-" log:"redact"`
+	Events    []string  `json:"events" example:"item.created"`
+	Active    bool      `json:"active" example:"true"`
+	CreatedAt time.Time `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	UpdatedAt time.Time `json:"updated_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id" example:"1" format:"int64"`
+	SubscriptionID int             `json:"subscription_id" example:"1" format:"int64"`
+	Event          string          `json:"event" example:"item.created"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status" example:"pending" enums:"pending,delivered,dead"`
+	Attempts       int             `json:"attempts" example:"1"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastStatusCode *int            `json:"last_status_code" example:"500"`
+	LastError      *string         `json:"last_error" example:"unexpected status 500 Internal Server Error"`
+	CreatedAt      time.Time       `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	DeliveredAt    *time.Time      `json:"delivered_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+// WebhookPayload is the signed JSON body POSTed to subscribers
+type WebhookPayload struct {
+	Event      string    `json:"event" example:"item.created"`
+	TenantID   string    `json:"tenant_id" example:"acme"`
+	OccurredAt time.Time `json:"occurred_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	Data       *Item     `json:"data"`
+}
+
+// WebhookDispatch is a claimed delivery with what the dispatcher needs to
+// send it
+type WebhookDispatch struct {
+	ID       int64
+	Event    string
+	Payload  json.RawMessage
+	Attempts int
+	URL      string
+	Secret   string `log:"redact"`
+}
+
+// OutboxEvent is a domain event waiting in the outbox to be published
+type OutboxEvent struct {
+	ID            int64
+	TenantID      string
+	AggregateType string
+	AggregateID   int
+	EventType     string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+}
+
 // API Request/Response Models
 
 type StatusResponse struct {
@@ -45,3 +147,77 @@ type CreateItemResponse struct {
 	Data *Item                  `json:"data"`
 	Meta CreateItemResponseMeta `json:"meta"`
 }
+
+type ImportRowError struct {
+	Line  int    `json:"line" example:"3"`
+	Error string `json:"error" example:"invalid price"`
+}
+
+type ImportReport struct {
+	Inserted int              `json:"inserted" example:"10"`
+	Updated  int              `json:"updated" example:"2"`
+	Skipped  int              `json:"skipped" example:"1"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+type ImportItemsResponse struct {
+	Data ImportReport `json:"data"`
+	Meta struct{}     `json:"meta"`
+}
+
+type LogLevelRequest struct {
+	Level string `json:"level" example:"debug"`
+}
+
+type LogLevelResponse struct {
+	Level    string `json:"level" example:"debug"`
+	Previous string `json:"previous,omitempty" example:"info"`
+}
+
+type CreateAPIKeyRequest struct {
+	Data APIKeyIn `json:"data"`
+}
+
+type CreateAPIKeyResponse struct {
+	Data *APIKey `json:"data"`
+	// Key is only returned on creation
+	Key string `json:"key" example:"ek_3f9a1c2b_Zm9vYmFyYmF6..."`
+}
+
+type GetAPIKeysResponse struct {
+	Data []*APIKey `json:"data"`
+}
+
+type RevokeAPIKeyResponse struct {
+	Data *APIKey `json:"data"`
+}
+
+type CreateWebhookRequest struct {
+	Data WebhookSubscriptionIn `json:"data"`
+}
+
+type CreateWebhookResponse struct {
+	Data *WebhookSubscription `json:"data"`
+	// Secret signs deliveries and is only returned on creation
+	Secret string `json:"secret" example:"whsec_Zm9vYmFyYmF6..."`
+}
+
+type UpdateWebhookRequest struct {
+	Data WebhookSubscriptionIn `json:"data"`
+}
+
+type WebhookResponse struct {
+	Data *WebhookSubscription `json:"data"`
+}
+
+type GetWebhooksResponse struct {
+	Data []*WebhookSubscription `json:"data"`
+}
+
+type GetWebhookDeliveriesResponse struct {
+	Data []*WebhookDelivery `json:"data"`
+}
+
+type WebhookDeliveryResponse struct {
+	Data *WebhookDelivery `json:"data"`
+}
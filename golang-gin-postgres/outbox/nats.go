@@ -0,0 +1,196 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrorNATSServer         = errors.New("nats server error")
+	ErrorNATSConnectionLost = errors.New("nats connection lost")
+)
+
+// NATSPublisher publishes with the NATS client protocol over a single
+// connection, so Messages reach the server in the order they are published.
+// Flush is a PING: the server answers PONG once it has processed everything
+// sent before. A broken connection is dropped and dialed again on the next
+// Publish. TLS is not supported.
+type NATSPublisher struct {
+	mu      sync.Mutex
+	address string
+	user    *url.Userinfo
+	timeout time.Duration
+	conn    net.Conn
+	reader  *bufio.Reader
+	writer  *bufio.Writer
+	// unflushed is set by Publish until Flush, lost when the connection
+	// broke meanwhile
+	unflushed bool
+	lost      bool
+}
+
+// NewNATSPublisher parses a nats://[user:password@]host:port URL, connecting
+// lazily
+func NewNATSPublisher(natsURL string, timeout time.Duration) (*NATSPublisher, error) {
+	u, err := url.Parse(natsURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, errors.Errorf("invalid NATS_URL %q", natsURL)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATSPublisher{address: address, user: u.User, timeout: timeout}, nil
+}
+
+// Publish sends message with HPUB, its id and key as headers
+func (p *NATSPublisher) Publish(ctx context.Context, message Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(ctx); err != nil {
+		return err
+	}
+	p.setDeadline(ctx)
+	headers := "NATS/1.0\r\n" +
+		HeaderMessageID + ": " + strconv.FormatInt(message.ID, 10) + "\r\n" +
+		HeaderKey + ": " + message.Key + "\r\n\r\n"
+	_, err := fmt.Fprintf(p.writer, "HPUB %s %d %d\r\n%s%s\r\n",
+		message.Subject, len(headers), len(headers)+len(message.Payload), headers, message.Payload)
+	if err != nil {
+		p.drop()
+		return err
+	}
+	p.unflushed = true
+	return nil
+}
+
+// Flush writes buffered Messages and waits for the server to confirm them.
+// Messages published on a connection that broke since are lost, which Flush
+// reports rather than dialing again.
+func (p *NATSPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lost := p.lost || p.conn == nil
+	p.lost = false
+	if lost {
+		p.unflushed = false
+		return ErrorNATSConnectionLost
+	}
+	if err := p.ping(ctx); err != nil {
+		p.drop()
+		p.lost, p.unflushed = false, false
+		return err
+	}
+	p.unflushed = false
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drop()
+	return nil
+}
+
+// connect dials the server unless connected, reading its INFO and sending
+// CONNECT
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	if p.conn != nil {
+		return nil
+	}
+	dialer := net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.address)
+	if err != nil {
+		return err
+	}
+	p.conn, p.reader, p.writer = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+	p.setDeadline(ctx)
+	line, err := p.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		p.drop()
+		return errors.Errorf("expected NATS INFO, got %q: %v", line, err)
+	}
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"headers":  true,
+		"name":     "example-server-outbox",
+		"lang":     "go",
+		"version":  "1",
+	}
+	if p.user != nil {
+		options["user"] = p.user.Username()
+		if password, ok := p.user.Password(); ok {
+			options["pass"] = password
+		}
+	}
+	connectOptions, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(p.writer, "CONNECT %s\r\n", connectOptions); err != nil {
+		p.drop()
+		return err
+	}
+	// Make sure the server accepted CONNECT before publishing
+	if err := p.ping(ctx); err != nil {
+		p.drop()
+		return err
+	}
+	return nil
+}
+
+// ping sends PING and reads until PONG, answering the server's PINGs
+func (p *NATSPublisher) ping(ctx context.Context) error {
+	p.setDeadline(ctx)
+	if _, err := p.writer.WriteString("PING\r\n"); err != nil {
+		return err
+	}
+	if err := p.writer.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.writer.WriteString("PONG\r\n"); err != nil {
+				return err
+			}
+			if err := p.writer.Flush(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.Wrap(ErrorNATSServer, strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+func (p *NATSPublisher) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(p.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	p.conn.SetDeadline(deadline)
+}
+
+func (p *NATSPublisher) drop() {
+	p.lost = p.lost || p.unflushed
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.reader, p.writer = nil, nil, nil
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 
+	"example-server/cache"
 	"example-server/database"
 	"example-server/logger"
 	"example-server/models"
+	"example-server/tenant"
 )
 
 var (
@@ -19,77 +21,134 @@ var (
 	ErrorItemsQuery   = errors.New("Error querying Items")
 )
 
-func FetchPaginatedItems(dbPool database.PgxPoolIface, offset, chunkSize int) ([]*models.Item, error) {
-	// Fetch paginated Items
-	rows, err := dbPool.Query(
-		context.Background(),
-		"SELECT id, uuid, created_at, name, price FROM item ORDER BY id OFFSET $1 LIMIT $2",
-		offset, chunkSize,
-	)
-	// Handle Items fetch error
-	if err != nil {
-		logger.LogErrorWithStacktrace(err, "Error querying Items")
-		return nil, ErrorItemsQuery
+// withTenantTx runs fn in a transaction scoped to the request tenant. Row
+// level security isolates tenants; queries also filter on tenant_id since
+// superusers bypass RLS. Transaction failures outside fn are logged and
+// reported as txErr.
+func withTenantTx(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	txErr error,
+	fn func(tx pgx.Tx, tenantID string) error,
+) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrorMissingTenant
 	}
-	defer rows.Close()
-	// Iterate over rows and append Items
+	var fnErr error
+	err := database.WithTenantTx(ctx, dbPool, tenantID, func(tx pgx.Tx) error {
+		fnErr = fn(tx, tenantID)
+		return fnErr
+	})
+	if err != nil && fnErr == nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error in tenant transaction")
+		return txErr
+	}
+	return err
+}
+
+func FetchPaginatedItems(ctx context.Context, dbPool database.PgxPoolIface, offset, chunkSize int) ([]*models.Item, error) {
+	// Fetch paginated Items
+	ctx = database.WithQueryName(ctx, "item.fetch_paginated")
 	var items []*models.Item
-	for rows.Next() {
-		var item models.Item
-		// Scan Item and append to Items unless error
-		if err := rows.Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price); err != nil {
-			logger.LogErrorWithStacktrace(err, "Error scanning Item")
-			return nil, ErrorItemsQuery
+	err := withTenantTx(ctx, dbPool, ErrorItemsQuery, func(tx pgx.Tx, tenantID string) error {
+		rows, err := tx.Query(
+			ctx,
+			"SELECT id, uuid, created_at, name, price FROM item WHERE tenant_id = $1 ORDER BY id OFFSET $2 LIMIT $3",
+			tenantID, offset, chunkSize,
+		)
+		// Handle Items fetch error
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying Items")
+			return ErrorItemsQuery
 		}
-		items = append(items, &item)
+		items, err = scanItems(ctx, rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	// Handle row iteration error
-	if err := rows.Err(); err != nil {
-		logger.LogErrorWithStacktrace(err, "Error iterating over paginated Items")
-		return nil, ErrorItemsQuery
+	return items, nil
+}
+
+func FetchItemById(ctx context.Context, dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
+	// Read through the Item cache when the pool has one
+	if items := cache.ItemsFromPool(dbPool); items != nil {
+		return items.Fetch(ctx, itemId, func(ctx context.Context) (*models.Item, error) {
+			return loadItemById(ctx, dbPool, itemId)
+		})
 	}
-	// Check if the slice is nil and replace it with an empty slice
-	if items == nil {
-		items = []*models.Item{}
+	return loadItemById(ctx, dbPool, itemId)
+}
+
+// invalidateItems drops changed Items from the Item cache, if any
+func invalidateItems(ctx context.Context, dbPool database.PgxPoolIface, itemIds ...int) {
+	if items := cache.ItemsFromPool(dbPool); items != nil {
+		items.Invalidate(ctx, itemIds...)
 	}
-	return items, nil
 }
 
-func FetchItemById(dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
+func loadItemById(ctx context.Context, dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
 	// Fetch Item by ID
+	var item *models.Item
+	err := withTenantTx(ctx, dbPool, ErrorItemsQuery, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		item, err = fetchItemById(ctx, tx, tenantID, itemId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func fetchItemById(ctx context.Context, tx pgx.Tx, tenantID string, itemId int) (*models.Item, error) {
+	ctx = database.WithQueryName(ctx, "item.fetch_by_id")
 	var item models.Item
-	err := dbPool.QueryRow(
-		context.Background(),
-		"SELECT id, uuid, created_at, name, price FROM item WHERE id = $1",
-		itemId,
+	err := tx.QueryRow(
+		ctx,
+		"SELECT id, uuid, created_at, name, price FROM item WHERE id = $1 AND tenant_id = $2",
+		itemId, tenantID,
 	).Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price)
-	// Handle Item fetch error
+	// Handle Item fetch error, other tenants' Items are not found either
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrorItemNotFound
 		}
-		logger.LogErrorWithStacktrace(err, "Error querying Item")
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying Item")
 		return nil, ErrorItemsQuery
 	}
 	return &item, nil
 }
 
-func FetchItemsByIds(dbPool database.PgxPoolIface, itemIds []int) ([]*models.Item, error) {
+func FetchItemsByIds(ctx context.Context, dbPool database.PgxPoolIface, itemIds []int) ([]*models.Item, error) {
 	// Fetch Items by IDs
-	var err error
-	var rows pgx.Rows
-	if len(itemIds) > 0 {
-		rows, err = dbPool.Query(
-			context.Background(),
-			"SELECT id, uuid, created_at, name, price FROM item WHERE id = ANY($1)",
-			itemIds,
-		)
+	ctx = database.WithQueryName(ctx, "item.fetch_by_ids")
+	if len(itemIds) == 0 {
+		return []*models.Item{}, nil
 	}
-	// Handle Items fetch error
+	var items []*models.Item
+	err := withTenantTx(ctx, dbPool, ErrorItemsQuery, func(tx pgx.Tx, tenantID string) error {
+		rows, err := tx.Query(
+			ctx,
+			"SELECT id, uuid, created_at, name, price FROM item WHERE id = ANY($1) AND tenant_id = $2",
+			itemIds, tenantID,
+		)
+		// Handle Items fetch error
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying Items")
+			return ErrorItemsQuery
+		}
+		items, err = scanItems(ctx, rows)
+		return err
+	})
 	if err != nil {
-		logger.LogErrorWithStacktrace(err, "Error querying Items")
-		return nil, ErrorItemsQuery
+		return nil, err
 	}
+	return items, nil
+}
+
+func scanItems(ctx context.Context, rows pgx.Rows) ([]*models.Item, error) {
 	defer rows.Close()
 	// Iterate over rows and append Items
 	var items []*models.Item
@@ -97,14 +156,14 @@ func FetchItemsByIds(dbPool database.PgxPoolIface, itemIds []int) ([]*models.Ite
 		var item models.Item
 		// Scan Item and append to Items unless error
 		if err := rows.Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price); err != nil {
-			logger.LogErrorWithStacktrace(err, "Error scanning Item")
+			logger.LogErrorWithStacktrace(ctx, err, "Error scanning Item")
 			return nil, ErrorItemsQuery
 		}
 		items = append(items, &item)
 	}
 	// Handle row iteration error
 	if err := rows.Err(); err != nil {
-		logger.LogErrorWithStacktrace(err, "Error iterating over Items")
+		logger.LogErrorWithStacktrace(ctx, err, "Error iterating over Items")
 		return nil, ErrorItemsQuery
 	}
 	// Check if the slice is nil and replace it with an empty slice
@@ -114,31 +173,41 @@ func FetchItemsByIds(dbPool database.PgxPoolIface, itemIds []int) ([]*models.Ite
 	return items, nil
 }
 
-func InsertItem(dbPool database.PgxPoolIface, itemIn models.ItemIn) (*models.Item, error) {
+func InsertItem(ctx context.Context, dbPool database.PgxPoolIface, itemIn models.ItemIn) (*models.Item, error) {
 	// Insert Item
-	var itemId int
-	err := dbPool.QueryRow(
-		context.Background(),
-		"INSERT INTO item (name, price) VALUES ($1, $2) RETURNING id",
-		itemIn.Name,
-		itemIn.Price,
-	).Scan(&itemId)
-	// Handle Item insert error
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			// Duplicate entry error handling
-			if pgErr.Code == "23505" {
-				return nil, ErrorItemExists
+	ctx = database.WithQueryName(ctx, "item.insert")
+	var item *models.Item
+	err := withTenantTx(ctx, dbPool, ErrorItemInsert, func(tx pgx.Tx, tenantID string) error {
+		var itemId int
+		err := tx.QueryRow(
+			ctx,
+			"INSERT INTO item (tenant_id, name, price) VALUES ($1, $2, $3) RETURNING id",
+			tenantID,
+			itemIn.Name,
+			itemIn.Price,
+		).Scan(&itemId)
+		// Handle Item insert error
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				// Duplicate entry error handling
+				if pgErr.Code == "23505" {
+					return ErrorItemExists
+				}
 			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error inserting Item")
+			return ErrorItemInsert
 		}
-		logger.LogErrorWithStacktrace(err, "Error inserting Item")
-		return nil, ErrorItemInsert
-	}
-	// Fetch Item by ID
-	item, err := FetchItemById(dbPool, itemId)
+		// Fetch Item by ID
+		item, err = fetchItemById(ctx, tx, tenantID, itemId)
+		if err != nil {
+			return err
+		}
+		return recordItemChange(ctx, tx, tenantID, models.WebhookEventItemCreated, item)
+	})
 	if err != nil {
 		return nil, err
 	}
+	database.RecordDomainEvent(dbPool, "item", "created")
 	return item, nil
 }
@@ -0,0 +1,183 @@
+package repos
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/bulk"
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+)
+
+var ErrorItemsImport = errors.New("Error importing Items")
+
+// itemChange is a merged Item and the event it sends out
+type itemChange struct {
+	event string
+	item  *models.Item
+}
+
+// StreamItems calls fn for every Item of the tenant in id order. Rows are read
+// off the connection as fn consumes them, so the table is never held in
+// memory; an error from fn stops the query and is returned as is.
+func StreamItems(ctx context.Context, dbPool database.PgxPoolIface, fn func(item *models.Item) error) error {
+	ctx = database.WithQueryName(ctx, "item.stream")
+	return streamItems(ctx, dbPool, fn,
+		"SELECT id, uuid, created_at, name, price FROM item WHERE tenant_id = $1 ORDER BY id",
+	)
+}
+
+// StreamPaginatedItems is the streaming variant of FetchPaginatedItems
+func StreamPaginatedItems(ctx context.Context, dbPool database.PgxPoolIface, offset, limit int, fn func(item *models.Item) error) error {
+	ctx = database.WithQueryName(ctx, "item.stream_paginated")
+	return streamItems(ctx, dbPool, fn,
+		"SELECT id, uuid, created_at, name, price FROM item WHERE tenant_id = $1 ORDER BY id OFFSET $2 LIMIT $3",
+		offset, limit,
+	)
+}
+
+// StreamItemsByIds is the streaming variant of FetchItemsByIds, in id order
+func StreamItemsByIds(ctx context.Context, dbPool database.PgxPoolIface, itemIds []int, fn func(item *models.Item) error) error {
+	ctx = database.WithQueryName(ctx, "item.stream_by_ids")
+	if len(itemIds) == 0 {
+		return nil
+	}
+	return streamItems(ctx, dbPool, fn,
+		"SELECT id, uuid, created_at, name, price FROM item WHERE tenant_id = $1 AND id = ANY($2) ORDER BY id",
+		itemIds,
+	)
+}
+
+// streamItems runs query with the tenant as $1 followed by args, calling fn
+// per row. A cancelled ctx, e.g. a client that went away, stops the query
+// and is returned as ctx.Err().
+func streamItems(ctx context.Context, dbPool database.PgxPoolIface, fn func(item *models.Item) error, query string, args ...any) error {
+	return withTenantTx(ctx, dbPool, ErrorItemsQuery, func(tx pgx.Tx, tenantID string) error {
+		rows, err := tx.Query(ctx, query, append([]any{tenantID}, args...)...)
+		// Handle Items fetch error
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying Items")
+			return ErrorItemsQuery
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var item models.Item
+			if err := rows.Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price); err != nil {
+				logger.LogErrorWithStacktrace(ctx, err, "Error scanning Item")
+				return ErrorItemsQuery
+			}
+			if err := fn(&item); err != nil {
+				return err
+			}
+		}
+		// Handle row iteration error
+		if err := rows.Err(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error iterating over Items")
+			return ErrorItemsQuery
+		}
+		return nil
+	})
+}
+
+// ImportItems copies rows into a staging table and merges them into item in
+// one transaction. Names that already exist are updated or skipped as
+// onConflict says; updates that leave the price unchanged count as skipped.
+// Inserted and updated Items send out their webhooks and outbox events like
+// single writes do.
+func ImportItems(ctx context.Context, dbPool database.PgxPoolIface, rows []bulk.Row, onConflict bulk.OnConflict) (models.ImportReport, error) {
+	ctx = database.WithQueryName(ctx, "item.import")
+	report := models.ImportReport{Errors: []models.ImportRowError{}}
+	var updatedIds []int
+	if len(rows) == 0 {
+		return report, nil
+	}
+	err := withTenantTx(ctx, dbPool, ErrorItemsImport, func(tx pgx.Tx, tenantID string) error {
+		// Stage rows with COPY, dropped again at commit
+		_, err := tx.Exec(
+			ctx,
+			"CREATE TEMP TABLE item_import (line INT NOT NULL, name VARCHAR(50) NOT NULL, price NUMERIC(10, 2) NOT NULL) ON COMMIT DROP",
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error creating Item import table")
+			return ErrorItemsImport
+		}
+		_, err = tx.CopyFrom(
+			ctx,
+			pgx.Identifier{"item_import"},
+			[]string{"line", "name", "price"},
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				return []any{rows[i].Line, rows[i].Item.Name, rows[i].Item.Price}, nil
+			}),
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error copying Items")
+			return ErrorItemsImport
+		}
+		// Merge into item; xmax is 0 for inserted rows
+		onConflictClause := "DO UPDATE SET price = EXCLUDED.price WHERE item.price IS DISTINCT FROM EXCLUDED.price"
+		if onConflict == bulk.OnConflictSkip {
+			onConflictClause = "DO NOTHING"
+		}
+		merged, err := tx.Query(
+			ctx,
+			"INSERT INTO item (tenant_id, name, price) SELECT $1, name, price FROM item_import ORDER BY line "+
+				"ON CONFLICT ON CONSTRAINT item_name_unique "+onConflictClause+
+				" RETURNING id, uuid, created_at, name, price, xmax = 0 AS inserted",
+			tenantID,
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error merging Items")
+			return ErrorItemsImport
+		}
+		defer merged.Close()
+		var changes []itemChange
+		for merged.Next() {
+			var item models.Item
+			var inserted bool
+			if err := merged.Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price, &inserted); err != nil {
+				logger.LogErrorWithStacktrace(ctx, err, "Error scanning merged Item")
+				return ErrorItemsImport
+			}
+			if inserted {
+				report.Inserted++
+				changes = append(changes, itemChange{models.WebhookEventItemCreated, &item})
+			} else {
+				report.Updated++
+				updatedIds = append(updatedIds, item.ID)
+				changes = append(changes, itemChange{models.WebhookEventItemUpdated, &item})
+			}
+		}
+		if err := merged.Err(); err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error merging Items")
+			return ErrorItemsImport
+		}
+		// Record the changes once the rows are read, the connection is busy
+		// until then
+		merged.Close()
+		for _, change := range changes {
+			if err := recordItemChange(ctx, tx, tenantID, change.event, change.item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	invalidateItems(ctx, dbPool, updatedIds...)
+	report.Skipped = len(rows) - report.Inserted - report.Updated
+	database.RecordDomainEvent(dbPool, "item", "imported")
+	return report, nil
+}
@@ -0,0 +1,148 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+)
+
+var (
+	ErrorOutboxEnqueue = errors.New("Error enqueuing outbox event")
+	ErrorOutboxQuery   = errors.New("Error querying outbox")
+)
+
+// Outbox aggregate types
+const outboxAggregateItem = "item"
+
+// recordItemChange writes what an Item change sends out in the transaction of
+// the change: its webhook deliveries and its outbox event
+func recordItemChange(ctx context.Context, tx pgx.Tx, tenantID, event string, item *models.Item) error {
+	if err := enqueueItemWebhooks(ctx, tx, tenantID, event, item); err != nil {
+		return err
+	}
+	return enqueueOutboxEvent(ctx, tx, tenantID, event, item)
+}
+
+// enqueueOutboxEvent adds the Item change to the outbox, the relay publishes
+// it once the transaction commits
+func enqueueOutboxEvent(ctx context.Context, tx pgx.Tx, tenantID, event string, item *models.Item) error {
+	ctx = database.WithQueryName(ctx, "outbox.enqueue")
+	payload, err := json.Marshal(item)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error encoding outbox event")
+		return ErrorOutboxEnqueue
+	}
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO outbox (tenant_id, aggregate_type, aggregate_id, event_type, payload) VALUES ($1, $2, $3, $4, $5)",
+		tenantID, outboxAggregateItem, item.ID, event, payload,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error enqueuing outbox event")
+		return ErrorOutboxEnqueue
+	}
+	return nil
+}
+
+// RelayOutboxEvents hands up to limit of the oldest outbox events across
+// tenants to publish, in order, and deletes the ones it reports published.
+// Relays take turns on an advisory lock so events stay in order, another
+// relay holding it makes this a no-op. A failed commit leaves the events to
+// be published again.
+func RelayOutboxEvents(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	limit int,
+	publish func(ctx context.Context, events []*models.OutboxEvent) []int64,
+) (int, error) {
+	var published []int64
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		locked, err := database.TryAdvisoryXactLock(ctx, tx, database.LockOutboxRelay)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error locking outbox")
+			return ErrorOutboxQuery
+		}
+		if !locked {
+			return nil
+		}
+		events, err := fetchOutboxEvents(ctx, tx, limit)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		published = publish(ctx, events)
+		if len(published) == 0 {
+			return nil
+		}
+		_, err = tx.Exec(
+			database.WithQueryName(ctx, "outbox.delete"),
+			"DELETE FROM outbox WHERE id = ANY($1)",
+			published,
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error deleting published outbox events")
+			return ErrorOutboxQuery
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), nil
+}
+
+func fetchOutboxEvents(ctx context.Context, tx pgx.Tx, limit int) ([]*models.OutboxEvent, error) {
+	ctx = database.WithQueryName(ctx, "outbox.fetch")
+	rows, err := tx.Query(
+		ctx,
+		"SELECT id, tenant_id, aggregate_type, aggregate_id, event_type, payload, created_at FROM outbox ORDER BY id LIMIT $1",
+		limit,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying outbox")
+		return nil, ErrorOutboxQuery
+	}
+	defer rows.Close()
+	events := []*models.OutboxEvent{}
+	for rows.Next() {
+		var event models.OutboxEvent
+		err := rows.Scan(
+			&event.ID, &event.TenantID, &event.AggregateType, &event.AggregateID,
+			&event.EventType, &event.Payload, &event.CreatedAt,
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error scanning outbox event")
+			return nil, ErrorOutboxQuery
+		}
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error iterating outbox")
+		return nil, ErrorOutboxQuery
+	}
+	return events, nil
+}
+
+// FetchOutboxLag returns how many events wait in the outbox across tenants and
+// how long the oldest has, in seconds
+func FetchOutboxLag(ctx context.Context, dbPool database.PgxPoolIface) (int, float64, error) {
+	ctx = database.WithQueryName(ctx, "outbox.lag")
+	var pending int
+	var lag float64
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		return tx.QueryRow(
+			ctx,
+			"SELECT count(*), COALESCE(EXTRACT(EPOCH FROM LOCALTIMESTAMP - min(created_at)), 0)::float8 FROM outbox",
+		).Scan(&pending, &lag)
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying outbox lag")
+		return 0, 0, ErrorOutboxQuery
+	}
+	return pending, lag, nil
+}
@@ -0,0 +1,473 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+)
+
+var (
+	ErrorWebhookNotFound          = errors.New("Webhook not found")
+	ErrorWebhookInsert            = errors.New("Error inserting webhook")
+	ErrorWebhooksQuery            = errors.New("Error querying webhooks")
+	ErrorWebhookUpdate            = errors.New("Error updating webhook")
+	ErrorWebhookDeliveryNotFound  = errors.New("Webhook delivery not found")
+	ErrorWebhookDeliveryDelivered = errors.New("Webhook delivery already delivered")
+	ErrorWebhookEnqueue           = errors.New("Error enqueuing webhook deliveries")
+	ErrorWebhookLeaseLost         = errors.New("Webhook delivery lease lost to another claim")
+)
+
+const (
+	webhookSubscriptionColumns = "id, url, secret, events, active, created_at, updated_at"
+	webhookDeliveryColumns     = "id, subscription_id, event, payload, status, attempts, next_attempt_at, " +
+		"last_attempt_at, last_status_code, last_error, created_at, delivered_at"
+)
+
+func scanWebhookSubscription(row pgx.Row) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := row.Scan(
+		&subscription.ID, &subscription.URL, &subscription.Secret, &subscription.Events,
+		&subscription.Active, &subscription.CreatedAt, &subscription.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func scanWebhookDelivery(row pgx.Row) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := row.Scan(
+		&delivery.ID, &delivery.SubscriptionID, &delivery.Event, &delivery.Payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastAttemptAt, &delivery.LastStatusCode,
+		&delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// webhookSubscriptionArgs defaults what the subscription leaves out
+func webhookSubscriptionArgs(subscriptionIn models.WebhookSubscriptionIn) ([]string, bool) {
+	events := subscriptionIn.Events
+	if events == nil {
+		events = []string{}
+	}
+	active := subscriptionIn.Active == nil || *subscriptionIn.Active
+	return events, active
+}
+
+func InsertWebhookSubscription(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	secret string,
+	subscriptionIn models.WebhookSubscriptionIn,
+) (*models.WebhookSubscription, error) {
+	// Insert webhook subscription for the tenant
+	ctx = database.WithQueryName(ctx, "webhook.insert")
+	events, active := webhookSubscriptionArgs(subscriptionIn)
+	var subscription *models.WebhookSubscription
+	err := withTenantTx(ctx, dbPool, ErrorWebhookInsert, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		subscription, err = scanWebhookSubscription(tx.QueryRow(
+			ctx,
+			"INSERT INTO webhook_subscriptions (tenant_id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5) "+
+				"RETURNING "+webhookSubscriptionColumns,
+			tenantID, subscriptionIn.URL, secret, events, active,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error inserting webhook")
+			return ErrorWebhookInsert
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "webhook", "created")
+	return subscription, nil
+}
+
+func FetchWebhookSubscriptions(ctx context.Context, dbPool database.PgxPoolIface) ([]*models.WebhookSubscription, error) {
+	// Fetch the tenant's webhook subscriptions
+	ctx = database.WithQueryName(ctx, "webhook.fetch_all")
+	subscriptions := []*models.WebhookSubscription{}
+	err := withTenantTx(ctx, dbPool, ErrorWebhooksQuery, func(tx pgx.Tx, tenantID string) error {
+		rows, err := tx.Query(
+			ctx,
+			"SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE tenant_id = $1 ORDER BY id",
+			tenantID,
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying webhooks")
+			return ErrorWebhooksQuery
+		}
+		defer rows.Close()
+		for rows.Next() {
+			subscription, err := scanWebhookSubscription(rows)
+			if err != nil {
+				logger.LogErrorWithStacktrace(ctx, err, "Error scanning webhook")
+				return ErrorWebhooksQuery
+			}
+			subscriptions = append(subscriptions, subscription)
+		}
+		if err := rows.Err(); err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error iterating webhooks")
+			return ErrorWebhooksQuery
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func FetchWebhookSubscriptionById(ctx context.Context, dbPool database.PgxPoolIface, subscriptionId int) (*models.WebhookSubscription, error) {
+	// Fetch webhook subscription by ID
+	var subscription *models.WebhookSubscription
+	err := withTenantTx(ctx, dbPool, ErrorWebhooksQuery, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		subscription, err = fetchWebhookSubscriptionById(ctx, tx, tenantID, subscriptionId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func fetchWebhookSubscriptionById(ctx context.Context, tx pgx.Tx, tenantID string, subscriptionId int) (*models.WebhookSubscription, error) {
+	ctx = database.WithQueryName(ctx, "webhook.fetch_by_id")
+	subscription, err := scanWebhookSubscription(tx.QueryRow(
+		ctx,
+		"SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2",
+		subscriptionId, tenantID,
+	))
+	// Other tenants' subscriptions are not found either
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrorWebhookNotFound
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying webhook")
+		return nil, ErrorWebhooksQuery
+	}
+	return subscription, nil
+}
+
+func UpdateWebhookSubscription(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	subscriptionId int,
+	subscriptionIn models.WebhookSubscriptionIn,
+) (*models.WebhookSubscription, error) {
+	// Replace webhook subscription, keeping its secret
+	ctx = database.WithQueryName(ctx, "webhook.update")
+	events, active := webhookSubscriptionArgs(subscriptionIn)
+	var subscription *models.WebhookSubscription
+	err := withTenantTx(ctx, dbPool, ErrorWebhookUpdate, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		subscription, err = scanWebhookSubscription(tx.QueryRow(
+			ctx,
+			"UPDATE webhook_subscriptions SET url = $1, events = $2, active = $3, updated_at = CURRENT_TIMESTAMP "+
+				"WHERE id = $4 AND tenant_id = $5 RETURNING "+webhookSubscriptionColumns,
+			subscriptionIn.URL, events, active, subscriptionId, tenantID,
+		))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorWebhookNotFound
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error updating webhook")
+			return ErrorWebhookUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "webhook", "updated")
+	return subscription, nil
+}
+
+func DeleteWebhookSubscription(ctx context.Context, dbPool database.PgxPoolIface, subscriptionId int) (*models.WebhookSubscription, error) {
+	// Delete webhook subscription along with its deliveries
+	ctx = database.WithQueryName(ctx, "webhook.delete")
+	var subscription *models.WebhookSubscription
+	err := withTenantTx(ctx, dbPool, ErrorWebhookUpdate, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		subscription, err = scanWebhookSubscription(tx.QueryRow(
+			ctx,
+			"DELETE FROM webhook_subscriptions WHERE id = $1 AND tenant_id = $2 RETURNING "+webhookSubscriptionColumns,
+			subscriptionId, tenantID,
+		))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorWebhookNotFound
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error deleting webhook")
+			return ErrorWebhookUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "webhook", "deleted")
+	return subscription, nil
+}
+
+// FetchWebhookDeliveries returns the delivery log of a subscription, newest
+// first
+func FetchWebhookDeliveries(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	subscriptionId int,
+	limit int,
+) ([]*models.WebhookDelivery, error) {
+	deliveries := []*models.WebhookDelivery{}
+	err := withTenantTx(ctx, dbPool, ErrorWebhooksQuery, func(tx pgx.Tx, tenantID string) error {
+		if _, err := fetchWebhookSubscriptionById(ctx, tx, tenantID, subscriptionId); err != nil {
+			return err
+		}
+		queryCtx := database.WithQueryName(ctx, "webhook_delivery.fetch_by_subscription")
+		rows, err := tx.Query(
+			queryCtx,
+			"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE subscription_id = $1 AND tenant_id = $2 "+
+				"ORDER BY id DESC LIMIT $3",
+			subscriptionId, tenantID, limit,
+		)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying webhook deliveries")
+			return ErrorWebhooksQuery
+		}
+		defer rows.Close()
+		for rows.Next() {
+			delivery, err := scanWebhookDelivery(rows)
+			if err != nil {
+				logger.LogErrorWithStacktrace(ctx, err, "Error scanning webhook delivery")
+				return ErrorWebhooksQuery
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		if err := rows.Err(); err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error iterating webhook deliveries")
+			return ErrorWebhooksQuery
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery makes a dead or pending delivery due now, with a fresh
+// set of attempts
+func RetryWebhookDelivery(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	subscriptionId int,
+	deliveryId int64,
+) (*models.WebhookDelivery, error) {
+	ctx = database.WithQueryName(ctx, "webhook_delivery.retry")
+	var delivery *models.WebhookDelivery
+	err := withTenantTx(ctx, dbPool, ErrorWebhookUpdate, func(tx pgx.Tx, tenantID string) error {
+		var status string
+		err := tx.QueryRow(
+			ctx,
+			"SELECT status FROM webhook_deliveries WHERE id = $1 AND subscription_id = $2 AND tenant_id = $3 FOR UPDATE",
+			deliveryId, subscriptionId, tenantID,
+		).Scan(&status)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorWebhookDeliveryNotFound
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying webhook delivery")
+			return ErrorWebhookUpdate
+		}
+		if status == models.WebhookDeliveryDelivered {
+			return ErrorWebhookDeliveryDelivered
+		}
+		delivery, err = scanWebhookDelivery(tx.QueryRow(
+			ctx,
+			"UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP "+
+				"WHERE id = $2 RETURNING "+webhookDeliveryColumns,
+			models.WebhookDeliveryPending, deliveryId,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error retrying webhook delivery")
+			return ErrorWebhookUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "webhook_delivery", "retried")
+	return delivery, nil
+}
+
+// enqueueItemWebhooks adds a delivery of the Item change for every active
+// subscription of the tenant wanting event, in the transaction of the change
+// so deliveries exist exactly when the change is committed
+func enqueueItemWebhooks(ctx context.Context, tx pgx.Tx, tenantID, event string, item *models.Item) error {
+	ctx = database.WithQueryName(ctx, "webhook_delivery.enqueue")
+	payload, err := json.Marshal(models.WebhookPayload{
+		Event:      event,
+		TenantID:   tenantID,
+		OccurredAt: time.Now().UTC(),
+		Data:       item,
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error encoding webhook payload")
+		return ErrorWebhookEnqueue
+	}
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO webhook_deliveries (subscription_id, tenant_id, event, payload) "+
+			"SELECT id, tenant_id, $2, $3 FROM webhook_subscriptions "+
+			"WHERE tenant_id = $1 AND active AND (events = '{}' OR $2 = ANY(events))",
+		tenantID, event, payload,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error enqueuing webhook deliveries")
+		return ErrorWebhookEnqueue
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries of active
+// subscriptions across tenants, counting an attempt and leasing them until
+// lease has passed, when they are due again unless recorded as done. Other
+// dispatchers skip rows being claimed.
+func ClaimWebhookDeliveries(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	limit int,
+	lease time.Duration,
+) ([]*models.WebhookDispatch, error) {
+	ctx = database.WithQueryName(ctx, "webhook_delivery.claim")
+	dispatches := []*models.WebhookDispatch{}
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(
+			ctx,
+			"UPDATE webhook_deliveries d SET attempts = d.attempts + 1, last_attempt_at = CURRENT_TIMESTAMP, "+
+				"next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second' "+
+				"FROM webhook_subscriptions s WHERE s.id = d.subscription_id AND d.id IN ("+
+				"SELECT d.id FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id "+
+				"WHERE d.status = 'pending' AND d.next_attempt_at <= CURRENT_TIMESTAMP AND s.active "+
+				"ORDER BY d.next_attempt_at, d.id LIMIT $1 FOR UPDATE OF d SKIP LOCKED"+
+				") RETURNING d.id, d.event, d.payload, d.attempts, s.url, s.secret",
+			limit, lease.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var dispatch models.WebhookDispatch
+			err := rows.Scan(
+				&dispatch.ID, &dispatch.Event, &dispatch.Payload, &dispatch.Attempts, &dispatch.URL, &dispatch.Secret,
+			)
+			if err != nil {
+				return err
+			}
+			dispatches = append(dispatches, &dispatch)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error claiming webhook deliveries")
+		return nil, ErrorWebhooksQuery
+	}
+	return dispatches, nil
+}
+
+// webhookDeliveryLease fences outcomes of a claimed delivery to the claim that
+// sent it: once its lease expired and another dispatcher claimed it, or it
+// was resent, attempts moved on
+const webhookDeliveryLease = "status = 'pending' AND attempts = "
+
+// RecordWebhookDelivered marks a delivery claimed on the given attempt as
+// delivered, or returns ErrorWebhookLeaseLost
+func RecordWebhookDelivered(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	deliveryId int64,
+	attempt int,
+	statusCode int,
+) error {
+	ctx = database.WithQueryName(ctx, "webhook_delivery.delivered")
+	var recorded bool
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			"UPDATE webhook_deliveries SET status = $1, delivered_at = CURRENT_TIMESTAMP, last_status_code = $2, "+
+				"last_error = NULL WHERE id = $3 AND "+webhookDeliveryLease+"$4",
+			models.WebhookDeliveryDelivered, statusCode, deliveryId, attempt,
+		)
+		recorded = tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error recording webhook delivery")
+		return ErrorWebhookUpdate
+	}
+	if !recorded {
+		return ErrorWebhookLeaseLost
+	}
+	database.RecordDomainEvent(dbPool, "webhook_delivery", "delivered")
+	return nil
+}
+
+// RecordWebhookFailed records a failed attempt of a delivery claimed on that
+// attempt. It is due again after retryIn, or dead when retryIn is negative.
+// statusCode is 0 when no response came. It returns ErrorWebhookLeaseLost
+// once the delivery was claimed again.
+func RecordWebhookFailed(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	deliveryId int64,
+	attempt int,
+	statusCode int,
+	errMsg string,
+	retryIn time.Duration,
+) error {
+	ctx = database.WithQueryName(ctx, "webhook_delivery.failed")
+	status, event := models.WebhookDeliveryPending, "failed"
+	if retryIn < 0 {
+		status, event, retryIn = models.WebhookDeliveryDead, "dead", 0
+	}
+	var lastStatusCode *int
+	if statusCode != 0 {
+		lastStatusCode = &statusCode
+	}
+	var recorded bool
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			"UPDATE webhook_deliveries SET status = $1, next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', "+
+				"last_status_code = $3, last_error = $4 WHERE id = $5 AND "+webhookDeliveryLease+"$6",
+			status, retryIn.Seconds(), lastStatusCode, errMsg, deliveryId, attempt,
+		)
+		recorded = tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error recording webhook delivery")
+		return ErrorWebhookUpdate
+	}
+	if !recorded {
+		return ErrorWebhookLeaseLost
+	}
+	database.RecordDomainEvent(dbPool, "webhook_delivery", event)
+	return nil
+}
@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"example-server/auth"
+	"example-server/dependencies"
+	"example-server/logger"
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/repos"
+	"example-server/tenant"
+)
+
+// ADMIN API
+
+func SetupAdminRoutes(router *gin.Engine, deps *dependencies.Dependencies, adminToken string) {
+	if adminToken == "" {
+		log.Warn().Msg("ADMIN_TOKEN not set, admin API disabled")
+		return
+	}
+	adminRouterGroup := router.Group("/admin", middleware.AdminAuth(adminToken))
+	adminRouterGroup.GET("/loglevel", HandleGetLogLevel)
+	adminRouterGroup.PUT("/loglevel", HandleSetLogLevel)
+	adminRouterGroup.POST("/apikeys", HandleCreateAPIKey(deps))
+	adminRouterGroup.GET("/apikeys", HandleGetAPIKeys(deps))
+	adminRouterGroup.DELETE("/apikeys/:id", HandleRevokeAPIKey(deps))
+}
+
+// GetLogLevel godoc
+// @Summary Get Log Level
+// @Description Returns the current global log level.
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} models.LogLevelResponse
+// @Failure 401 {object} string "Unauthorized"
+// @Router /admin/loglevel [get]
+func HandleGetLogLevel(g *gin.Context) {
+	g.JSON(http.StatusOK, models.LogLevelResponse{Level: zerolog.GlobalLevel().String()})
+}
+
+// SetLogLevel godoc
+// @Summary Set Log Level
+// @Description Changes the global log level at runtime.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param logLevelRequest body models.LogLevelRequest true "Log Level Request"
+// @Success 200 {object} models.LogLevelResponse
+// @Failure 400 {object} string "Invalid log level"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 413 {object} string "Request body too large"
+// @Router /admin/loglevel [put]
+func HandleSetLogLevel(g *gin.Context) {
+	var logLevelRequest models.LogLevelRequest
+	if err := g.ShouldBindJSON(&logLevelRequest); err != nil {
+		respondWithBindError(g, err, "Invalid JSON payload")
+		return
+	}
+	level, err := logger.ParseLevel(logLevelRequest.Level)
+	if err != nil {
+		respondWithError(g, http.StatusBadRequest, "Invalid log level")
+		return
+	}
+	previous := logger.SetLevel(level)
+	g.JSON(http.StatusOK, models.LogLevelResponse{Level: level.String(), Previous: previous.String()})
+}
+
+// CreateAPIKey godoc
+// @Summary Create API Key
+// @Description Creates an API key. The key is only returned in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminToken
+// @Param createAPIKeyRequest body models.CreateAPIKeyRequest true "Create API Key Request"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} string "Invalid JSON payload"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 413 {object} string "Request body too large"
+// @Router /admin/apikeys [post]
+func HandleCreateAPIKey(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		// Parse and validate request
+		var createAPIKeyRequest models.CreateAPIKeyRequest
+		if err := g.ShouldBindJSON(&createAPIKeyRequest); err != nil {
+			respondWithBindError(g, err, "Invalid JSON payload")
+			return
+		}
+		apiKeyIn := createAPIKeyRequest.Data
+		if err := deps.Validator.Struct(apiKeyIn); err != nil || tenant.Validate(apiKeyIn.TenantID) != nil {
+			respondWithError(g, http.StatusBadRequest, "Invalid API key data")
+			return
+		}
+		// Generate key and store its hash
+		key, prefix, keyHash, err := auth.GenerateAPIKey()
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error generating API key")
+			respondWithError(g, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		apiKey, err := repos.InsertAPIKey(ctx, deps.DBPool, prefix, keyHash, apiKeyIn)
+		if err != nil {
+			respondWithError(g, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("apiKeyId", apiKey.ID).
+			Str("owner", apiKey.Owner).
+			Str("tenant_id", apiKey.TenantID).
+			Msg("API key created")
+		g.JSON(http.StatusCreated, models.CreateAPIKeyResponse{Data: apiKey, Key: key})
+	}
+}
+
+// GetAPIKeys godoc
+// @Summary Get API Keys
+// @Description Returns all API keys without their secrets.
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Success 200 {object} models.GetAPIKeysResponse
+// @Failure 401 {object} string "Unauthorized"
+// @Router /admin/apikeys [get]
+func HandleGetAPIKeys(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		apiKeys, err := repos.FetchAPIKeys(g.Request.Context(), deps.DBPool)
+		if err != nil {
+			respondWithError(g, http.StatusInternalServerError, "Failed to query API keys")
+			return
+		}
+		g.JSON(http.StatusOK, models.GetAPIKeysResponse{Data: apiKeys})
+	}
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API Key
+// @Description Revokes an API key by id.
+// @Tags admin
+// @Produce json
+// @Security AdminToken
+// @Param id path int true "API Key ID"
+// @Success 200 {object} models.RevokeAPIKeyResponse
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 404 {object} string "API key not found"
+// @Router /admin/apikeys/{id} [delete]
+func HandleRevokeAPIKey(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		apiKeyId, err := strconv.Atoi(g.Param("id"))
+		if err != nil {
+			respondWithError(g, http.StatusBadRequest, "Invalid API key ID")
+			return
+		}
+		apiKey, err := repos.RevokeAPIKey(ctx, deps.DBPool, apiKeyId)
+		if err != nil {
+			if errors.Is(err, repos.ErrorAPIKeyNotFound) {
+				respondWithError(g, http.StatusNotFound, "API key not found")
+				return
+			}
+			respondWithError(g, http.StatusInternalServerError, "Failed to revoke API key")
+			return
+		}
+		// Stop accepting the key on this instance right away
+		deps.APIKeys.Invalidate(apiKey.Prefix)
+		logger.FromContext(ctx).Info().
+			Int("apiKeyId", apiKey.ID).
+			Msg("API key revoked")
+		g.JSON(http.StatusOK, models.RevokeAPIKeyResponse{Data: apiKey})
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 
+	"example-server/bulk"
+	"example-server/changefeed"
 	"example-server/dependencies"
+	"example-server/logger"
 	"example-server/models"
 	"example-server/repos"
 )
@@ -23,11 +25,35 @@ func parseQueryParam(g *gin.Context, key string, defaultValue interface{}) inter
 	return defaultValue
 }
 
+// respondWithError writes an error body, including the request ID when set
+func respondWithError(g *gin.Context, code int, errMsg string) {
+	body := gin.H{"error": errMsg}
+	if requestId := logger.RequestIdFromContext(g.Request.Context()); requestId != "" {
+		body["request_id"] = requestId
+	}
+	g.JSON(code, body)
+}
+
+// respondWithBindError reports bodies cut off by middleware.MaxBodySize with
+// 413 and other bind errors with 400 and errMsg
+func respondWithBindError(g *gin.Context, err error, errMsg string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(g, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	respondWithError(g, http.StatusBadRequest, errMsg)
+}
+
 // ITEMS API
 
-func SetupItemsAPIRoutes(router *gin.Engine, deps *dependencies.Dependencies) {
-	itemsRouterGroup := router.Group("/api/items")
+func SetupItemsAPIRoutes(router *gin.Engine, deps *dependencies.Dependencies, middlewares ...gin.HandlerFunc) {
+	itemsRouterGroup := router.Group("/api/items", middlewares...)
 	itemsRouterGroup.GET("/all", HandleGetAllItems(deps))
+	itemsRouterGroup.GET("/export", HandleExportItems(deps))
+	itemsRouterGroup.POST("/import", HandleImportItems(deps))
+	itemsRouterGroup.GET("/stream", HandleStreamItems(deps, bulk.StreamMaxRowsFromEnv()))
+	itemsRouterGroup.GET("/events", HandleItemEvents(deps, changefeed.HeartbeatFromEnv()))
 	itemsRouterGroup.GET("/:id", HandleGetItem(deps))
 	itemsRouterGroup.GET("", HandleGetItems(deps))
 	itemsRouterGroup.POST("", HandleCreateItem(deps))
@@ -37,40 +63,48 @@ func SetupItemsAPIRoutes(router *gin.Engine, deps *dependencies.Dependencies) {
 // @Summary Get All Items
 // @Description Returns all Items.
 // @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Produce json
 // @Param offset query int true "Offset" minimum(0)
 // @Param chunkSize query int true "Chunk size" minimum(1) maximum(20)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
 // @Success 200 {object} models.GetItemsResponse
+// @Failure 400 {object} string "Missing tenant"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
 // @Router /api/items/all [get]
 func HandleGetAllItems(deps *dependencies.Dependencies) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		ctx := g.Request.Context()
 		// Parse query params and validate
 		offsetParam := parseQueryParam(g, "offset", -1)
 		chunkSizeParam := parseQueryParam(g, "chunkSize", -1)
 		offset, offsetOk := offsetParam.(int)
 		chunkSize, chunkSizeOk := chunkSizeParam.(int)
 		if !offsetOk || !chunkSizeOk || offset < 0 || chunkSize < 1 || chunkSize > 20 {
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Msg("Invalid query parameters received on /api/items/all")
-			g.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+			respondWithError(g, http.StatusBadRequest, "Invalid query parameters")
 			return
 		}
-		log.Info().
+		logger.FromContext(ctx).Info().
 			Int("offset", offset).
 			Int("chunkSize", chunkSize).
 			Msg("Fetching all items")
 		// Fetch Items
-		items, err := repos.FetchPaginatedItems(deps.DBPool, offset, chunkSize)
+		items, err := repos.FetchPaginatedItems(ctx, deps.DBPool, offset, chunkSize)
 		if err != nil {
-			log.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Int("offset", offset).
 				Int("chunkSize", chunkSize).
 				Msg("Problem fetching paginated items")
-			g.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query Items"})
+			respondWithError(g, http.StatusInternalServerError, "Failed to query Items")
 			return
 		}
-		log.Info().
+		logger.FromContext(ctx).Info().
 			Int("numItems", len(items)).
 			Msg("Fetched items")
 		// Return response
@@ -82,47 +116,55 @@ func HandleGetAllItems(deps *dependencies.Dependencies) gin.HandlerFunc {
 // @Summary Get Item
 // @Description Returns Item by id.
 // @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Produce json
 // @Param id path int true "Item ID"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
 // @Success 200 {object} models.GetItemResponse
 // @Failure 404 {object} string "Item not found"
+// @Failure 400 {object} string "Missing tenant"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
 // @Router /api/items/{id} [get]
 func HandleGetItem(deps *dependencies.Dependencies) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		ctx := g.Request.Context()
 		// Parse Item ID
 		itemId, err := strconv.Atoi(g.Param("id"))
 		if err != nil {
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Msg("Invalid Item ID received on /api/items/:id")
-			g.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Item ID"})
+			respondWithError(g, http.StatusBadRequest, "Invalid Item ID")
 			return
 		}
-		log.Info().
+		logger.FromContext(ctx).Info().
 			Int("itemId", itemId).
 			Msg("Fetching item by id")
 		// Fetch Item by ID
-		item, err := repos.FetchItemById(deps.DBPool, itemId)
+		item, err := repos.FetchItemById(ctx, deps.DBPool, itemId)
 		if err != nil {
 			if errors.Is(err, repos.ErrorItemNotFound) {
-				log.Warn().
+				logger.FromContext(ctx).Warn().
 					Int("itemId", itemId).
 					Msg("Item not found")
-				g.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+				respondWithError(g, http.StatusNotFound, "Item not found")
 				return
 			}
-			log.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Int("itemId", itemId).
 				Msg("Problem fetching item by id")
-			g.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query Item"})
+			respondWithError(g, http.StatusInternalServerError, "Failed to query Item")
 			return
 		}
 		// Return Item if found otherwise 404
 		if item == nil {
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Int("itemId", itemId).
 				Msg("Item not found")
-			g.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			respondWithError(g, http.StatusNotFound, "Item not found")
 		}
 		g.JSON(http.StatusOK, models.GetItemResponse{Data: item, Meta: struct{}{}})
 	}
@@ -132,13 +174,21 @@ func HandleGetItem(deps *dependencies.Dependencies) gin.HandlerFunc {
 // @Summary Get Items
 // @Description Returns Items by ids. Only returns subset of Items found.
 // @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Accept json
 // @Produce json
 // @Param item_ids query []int true "Item IDs" collectionFormat(multi)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
 // @Success 200 {array} models.GetItemsResponse
+// @Failure 400 {object} string "Missing tenant"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
 // @Router /api/items [get]
 func HandleGetItems(deps *dependencies.Dependencies) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		ctx := g.Request.Context()
 		// Parse Item IDs
 		var itemIds []int
 		var err error
@@ -149,25 +199,25 @@ func HandleGetItems(deps *dependencies.Dependencies) gin.HandlerFunc {
 				itemIds[i], err = strconv.Atoi(itemIdStr)
 				// Handle Item ID parse error
 				if err != nil {
-					log.Warn().
+					logger.FromContext(ctx).Warn().
 						Msg("Invalid Item ID received on /api/items")
-					g.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Item ID"})
+					respondWithError(g, http.StatusBadRequest, "Invalid Item ID")
 					return
 				}
 			}
 		} else {
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Msg("Missing Item IDs received on /api/items")
-			g.JSON(http.StatusBadRequest, gin.H{"error": "Missing Item IDs"})
+			respondWithError(g, http.StatusBadRequest, "Missing Item IDs")
 			return
 		}
 		// Fetch Items by IDs
-		items, err := repos.FetchItemsByIds(deps.DBPool, itemIds)
+		items, err := repos.FetchItemsByIds(ctx, deps.DBPool, itemIds)
 		if err != nil {
-			log.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Msg("Problem fetching items by ids")
-			g.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query Items"})
+			respondWithError(g, http.StatusInternalServerError, "Failed to query Items")
 			return
 		}
 		// Return response
@@ -180,49 +230,55 @@ func HandleGetItems(deps *dependencies.Dependencies) gin.HandlerFunc {
 // @Summary Create Item
 // @Description Creates Item.
 // @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
 // @Accept json
 // @Produce json
 // @Param createItemRequest body models.CreateItemRequest true "Create Item Request"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
 // @Success 201 {object} models.CreateItemResponse
 // @Failure 409 {object} string "Item already exists"
+// @Failure 400 {object} string "Missing tenant"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 413 {object} string "Request body too large"
+// @Failure 429 {object} string "Too many requests"
 // @Router /api/items [post]
 func HandleCreateItem(deps *dependencies.Dependencies) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		ctx := g.Request.Context()
 		// Deserialize request
 		var createItemRequest models.CreateItemRequest
 		if err := g.ShouldBindJSON(&createItemRequest); err != nil {
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Msg("Invalid JSON payload received on /api/items")
-			g.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON payload"})
+			respondWithBindError(g, err, "Invalid JSON payload")
 			return
 		}
 		// Validate request ItemIn data
 		if err := deps.Validator.Struct(createItemRequest.Data); err != nil {
 			// log.Println("Error validating request:", err)
-			log.Warn().
+			logger.FromContext(ctx).Warn().
 				Msg("Invalid Item data payload received on /api/items")
-			g.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Item data payload"})
+			respondWithError(g, http.StatusBadRequest, "Invalid Item data payload")
 			return
 		}
 		// Insert Item
-		item, err := repos.InsertItem(deps.DBPool, createItemRequest.Data)
+		item, err := repos.InsertItem(ctx, deps.DBPool, createItemRequest.Data)
 		// Handle Item insert error
 		if err != nil {
 			if errors.Is(err, repos.ErrorItemExists) {
-				g.JSON(
-					http.StatusConflict,
-					gin.H{"error": "Item already exists"},
-				)
+				respondWithError(g, http.StatusConflict, "Item already exists")
 				return
 			}
-			log.Error().
+			logger.FromContext(ctx).Error().
 				Err(err).
 				Msg("Problem inserting item")
-			g.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create Item"})
+			respondWithError(g, http.StatusInternalServerError, "Failed to create Item")
 			return
 		}
 		// Return response
-		log.Info().
+		logger.FromContext(ctx).Info().
 			Int("itemId", item.ID).
 			Msg("Created item")
 		g.JSON(
@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/bulk"
+	"example-server/dependencies"
+	"example-server/logger"
+	"example-server/models"
+	"example-server/repos"
+)
+
+// exportFlushRows is how many rows an export writes between flushes
+const exportFlushRows = 500
+
+// ExportItems godoc
+// @Summary Export Items
+// @Description Streams all Items as CSV or NDJSON.
+// @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "File format" Enums(csv, ndjson) default(csv)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {string} string "CSV with an id,uuid,created_at,name,price header, or one JSON Item per line"
+// @Failure 400 {object} string "Invalid format"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/items/export [get]
+func HandleExportItems(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		format, err := bulk.ParseFormat(g.DefaultQuery("format", string(bulk.FormatCSV)))
+		if err != nil {
+			logger.FromContext(ctx).Warn().
+				Msg("Invalid format received on /api/items/export")
+			respondWithError(g, http.StatusBadRequest, "Invalid format")
+			return
+		}
+		// Stream Items
+		g.Header("Content-Disposition", `attachment; filename="items.`+string(format)+`"`)
+		numItems, err := writeItemStream(g, format, "Failed to export Items", func(fn func(item *models.Item) error) error {
+			return repos.StreamItems(ctx, deps.DBPool, fn)
+		})
+		if err != nil {
+			logger.FromContext(ctx).Error().
+				Err(err).
+				Int("numItems", numItems).
+				Msg("Problem exporting items")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("numItems", numItems).
+			Str("format", string(format)).
+			Msg("Exported items")
+	}
+}
+
+// StreamItems godoc
+// @Summary Stream Items
+// @Description Streams Items by offset and limit, or by ids, without loading them into memory first. Returns the usual {"data": [...]} envelope, or one JSON Item per line when NDJSON is accepted. A response holds at most STREAM_MAX_ROWS Items; larger limits are capped.
+// @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Produce application/x-ndjson
+// @Param offset query int false "Offset" minimum(0) default(0)
+// @Param limit query int false "Maximum number of Items, capped at STREAM_MAX_ROWS" minimum(1)
+// @Param item_ids query []int false "Item IDs, instead of offset and limit" collectionFormat(multi)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.GetItemsResponse
+// @Failure 400 {object} string "Invalid query parameters"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/items/stream [get]
+func HandleStreamItems(deps *dependencies.Dependencies, maxRows int) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		format := bulk.FormatJSON
+		if g.NegotiateFormat(gin.MIMEJSON, bulk.FormatNDJSON.ContentType()) == bulk.FormatNDJSON.ContentType() {
+			format = bulk.FormatNDJSON
+		}
+		var stream func(fn func(item *models.Item) error) error
+		if itemIdsStrArr, ok := g.GetQueryArray("item_ids"); ok {
+			// Parse Item IDs
+			if len(itemIdsStrArr) > maxRows {
+				logger.FromContext(ctx).Warn().
+					Int("numItemIds", len(itemIdsStrArr)).
+					Msg("Too many Item IDs received on /api/items/stream")
+				respondWithError(g, http.StatusBadRequest, "Too many Item IDs")
+				return
+			}
+			itemIds := make([]int, len(itemIdsStrArr))
+			for i, itemIdStr := range itemIdsStrArr {
+				itemId, err := strconv.Atoi(itemIdStr)
+				if err != nil {
+					logger.FromContext(ctx).Warn().
+						Msg("Invalid Item ID received on /api/items/stream")
+					respondWithError(g, http.StatusBadRequest, "Invalid Item ID")
+					return
+				}
+				itemIds[i] = itemId
+			}
+			stream = func(fn func(item *models.Item) error) error {
+				return repos.StreamItemsByIds(ctx, deps.DBPool, itemIds, fn)
+			}
+		} else {
+			// Parse query params and validate, capping limit at maxRows
+			offset, offsetErr := strconv.Atoi(g.DefaultQuery("offset", "0"))
+			limit, limitErr := strconv.Atoi(g.DefaultQuery("limit", strconv.Itoa(maxRows)))
+			if offsetErr != nil || limitErr != nil || offset < 0 || limit < 1 {
+				logger.FromContext(ctx).Warn().
+					Msg("Invalid query parameters received on /api/items/stream")
+				respondWithError(g, http.StatusBadRequest, "Invalid query parameters")
+				return
+			}
+			limit = min(limit, maxRows)
+			stream = func(fn func(item *models.Item) error) error {
+				return repos.StreamPaginatedItems(ctx, deps.DBPool, offset, limit, fn)
+			}
+		}
+		// Stream Items
+		numItems, err := writeItemStream(g, format, "Failed to query Items", stream)
+		if err != nil {
+			logger.FromContext(ctx).Error().
+				Err(err).
+				Int("numItems", numItems).
+				Msg("Problem streaming items")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("numItems", numItems).
+			Str("format", string(format)).
+			Msg("Streamed items")
+	}
+}
+
+// writeItemStream writes the Items stream yields in format, flushing every
+// exportFlushRows rows. The writers buffer, so errors before the first flush
+// still get a 500 with errMsg; later ones can only cut the response off. A
+// client that went away is logged and not treated as an error.
+func writeItemStream(
+	g *gin.Context,
+	format bulk.Format,
+	errMsg string,
+	stream func(fn func(item *models.Item) error) error,
+) (int, error) {
+	ctx := g.Request.Context()
+	g.Header("Content-Type", format.ContentType())
+	g.Status(http.StatusOK)
+	writer := bulk.NewWriter(g.Writer, format)
+	numItems := 0
+	err := stream(func(item *models.Item) error {
+		if err := writer.Write(item); err != nil {
+			return err
+		}
+		numItems++
+		if numItems%exportFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			g.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil && ctx.Err() != nil {
+		logger.FromContext(ctx).Info().
+			Err(err).
+			Int("numItems", numItems).
+			Msg("Client went away while streaming items")
+		return numItems, nil
+	}
+	if err != nil && !g.Writer.Written() {
+		g.Writer.Header().Del("Content-Disposition")
+		g.Writer.Header().Del("Content-Type")
+		respondWithError(g, http.StatusInternalServerError, errMsg)
+	}
+	return numItems, err
+}
+
+// ImportItems godoc
+// @Summary Import Items
+// @Description Loads Items from CSV (with name and price columns) or NDJSON, as sent by Content-Type. Existing names are updated, or left alone with on_conflict=skip. Invalid rows are reported by line and do not stop the import.
+// @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param file body string true "CSV or NDJSON file"
+// @Param on_conflict query string false "What to do with existing names" Enums(update, skip) default(update)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.ImportItemsResponse
+// @Failure 400 {object} string "Invalid import file"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 413 {object} string "Request body too large"
+// @Failure 415 {object} string "Unsupported import format"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/items/import [post]
+func HandleImportItems(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		format, err := bulk.FormatFromContentType(g.GetHeader("Content-Type"))
+		if err != nil {
+			logger.FromContext(ctx).Warn().
+				Str("content_type", g.GetHeader("Content-Type")).
+				Msg("Unsupported import format received on /api/items/import")
+			respondWithError(g, http.StatusUnsupportedMediaType, "Unsupported import format")
+			return
+		}
+		onConflict, err := bulk.ParseOnConflict(g.DefaultQuery("on_conflict", string(bulk.OnConflictUpdate)))
+		if err != nil {
+			logger.FromContext(ctx).Warn().
+				Msg("Invalid on_conflict received on /api/items/import")
+			respondWithError(g, http.StatusBadRequest, "Invalid on_conflict")
+			return
+		}
+		// Read rows, keeping invalid ones for the report
+		rows, rowErrors, err := bulk.ReadItems(g.Request.Body, format)
+		if err != nil {
+			logger.FromContext(ctx).Warn().
+				Err(err).
+				Msg("Invalid import file received on /api/items/import")
+			respondWithBindError(g, err, "Invalid import file")
+			return
+		}
+		// Import Items
+		report, err := repos.ImportItems(ctx, deps.DBPool, rows, onConflict)
+		if err != nil {
+			logger.FromContext(ctx).Error().
+				Err(err).
+				Int("numRows", len(rows)).
+				Msg("Problem importing items")
+			respondWithError(g, http.StatusInternalServerError, "Failed to import Items")
+			return
+		}
+		report.Errors = rowErrors
+		logger.FromContext(ctx).Info().
+			Int("inserted", report.Inserted).
+			Int("updated", report.Updated).
+			Int("skipped", report.Skipped).
+			Int("errors", len(report.Errors)).
+			Msg("Imported items")
+		g.JSON(http.StatusOK, models.ImportItemsResponse{Data: report, Meta: struct{}{}})
+	}
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"example-server/changefeed"
+	"example-server/dependencies"
+	"example-server/logger"
+	"example-server/tenant"
+)
+
+// ItemEvents godoc
+// @Summary Item Events
+// @Description Streams Item changes as Server-Sent Events named created, updated or deleted, with the Item ID and tenant as data. Event IDs can be sent back as Last-Event-ID to resume; when the events since then are no longer buffered a reset event is sent first, after which Items should be fetched again. Idle streams get a heartbeat comment every EVENTS_HEARTBEAT_INTERVAL.
+// @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce text/event-stream
+// @Param item_ids query []int false "Only stream changes to these Items" collectionFormat(multi)
+// @Param Last-Event-ID header string false "ID of the last event received"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} changefeed.Event
+// @Failure 400 {object} string "Invalid Item ID"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
+// @Failure 503 {object} string "Item events unavailable"
+// @Router /api/items/events [get]
+func HandleItemEvents(deps *dependencies.Dependencies, heartbeat time.Duration) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		if deps.Changes == nil {
+			respondWithError(g, http.StatusServiceUnavailable, "Item events unavailable")
+			return
+		}
+		// Parse Item IDs
+		var itemIds map[int]bool
+		if itemIdsStrArr, ok := g.GetQueryArray("item_ids"); ok {
+			itemIds = make(map[int]bool, len(itemIdsStrArr))
+			for _, itemIdStr := range itemIdsStrArr {
+				itemId, err := strconv.Atoi(itemIdStr)
+				if err != nil {
+					logger.FromContext(ctx).Warn().
+						Msg("Invalid Item ID received on /api/items/events")
+					respondWithError(g, http.StatusBadRequest, "Invalid Item ID")
+					return
+				}
+				itemIds[itemId] = true
+			}
+		}
+		// Subscribe, resuming after Last-Event-ID when sent
+		tenantID, _ := tenant.FromContext(ctx)
+		var subscription *changefeed.Subscription
+		complete := true
+		if lastEventId := g.GetHeader("Last-Event-ID"); lastEventId != "" {
+			seq, ok := deps.Changes.ParseEventID(lastEventId)
+			subscription, complete = deps.Changes.SubscribeAfter(tenantID, seq)
+			complete = complete && ok
+		} else {
+			subscription = deps.Changes.Subscribe(tenantID)
+		}
+		defer subscription.Close()
+		// Stream events
+		g.Header("Content-Type", sse.ContentType)
+		g.Header("Cache-Control", "no-cache")
+		g.Header("X-Accel-Buffering", "no")
+		g.Status(http.StatusOK)
+		if !complete {
+			g.Render(-1, sse.Event{Event: "reset", Data: "{}"})
+		}
+		g.Writer.Flush()
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		numEvents := 0
+		g.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ticker.C:
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err == nil
+			case event, ok := <-subscription.Events():
+				if !ok {
+					logger.FromContext(ctx).Warn().
+						Err(subscription.Err()).
+						Int("numEvents", numEvents).
+						Msg("Item event stream ended")
+					return false
+				}
+				if itemIds != nil && !itemIds[event.ID] {
+					return true
+				}
+				numEvents++
+				g.Render(-1, sse.Event{
+					Id:    deps.Changes.EventID(event),
+					Event: string(event.Op),
+					Data:  event,
+				})
+				return true
+			}
+		})
+		logger.FromContext(ctx).Info().
+			Int("numEvents", numEvents).
+			Msg("Streamed item events")
+	}
+}
@@ -1,11 +1,11 @@
 package routes
 
 import (
+	"example-server/logger"
 	"example-server/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/rs/zerolog/log"
 )
 
 // Status godoc
@@ -16,7 +16,7 @@ import (
 // @Success 200 {object} models.StatusResponse
 // @Router /status [get]
 func HandleStatus(g *gin.Context) {
-	log.Info().Msg("Request to /status")
+	logger.FromContext(g.Request.Context()).Info().Msg("Request to /status")
 	status := models.StatusResponse{
 		Status: "ok",
 	}
@@ -0,0 +1,330 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/dependencies"
+	"example-server/logger"
+	"example-server/models"
+	"example-server/repos"
+	"example-server/webhook"
+)
+
+// Webhook delivery log page sizes
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 100
+)
+
+// WEBHOOKS API
+
+func SetupWebhooksAPIRoutes(router *gin.Engine, deps *dependencies.Dependencies, middlewares ...gin.HandlerFunc) {
+	webhooksRouterGroup := router.Group("/api/webhooks", middlewares...)
+	webhooksRouterGroup.POST("", HandleCreateWebhook(deps))
+	webhooksRouterGroup.GET("", HandleGetWebhooks(deps))
+	webhooksRouterGroup.GET("/:id", HandleGetWebhook(deps))
+	webhooksRouterGroup.PUT("/:id", HandleUpdateWebhook(deps))
+	webhooksRouterGroup.DELETE("/:id", HandleDeleteWebhook(deps))
+	webhooksRouterGroup.GET("/:id/deliveries", HandleGetWebhookDeliveries(deps))
+	webhooksRouterGroup.POST("/:id/deliveries/:deliveryId/retry", HandleRetryWebhookDelivery(deps))
+}
+
+// parseWebhookId answers 400 when the :id parameter is not a number
+func parseWebhookId(g *gin.Context) (int, bool) {
+	subscriptionId, err := strconv.Atoi(g.Param("id"))
+	if err != nil {
+		respondWithError(g, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return subscriptionId, true
+}
+
+// respondWithWebhookError maps repos errors, logging unexpected ones
+func respondWithWebhookError(g *gin.Context, err error, errMsg string) {
+	switch {
+	case errors.Is(err, repos.ErrorWebhookNotFound):
+		respondWithError(g, http.StatusNotFound, "Webhook not found")
+	case errors.Is(err, repos.ErrorWebhookDeliveryNotFound):
+		respondWithError(g, http.StatusNotFound, "Webhook delivery not found")
+	case errors.Is(err, repos.ErrorWebhookDeliveryDelivered):
+		respondWithError(g, http.StatusConflict, "Webhook delivery already delivered")
+	default:
+		logger.FromContext(g.Request.Context()).Error().Err(err).Msg(errMsg)
+		respondWithError(g, http.StatusInternalServerError, errMsg)
+	}
+}
+
+// CreateWebhook godoc
+// @Summary Create Webhook
+// @Description Subscribes a URL to Item events of the tenant. The signing secret is only returned in this response.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param createWebhookRequest body models.CreateWebhookRequest true "Create Webhook Request"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 201 {object} models.CreateWebhookResponse
+// @Failure 400 {object} string "Invalid webhook data"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 413 {object} string "Request body too large"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks [post]
+func HandleCreateWebhook(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		// Parse and validate request
+		var createWebhookRequest models.CreateWebhookRequest
+		if err := g.ShouldBindJSON(&createWebhookRequest); err != nil {
+			respondWithBindError(g, err, "Invalid JSON payload")
+			return
+		}
+		if err := deps.Validator.Struct(createWebhookRequest.Data); err != nil {
+			respondWithError(g, http.StatusBadRequest, "Invalid webhook data")
+			return
+		}
+		// Generate the signing secret
+		secret, err := webhook.GenerateSecret()
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error generating webhook secret")
+			respondWithError(g, http.StatusInternalServerError, "Failed to create webhook")
+			return
+		}
+		subscription, err := repos.InsertWebhookSubscription(ctx, deps.DBPool, secret, createWebhookRequest.Data)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to create webhook")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("webhookId", subscription.ID).
+			Msg("Webhook created")
+		g.JSON(http.StatusCreated, models.CreateWebhookResponse{Data: subscription, Secret: secret})
+	}
+}
+
+// GetWebhooks godoc
+// @Summary Get Webhooks
+// @Description Returns the webhooks of the tenant without their secrets.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.GetWebhooksResponse
+// @Failure 400 {object} string "Missing tenant"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks [get]
+func HandleGetWebhooks(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		subscriptions, err := repos.FetchWebhookSubscriptions(g.Request.Context(), deps.DBPool)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to query webhooks")
+			return
+		}
+		g.JSON(http.StatusOK, models.GetWebhooksResponse{Data: subscriptions})
+	}
+}
+
+// GetWebhook godoc
+// @Summary Get Webhook
+// @Description Returns a webhook by id without its secret.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.WebhookResponse
+// @Failure 400 {object} string "Invalid webhook ID"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Webhook not found"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks/{id} [get]
+func HandleGetWebhook(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		subscriptionId, ok := parseWebhookId(g)
+		if !ok {
+			return
+		}
+		subscription, err := repos.FetchWebhookSubscriptionById(g.Request.Context(), deps.DBPool, subscriptionId)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to query webhook")
+			return
+		}
+		g.JSON(http.StatusOK, models.WebhookResponse{Data: subscription})
+	}
+}
+
+// UpdateWebhook godoc
+// @Summary Update Webhook
+// @Description Replaces the URL, events and active flag of a webhook, keeping its secret.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param updateWebhookRequest body models.UpdateWebhookRequest true "Update Webhook Request"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.WebhookResponse
+// @Failure 400 {object} string "Invalid webhook data"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Webhook not found"
+// @Failure 413 {object} string "Request body too large"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks/{id} [put]
+func HandleUpdateWebhook(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		subscriptionId, ok := parseWebhookId(g)
+		if !ok {
+			return
+		}
+		var updateWebhookRequest models.UpdateWebhookRequest
+		if err := g.ShouldBindJSON(&updateWebhookRequest); err != nil {
+			respondWithBindError(g, err, "Invalid JSON payload")
+			return
+		}
+		if err := deps.Validator.Struct(updateWebhookRequest.Data); err != nil {
+			respondWithError(g, http.StatusBadRequest, "Invalid webhook data")
+			return
+		}
+		subscription, err := repos.UpdateWebhookSubscription(ctx, deps.DBPool, subscriptionId, updateWebhookRequest.Data)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to update webhook")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("webhookId", subscription.ID).
+			Msg("Webhook updated")
+		g.JSON(http.StatusOK, models.WebhookResponse{Data: subscription})
+	}
+}
+
+// DeleteWebhook godoc
+// @Summary Delete Webhook
+// @Description Deletes a webhook and its delivery log; pending deliveries are not sent.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.WebhookResponse
+// @Failure 400 {object} string "Invalid webhook ID"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Webhook not found"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks/{id} [delete]
+func HandleDeleteWebhook(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		subscriptionId, ok := parseWebhookId(g)
+		if !ok {
+			return
+		}
+		subscription, err := repos.DeleteWebhookSubscription(ctx, deps.DBPool, subscriptionId)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to delete webhook")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("webhookId", subscription.ID).
+			Msg("Webhook deleted")
+		g.JSON(http.StatusOK, models.WebhookResponse{Data: subscription})
+	}
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get Webhook Deliveries
+// @Description Returns the delivery log of a webhook, newest first: status, attempts and the last response or error.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param limit query int false "Deliveries to return" minimum(1) maximum(100) default(50)
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.GetWebhookDeliveriesResponse
+// @Failure 400 {object} string "Invalid limit"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Webhook not found"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks/{id}/deliveries [get]
+func HandleGetWebhookDeliveries(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		subscriptionId, ok := parseWebhookId(g)
+		if !ok {
+			return
+		}
+		limit := defaultDeliveriesLimit
+		if limitStr, ok := g.GetQuery("limit"); ok {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+				respondWithError(g, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+		}
+		deliveries, err := repos.FetchWebhookDeliveries(g.Request.Context(), deps.DBPool, subscriptionId, limit)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to query webhook deliveries")
+			return
+		}
+		g.JSON(http.StatusOK, models.GetWebhookDeliveriesResponse{Data: deliveries})
+	}
+}
+
+// RetryWebhookDelivery godoc
+// @Summary Retry Webhook Delivery
+// @Description Sends a dead or pending delivery again right away, with a fresh set of attempts.
+// @Tags webhooks
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param deliveryId path int true "Delivery ID"
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 200 {object} models.WebhookDeliveryResponse
+// @Failure 400 {object} string "Invalid delivery ID"
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 404 {object} string "Webhook delivery not found"
+// @Failure 409 {object} string "Webhook delivery already delivered"
+// @Failure 429 {object} string "Too many requests"
+// @Router /api/webhooks/{id}/deliveries/{deliveryId}/retry [post]
+func HandleRetryWebhookDelivery(deps *dependencies.Dependencies) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		subscriptionId, ok := parseWebhookId(g)
+		if !ok {
+			return
+		}
+		deliveryId, err := strconv.ParseInt(g.Param("deliveryId"), 10, 64)
+		if err != nil {
+			respondWithError(g, http.StatusBadRequest, "Invalid delivery ID")
+			return
+		}
+		delivery, err := repos.RetryWebhookDelivery(ctx, deps.DBPool, subscriptionId, deliveryId)
+		if err != nil {
+			respondWithWebhookError(g, err, "Failed to retry webhook delivery")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("webhookId", subscriptionId).
+			Int64("deliveryId", deliveryId).
+			Msg("Webhook delivery retried")
+		g.JSON(http.StatusOK, models.WebhookDeliveryResponse{Data: delivery})
+	}
+}
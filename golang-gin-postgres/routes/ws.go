@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"example-server/dependencies"
+	"example-server/logger"
+	"example-server/tenant"
+	"example-server/ws"
+)
+
+// WEBSOCKET API
+
+func SetupWebSocketRoutes(router *gin.Engine, deps *dependencies.Dependencies, middlewares ...gin.HandlerFunc) {
+	wsRouterGroup := router.Group("/ws", middlewares...)
+	wsRouterGroup.GET("", HandleWebSocket(deps, ws.ConfigFromEnv()))
+}
+
+// WebSocket godoc
+// @Summary Item WebSocket
+// @Description Upgrades to a WebSocket pushing the changes to subscribed Items. Clients send JSON messages {"type": "subscribe" | "unsubscribe", "id": "1", "item_ids": [1, 2]}, answered with the same type and the Items now subscribed to, or {"type": "ping"}, answered with a pong. Changes arrive as {"type": "event", "event": {"op": "updated", "id": 1, "tenant_id": "acme"}} and rejected requests as {"type": "error", "id": "1", "error": "..."}. Clients more than WS_SEND_BUFFER messages behind are disconnected with close code 1008.
+// @Tags items
+// @Security BearerAuth
+// @Security APIKeyAuth
+// @Param X-Tenant-ID header string false "Tenant, required when the credentials carry none"
+// @Success 101 {object} ws.Message
+// @Failure 401 {object} string "Unauthorized"
+// @Failure 403 {object} string "Forbidden"
+// @Failure 426 {object} string "WebSocket upgrade required"
+// @Failure 429 {object} string "Too many requests"
+// @Failure 503 {object} string "Item events unavailable"
+// @Router /ws [get]
+func HandleWebSocket(deps *dependencies.Dependencies, config ws.Config) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		ctx := g.Request.Context()
+		if !websocket.IsWebSocketUpgrade(g.Request) {
+			g.Header("Upgrade", "websocket")
+			respondWithError(g, http.StatusUpgradeRequired, "WebSocket upgrade required")
+			return
+		}
+		if deps.Changes == nil {
+			respondWithError(g, http.StatusServiceUnavailable, "Item events unavailable")
+			return
+		}
+		tenantID, _ := tenant.FromContext(ctx)
+		logger.FromContext(ctx).Info().Msg("WebSocket connected")
+		if err := ws.Serve(g.Writer, g.Request, deps.Changes, tenantID, config); err != nil {
+			logger.FromContext(ctx).Warn().Err(err).Msg("WebSocket closed")
+			return
+		}
+		logger.FromContext(ctx).Info().Msg("WebSocket closed")
+	}
+}
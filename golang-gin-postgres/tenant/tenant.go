@@ -0,0 +1,65 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Header names the tenant for cross-tenant callers, whose credentials carry
+// none
+const Header = "X-Tenant-ID"
+
+var (
+	ErrorMissingTenant  = errors.New("missing tenant")
+	ErrorInvalidTenant  = errors.New("invalid tenant")
+	ErrorTenantMismatch = errors.New("tenant does not match credentials")
+	ErrorTenantRequired = errors.New("credentials are not bound to a tenant")
+)
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Resolve picks the tenant of a request: the one bound to the credentials,
+// else the X-Tenant-ID header when the credentials are allowed to act on
+// any tenant. A header naming another tenant than the credentials is
+// rejected rather than ignored, as are tenant-less credentials that aren't
+// cross-tenant.
+func Resolve(credentialTenant, headerTenant string, crossTenant bool) (string, error) {
+	tenantID := credentialTenant
+	switch {
+	case tenantID == "" && !crossTenant:
+		return "", ErrorTenantRequired
+	case tenantID == "":
+		tenantID = headerTenant
+	case headerTenant != "" && headerTenant != credentialTenant:
+		return "", ErrorTenantMismatch
+	}
+	if tenantID == "" {
+		return "", ErrorMissingTenant
+	}
+	if err := Validate(tenantID); err != nil {
+		return "", err
+	}
+	return tenantID, nil
+}
+
+// Validate checks that tenantID is a well-formed tenant ID
+func Validate(tenantID string) error {
+	if !idPattern.MatchString(tenantID) {
+		return errors.Wrapf(ErrorInvalidTenant, "%q", tenantID)
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+func NewContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// FromContext returns the tenant resolved for the request, if any
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
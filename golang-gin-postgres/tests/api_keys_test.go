@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v3"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/routes"
+	"example-server/tenant"
+)
+
+// HELPERS
+
+func getMockAPIKey(t *testing.T) (string, models.APIKey) {
+	t.Helper()
+	key, prefix, keyHash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %s", err)
+	}
+	return key, models.APIKey{
+		ID:        1,
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Owner:     "billing-service",
+		TenantID:  mockTenant,
+		Scopes:    []string{"items:read"},
+		CreatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func getMockAPIKeyRows(mockDBPool pgxmock.PgxPoolIface, apiKeys ...models.APIKey) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{
+		"id", "prefix", "key_hash", "owner", "tenant_id", "scopes", "created_at", "last_used_at", "expires_at", "revoked_at",
+	})
+	for _, apiKey := range apiKeys {
+		rows.AddRow(
+			apiKey.ID, apiKey.Prefix, apiKey.KeyHash, apiKey.Owner, apiKey.TenantID, apiKey.Scopes,
+			apiKey.CreatedAt, apiKey.LastUsedAt, apiKey.ExpiresAt, apiKey.RevokedAt,
+		)
+	}
+	return rows
+}
+
+func expectAPIKeyLookup(mockDBPool pgxmock.PgxPoolIface, apiKey models.APIKey) {
+	mockDBPool.ExpectQuery("SELECT (.+) FROM api_keys WHERE prefix = (.+)").
+		WithArgs(apiKey.Prefix).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	mockDBPool.ExpectExec("UPDATE api_keys SET last_used_at = (.+) WHERE id = (.+)").
+		WithArgs(apiKey.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+}
+
+// TESTS
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, keyHash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if !strings.HasPrefix(key, "ek_"+prefix+"_") {
+		t.Errorf("Expected key to start with ek_%s_, but got %s", prefix, key)
+	}
+	if string(keyHash) != string(auth.HashAPIKey(key)) || strings.Contains(string(keyHash), key) {
+		t.Errorf("Expected stored hash to be the key hash")
+	}
+}
+
+func TestAPIKeyAuthenticatorCachesLookups(t *testing.T) {
+	// setup mock dependencies and a single DB lookup
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	// authenticate twice, the second time from the cache
+	for i := 0; i < 2; i++ {
+		principal, err := deps.APIKeys.Authenticate(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+		if principal.Method != auth.MethodAPIKey || principal.Subject != "billing-service" || !principal.HasScope("items:read") {
+			t.Errorf("Expected API key principal for billing-service, but got %+v", principal)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAPIKeyAuthenticatorRejectsInvalidKeys(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	key, apiKey := getMockAPIKey(t)
+	revoked, expired := apiKey, apiKey
+	revoked.RevokedAt = &past
+	expired.ExpiresAt = &past
+	testCases := map[string]struct {
+		key    string
+		apiKey *models.APIKey
+	}{
+		"malformed":    {key: "not-a-key"},
+		"unknown":      {key: key},
+		"wrong secret": {key: key[:len(key)-4] + "AAAA", apiKey: &apiKey},
+		"revoked":      {key: key, apiKey: &revoked},
+		"expired":      {key: key, apiKey: &expired},
+	}
+	for name, tc := range testCases {
+		deps, mockDBPool := getMockDependencies()
+		if tc.apiKey != nil {
+			expectAPIKeyLookup(mockDBPool, *tc.apiKey)
+		} else if name != "malformed" {
+			mockDBPool.ExpectQuery("SELECT (.+) FROM api_keys WHERE prefix = (.+)").
+				WithArgs(apiKey.Prefix).
+				WillReturnRows(getMockAPIKeyRows(mockDBPool))
+		}
+		if _, err := deps.APIKeys.Authenticate(context.Background(), tc.key); !errors.Is(err, auth.ErrorInvalidAPIKey) {
+			t.Errorf("Expected %s key to be rejected with %s, but got %v", name, auth.ErrorInvalidAPIKey, err)
+		}
+	}
+}
+
+func TestItemsAPIAcceptsAPIKey(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]}))
+	mockDBPool.ExpectCommit()
+	// exec request
+	r := gin.New()
+	routes.SetupItemsAPIRoutes(r, deps, middleware.Authenticate(getMockVerifier(t, getMockKeys(t)), deps.APIKeys), middleware.Tenant())
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{middleware.APIKeyHeader: key})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	// assert an invalid key is rejected
+	w = performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{middleware.APIKeyHeader: "not-a-key"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAPIKeyIsBoundToItsTenant(t *testing.T) {
+	// setup mock dependencies with a key bound to tenant-b
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	apiKey.TenantID = "tenant-b"
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	// item 1 belongs to tenant-a, so the key's scoped query finds nothing
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockRows(mockDBPool, nil))
+	mockDBPool.ExpectRollback()
+	r := gin.New()
+	routes.SetupItemsAPIRoutes(r, deps, middleware.Authenticate(getMockVerifier(t, getMockKeys(t)), deps.APIKeys), middleware.Tenant())
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{middleware.APIKeyHeader: key})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	// assert the header cannot move the key to another tenant
+	w = performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		middleware.APIKeyHeader: key,
+		tenant.Header:           mockTenant,
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminCreateAPIKeyShowsKeyOnce(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	_, apiKey := getMockAPIKey(t)
+	mockDBPool.ExpectQuery("INSERT INTO api_keys (.+) VALUES (.+) RETURNING (.+)").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), "billing-service", mockTenant, []string{"items:read"}, (*time.Time)(nil)).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM api_keys ORDER BY id").
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	r := gin.New()
+	routes.SetupAdminRoutes(r, deps, mockAdminToken)
+	// exec create request
+	w := performAdminRequest(r, "POST", "/admin/apikeys", mockAdminToken, `{"data":{"owner":"billing-service","tenant_id":"`+mockTenant+`","scopes":["items:read"]}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"key":"ek_`) || strings.Contains(w.Body.String(), "key_hash") {
+		t.Errorf("Expected the key and no hash in the response, but got %s", w.Body.String())
+	}
+	// exec list request
+	w = performAdminRequest(r, "GET", "/admin/apikeys", mockAdminToken, "")
+	expectedBody := `{"data":[{"id":1,"prefix":"` + apiKey.Prefix + `","owner":"billing-service","tenant_id":"` + mockTenant + `","scopes":["items:read"],"created_at":"2021-01-01T00:00:00Z","last_used_at":null,"expires_at":null,"revoked_at":null}]}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminCreateAPIKeyRequiresOwnerAndTenant(t *testing.T) {
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	routes.SetupAdminRoutes(r, deps, mockAdminToken)
+	for _, body := range []string{
+		`{"data":{"tenant_id":"tenant-a","scopes":["items:read"]}}`,
+		`{"data":{"owner":"billing-service","scopes":["items:read"]}}`,
+		`{"data":{"owner":"billing-service","tenant_id":"tenant a","scopes":["items:read"]}}`,
+	} {
+		w := performAdminRequest(r, "POST", "/admin/apikeys", mockAdminToken, body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
+
+func TestAdminRevokeAPIKey(t *testing.T) {
+	// setup mock dependencies with a cached key
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	if _, err := deps.APIKeys.Authenticate(context.Background(), key); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	revoked := apiKey
+	revokedAt := time.Now()
+	revoked.RevokedAt = &revokedAt
+	mockDBPool.ExpectQuery("UPDATE api_keys SET revoked_at = (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(1).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, revoked))
+	mockDBPool.ExpectQuery("UPDATE api_keys SET revoked_at = (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(2).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool))
+	expectAPIKeyLookup(mockDBPool, revoked)
+	r := gin.New()
+	routes.SetupAdminRoutes(r, deps, mockAdminToken)
+	// exec revoke requests
+	if w := performAdminRequest(r, "DELETE", "/admin/apikeys/1", mockAdminToken, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if w := performAdminRequest(r, "DELETE", "/admin/apikeys/2", mockAdminToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	// assert the revoked key is looked up again and rejected
+	if _, err := deps.APIKeys.Authenticate(context.Background(), key); !errors.Is(err, auth.ErrorInvalidAPIKey) {
+		t.Errorf("Expected revoked key to be rejected, but got %v", err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"example-server/dependencies"
 	"example-server/models"
 	"example-server/routes"
+	"example-server/tenant"
 )
 
 // MOCKS
@@ -23,6 +24,7 @@ import (
 const (
 	mockRecord1 = "mockRecord1"
 	mockRecord2 = "mockRecord2"
+	mockTenant  = "tenant-a"
 )
 
 var mockRecords = map[string]models.Item{
@@ -53,6 +55,8 @@ func getMockDependencies() (*dependencies.Dependencies, pgxmock.PgxPoolIface) {
 	deps := dependencies.NewDependencies(
 		validator.New(),
 		mockDBPool,
+		nil,
+		nil,
 	)
 	return deps, mockDBPool
 }
@@ -72,6 +76,36 @@ func getMockRows(mockDBPool pgxmock.PgxPoolIface, items []models.Item) *pgxmock.
 	return rows
 }
 
+// withMockTenant scopes requests to mockTenant as the Tenant middleware would
+func withMockTenant(g *gin.Context) {
+	g.Request = g.Request.WithContext(tenant.NewContext(g.Request.Context(), mockTenant))
+}
+
+// expectTenantTx expects the transaction and tenant setting every Item query runs in
+func expectTenantTx(mockDBPool pgxmock.PgxPoolIface, tenantID string) {
+	mockDBPool.ExpectBegin()
+	mockDBPool.ExpectExec("SELECT set_config\\('app.tenant_id', (.+), true\\)").
+		WithArgs(tenantID).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+}
+
+// expectWebhookEnqueue expects the webhook deliveries written along with an
+// Item change
+func expectWebhookEnqueue(mockDBPool pgxmock.PgxPoolIface, tenantID, event string) {
+	mockDBPool.ExpectExec("INSERT INTO webhook_deliveries (.+) SELECT (.+) FROM webhook_subscriptions").
+		WithArgs(tenantID, event, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+}
+
+// expectItemChange expects what an Item change writes in its transaction:
+// webhook deliveries and the outbox event
+func expectItemChange(mockDBPool pgxmock.PgxPoolIface, tenantID, event string) {
+	expectWebhookEnqueue(mockDBPool, tenantID, event)
+	mockDBPool.ExpectExec("INSERT INTO outbox (.+) VALUES (.+)").
+		WithArgs(tenantID, "item", pgxmock.AnyArg(), event, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
 func performRequest(r http.Handler, method string, path string, body ...string) *httptest.ResponseRecorder {
 	var req *http.Request
 	if len(body) > 0 {
@@ -118,11 +152,14 @@ func TestGetAllItems200(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]})
-	mockDBPool.ExpectQuery("SELECT (.+) FROM item ORDER BY id OFFSET (.+) LIMIT (.)").
-		WithArgs(0, 2).
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
 		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/all", routes.HandleGetAllItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/all?offset=0&chunkSize=2")
@@ -146,11 +183,14 @@ func TestGetAllItems200Empty(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, nil)
-	mockDBPool.ExpectQuery("SELECT (.+) FROM item ORDER BY id OFFSET (.+) LIMIT (.)").
-		WithArgs(0, 2).
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
 		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/all", routes.HandleGetAllItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/all?offset=0&chunkSize=2")
@@ -218,11 +258,14 @@ func TestGetAllItems400MissingQueryParams(t *testing.T) {
 func TestGetAllItems500PostgresError(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
-	mockDBPool.ExpectQuery("SELECT (.+) FROM item ORDER BY id OFFSET (.+) LIMIT (.)").
-		WithArgs(0, 2).
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
 		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/all", routes.HandleGetAllItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/all?offset=0&chunkSize=2")
@@ -237,11 +280,14 @@ func TestGetItem200(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]})
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
-		WithArgs(1).
+		WithArgs(1, mockTenant).
 		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/:id", routes.HandleGetItem(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/1")
@@ -265,11 +311,14 @@ func TestGetItem404(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, []models.Item{})
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
-		WithArgs(1).
+		WithArgs(1, mockTenant).
 		WillReturnRows(rows)
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/:id", routes.HandleGetItem(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/1")
@@ -312,11 +361,14 @@ func TestGetItem400(t *testing.T) {
 func TestGetItem500PostgresError(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
-		WithArgs(1).
+		WithArgs(1, mockTenant).
 		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items/:id", routes.HandleGetItem(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items/1")
@@ -331,11 +383,14 @@ func TestGetItems200(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]})
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = ANY(.+)").
-		WithArgs([]int{1, 2}).
+		WithArgs([]int{1, 2}, mockTenant).
 		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items", routes.HandleGetItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items?item_ids=1&item_ids=2")
@@ -359,11 +414,14 @@ func TestGetItems200Empty(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	rows := getMockRows(mockDBPool, nil)
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = ANY(.+)").
-		WithArgs([]int{1, 2}).
+		WithArgs([]int{1, 2}, mockTenant).
 		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items", routes.HandleGetItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items?item_ids=1&item_ids=2")
@@ -426,11 +484,14 @@ func TestGetItems400InvalidItemIds(t *testing.T) {
 func TestGetItems500PostgresError(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = ANY(.+)").
-		WithArgs([]int{1, 2}).
+		WithArgs([]int{1, 2}, mockTenant).
 		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.GET("/api/items", routes.HandleGetItems(deps))
 	// exec request
 	w := performRequest(r, "GET", "/api/items?item_ids=1&item_ids=2")
@@ -446,14 +507,18 @@ func TestCreateItem201(t *testing.T) {
 	deps, mockDBPool := getMockDependencies()
 	mockCreateRecord := mockRecords[mockRecord1]
 	rows := getMockRows(mockDBPool, []models.Item{mockCreateRecord})
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
-		WithArgs(mockCreateRecord.Name, mockCreateRecord.Price).
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
 		WillReturnRows(mockDBPool.NewRows([]string{"id"}).AddRow(mockCreateRecord.ID))
 	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
-		WithArgs(mockCreateRecord.ID).
+		WithArgs(mockCreateRecord.ID, mockTenant).
 		WillReturnRows(rows)
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+	mockDBPool.ExpectCommit()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.POST("/api/items", routes.HandleCreateItem(deps))
 	// exec request
 	createItemRequest := models.CreateItemRequest{
@@ -521,11 +586,14 @@ func TestCreateItem409Duplicate(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	mockCreateRecord := mockRecords[mockRecord1]
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
-		WithArgs(mockCreateRecord.Name, mockCreateRecord.Price).
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
 		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.POST("/api/items", routes.HandleCreateItem(deps))
 	// exec request
 	createItemRequest := models.CreateItemRequest{
@@ -547,11 +615,14 @@ func TestCreateItem500PostgresError(t *testing.T) {
 	// setup mock dependencies and DB query expectations
 	deps, mockDBPool := getMockDependencies()
 	mockCreateRecord := mockRecords[mockRecord1]
+	expectTenantTx(mockDBPool, mockTenant)
 	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
-		WithArgs(mockCreateRecord.Name, mockCreateRecord.Price).
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
 		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
 	// setup router
 	r := gin.Default()
+	r.Use(withMockTenant)
 	r.POST("/api/items", routes.HandleCreateItem(deps))
 	// exec request
 	createItemRequest := models.CreateItemRequest{
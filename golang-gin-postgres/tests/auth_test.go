@@ -0,0 +1,335 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/routes"
+)
+
+const (
+	mockIssuer     = "https://issuer.example.com"
+	mockAudience   = "items-api"
+	mockHMACSecret = "test-secret"
+)
+
+// HELPERS
+
+type mockKeys struct {
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func getMockKeys(t *testing.T) mockKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %s", err)
+	}
+	return mockKeys{rsaKey: rsaKey, ecKey: ecKey}
+}
+
+// jwks renders the public keys as a JWKS document with kids "rsa" and "ec"
+func (k mockKeys) jwks() []byte {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set := map[string]interface{}{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+			"n": b64(k.rsaKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(k.rsaKey.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec", "use": "sig", "alg": "ES256", "crv": "P-256",
+			"x": b64(k.ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(k.ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}}
+	data, _ := json.Marshal(set)
+	return data
+}
+
+func getMockClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":       "user-1",
+		"iss":       mockIssuer,
+		"aud":       mockAudience,
+		"exp":       now.Add(time.Hour).Unix(),
+		"nbf":       now.Add(-time.Minute).Unix(),
+		"scope":     "items:read items:write",
+		"tenant_id": mockTenant,
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %s", err)
+	}
+	return signed
+}
+
+func getMockVerifier(t *testing.T, keys mockKeys) *auth.Verifier {
+	t.Helper()
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, keys.jwks(), 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %s", err)
+	}
+	verifier, err := auth.NewVerifier(context.Background(), auth.Config{
+		HMACSecret: []byte(mockHMACSecret),
+		JWKSFile:   jwksFile,
+		Issuer:     mockIssuer,
+		Audience:   mockAudience,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	return verifier
+}
+
+// TESTS
+
+func TestVerifierAcceptsSupportedAlgorithms(t *testing.T) {
+	keys := getMockKeys(t)
+	verifier := getMockVerifier(t, keys)
+	tokens := map[string]string{
+		"HS256": signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", getMockClaims()),
+		"RS256": signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", getMockClaims()),
+		"ES256": signToken(t, jwt.SigningMethodES256, keys.ecKey, "ec", getMockClaims()),
+	}
+	for alg, token := range tokens {
+		principal, err := verifier.Verify(context.Background(), token)
+		if err != nil {
+			t.Errorf("Expected %s token to verify, but got %s", alg, err)
+			continue
+		}
+		if principal.Subject != "user-1" || !principal.HasScope("items:write") {
+			t.Errorf("Expected %s principal user-1 with items:write, but got %+v", alg, principal)
+		}
+	}
+}
+
+func TestVerifierRejectsInvalidTokens(t *testing.T) {
+	keys := getMockKeys(t)
+	verifier := getMockVerifier(t, keys)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	withClaim := func(key string, value interface{}) jwt.MapClaims {
+		claims := getMockClaims()
+		claims[key] = value
+		return claims
+	}
+	testCases := map[string]string{
+		"expired":         signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", withClaim("exp", time.Now().Add(-time.Hour).Unix())),
+		"not yet valid":   signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", withClaim("nbf", time.Now().Add(time.Hour).Unix())),
+		"wrong audience":  signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", withClaim("aud", "other-api")),
+		"wrong issuer":    signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", withClaim("iss", "https://evil.example.com")),
+		"missing exp":     signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", withClaim("exp", nil)),
+		"wrong secret":    signToken(t, jwt.SigningMethodHS256, []byte("other-secret"), "", getMockClaims()),
+		"wrong RSA key":   signToken(t, jwt.SigningMethodRS256, otherKey, "rsa", getMockClaims()),
+		"unknown kid":     signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "unknown", getMockClaims()),
+		"unsupported alg": signToken(t, jwt.SigningMethodHS512, []byte(mockHMACSecret), "", getMockClaims()),
+		"unsigned":        signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", getMockClaims()),
+		"malformed":       "not-a-token",
+	}
+	for name, token := range testCases {
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrorInvalidToken) {
+			t.Errorf("Expected %s token to be rejected with %s, but got %v", name, auth.ErrorInvalidToken, err)
+		}
+	}
+}
+
+func TestVerifierLoadsJWKSFromURL(t *testing.T) {
+	keys := getMockKeys(t)
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(keys.jwks())
+	}))
+	defer jwksServer.Close()
+	verifier, err := auth.NewVerifier(context.Background(), auth.Config{JWKSURL: jwksServer.URL})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	token := signToken(t, jwt.SigningMethodES256, keys.ecKey, "ec", getMockClaims())
+	if _, err := verifier.Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected token to verify, but got %s", err)
+	}
+	// HS256 is not accepted without a configured secret
+	token = signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", getMockClaims())
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrorInvalidToken) {
+		t.Errorf("Expected HS256 token to be rejected, but got %v", err)
+	}
+}
+
+func TestVerifierDropsKeysRotatedOutOfJWKS(t *testing.T) {
+	keys, rotated := getMockKeys(t), getMockKeys(t)
+	// the identity provider replaces the "rsa" key with "rsa-2"
+	rotatedJWKS := strings.Replace(string(rotated.jwks()), `"kid":"rsa"`, `"kid":"rsa-2"`, 1)
+	var rotatedOut atomic.Bool
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rotatedOut.Load() {
+			_, _ = w.Write([]byte(rotatedJWKS))
+			return
+		}
+		_, _ = w.Write(keys.jwks())
+	}))
+	defer jwksServer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := auth.Config{JWKSURL: jwksServer.URL, JWKSRefreshInterval: 10 * time.Millisecond}
+	verifier, err := auth.NewVerifier(ctx, config)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	oldToken := signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", getMockClaims())
+	if _, err := verifier.Verify(ctx, oldToken); err != nil {
+		t.Fatalf("Expected token to verify, but got %s", err)
+	}
+	rotatedOut.Store(true)
+	newToken := signToken(t, jwt.SigningMethodRS256, rotated.rsaKey, "rsa-2", getMockClaims())
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, err := verifier.Verify(ctx, newToken)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the rotated key to be loaded, but got %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := verifier.Verify(ctx, oldToken); !errors.Is(err, auth.ErrorInvalidToken) {
+		t.Errorf("Expected the rotated out key to be rejected with %s, but got %v", auth.ErrorInvalidToken, err)
+	}
+}
+
+func TestVerifierSkipsUnsupportedKeys(t *testing.T) {
+	keys := getMockKeys(t)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %s", err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	_ = json.Unmarshal(keys.jwks(), &set)
+	set.Keys = append(set.Keys,
+		map[string]string{
+			"kty": "EC", "kid": "p384", "use": "sig", "alg": "ES384", "crv": "P-384",
+			"x": b64(p384Key.X.FillBytes(make([]byte, 48))),
+			"y": b64(p384Key.Y.FillBytes(make([]byte, 48))),
+		},
+		map[string]string{"kty": "EC", "kid": "p521", "crv": "P-521", "x": "AA", "y": "AA"},
+		map[string]string{"kty": "RSA", "kid": "ps256", "alg": "PS256", "n": "AQAB", "e": "AQAB"},
+		map[string]string{"kty": "OKP", "kid": "ed25519", "crv": "Ed25519", "x": "AA"},
+	)
+	data, _ := json.Marshal(set)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, data, 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %s", err)
+	}
+	verifier, err := auth.NewVerifier(context.Background(), auth.Config{JWKSFile: jwksFile})
+	if err != nil {
+		t.Fatalf("Expected unsupported keys to be skipped, but got %s", err)
+	}
+	for kid, token := range map[string]string{
+		"rsa": signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", getMockClaims()),
+		"ec":  signToken(t, jwt.SigningMethodES256, keys.ecKey, "ec", getMockClaims()),
+	} {
+		if _, err := verifier.Verify(context.Background(), token); err != nil {
+			t.Errorf("Expected the %s key to verify next to unsupported keys, but got %s", kid, err)
+		}
+	}
+	token := signToken(t, jwt.SigningMethodES384, p384Key, "p384", getMockClaims())
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrorInvalidToken) {
+		t.Errorf("Expected the skipped P-384 key to be rejected with %s, but got %v", auth.ErrorInvalidToken, err)
+	}
+}
+
+func TestVerifierRejectsMalformedSupportedKeys(t *testing.T) {
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	data := `{"keys":[{"kty":"EC","kid":"ec","crv":"P-256","x":"not base64!","y":"AA"}]}`
+	if err := os.WriteFile(jwksFile, []byte(data), 0o600); err != nil {
+		t.Fatalf("Failed to write JWKS: %s", err)
+	}
+	if _, err := auth.NewVerifier(context.Background(), auth.Config{JWKSFile: jwksFile}); !errors.Is(err, auth.ErrorInvalidKeySet) {
+		t.Errorf("Expected %s, but got %v", auth.ErrorInvalidKeySet, err)
+	}
+}
+
+func TestVerifierRequiresKeys(t *testing.T) {
+	if _, err := auth.NewVerifier(context.Background(), auth.Config{}); !errors.Is(err, auth.ErrorNotConfigured) {
+		t.Errorf("Expected %s, but got %v", auth.ErrorNotConfigured, err)
+	}
+}
+
+func TestAuthenticateMiddlewareSetsPrincipal(t *testing.T) {
+	keys := getMockKeys(t)
+	verifier := getMockVerifier(t, keys)
+	// setup router echoing the principal subject
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	r.GET("/whoami", middleware.Authenticate(verifier, nil), func(g *gin.Context) {
+		principal, _ := auth.FromContext(g.Request.Context())
+		g.JSON(http.StatusOK, gin.H{"sub": principal.Subject})
+	})
+	token := signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", getMockClaims())
+	w := performRequestWithHeaders(r, "GET", "/whoami", map[string]string{"Authorization": "Bearer " + token})
+	expectedBody := `{"sub":"user-1"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestItemsAPIRequiresToken(t *testing.T) {
+	keys := getMockKeys(t)
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupItemsAPIRoutes(r, deps, middleware.Authenticate(getMockVerifier(t, keys), deps.APIKeys))
+	for _, header := range []string{"", "Basic dXNlcjpwYXNz", "Bearer not-a-token"} {
+		w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+			"Authorization":            header,
+			middleware.RequestIdHeader: "abc-123",
+		})
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+		}
+		expectedBody := `{"error":"Unauthorized","request_id":"abc-123"}`
+		if w.Body.String() != expectedBody {
+			t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected WWW-Authenticate header")
+		}
+	}
+}
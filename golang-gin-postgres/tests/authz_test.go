@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/routes"
+)
+
+// HELPERS
+
+func getAuthzRouter(t *testing.T, policy *auth.Policy) (*gin.Engine, mockKeys) {
+	t.Helper()
+	deps, _ := getMockDependencies()
+	keys := getMockKeys(t)
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupItemsAPIRoutes(r, deps,
+		middleware.Authenticate(getMockVerifier(t, keys), deps.APIKeys),
+		middleware.Authorize(policy),
+		middleware.Tenant(),
+	)
+	return r, keys
+}
+
+func getScopedToken(t *testing.T, keys mockKeys, scope string) string {
+	t.Helper()
+	claims := getMockClaims()
+	claims["scope"] = scope
+	return signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", claims)
+}
+
+// TESTS
+
+func TestDefaultPolicyCoversItemsRoutes(t *testing.T) {
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load policy: %s", err)
+	}
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	routes.SetupItemsAPIRoutes(r, deps)
+	for _, route := range r.Routes() {
+		operation := route.Method + " " + route.Path
+		if _, ok := policy.Operations[operation]; !ok {
+			t.Errorf("Expected policy entry for %s", operation)
+		}
+	}
+}
+
+func TestAuthorizeAllowsScopedRoutes(t *testing.T) {
+	policy, _ := auth.PolicyFromEnv()
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]}))
+	mockDBPool.ExpectCommit()
+	keys := getMockKeys(t)
+	r := gin.New()
+	routes.SetupItemsAPIRoutes(r, deps,
+		middleware.Authenticate(getMockVerifier(t, keys), nil),
+		middleware.Authorize(policy),
+		middleware.Tenant(),
+	)
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getScopedToken(t, keys, "items:read"),
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestAuthorizeRejectsMissingScope(t *testing.T) {
+	policy, _ := auth.PolicyFromEnv()
+	r, keys := getAuthzRouter(t, policy)
+	w := performRequestWithHeaders(r, "POST", "/api/items", map[string]string{
+		"Authorization":            "Bearer " + getScopedToken(t, keys, "items:read"),
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Errorf("Expected problem content type, but got %s", contentType)
+	}
+	expectedBody := `{"detail":"missing required scopes: items:write","error":"Forbidden","instance":"/api/items","missing_scopes":["items:write"],"request_id":"abc-123","status":403,"title":"Forbidden","type":"about:blank"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestAuthorizeUsesPolicyFile(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	policyYaml := "operations:\n  GET /api/items/:id: [items:read, items:audit]\n"
+	if err := os.WriteFile(policyFile, []byte(policyYaml), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %s", err)
+	}
+	t.Setenv("AUTH_POLICY_FILE", policyFile)
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load policy: %s", err)
+	}
+	r, keys := getAuthzRouter(t, policy)
+	token := getScopedToken(t, keys, "items:read items:write")
+	// a scope added by the file is now required
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{"Authorization": "Bearer " + token})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	// routes missing from the file are denied
+	w = performRequestWithHeaders(r, "POST", "/api/items", map[string]string{"Authorization": "Bearer " + token})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestParsePolicyRejectsInvalidFiles(t *testing.T) {
+	for _, data := range []string{"", "operations: [", "operations:\n  GET /api/items: ['']\n"} {
+		if _, err := auth.ParsePolicy([]byte(data)); !errors.Is(err, auth.ErrorInvalidPolicy) {
+			t.Errorf("Expected %s for %q, but got %v", auth.ErrorInvalidPolicy, data, err)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v3"
+
+	"example-server/bulk"
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/routes"
+)
+
+// HELPERS
+
+func getBulkRouter() (*gin.Engine, pgxmock.PgxPoolIface) {
+	deps, mockDBPool := getMockDependencies()
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	return r, mockDBPool
+}
+
+func performImportRequest(r http.Handler, path, contentType, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// expectImport expects the staging table, COPY and merge, returning one row
+// per merged Item with whether it was inserted, numbering Items from 1, and
+// the change each merged Item records
+func expectImport(mockDBPool pgxmock.PgxPoolIface, onConflict string, inserted ...bool) {
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectExec("CREATE TEMP TABLE item_import").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mockDBPool.ExpectCopyFrom(pgx.Identifier{"item_import"}, []string{"line", "name", "price"}).
+		WillReturnResult(int64(len(inserted)))
+	item := mockRecords[mockRecord1]
+	rows := mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price", "inserted"})
+	for i, inserted := range inserted {
+		rows.AddRow(i+1, item.UUID, item.CreatedAt, item.Name, item.Price, inserted)
+	}
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) SELECT (.+) FROM item_import (.+) ON CONFLICT ON CONSTRAINT item_name_unique " + onConflict).
+		WithArgs(mockTenant).
+		WillReturnRows(rows)
+	for _, inserted := range inserted {
+		if inserted {
+			expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+		} else {
+			expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemUpdated)
+		}
+	}
+	mockDBPool.ExpectCommit()
+}
+
+// TESTS
+
+func TestExportItemsCSV(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequest(r, "GET", "/api/items/export")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{
+		"Content-Type":        "text/csv; charset=utf-8",
+		"Content-Disposition": `attachment; filename="items.csv"`,
+	})
+	expectedBody := "id,uuid,created_at,name,price\n" +
+		"1,550e8400-e29b-41d4-a716-446655440000,2021-01-01T00:00:00Z,pi,3.14\n" +
+		"2,550e8400-e29b-41d4-a716-446655440001,2021-01-01T00:00:00Z,tree-fiddy,3.5\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestExportItemsNDJSON(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequest(r, "GET", "/api/items/export?format=ndjson")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/x-ndjson"})
+	expectedBody := `{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14}` + "\n" +
+		`{"id":2,"uuid":"550e8400-e29b-41d4-a716-446655440001","created_at":"2021-01-01T00:00:00Z","name":"tree-fiddy","price":3.5}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestExportItemsInvalidFormat(t *testing.T) {
+	r, _ := getBulkRouter()
+	w := performRequestWithHeaders(r, "GET", "/api/items/export?format=xml", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"Invalid format","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestExportItemsQueryError(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	w := performRequestWithHeaders(r, "GET", "/api/items/export", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/json; charset=utf-8", "Content-Disposition": ""})
+	expectedBody := `{"error":"Failed to export Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestImportItemsCSV(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	// one new name, one changed price, one unchanged price
+	expectImport(mockDBPool, "DO UPDATE", true, false)
+	body := "name,price\n" +
+		"pi,3.14\n" +
+		"tree-fiddy,3.50\n" +
+		"e,2.71\n" +
+		"free,\n" +
+		"pi,1\n" +
+		",1\n"
+	w := performImportRequest(r, "/api/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":1,"skipped":1,"errors":[` +
+		`{"line":5,"error":"invalid price"},` +
+		`{"line":6,"error":"duplicate name, first seen on line 2"},` +
+		`{"line":7,"error":"name is required"}]},"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsRecordsChanges(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	inserted, updated := mockRecords[mockRecord1], mockRecords[mockRecord2]
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectExec("CREATE TEMP TABLE item_import").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mockDBPool.ExpectCopyFrom(pgx.Identifier{"item_import"}, []string{"line", "name", "price"}).
+		WillReturnResult(2)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) RETURNING id, uuid, created_at, name, price, xmax = 0 AS inserted").
+		WithArgs(mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price", "inserted"}).
+			AddRow(inserted.ID, inserted.UUID, inserted.CreatedAt, inserted.Name, inserted.Price, true).
+			AddRow(updated.ID, updated.UUID, updated.CreatedAt, updated.Name, updated.Price, false))
+	// the inserted Item is announced as created, the updated one as updated
+	for _, change := range []struct {
+		event string
+		item  models.Item
+	}{
+		{models.WebhookEventItemCreated, inserted},
+		{models.WebhookEventItemUpdated, updated},
+	} {
+		payload, _ := json.Marshal(change.item)
+		expectWebhookEnqueue(mockDBPool, mockTenant, change.event)
+		mockDBPool.ExpectExec("INSERT INTO outbox (.+) VALUES (.+)").
+			WithArgs(mockTenant, "item", change.item.ID, change.event, payload).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockDBPool.ExpectCommit()
+	w := performImportRequest(r, "/api/items/import", "text/csv", "name,price\npi,3.14\ntree-fiddy,3.50\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsNDJSONSkipConflicts(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectImport(mockDBPool, "DO NOTHING", true)
+	body := `{"name":"pi","price":3.14}` + "\n" +
+		"\n" +
+		`{"name":"e","price":-1}` + "\n" +
+		`not json` + "\n" +
+		`{"id":7,"uuid":"550e8400-e29b-41d4-a716-446655440007","name":"tree-fiddy","price":3.5}`
+	w := performImportRequest(r, "/api/items/import?on_conflict=skip", "application/x-ndjson", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":0,"skipped":1,"errors":[` +
+		`{"line":3,"error":"price must not be negative"},` +
+		`{"line":4,"error":"invalid JSON"}]},"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsWithoutValidRowsSkipsDB(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	w := performImportRequest(r, "/api/items/import", "text/csv", "name,price\n,1\n")
+	expectedBody := `{"data":{"inserted":0,"updated":0,"skipped":0,"errors":[{"line":2,"error":"name is required"}]},"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsRejectsInvalidRequests(t *testing.T) {
+	r, _ := getBulkRouter()
+	for _, test := range []struct {
+		path, contentType, body string
+		expectedStatusCode      int
+		expectedBody            string
+	}{
+		{"/api/items/import", "application/json", `{}`, http.StatusUnsupportedMediaType,
+			`{"error":"Unsupported import format","request_id":"abc-123"}`},
+		{"/api/items/import?on_conflict=replace", "text/csv", "name,price\n", http.StatusBadRequest,
+			`{"error":"Invalid on_conflict","request_id":"abc-123"}`},
+		{"/api/items/import", "text/csv", "title,cost\npi,3.14\n", http.StatusBadRequest,
+			`{"error":"Invalid import file","request_id":"abc-123"}`},
+	} {
+		w := performImportRequest(r, test.path, test.contentType, test.body)
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Expected status code %d, but got %d", test.expectedStatusCode, w.Code)
+		}
+		if w.Body.String() != test.expectedBody {
+			t.Errorf("Expected %s, but got %s", test.expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestImportItemsDBError(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectExec("CREATE TEMP TABLE item_import").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mockDBPool.ExpectCopyFrom(pgx.Identifier{"item_import"}, []string{"line", "name", "price"}).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	w := performImportRequest(r, "/api/items/import", "text/csv", "name,price\npi,3.14\n")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	expectedBody := `{"error":"Failed to import Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestImportItemsGetOwnBodyLimit(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectImport(mockDBPool, "DO UPDATE", true, true)
+	r := gin.New()
+	r.Use(middleware.ForImports(middleware.MaxBodySize(1024), middleware.MaxBodySize(16)))
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	// the import is within its own limit
+	w := performImportRequest(r, "/api/items/import", "text/csv", "name,price\npi,3.14\ne,2.71\n")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	// other routes keep the default limit
+	w = performImportRequest(r, "/api/items", "application/json", `{"data":{"name":"pi","price":3.14}}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsPriceLimit(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectImport(mockDBPool, "DO UPDATE", true)
+	// 99999999.99 fits the column but rounds up to 1e8 as a float32
+	body := "name,price\n" +
+		"pi,99999992\n" +
+		"e,99999999.99\n"
+	w := performImportRequest(r, "/api/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":0,"skipped":0,"errors":[{"line":3,"error":"price is too large"}]},"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestBulkExportCanBeImported(t *testing.T) {
+	var exported strings.Builder
+	writer := bulk.NewWriter(&exported, bulk.FormatCSV)
+	for _, key := range []string{mockRecord1, mockRecord2} {
+		item := mockRecords[key]
+		if err := writer.Write(&item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rows, rowErrors, err := bulk.ReadItems(strings.NewReader(exported.String()), bulk.FormatCSV)
+	if err != nil || len(rowErrors) != 0 {
+		t.Fatalf("Expected the export to read back, but got %v %v", err, rowErrors)
+	}
+	expected := []bulk.Row{
+		{Line: 2, Item: models.ItemIn{Name: "pi", Price: 3.14}},
+		{Line: 3, Item: models.ItemIn{Name: "tree-fiddy", Price: 3.5}},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, rows)
+	}
+}
@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"example-server/cache"
+	"example-server/database"
+	"example-server/dependencies"
+	"example-server/models"
+	"example-server/repos"
+	"example-server/routes"
+	"example-server/tenant"
+)
+
+// HELPERS
+
+func getCachedMockDependencies(c cache.Cache) (*dependencies.Dependencies, pgxmock.PgxPoolIface, *prometheus.Registry) {
+	// setup mock dependencies reading Items through c, with cache and query
+	// metrics on a fresh registry
+	mockDBPool, err := pgxmock.NewPool()
+	if err != nil {
+		panic(err)
+	}
+	reg := prometheus.NewRegistry()
+	deps := dependencies.NewDependencies(
+		validator.New(),
+		mockDBPool,
+		database.NewQueryMetrics(reg),
+		cache.NewItemCache(c, cache.NewMetrics(reg)),
+	)
+	return deps, mockDBPool, reg
+}
+
+func getCacheRouter(deps *dependencies.Dependencies) *gin.Engine {
+	r := gin.New()
+	r.Use(withMockTenant)
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	r.POST("/api/items/import", routes.HandleImportItems(deps))
+	return r
+}
+
+func expectFetchItem(mockDBPool pgxmock.PgxPoolIface, item models.Item) {
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(item.ID, mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{item}))
+	mockDBPool.ExpectCommit()
+}
+
+func getMockRedisCache(t *testing.T) (*cache.RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute), server
+}
+
+// TESTS
+
+func TestItemCacheServesRepeatedLookups(t *testing.T) {
+	deps, mockDBPool, reg := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	r := getCacheRouter(deps)
+	expectFetchItem(mockDBPool, mockRecords[mockRecord1])
+	expectedBody := `{"data":{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14},"meta":{}}`
+	for i := 0; i < 2; i++ {
+		w := performRequest(r, "GET", "/api/items/1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		if w.Body.String() != expectedBody {
+			t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "miss"}); got != 1 {
+		t.Errorf("Expected 1 cache miss, but got %v", got)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "hit"}); got != 1 {
+		t.Errorf("Expected 1 cache hit, but got %v", got)
+	}
+}
+
+func TestItemCacheDoesNotCacheMissingItems(t *testing.T) {
+	deps, mockDBPool, _ := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	r := getCacheRouter(deps)
+	for i := 0; i < 2; i++ {
+		expectTenantTx(mockDBPool, mockTenant)
+		mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+			WithArgs(1, mockTenant).
+			WillReturnRows(getMockRows(mockDBPool, []models.Item{}))
+		mockDBPool.ExpectRollback()
+	}
+	for i := 0; i < 2; i++ {
+		w := performRequest(r, "GET", "/api/items/1")
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestItemCacheInvalidatedByImport(t *testing.T) {
+	deps, mockDBPool, reg := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	r := getCacheRouter(deps)
+	expectFetchItem(mockDBPool, mockRecords[mockRecord1])
+	performRequest(r, "GET", "/api/items/1")
+	// Item 1 is updated by the import
+	expectImport(mockDBPool, "DO UPDATE", false)
+	w := performImportRequest(r, "/api/items/import", "text/csv", "name,price\npi,3.15\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	updated := mockRecords[mockRecord1]
+	updated.Price = 3.15
+	expectFetchItem(mockDBPool, updated)
+	w = performRequest(r, "GET", "/api/items/1")
+	expectedBody := `{"data":{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.15},"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	// Domain events are still recorded through the cache pool
+	if got := getMetricValue(t, reg, "domain_events_total", map[string]string{"entity": "item", "event": "imported"}); got != 1 {
+		t.Errorf("Expected 1 import event, but got %v", got)
+	}
+}
+
+func TestItemCacheCollapsesConcurrentMisses(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	ctx := tenant.NewContext(context.Background(), mockTenant)
+	const numCallers = 10
+	var arrived sync.WaitGroup
+	arrived.Add(numCallers)
+	var loads atomic.Int32
+	load := func(ctx context.Context) (*models.Item, error) {
+		loads.Add(1)
+		// Hold the load until every caller has asked for the Item
+		arrived.Wait()
+		time.Sleep(20 * time.Millisecond)
+		item := mockRecords[mockRecord1]
+		return &item, nil
+	}
+	var done sync.WaitGroup
+	for i := 0; i < numCallers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			arrived.Done()
+			item, err := items.Fetch(ctx, 1, load)
+			if err != nil || item.Name != "pi" {
+				t.Errorf("Expected Item pi, but got %v, %v", item, err)
+			}
+		}()
+	}
+	done.Wait()
+	if loads.Load() != 1 {
+		t.Errorf("Expected 1 load, but got %d", loads.Load())
+	}
+}
+
+func TestItemCacheSkipsFillInvalidatedWhileLoading(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	ctx := tenant.NewContext(context.Background(), mockTenant)
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	staleLoad := func(ctx context.Context) (*models.Item, error) {
+		// Read the Item before the update commits
+		item := mockRecords[mockRecord1]
+		close(loading)
+		<-release
+		return &item, nil
+	}
+	done := make(chan *models.Item)
+	go func() {
+		item, _ := items.Fetch(ctx, 1, staleLoad)
+		done <- item
+	}()
+	<-loading
+	// The update commits and invalidates while the load is in flight
+	items.Invalidate(ctx, 1)
+	var loads atomic.Int32
+	freshLoad := func(ctx context.Context) (*models.Item, error) {
+		loads.Add(1)
+		return &models.Item{ID: 1, Name: "updated"}, nil
+	}
+	// Later callers don't join the stale load
+	if item, err := items.Fetch(ctx, 1, freshLoad); err != nil || item.Name != "updated" {
+		t.Errorf("Expected the updated Item, but got %v, %v", item, err)
+	}
+	close(release)
+	if item := <-done; item.Name != "pi" {
+		t.Errorf("Expected the stale caller to get what it read, but got %s", item.Name)
+	}
+	// The updated Item stays cached instead of what the stale load read
+	if item, _ := items.Fetch(ctx, 1, freshLoad); item.Name != "updated" {
+		t.Errorf("Expected the updated Item to be cached, but got %s", item.Name)
+	}
+	if loads.Load() != 1 {
+		t.Errorf("Expected 1 fresh load, but got %d", loads.Load())
+	}
+}
+
+func TestItemCacheKeysByTenant(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	loadFor := func(name string) func(ctx context.Context) (*models.Item, error) {
+		return func(ctx context.Context) (*models.Item, error) {
+			return &models.Item{ID: 1, Name: name}, nil
+		}
+	}
+	tenantA := tenant.NewContext(context.Background(), "tenant-a")
+	tenantB := tenant.NewContext(context.Background(), "tenant-b")
+	items.Fetch(tenantA, 1, loadFor("a"))
+	item, _ := items.Fetch(tenantB, 1, loadFor("b"))
+	if item.Name != "b" {
+		t.Errorf("Expected tenant-b's Item, but got %s", item.Name)
+	}
+	// Invalidation is scoped to the tenant too
+	items.Invalidate(tenantB, 1)
+	item, _ = items.Fetch(tenantA, 1, loadFor("reloaded"))
+	if item.Name != "a" {
+		t.Errorf("Expected tenant-a's cached Item, but got %s", item.Name)
+	}
+}
+
+func TestItemCacheFallsBackWhenRedisIsDown(t *testing.T) {
+	redisCache, server := getMockRedisCache(t)
+	deps, mockDBPool, reg := getCachedMockDependencies(redisCache)
+	r := getCacheRouter(deps)
+	server.Close()
+	expectFetchItem(mockDBPool, mockRecords[mockRecord1])
+	w := performRequest(r, "GET", "/api/items/1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "error"}); got != 1 {
+		t.Errorf("Expected 1 cache error, but got %v", got)
+	}
+}
+
+func TestRepoFetchesThroughRedisCache(t *testing.T) {
+	redisCache, server := getMockRedisCache(t)
+	deps, mockDBPool, _ := getCachedMockDependencies(redisCache)
+	ctx := tenant.NewContext(context.Background(), mockTenant)
+	expectFetchItem(mockDBPool, mockRecords[mockRecord1])
+	for i := 0; i < 2; i++ {
+		item, err := repos.FetchItemById(ctx, deps.DBPool, 1)
+		if err != nil || item.Name != "pi" {
+			t.Fatalf("Expected Item pi, but got %v, %v", item, err)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	key := "item:" + mockTenant + ":1"
+	if ttl := server.TTL(key); ttl != time.Minute {
+		t.Errorf("Expected %s to expire in 1m, but got %s", key, ttl)
+	}
+	// Expired entries are loaded again
+	server.FastForward(time.Minute)
+	expectFetchItem(mockDBPool, mockRecords[mockRecord1])
+	if _, err := repos.FetchItemById(ctx, deps.DBPool, 1); err != nil {
+		t.Fatalf("Expected Item pi, but got %v", err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.NewMemoryCache(2, time.Minute)
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("1"))
+	c.Set(ctx, "b", []byte("2"))
+	// Reading a makes b the least recently used
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"))
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, but got %d", c.Len())
+	}
+}
+
+func TestMemoryCacheExpiresEntries(t *testing.T) {
+	c := cache.NewMemoryCache(2, 10*time.Millisecond)
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("1"))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Errorf("Expected a to have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected expired entries to be dropped on read, but got %d", c.Len())
+	}
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	config := cache.ConfigFromEnv()
+	if config.Backend != cache.BackendMemory || config.TTL != time.Minute || config.MaxEntries != 10000 {
+		t.Errorf("Expected the default config, but got %+v", config)
+	}
+	t.Setenv("CACHE_BACKEND", "Redis")
+	t.Setenv("CACHE_TTL", "5s")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/1")
+	config = cache.ConfigFromEnv()
+	if config.Backend != cache.BackendRedis || config.TTL != 5*time.Second {
+		t.Errorf("Expected the redis config, but got %+v", config)
+	}
+	if c, err := cache.New(config); err != nil {
+		t.Errorf("Expected a Redis cache, but got %v", err)
+	} else {
+		c.Close()
+	}
+	if c, err := cache.New(cache.Config{Backend: cache.BackendNone}); c != nil || err != nil {
+		t.Errorf("Expected no cache, but got %v, %v", c, err)
+	}
+	if _, err := cache.New(cache.Config{Backend: "memcached"}); err == nil {
+		t.Errorf("Expected an invalid backend error")
+	}
+}
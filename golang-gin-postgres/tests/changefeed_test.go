@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"example-server/changefeed"
+)
+
+// MOCKS
+
+// mockListenConn hands out notifications sent on its channel, failing once
+// the channel is closed as a dropped connection would
+type mockListenConn struct {
+	notifications chan string
+	mu            sync.Mutex
+	executed      []string
+}
+
+func (c *mockListenConn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.executed = append(c.executed, sql)
+	return pgconn.NewCommandTag("LISTEN"), nil
+}
+
+func (c *mockListenConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case payload, ok := <-c.notifications:
+		if !ok {
+			return nil, errors.New("connection reset")
+		}
+		return &pgconn.Notification{Channel: changefeed.Channel, Payload: payload}, nil
+	}
+}
+
+func (c *mockListenConn) Close(ctx context.Context) error {
+	return nil
+}
+
+// HELPERS
+
+// runMockListener runs a Listener connecting to conns in turn, failing once
+// they run out, until the test ends
+func runMockListener(t *testing.T, conns ...*mockListenConn) (*changefeed.Listener, *atomic.Int32) {
+	t.Helper()
+	var connects atomic.Int32
+	listener := changefeed.NewListener(func(ctx context.Context) (changefeed.Conn, error) {
+		i := int(connects.Add(1)) - 1
+		if i >= len(conns) {
+			return nil, errors.New("connection refused")
+		}
+		return conns[i], nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return listener, &connects
+}
+
+func expectEvent(t *testing.T, s *changefeed.Subscription, expected changefeed.Event) {
+	t.Helper()
+	select {
+	case event := <-s.Events():
+		if event.Seq == 0 {
+			t.Errorf("Expected %+v to be numbered", event)
+		}
+		event.Seq = expected.Seq
+		if event != expected {
+			t.Errorf("Expected %+v, but got %+v", expected, event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for %+v", expected)
+	}
+}
+
+// TESTS
+
+func TestChangefeedDeliversTypedEvents(t *testing.T) {
+	conn := &mockListenConn{notifications: make(chan string)}
+	listener, _ := runMockListener(t, conn)
+	all := listener.Subscribe("")
+	defer all.Close()
+	tenantA := listener.Subscribe(mockTenant)
+	defer tenantA.Close()
+	conn.notifications <- `{"op":"created","id":1,"tenant_id":"tenant-b"}`
+	conn.notifications <- `not json`
+	conn.notifications <- `{"op":"deleted","id":2,"tenant_id":"tenant-a"}`
+	expectEvent(t, all, changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: "tenant-b"})
+	expectEvent(t, all, changefeed.Event{Op: changefeed.OpDeleted, ID: 2, TenantID: "tenant-a"})
+	// Other tenants' changes are filtered out
+	expectEvent(t, tenantA, changefeed.Event{Op: changefeed.OpDeleted, ID: 2, TenantID: "tenant-a"})
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if len(conn.executed) != 1 || conn.executed[0] != "LISTEN item_changes" {
+		t.Errorf("Expected LISTEN item_changes, but got %v", conn.executed)
+	}
+}
+
+func TestChangefeedReconnects(t *testing.T) {
+	first := &mockListenConn{notifications: make(chan string)}
+	second := &mockListenConn{notifications: make(chan string)}
+	listener, connects := runMockListener(t, first, second)
+	s := listener.Subscribe("")
+	defer s.Close()
+	first.notifications <- `{"op":"updated","id":1,"tenant_id":"tenant-a"}`
+	expectEvent(t, s, changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: "tenant-a"})
+	// Drop the connection, the listener comes back on the next one
+	close(first.notifications)
+	select {
+	case second.notifications <- `{"op":"updated","id":2,"tenant_id":"tenant-a"}`:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the listener to reconnect")
+	}
+	expectEvent(t, s, changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: "tenant-a"})
+	if connects.Load() != 2 {
+		t.Errorf("Expected 2 connects, but got %d", connects.Load())
+	}
+}
+
+func TestChangefeedReplayIncompleteAcrossReconnect(t *testing.T) {
+	first := &mockListenConn{notifications: make(chan string)}
+	second := &mockListenConn{notifications: make(chan string)}
+	listener, _ := runMockListener(t, first, second)
+	s := listener.Subscribe("")
+	defer s.Close()
+	first.notifications <- `{"op":"updated","id":1,"tenant_id":"tenant-a"}`
+	expectEvent(t, s, changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: "tenant-a"})
+	// Changes made while reconnecting are never received
+	close(first.notifications)
+	select {
+	case second.notifications <- `{"op":"updated","id":2,"tenant_id":"tenant-a"}`:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for the listener to reconnect")
+	}
+	expectEvent(t, s, changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: "tenant-a"})
+	// Resuming from before the gap may have missed changes, from after not
+	before, complete := listener.SubscribeAfter("", 1)
+	before.Close()
+	if complete {
+		t.Errorf("Expected an incomplete replay from before the reconnect")
+	}
+	after, complete := listener.SubscribeAfter("", 2)
+	after.Close()
+	if !complete {
+		t.Errorf("Expected a complete replay from after the reconnect")
+	}
+}
+
+func TestChangefeedDropsSlowSubscribers(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	slow := listener.Subscribe("")
+	for i := 0; i <= changefeed.BufferSize; i++ {
+		listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: i, TenantID: mockTenant})
+	}
+	received := 0
+	for range slow.Events() {
+		received++
+	}
+	if received != changefeed.BufferSize {
+		t.Errorf("Expected %d buffered events, but got %d", changefeed.BufferSize, received)
+	}
+	if !errors.Is(slow.Err(), changefeed.ErrorSlowSubscriber) {
+		t.Errorf("Expected %s, but got %v", changefeed.ErrorSlowSubscriber, slow.Err())
+	}
+}
+
+func TestChangefeedReplaysBufferedEvents(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	for i := 1; i <= changefeed.ReplaySize+2; i++ {
+		listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: i, TenantID: mockTenant})
+	}
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: "tenant-b"})
+	// Resuming from one of the last events replays what came after it
+	s, complete := listener.SubscribeAfter(mockTenant, changefeed.ReplaySize+1)
+	defer s.Close()
+	if !complete {
+		t.Errorf("Expected a complete replay")
+	}
+	expectEvent(t, s, changefeed.Event{Seq: changefeed.ReplaySize + 2, Op: changefeed.OpUpdated, ID: changefeed.ReplaySize + 2, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	expectEvent(t, s, changefeed.Event{Seq: changefeed.ReplaySize + 4, Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	// Events that fell out of the buffer, or were never handed out, are missed
+	for _, seq := range []uint64{1, changefeed.ReplaySize + 5} {
+		s, complete := listener.SubscribeAfter(mockTenant, seq)
+		s.Close()
+		if complete {
+			t.Errorf("Expected an incomplete replay after %d", seq)
+		}
+	}
+	s, complete = listener.SubscribeAfter(mockTenant, changefeed.ReplaySize+4)
+	s.Close()
+	if !complete {
+		t.Errorf("Expected a complete replay when caught up")
+	}
+}
+
+func TestChangefeedClosesSubscriptionsWhenStopped(t *testing.T) {
+	listener := changefeed.NewListener(func(ctx context.Context) (changefeed.Conn, error) {
+		return nil, errors.New("connection refused")
+	})
+	s := listener.Subscribe("")
+	closed := listener.Subscribe("")
+	closed.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	listener.Run(ctx)
+	if _, ok := <-s.Events(); ok || !errors.Is(s.Err(), changefeed.ErrorListenerStopped) {
+		t.Errorf("Expected the subscription to end with %s, but got %v", changefeed.ErrorListenerStopped, s.Err())
+	}
+	if closed.Err() != nil {
+		t.Errorf("Expected no error after Close, but got %v", closed.Err())
+	}
+	// Late subscribers are told right away
+	late := listener.Subscribe("")
+	if _, ok := <-late.Events(); ok || !errors.Is(late.Err(), changefeed.ErrorListenerStopped) {
+		t.Errorf("Expected a closed subscription, but got %v", late.Err())
+	}
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pashagolub/pgxmock/v3"
+
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/routes"
+)
+
+// HELPERS
+
+var mockLargeBody = strings.Repeat(`{"name":"pi","price":3.14}`, 100)
+
+func getCompressRouter(t *testing.T, config middleware.CompressionConfig, maxBodyBytes int64) (*gin.Engine, pgxmock.PgxPoolIface) {
+	t.Helper()
+	deps, mockDBPool := getMockDependencies()
+	r := gin.New()
+	r.Use(
+		middleware.RequestID(),
+		middleware.MaxBodySize(maxBodyBytes),
+		middleware.Decompress(maxBodyBytes),
+		middleware.Compress(config),
+	)
+	r.GET("/large", func(g *gin.Context) {
+		g.Data(http.StatusOK, "application/json", []byte(mockLargeBody))
+	})
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	return r, mockDBPool
+}
+
+func getMockCompressionConfig() middleware.CompressionConfig {
+	return middleware.CompressionConfig{
+		Encodings: []string{middleware.EncodingZstd, middleware.EncodingGzip},
+		MinBytes:  1024,
+	}
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var reader io.Reader
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to read gzip body: %s", err)
+		}
+		reader = gzipReader
+	case "zstd":
+		zstdReader, err := zstd.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to read zstd body: %s", err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		reader = w.Body
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decode body: %s", err)
+	}
+	return string(body)
+}
+
+func gzipBody(t *testing.T, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func performEncodedRequest(r http.Handler, path, encoding string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", encoding)
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestCompressNegotiatesEncoding(t *testing.T) {
+	r, _ := getCompressRouter(t, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	for acceptEncoding, expected := range map[string]string{
+		"gzip, zstd":             "zstd",
+		"gzip":                   "gzip",
+		"zstd;q=0.5, gzip;q=0.8": "gzip",
+		"*":                      "zstd",
+		"br":                     "",
+		"gzip;q=0":               "",
+		"":                       "",
+	} {
+		w := performRequestWithHeaders(r, "GET", "/large", map[string]string{"Accept-Encoding": acceptEncoding})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		expectHeaders(t, w, map[string]string{
+			"Content-Encoding": expected,
+			"Vary":             "Accept-Encoding",
+		})
+		if body := decodeBody(t, w); body != mockLargeBody {
+			t.Errorf("Expected the original body for %q, but got %d bytes", acceptEncoding, len(body))
+		}
+	}
+}
+
+func TestCompressSkipsSmallResponses(t *testing.T) {
+	r, _ := getCompressRouter(t, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "GET", "/api/items/abc", map[string]string{
+		"Accept-Encoding":          "gzip",
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding, but got %s", w.Header().Get("Content-Encoding"))
+	}
+	expectedBody := `{"error":"Invalid Item ID","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	r, _ := getCompressRouter(t, middleware.CompressionConfig{}, middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "GET", "/large", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("Expected an unencoded response, but got headers %v", w.Header())
+	}
+	if w.Body.String() != mockLargeBody {
+		t.Errorf("Expected the original body")
+	}
+}
+
+func TestDecompressGzipRequestBody(t *testing.T) {
+	r, mockDBPool := getCompressRouter(t, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	mockCreateRecord := mockRecords[mockRecord1]
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
+		WillReturnRows(mockDBPool.NewRows([]string{"id"}).AddRow(mockCreateRecord.ID))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(mockCreateRecord.ID, mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockCreateRecord}))
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+	mockDBPool.ExpectCommit()
+	createItemRequestJson, _ := json.Marshal(models.CreateItemRequest{
+		Data: models.ItemIn{Name: mockCreateRecord.Name, Price: mockCreateRecord.Price},
+	})
+	w := performEncodedRequest(r, "/api/items", "gzip", gzipBody(t, string(createItemRequestJson)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14},"meta":{"created":true}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestDecompressRejectsUnsupportedEncoding(t *testing.T) {
+	r, _ := getCompressRouter(t, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performEncodedRequest(r, "/api/items", "br", []byte(`{}`))
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	expectedBody := `{"error":"Unsupported content encoding","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestDecompressLimitsDecodedSize(t *testing.T) {
+	r, _ := getCompressRouter(t, getMockCompressionConfig(), 256)
+	// compresses to well under the limit
+	body := gzipBody(t, `{"data":{"name":"`+strings.Repeat("a", 4096)+`","price":3.14}}`)
+	w := performEncodedRequest(r, "/api/items", "gzip", body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestDecompressRejectsCorruptBody(t *testing.T) {
+	r, _ := getCompressRouter(t, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performEncodedRequest(r, "/api/items", "gzip", []byte(`{"data":{}}`))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCompressionConfigFromEnv(t *testing.T) {
+	t.Setenv("COMPRESSION_ENCODINGS", "gzip, br")
+	t.Setenv("COMPRESSION_MIN_BYTES", "0")
+	config := middleware.CompressionConfigFromEnv()
+	if len(config.Encodings) != 1 || config.Encodings[0] != "gzip" || config.MinBytes != 0 {
+		t.Errorf("Unexpected compression config %+v", config)
+	}
+	t.Setenv("COMPRESSION_ENCODINGS", "none")
+	if config := middleware.CompressionConfigFromEnv(); len(config.Encodings) != 0 {
+		t.Errorf("Expected compression to be disabled, but got %+v", config)
+	}
+}
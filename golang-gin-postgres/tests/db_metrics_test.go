@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example-server/database"
+	"example-server/dependencies"
+	"example-server/models"
+	"example-server/routes"
+)
+
+// HELPERS
+
+func getInstrumentedMockDependencies() (*dependencies.Dependencies, pgxmock.PgxPoolIface, *prometheus.Registry) {
+	// setup mock dependencies with query metrics on a fresh registry
+	mockDBPool, err := pgxmock.NewPool()
+	if err != nil {
+		panic(err)
+	}
+	reg := prometheus.NewRegistry()
+	deps := dependencies.NewDependencies(
+		validator.New(),
+		mockDBPool,
+		database.NewQueryMetrics(reg),
+		nil,
+	)
+	return deps, mockDBPool, reg
+}
+
+// getMetricValue returns a counter or gauge value or a histogram sample count
+// for the series matching the given labels
+func getMetricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %s", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched != len(labels) {
+				continue
+			}
+			if metric.GetHistogram() != nil {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			if metric.GetGauge() != nil {
+				return metric.GetGauge().GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// TESTS
+
+func TestDBMetricsDisabledDoesNotWrapPool(t *testing.T) {
+	deps, _ := getMockDependencies()
+	if _, ok := deps.DBPool.(*database.InstrumentedPool); ok {
+		t.Errorf("Expected DB pool not to be instrumented when metrics are disabled")
+	}
+}
+
+func TestDBMetricsFetchItemByIdOk(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]})
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	w := performRequest(r, "GET", "/api/items/1")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	// assert query duration was observed and no error was counted
+	labels := map[string]string{"query": "item.fetch_by_id", "outcome": database.OutcomeOK}
+	if v := getMetricValue(t, reg, "db_query_duration_seconds", labels); v != 1 {
+		t.Errorf("Expected 1 observed query, but got %v", v)
+	}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 0 {
+		t.Errorf("Expected 0 query errors, but got %v", v)
+	}
+}
+
+func TestDBMetricsFetchItemByIdNotFound(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	rows := getMockRows(mockDBPool, []models.Item{})
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(rows)
+	mockDBPool.ExpectRollback()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	w := performRequest(r, "GET", "/api/items/1")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	// assert not_found outcome was counted
+	labels := map[string]string{"query": "item.fetch_by_id", "outcome": database.OutcomeNotFound}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 1 {
+		t.Errorf("Expected 1 not_found query, but got %v", v)
+	}
+}
+
+func TestDBMetricsFetchPaginatedItemsError(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
+		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.GET("/api/items/all", routes.HandleGetAllItems(deps))
+	w := performRequest(r, "GET", "/api/items/all?offset=0&chunkSize=2")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	// assert error outcome was counted
+	labels := map[string]string{"query": "item.fetch_paginated", "outcome": database.OutcomeError}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 1 {
+		t.Errorf("Expected 1 query error, but got %v", v)
+	}
+}
+
+func TestDBMetricsFetchItemsByIdsRecordedOnClose(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]})
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = ANY(.+)").
+		WithArgs([]int{1, 2}, mockTenant).
+		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.GET("/api/items", routes.HandleGetItems(deps))
+	w := performRequest(r, "GET", "/api/items?item_ids=1&item_ids=2")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	// assert exactly one observation for the whole result set
+	labels := map[string]string{"query": "item.fetch_by_ids", "outcome": database.OutcomeOK}
+	if v := getMetricValue(t, reg, "db_query_duration_seconds", labels); v != 1 {
+		t.Errorf("Expected 1 observed query, but got %v", v)
+	}
+}
+
+func TestDBMetricsCreateItemCountsDomainEvent(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	mockCreateRecord := mockRecords[mockRecord1]
+	rows := getMockRows(mockDBPool, []models.Item{mockCreateRecord})
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
+		WillReturnRows(mockDBPool.NewRows([]string{"id"}).AddRow(mockCreateRecord.ID))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(mockCreateRecord.ID, mockTenant).
+		WillReturnRows(rows)
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+	mockDBPool.ExpectCommit()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.POST("/api/items", routes.HandleCreateItem(deps))
+	createItemRequestJson, _ := json.Marshal(models.CreateItemRequest{
+		Data: models.ItemIn{Name: mockCreateRecord.Name, Price: mockCreateRecord.Price},
+	})
+	w := performRequest(r, "POST", "/api/items", string(createItemRequestJson))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code %d, but got %d", http.StatusCreated, w.Code)
+	}
+	// assert insert query and domain event were recorded
+	insertLabels := map[string]string{"query": "item.insert", "outcome": database.OutcomeOK}
+	if v := getMetricValue(t, reg, "db_query_duration_seconds", insertLabels); v != 1 {
+		t.Errorf("Expected 1 observed insert, but got %v", v)
+	}
+	eventLabels := map[string]string{"entity": "item", "event": "created"}
+	if v := getMetricValue(t, reg, "domain_events_total", eventLabels); v != 1 {
+		t.Errorf("Expected 1 item created event, but got %v", v)
+	}
+}
+
+func TestDBMetricsCreateItemConflict(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	mockCreateRecord := mockRecords[mockRecord1]
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockCreateRecord.Name, mockCreateRecord.Price).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mockDBPool.ExpectRollback()
+	// setup router and exec request
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.POST("/api/items", routes.HandleCreateItem(deps))
+	createItemRequestJson, _ := json.Marshal(models.CreateItemRequest{
+		Data: models.ItemIn{Name: mockCreateRecord.Name, Price: mockCreateRecord.Price},
+	})
+	w := performRequest(r, "POST", "/api/items", string(createItemRequestJson))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, but got %d", http.StatusConflict, w.Code)
+	}
+	// assert conflict outcome was counted and no domain event was recorded
+	labels := map[string]string{"query": "item.insert", "outcome": database.OutcomeConflict}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 1 {
+		t.Errorf("Expected 1 conflict, but got %v", v)
+	}
+	eventLabels := map[string]string{"entity": "item", "event": "created"}
+	if v := getMetricValue(t, reg, "domain_events_total", eventLabels); v != 0 {
+		t.Errorf("Expected 0 item created events, but got %v", v)
+	}
+}
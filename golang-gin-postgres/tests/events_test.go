@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/changefeed"
+	"example-server/middleware"
+	"example-server/routes"
+)
+
+// HELPERS
+
+// getEventsServer serves the Items API over a real connection, which gin's
+// streaming needs to notice clients going away
+func getEventsServer(t *testing.T, listener *changefeed.Listener) *httptest.Server {
+	t.Setenv("EVENTS_HEARTBEAT_INTERVAL", "1h")
+	deps, _ := getMockDependencies()
+	deps.Changes = listener
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openEventStream starts reading events once the stream is subscribed
+func openEventStream(t *testing.T, url string, headers map[string]string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Error opening event stream: %s", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+	expected := map[string]string{
+		"Content-Type":      "text/event-stream;charset=utf-8",
+		"Cache-Control":     "no-cache",
+		"X-Accel-Buffering": "no",
+	}
+	for key, value := range expected {
+		if resp.Header.Get(key) != value {
+			t.Errorf("Expected %s header %q, but got %q", key, value, resp.Header.Get(key))
+		}
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// expectSSE reads the next blank line terminated block of the stream
+func expectSSE(t *testing.T, stream *bufio.Reader, expected string) {
+	t.Helper()
+	var block strings.Builder
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading event stream after %q: %s", block.String(), err)
+		}
+		if line == "\n" {
+			break
+		}
+		block.WriteString(line)
+	}
+	if block.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, block.String())
+	}
+}
+
+// TESTS
+
+func TestItemEventsStream(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, listener)
+	stream := openEventStream(t, server.URL+"/api/items/events?item_ids=1&item_ids=3", nil)
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 3, TenantID: "tenant-b"})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 3, TenantID: mockTenant})
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 1})+"\nevent:created\ndata:{\"op\":\"created\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 4})+"\nevent:deleted\ndata:{\"op\":\"deleted\",\"id\":3,\"tenant_id\":\"tenant-a\"}\n")
+}
+
+func TestItemEventsResume(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, listener)
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: mockTenant})
+	stream := openEventStream(t, server.URL+"/api/items/events", map[string]string{"Last-Event-ID": listener.EventID(changefeed.Event{Seq: 1})})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 2})+"\nevent:updated\ndata:{\"op\":\"updated\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 3})+"\nevent:deleted\ndata:{\"op\":\"deleted\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+}
+
+func TestItemEventsResetWhenResumeIsUnavailable(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, listener)
+	// Ids past the last event, malformed, or from another process or before a restart
+	other := changefeed.NewListener(nil)
+	other.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	for _, lastEventId := range []string{
+		listener.EventID(changefeed.Event{Seq: 7}),
+		"not-an-id",
+		"1",
+		other.EventID(changefeed.Event{Seq: 1}),
+	} {
+		stream := openEventStream(t, server.URL+"/api/items/events", map[string]string{"Last-Event-ID": lastEventId})
+		expectSSE(t, stream, "event:reset\ndata:{}\n")
+	}
+}
+
+func TestItemEventsHeartbeat(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	deps, _ := getMockDependencies()
+	deps.Changes = listener
+	r := gin.New()
+	r.GET("/events", routes.HandleItemEvents(deps, 10*time.Millisecond))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	stream := openEventStream(t, server.URL+"/events", nil)
+	expectSSE(t, stream, ": heartbeat\n")
+}
+
+func TestItemEventsEndWithListener(t *testing.T) {
+	listener := changefeed.NewListener(func(ctx context.Context) (changefeed.Conn, error) {
+		return nil, ctx.Err()
+	})
+	server := getEventsServer(t, listener)
+	stream := openEventStream(t, server.URL+"/api/items/events", nil)
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	listener.Run(ctx)
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 1})+"\nevent:created\ndata:{\"op\":\"created\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	if line, err := stream.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected the stream to end, but got %q, %v", line, err)
+	}
+}
+
+func TestItemEventsInvalidItemId(t *testing.T) {
+	deps, _ := getMockDependencies()
+	deps.Changes = changefeed.NewListener(nil)
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	w := performRequestWithHeaders(r, "GET", "/api/items/events?item_ids=one", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"Invalid Item ID","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestItemEventsUnavailable(t *testing.T) {
+	r, _ := getBulkRouter()
+	w := performRequestWithHeaders(r, "GET", "/api/items/events", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	expectedBody := `{"error":"Item events unavailable","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
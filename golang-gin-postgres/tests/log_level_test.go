@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"example-server/logger"
+	"example-server/middleware"
+	"example-server/routes"
+)
+
+const mockAdminToken = "admin-secret"
+
+// HELPERS
+
+func getAdminRouter() *gin.Engine {
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupAdminRoutes(r, deps, mockAdminToken)
+	return r
+}
+
+// restoreLevel resets the global log level after the test
+func restoreLevel(t *testing.T) {
+	t.Helper()
+	original := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(original) })
+}
+
+func performAdminRequest(r http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestLogFormatJSONAndConsole(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("LOG_FORMAT", logger.FormatJSON)
+	l := logger.NewLogger(&buf)
+	l.Info().Msg("json line")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("Expected a JSON line, but got %s", buf.String())
+	}
+	buf.Reset()
+	t.Setenv("LOG_FORMAT", logger.FormatConsole)
+	l = logger.NewLogger(&buf)
+	l.Info().Msg("console line")
+	if strings.HasPrefix(buf.String(), "{") || !strings.Contains(buf.String(), "console line") {
+		t.Errorf("Expected a console line, but got %s", buf.String())
+	}
+}
+
+func TestLogSamplingKeepsInfoBurst(t *testing.T) {
+	restoreLevel(t)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	var buf bytes.Buffer
+	t.Setenv("LOG_FORMAT", logger.FormatJSON)
+	t.Setenv("LOG_SAMPLE_INFO_BURST", "2")
+	l := logger.NewLogger(&buf)
+	for i := 0; i < 5; i++ {
+		l.Info().Int("i", i).Msg("high volume")
+	}
+	l.Warn().Msg("not sampled")
+	lines := parseLogLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 2 info lines and 1 warn line, but got %v", lines)
+	}
+	if lines[2]["level"] != "warn" {
+		t.Errorf("Expected warn line to be kept, but got %v", lines[2])
+	}
+}
+
+func TestParseLevelRejectsUnknownLevel(t *testing.T) {
+	for _, invalid := range []string{"", "verbose"} {
+		if _, err := logger.ParseLevel(invalid); err == nil {
+			t.Errorf("Expected error for level %q", invalid)
+		}
+	}
+	level, err := logger.ParseLevel("warn")
+	if err != nil || level != zerolog.WarnLevel {
+		t.Errorf("Expected warn level, but got %s (%v)", level, err)
+	}
+}
+
+func TestAdminLogLevelRequiresToken(t *testing.T) {
+	r := getAdminRouter()
+	for _, token := range []string{"", "wrong"} {
+		w := performAdminRequest(r, "PUT", "/admin/loglevel", token, `{"level":"warn"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+		}
+		if w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("Expected WWW-Authenticate header, but got %q", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAdminLogLevelDisabledWithoutToken(t *testing.T) {
+	r := gin.New()
+	routes.SetupAdminRoutes(r, nil, "")
+	w := performAdminRequest(r, "GET", "/admin/loglevel", "", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestAdminSetLogLevel(t *testing.T) {
+	restoreLevel(t)
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	buf := captureLogs(t)
+	// exec request
+	r := getAdminRouter()
+	w := performAdminRequest(r, "PUT", "/admin/loglevel", mockAdminToken, `{"level":"warn"}`)
+	expectedBody := `{"level":"warn","previous":"info"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	// assert info lines are now dropped and warn lines kept
+	buf.Reset()
+	log.Info().Msg("dropped")
+	log.Warn().Msg("kept")
+	lines := parseLogLines(t, buf)
+	if len(lines) != 1 || lines[0]["message"] != "kept" {
+		t.Errorf("Expected only the warn line, but got %v", lines)
+	}
+	// assert GET reflects the new level
+	w = performAdminRequest(r, "GET", "/admin/loglevel", mockAdminToken, "")
+	expectedBody = `{"level":"warn"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestAdminSetLogLevelInvalid(t *testing.T) {
+	restoreLevel(t)
+	r := getAdminRouter()
+	w := performAdminRequest(r, "PUT", "/admin/loglevel", mockAdminToken, `{"level":"verbose"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"error":"Invalid log level"`) {
+		t.Errorf("Expected invalid log level error, but got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,341 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v3"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example-server/database"
+	"example-server/models"
+	"example-server/outbox"
+	"example-server/repos"
+	"example-server/tenant"
+)
+
+// MOCKS
+
+var mockOutboxCreatedAt = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// mockOutboxEvents are two Items' events, the first Item's interleaved
+var mockOutboxEvents = []models.OutboxEvent{
+	{ID: 1, TenantID: mockTenant, AggregateType: "item", AggregateID: 1, EventType: models.WebhookEventItemCreated},
+	{ID: 2, TenantID: mockTenant, AggregateType: "item", AggregateID: 2, EventType: models.WebhookEventItemCreated},
+	{ID: 3, TenantID: mockTenant, AggregateType: "item", AggregateID: 1, EventType: models.WebhookEventItemUpdated},
+}
+
+// HELPERS
+
+func getOutboxRows(mockDBPool pgxmock.PgxPoolIface, events ...models.OutboxEvent) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{"id", "tenant_id", "aggregate_type", "aggregate_id", "event_type", "payload", "created_at"})
+	for _, e := range events {
+		payload := json.RawMessage(`{"id":` + strconv.Itoa(e.AggregateID) + `}`)
+		rows.AddRow(e.ID, e.TenantID, e.AggregateType, e.AggregateID, e.EventType, payload, mockOutboxCreatedAt)
+	}
+	return rows
+}
+
+func getMockOutboxConfig() outbox.Config {
+	return outbox.Config{
+		Publisher:      outbox.PublisherNATS,
+		SubjectPrefix:  "events",
+		PollInterval:   time.Hour,
+		BatchSize:      10,
+		PublishTimeout: 5 * time.Second,
+	}
+}
+
+// expectOutboxBatch expects the relay to take the lock and read events
+func expectOutboxBatch(mockDBPool pgxmock.PgxPoolIface, events ...models.OutboxEvent) {
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectQuery("SELECT pg_try_advisory_xact_lock\\((.+)\\)").
+		WithArgs(database.LockOutboxRelay).
+		WillReturnRows(mockDBPool.NewRows([]string{"locked"}).AddRow(true))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM outbox ORDER BY id LIMIT (.+)").
+		WithArgs(10).
+		WillReturnRows(getOutboxRows(mockDBPool, events...))
+}
+
+func expectOutboxDelete(mockDBPool pgxmock.PgxPoolIface, ids ...int64) {
+	mockDBPool.ExpectExec("DELETE FROM outbox WHERE id = ANY\\((.+)\\)").
+		WithArgs(ids).
+		WillReturnResult(pgxmock.NewResult("DELETE", int64(len(ids))))
+}
+
+// natsMessage is what the NATS stand-in got from an HPUB
+type natsMessage struct {
+	subject string
+	headers string
+	payload string
+}
+
+// getNATSServer runs an in-memory stand-in for a NATS server speaking
+// enough of the client protocol for the publisher: INFO, CONNECT, PING and
+// HPUB. Connections are closed after dropAfter HPUBs when it is positive.
+func getNATSServer(t *testing.T, dropAfter int) (string, chan natsMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan natsMessage, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveNATS(conn, messages, dropAfter)
+		}
+	}()
+	return "nats://" + listener.Addr().String(), messages
+}
+
+func serveNATS(conn net.Conn, messages chan natsMessage, dropAfter int) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"headers\":true}\r\n")
+	published := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "HPUB":
+			if dropAfter > 0 && published == dropAfter {
+				return
+			}
+			headerLen, _ := strconv.Atoi(fields[2])
+			totalLen, _ := strconv.Atoi(fields[3])
+			body := make([]byte, totalLen+2)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			messages <- natsMessage{
+				subject: fields[1],
+				headers: string(body[:headerLen]),
+				payload: string(body[headerLen:totalLen]),
+			}
+			published++
+		}
+	}
+}
+
+// failingPublisher fails to publish the given outbox ids
+type failingPublisher struct {
+	failIds   map[int64]bool
+	published []int64
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, message outbox.Message) error {
+	if p.failIds[message.ID] {
+		return errors.New("publish failed")
+	}
+	p.published = append(p.published, message.ID)
+	return nil
+}
+
+func (p *failingPublisher) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (p *failingPublisher) Close() error {
+	return nil
+}
+
+// TESTS
+
+func TestOutboxRelayPublishesToNATS(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	natsURL, messages := getNATSServer(t, 0)
+	publisher, err := outbox.NewNATSPublisher(natsURL, time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	defer publisher.Close()
+	expectOutboxBatch(mockDBPool, mockOutboxEvents...)
+	expectOutboxDelete(mockDBPool, 1, 2, 3)
+	mockDBPool.ExpectCommit()
+	reg := prometheus.NewRegistry()
+	relay := outbox.NewRelay(mockDBPool, publisher, getMockOutboxConfig(), outbox.NewMetrics(reg))
+	published, err := relay.RelayDue(context.Background())
+	if err != nil || published != 3 {
+		t.Fatalf("Expected 3 published events, but got %d, %v", published, err)
+	}
+	// assert messages arrived in outbox order with their keys
+	expected := []natsMessage{
+		{
+			subject: "events.item.created",
+			headers: "NATS/1.0\r\nNats-Msg-Id: 1\r\nOutbox-Key: tenant-a/item/1\r\n\r\n",
+			payload: `{"id":1,"event":"item.created","tenant_id":"tenant-a","occurred_at":"2021-01-01T00:00:00Z","data":{"id":1}}`,
+		},
+		{
+			subject: "events.item.created",
+			headers: "NATS/1.0\r\nNats-Msg-Id: 2\r\nOutbox-Key: tenant-a/item/2\r\n\r\n",
+			payload: `{"id":2,"event":"item.created","tenant_id":"tenant-a","occurred_at":"2021-01-01T00:00:00Z","data":{"id":2}}`,
+		},
+		{
+			subject: "events.item.updated",
+			headers: "NATS/1.0\r\nNats-Msg-Id: 3\r\nOutbox-Key: tenant-a/item/1\r\n\r\n",
+			payload: `{"id":3,"event":"item.updated","tenant_id":"tenant-a","occurred_at":"2021-01-01T00:00:00Z","data":{"id":1}}`,
+		},
+	}
+	for _, want := range expected {
+		if got := <-messages; got != want {
+			t.Errorf("Expected %+v, but got %+v", want, got)
+		}
+	}
+	if v := getMetricValue(t, reg, "outbox_events_total", map[string]string{"outcome": outbox.OutcomePublished}); v != 3 {
+		t.Errorf("Expected 3 published events, but got %v", v)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayKeepsItemOrderOnFailure(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// the first Item's first event fails, so its later event must wait
+	publisher := &failingPublisher{failIds: map[int64]bool{1: true}}
+	expectOutboxBatch(mockDBPool, mockOutboxEvents...)
+	expectOutboxDelete(mockDBPool, 2)
+	mockDBPool.ExpectCommit()
+	relay := outbox.NewRelay(mockDBPool, publisher, getMockOutboxConfig(), nil)
+	published, err := relay.RelayDue(context.Background())
+	if err != nil || published != 1 {
+		t.Fatalf("Expected 1 published event, but got %d, %v", published, err)
+	}
+	if len(publisher.published) != 1 || publisher.published[0] != 2 {
+		t.Errorf("Expected only event 2 published, but got %v", publisher.published)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestOutboxRelayKeepsEventsWhenConnectionDrops(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// the stand-in hangs up after the first message, which may be lost
+	natsURL, _ := getNATSServer(t, 1)
+	publisher, _ := outbox.NewNATSPublisher(natsURL, time.Second)
+	defer publisher.Close()
+	expectOutboxBatch(mockDBPool, mockOutboxEvents...)
+	mockDBPool.ExpectCommit()
+	reg := prometheus.NewRegistry()
+	relay := outbox.NewRelay(mockDBPool, publisher, getMockOutboxConfig(), outbox.NewMetrics(reg))
+	published, err := relay.RelayDue(context.Background())
+	if err != nil || published != 0 {
+		t.Fatalf("Expected no published events, but got %d, %v", published, err)
+	}
+	if v := getMetricValue(t, reg, "outbox_events_total", map[string]string{"outcome": outbox.OutcomeFailed}); v == 0 {
+		t.Errorf("Expected failed events to be counted")
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestOutboxRelaySkipsWhenLocked(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectQuery("SELECT pg_try_advisory_xact_lock\\((.+)\\)").
+		WithArgs(database.LockOutboxRelay).
+		WillReturnRows(mockDBPool.NewRows([]string{"locked"}).AddRow(false))
+	mockDBPool.ExpectCommit()
+	relay := outbox.NewRelay(mockDBPool, &failingPublisher{}, getMockOutboxConfig(), nil)
+	published, err := relay.RelayDue(context.Background())
+	if err != nil || published != 0 {
+		t.Fatalf("Expected no published events, but got %d, %v", published, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestOutboxLagMetrics(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectQuery("SELECT count\\(\\*\\), (.+) FROM outbox").
+		WillReturnRows(mockDBPool.NewRows([]string{"count", "lag"}).AddRow(4, 12.5))
+	mockDBPool.ExpectCommit()
+	reg := prometheus.NewRegistry()
+	relay := outbox.NewRelay(mockDBPool, &failingPublisher{}, getMockOutboxConfig(), outbox.NewMetrics(reg))
+	relay.RecordLag(context.Background())
+	if v := getMetricValue(t, reg, "outbox_pending_events", nil); v != 4 {
+		t.Errorf("Expected 4 pending events, but got %v", v)
+	}
+	if v := getMetricValue(t, reg, "outbox_lag_seconds", nil); v != 12.5 {
+		t.Errorf("Expected 12.5s lag, but got %v", v)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestInsertItemRollsBackWhenOutboxFails(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	mockItem := mockRecords[mockRecord1]
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockItem.Name, mockItem.Price).
+		WillReturnRows(mockDBPool.NewRows([]string{"id"}).AddRow(mockItem.ID))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(mockItem.ID, mockTenant).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockItem}))
+	expectWebhookEnqueue(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+	mockDBPool.ExpectExec("INSERT INTO outbox (.+)").
+		WithArgs(mockTenant, "item", mockItem.ID, models.WebhookEventItemCreated, pgxmock.AnyArg()).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	ctx := tenant.NewContext(context.Background(), mockTenant)
+	_, err := repos.InsertItem(ctx, deps.DBPool, models.ItemIn{Name: mockItem.Name, Price: mockItem.Price})
+	if !errors.Is(err, repos.ErrorOutboxEnqueue) {
+		t.Fatalf("Expected %s, but got %v", repos.ErrorOutboxEnqueue, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestLogPublisher(t *testing.T) {
+	var out bytes.Buffer
+	publisher := outbox.NewLogPublisher(&out)
+	err := publisher.Publish(context.Background(), outbox.Message{
+		ID: 1, Subject: "events.item.created", Key: "tenant-a/item/1", Payload: []byte(`{"id":1}`),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := `{"id":1,"subject":"events.item.created","key":"tenant-a/item/1","payload":{"id":1}}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected %s, but got %s", expected, out.String())
+	}
+}
+
+func TestNewPublisher(t *testing.T) {
+	if _, err := outbox.NewPublisher(outbox.Config{Publisher: "kafka"}); !errors.Is(err, outbox.ErrorInvalidPublisher) {
+		t.Errorf("Expected %s, but got %v", outbox.ErrorInvalidPublisher, err)
+	}
+	if _, err := outbox.NewPublisher(outbox.Config{Publisher: outbox.PublisherNATS, NATSURL: "http://localhost"}); err == nil {
+		t.Errorf("Expected an invalid NATS_URL error")
+	}
+}
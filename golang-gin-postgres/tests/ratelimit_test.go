@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/ratelimit"
+)
+
+const mockRateLimits = `
+default:
+  rate: 2
+  period: 1m
+routes:
+  GET /relaxed:
+    rate: 5
+    period: 1m
+  GET /unlimited:
+    rate: 0
+`
+
+// HELPERS
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+// getRateLimitRouter serves /limited, /relaxed and /unlimited with the
+// principal taken from the X-Test-Subject or X-Test-API-Key header
+func getRateLimitRouter(t *testing.T, store ratelimit.Store, config string) *gin.Engine {
+	t.Helper()
+	limits, err := ratelimit.ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("Failed to parse limits: %s", err)
+	}
+	r := gin.New()
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("Failed to set trusted proxies: %s", err)
+	}
+	r.Use(middleware.RequestID())
+	r.Use(func(g *gin.Context) {
+		var principal *auth.Principal
+		if subject := g.GetHeader("X-Test-Subject"); subject != "" {
+			principal = &auth.Principal{Method: auth.MethodJWT, Issuer: mockIssuer, Subject: subject}
+		} else if prefix := g.GetHeader("X-Test-API-Key"); prefix != "" {
+			principal = &auth.Principal{
+				Method:  auth.MethodAPIKey,
+				Subject: "billing-service",
+				Claims:  map[string]interface{}{"api_key_prefix": prefix},
+			}
+		}
+		if principal != nil {
+			g.Request = g.Request.WithContext(auth.NewContext(g.Request.Context(), principal))
+		}
+	})
+	r.Use(middleware.RateLimit(ratelimit.NewLimiter(store, limits)))
+	for _, path := range []string{"/limited", "/relaxed", "/unlimited"} {
+		r.GET(path, func(g *gin.Context) { g.String(http.StatusOK, "ok") })
+	}
+	return r
+}
+
+func performRequestFrom(r http.Handler, path, remoteAddr string, headers map[string]string) int {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// TESTS
+
+func TestRateLimitRejectsWith429(t *testing.T) {
+	r := getRateLimitRouter(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	headers := map[string]string{"X-Test-Subject": "user-1", middleware.RequestIdHeader: "abc-123"}
+	for i := 0; i < 2; i++ {
+		w := performRequestWithHeaders(r, "GET", "/limited", headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		if w.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, but got %q", w.Header().Get("RateLimit-Limit"))
+		}
+	}
+	w := performRequestWithHeaders(r, "GET", "/limited", headers)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	expectedBody := `{"error":"Too many requests","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	expectedHeaders := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "30",
+	}
+	for header, expected := range expectedHeaders {
+		if w.Header().Get(header) != expected {
+			t.Errorf("Expected %s %q, but got %q", header, expected, w.Header().Get(header))
+		}
+	}
+}
+
+func TestRateLimitSeparatesClients(t *testing.T) {
+	r := getRateLimitRouter(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	clients := []map[string]string{
+		{"X-Test-Subject": "user-1"},
+		{"X-Test-Subject": "user-2"},
+		{"X-Test-API-Key": "key1"},
+		{"X-Test-API-Key": "key2"},
+	}
+	for _, headers := range clients {
+		for i := 0; i < 2; i++ {
+			if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusOK {
+				t.Errorf("Expected status code %d for %v, but got %d", http.StatusOK, headers, code)
+			}
+		}
+		if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusTooManyRequests {
+			t.Errorf("Expected status code %d for %v, but got %d", http.StatusTooManyRequests, headers, code)
+		}
+	}
+}
+
+func TestRateLimitKeysAnonymousClientsByIP(t *testing.T) {
+	r := getRateLimitRouter(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	// X-Forwarded-For is only believed from the trusted 10.0.0.0/8 proxies
+	forwarded := map[string]string{"X-Forwarded-For": "198.51.100.7"}
+	for i := 0; i < 2; i++ {
+		performRequestFrom(r, "/limited", "10.0.0.1:1234", forwarded)
+	}
+	if code := performRequestFrom(r, "/limited", "10.0.0.2:1234", forwarded); code != http.StatusTooManyRequests {
+		t.Errorf("Expected forwarded client to be limited, but got %d", code)
+	}
+	if code := performRequestFrom(r, "/limited", "10.0.0.1:1234", nil); code != http.StatusOK {
+		t.Errorf("Expected proxy itself to have its own bucket, but got %d", code)
+	}
+	spoofed := map[string]string{"X-Forwarded-For": "198.51.100.8"}
+	for i := 0; i < 2; i++ {
+		performRequestFrom(r, "/limited", "192.0.2.1:1234", spoofed)
+	}
+	spoofed["X-Forwarded-For"] = "198.51.100.9"
+	if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", spoofed); code != http.StatusTooManyRequests {
+		t.Errorf("Expected untrusted X-Forwarded-For to be ignored, but got %d", code)
+	}
+}
+
+func TestRateLimitRouteOverrides(t *testing.T) {
+	r := getRateLimitRouter(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	headers := map[string]string{"X-Test-Subject": "user-1"}
+	for i := 0; i < 5; i++ {
+		if code := performRequestFrom(r, "/relaxed", "192.0.2.1:1234", headers); code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, code)
+		}
+	}
+	if code := performRequestFrom(r, "/relaxed", "192.0.2.1:1234", headers); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, but got %d", http.StatusTooManyRequests, code)
+	}
+	for i := 0; i < 10; i++ {
+		w := performRequestWithHeaders(r, "GET", "/unlimited", headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		if w.Header().Get("RateLimit-Limit") != "" {
+			t.Errorf("Expected no RateLimit headers on unlimited routes")
+		}
+	}
+}
+
+func TestRateLimitRefillsBucket(t *testing.T) {
+	r := getRateLimitRouter(t, ratelimit.NewMemoryStore(), "default: {rate: 20, period: 1s, burst: 1}")
+	headers := map[string]string{"X-Test-Subject": "user-1"}
+	if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, code)
+	}
+	if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusOK {
+		t.Errorf("Expected refilled bucket to allow request, but got %d", code)
+	}
+}
+
+func TestRateLimitFailsOpenOnStoreErrors(t *testing.T) {
+	r := getRateLimitRouter(t, failingStore{}, mockRateLimits)
+	for i := 0; i < 5; i++ {
+		if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", nil); code != http.StatusOK {
+			t.Errorf("Expected status code %d, but got %d", http.StatusOK, code)
+		}
+	}
+}
+
+func TestRateLimitLimitsFailedAuthenticationByIP(t *testing.T) {
+	limits, err := ratelimit.ParseConfig([]byte(mockRateLimits + "client_ip: {rate: 3, period: 1m}\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse limits: %s", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits)
+	keys := getMockKeys(t)
+	r := gin.New()
+	r.Use(
+		middleware.RequestID(),
+		middleware.ClientIPRateLimit(limiter),
+		middleware.Authenticate(getMockVerifier(t, keys), nil),
+		middleware.RateLimit(limiter),
+	)
+	for _, path := range []string{"/limited", "/unlimited"} {
+		r.GET(path, func(g *gin.Context) { g.String(http.StatusOK, "ok") })
+	}
+	headers := map[string]string{"Authorization": "Bearer not-a-token"}
+	for i := 0; i < 3; i++ {
+		if code := performRequestFrom(r, "/limited", "192.0.2.1:1234", headers); code != http.StatusUnauthorized {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusUnauthorized, code)
+		}
+	}
+	req, _ := http.NewRequest("GET", "/limited", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	expectedBody := `{"error":"Too many requests","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "20" {
+		t.Errorf("Expected Retry-After 20, but got %q", w.Header().Get("Retry-After"))
+	}
+	// routes without a limit skip the client IP bucket
+	if code := performRequestFrom(r, "/unlimited", "192.0.2.1:1234", headers); code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, code)
+	}
+	if code := performRequestFrom(r, "/limited", "192.0.2.2:1234", headers); code != http.StatusUnauthorized {
+		t.Errorf("Expected another IP to have its own bucket, but got %d", code)
+	}
+}
+
+func TestDefaultRateLimitsParse(t *testing.T) {
+	t.Setenv("RATE_LIMIT_FILE", "")
+	limits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load default limits: %s", err)
+	}
+	if limits.Default.Unlimited() {
+		t.Errorf("Expected a default limit")
+	}
+	if limits.ClientIP.Unlimited() {
+		t.Errorf("Expected a client IP limit")
+	}
+}
+
+func TestParseRateLimitsRejectsInvalidFiles(t *testing.T) {
+	configs := map[string]string{
+		"malformed":       "default: [",
+		"negative burst":  "default: {rate: 10, burst: -1}",
+		"negative period": "routes: {GET /x: {rate: 10, period: -1s}}",
+		"negative client": "client_ip: {rate: 10, burst: -1}",
+	}
+	for name, config := range configs {
+		if _, err := ratelimit.ParseConfig([]byte(config)); !errors.Is(err, ratelimit.ErrorInvalidLimit) {
+			t.Errorf("%s: expected ErrorInvalidLimit, but got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"example-server/middleware"
+	"example-server/routes"
+)
+
+// HELPERS
+
+// captureLogs redirects the global logger to a buffer for the test duration
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = original })
+	return &buf
+}
+
+func parseLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, raw := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]interface{}
+		if err := json.Unmarshal(raw, &line); err != nil {
+			t.Fatalf("Failed to parse log line %s: %s", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func performRequestWithHeaders(r http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func getRequestIdRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.AccessLog())
+	return r
+}
+
+// TESTS
+
+func TestRequestIdGeneratedWhenMissing(t *testing.T) {
+	r := getRequestIdRouter()
+	r.GET("/status", routes.HandleStatus)
+	w := performRequest(r, "GET", "/status")
+	requestId := w.Header().Get(middleware.RequestIdHeader)
+	if _, err := uuid.Parse(requestId); err != nil {
+		t.Errorf("Expected generated UUID request id, but got %q", requestId)
+	}
+}
+
+func TestRequestIdEchoesValidHeader(t *testing.T) {
+	r := getRequestIdRouter()
+	r.GET("/status", routes.HandleStatus)
+	w := performRequestWithHeaders(r, "GET", "/status", map[string]string{middleware.RequestIdHeader: "abc-123"})
+	if requestId := w.Header().Get(middleware.RequestIdHeader); requestId != "abc-123" {
+		t.Errorf("Expected request id abc-123, but got %q", requestId)
+	}
+}
+
+func TestRequestIdReplacesInvalidHeader(t *testing.T) {
+	r := getRequestIdRouter()
+	r.GET("/status", routes.HandleStatus)
+	for _, invalid := range []string{"has space", "new\nline", strings.Repeat("a", 129)} {
+		w := performRequestWithHeaders(r, "GET", "/status", map[string]string{middleware.RequestIdHeader: invalid})
+		requestId := w.Header().Get(middleware.RequestIdHeader)
+		if _, err := uuid.Parse(requestId); err != nil {
+			t.Errorf("Expected invalid request id %q to be replaced, but got %q", invalid, requestId)
+		}
+	}
+}
+
+func TestRequestIdInErrorBody(t *testing.T) {
+	deps, _ := getMockDependencies()
+	r := getRequestIdRouter()
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	w := performRequestWithHeaders(r, "GET", "/api/items/invalid", map[string]string{middleware.RequestIdHeader: "abc-123"})
+	expectedBody := `{"error":"Invalid Item ID","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestRequestIdOnHandlerAndRepoLogLines(t *testing.T) {
+	buf := captureLogs(t)
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
+	// exec request
+	r := getRequestIdRouter()
+	r.Use(withMockTenant)
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{middleware.RequestIdHeader: "abc-123"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	// assert handler, repo and access log lines all carry the request id
+	lines := parseLogLines(t, buf)
+	messages := map[string]bool{}
+	for _, line := range lines {
+		if line["request_id"] != "abc-123" {
+			t.Errorf("Expected request_id abc-123 on %v", line)
+		}
+		messages[line["message"].(string)] = true
+	}
+	for _, msg := range []string{"Fetching item by id", "Error querying Item", "Request served"} {
+		if !messages[msg] {
+			t.Errorf("Expected a %q log line, but got %v", msg, lines)
+		}
+	}
+}
+
+func TestAccessLogFields(t *testing.T) {
+	buf := captureLogs(t)
+	deps, mockDBPool := getMockDependencies()
+	rows := getMockRows(mockDBPool, nil)
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(rows)
+	mockDBPool.ExpectRollback()
+	// exec request
+	r := getRequestIdRouter()
+	r.Use(withMockTenant)
+	r.GET("/api/items/:id", routes.HandleGetItem(deps))
+	w := performRequest(r, "GET", "/api/items/1")
+	// assert access log line
+	var accessLog map[string]interface{}
+	for _, line := range parseLogLines(t, buf) {
+		if line["message"] == "Request served" {
+			accessLog = line
+		}
+	}
+	if accessLog == nil {
+		t.Fatalf("Expected an access log line")
+	}
+	expected := map[string]interface{}{
+		"level":  "warn",
+		"method": "GET",
+		"route":  "/api/items/:id",
+		"path":   "/api/items/1",
+		"status": float64(http.StatusNotFound),
+		"bytes":  float64(w.Body.Len()),
+	}
+	for key, value := range expected {
+		if accessLog[key] != value {
+			t.Errorf("Expected access log %s=%v, but got %v", key, value, accessLog[key])
+		}
+	}
+	for _, key := range []string{"latency", "client_ip", "request_id"} {
+		if _, ok := accessLog[key]; !ok {
+			t.Errorf("Expected access log field %s", key)
+		}
+	}
+}
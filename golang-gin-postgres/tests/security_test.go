@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example-server/middleware"
+	"example-server/routes"
+)
+
+// HELPERS
+
+func getSecurityRouter(t *testing.T, cors middleware.CORSConfig, maxBodyBytes int64) *gin.Engine {
+	t.Helper()
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	r.Use(
+		middleware.RequestID(),
+		middleware.SecurityHeaders(time.Hour),
+		middleware.CORS(cors),
+		middleware.MaxBodySize(maxBodyBytes),
+	)
+	routes.SetupItemsAPIRoutes(r, deps, withMockTenant)
+	return r
+}
+
+func getMockCORSConfig() middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{middleware.RequestIdHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func expectHeaders(t *testing.T, w *httptest.ResponseRecorder, expectedHeaders map[string]string) {
+	t.Helper()
+	for header, expected := range expectedHeaders {
+		if w.Header().Get(header) != expected {
+			t.Errorf("Expected %s %q, but got %q", header, expected, w.Header().Get(header))
+		}
+	}
+}
+
+// TESTS
+
+func TestCORSPreflightAllowedOrigin(t *testing.T) {
+	r := getSecurityRouter(t, getMockCORSConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "OPTIONS", "/api/items/1", map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "Authorization",
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNoContent, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	})
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Expected no credentials header")
+	}
+}
+
+func TestCORSPreflightRejectsOtherOrigins(t *testing.T) {
+	r := getSecurityRouter(t, getMockCORSConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "OPTIONS", "/api/items/1", map[string]string{
+		"Origin":                        "https://evil.example.com",
+		"Access-Control-Request-Method": "GET",
+		middleware.RequestIdHeader:      "abc-123",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"Origin not allowed","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin header")
+	}
+}
+
+func TestCORSSimpleRequests(t *testing.T) {
+	r := getSecurityRouter(t, getMockCORSConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "GET", "/api/items/abc", map[string]string{
+		"Origin": "https://app.example.com",
+	})
+	expectHeaders(t, w, map[string]string{
+		"Access-Control-Allow-Origin":   "https://app.example.com",
+		"Access-Control-Expose-Headers": middleware.RequestIdHeader,
+		"Vary":                          "Origin",
+	})
+	w = performRequestWithHeaders(r, "GET", "/api/items/abc", map[string]string{
+		"Origin": "https://evil.example.com",
+	})
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin header for other origins")
+	}
+}
+
+func TestCORSCredentialsAndWildcard(t *testing.T) {
+	config := getMockCORSConfig()
+	config.AllowCredentials = true
+	r := getSecurityRouter(t, config, middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "GET", "/api/items/abc", map[string]string{
+		"Origin": "https://app.example.com",
+	})
+	expectHeaders(t, w, map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+	})
+	config = getMockCORSConfig()
+	config.AllowedOrigins = []string{"*"}
+	r = getSecurityRouter(t, config, middleware.DefaultMaxBodyBytes)
+	w = performRequestWithHeaders(r, "GET", "/api/items/abc", map[string]string{
+		"Origin": "https://any.example.com",
+	})
+	expectHeaders(t, w, map[string]string{"Access-Control-Allow-Origin": "*"})
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_MAX_AGE", "1h")
+	config := middleware.CORSConfigFromEnv()
+	if len(config.AllowedOrigins) != 1 || config.MaxAge != time.Hour {
+		t.Errorf("Unexpected CORS config %+v", config)
+	}
+	if config.AllowCredentials {
+		t.Errorf("Expected credentials to be ignored with a wildcard origin")
+	}
+	if len(config.AllowedMethods) == 0 || len(config.AllowedHeaders) == 0 {
+		t.Errorf("Expected default methods and headers")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	r := getSecurityRouter(t, middleware.CORSConfig{}, middleware.DefaultMaxBodyBytes)
+	w := performRequestWithHeaders(r, "GET", "/api/items/abc", nil)
+	expectHeaders(t, w, map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+	})
+	r = gin.New()
+	r.Use(middleware.SecurityHeaders(0))
+	r.GET("/status", routes.HandleStatus)
+	w = performRequest(r, "GET", "/status")
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("Expected no HSTS header when disabled")
+	}
+}
+
+func TestMaxBodySizeRejectsDeclaredLength(t *testing.T) {
+	r := getSecurityRouter(t, middleware.CORSConfig{}, 16)
+	req, _ := http.NewRequest("POST", "/api/items", strings.NewReader(`{"data":{"name":"pi","price":3.14}}`))
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestMaxBodySizeRejectsChunkedBody(t *testing.T) {
+	r := getSecurityRouter(t, middleware.CORSConfig{}, 16)
+	// MultiReader hides the length, as with a chunked body
+	body := io.MultiReader(strings.NewReader(`{"data":{"name":"pi","price":3.14}}`))
+	req, _ := http.NewRequest("POST", "/api/items", body)
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestMaxBodyBytesFromEnv(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "2048")
+	if limit := middleware.MaxBodyBytesFromEnv(); limit != 2048 {
+		t.Errorf("Expected 2048, but got %d", limit)
+	}
+	t.Setenv("MAX_BODY_BYTES", "invalid")
+	if limit := middleware.MaxBodyBytesFromEnv(); limit != middleware.DefaultMaxBodyBytes {
+		t.Errorf("Expected default limit, but got %d", limit)
+	}
+}
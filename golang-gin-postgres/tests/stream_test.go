@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example-server/middleware"
+	"example-server/models"
+)
+
+const (
+	mockRecord1JSON = `{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14}`
+	mockRecord2JSON = `{"id":2,"uuid":"550e8400-e29b-41d4-a716-446655440001","created_at":"2021-01-01T00:00:00Z","name":"tree-fiddy","price":3.5}`
+)
+
+// TESTS
+
+func TestStreamItemsJSON(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequest(r, "GET", "/api/items/stream")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	expectedBody := `{"data":[` + mockRecord1JSON + `,` + mockRecord2JSON + `],"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestStreamItemsJSONEmpty(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 20, 5).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{}))
+	mockDBPool.ExpectCommit()
+	w := performRequest(r, "GET", "/api/items/stream?offset=20&limit=5")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectedBody := `{"data":[],"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsNDJSONByIds(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) AND id = ANY(.+) ORDER BY id").
+		WithArgs(mockTenant, []int{2, 1}).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequestWithHeaders(r, "GET", "/api/items/stream?item_ids=2&item_ids=1", map[string]string{
+		"Accept": "application/x-ndjson",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/x-ndjson"})
+	expectedBody := mockRecord1JSON + "\n" + mockRecord2JSON + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestStreamItemsCapsLimit(t *testing.T) {
+	t.Setenv("STREAM_MAX_ROWS", "2")
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequest(r, "GET", "/api/items/stream?limit=500")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	// Ids beyond the cap are rejected rather than dropped
+	w = performRequestWithHeaders(r, "GET", "/api/items/stream?item_ids=1&item_ids=2&item_ids=3", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"Too many Item IDs","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsRejectsInvalidQuery(t *testing.T) {
+	r, _ := getBulkRouter()
+	tests := map[string]string{
+		"/api/items/stream?offset=-1":    `{"error":"Invalid query parameters","request_id":"abc-123"}`,
+		"/api/items/stream?limit=0":      `{"error":"Invalid query parameters","request_id":"abc-123"}`,
+		"/api/items/stream?limit=ten":    `{"error":"Invalid query parameters","request_id":"abc-123"}`,
+		"/api/items/stream?item_ids=one": `{"error":"Invalid Item ID","request_id":"abc-123"}`,
+	}
+	for path, expectedBody := range tests {
+		w := performRequestWithHeaders(r, "GET", path, map[string]string{
+			middleware.RequestIdHeader: "abc-123",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, but got %d", path, http.StatusBadRequest, w.Code)
+		}
+		if w.Body.String() != expectedBody {
+			t.Errorf("%s: expected %s, but got %s", path, expectedBody, w.Body.String())
+		}
+	}
+}
+
+func TestStreamItemsQueryError(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	w := performRequestWithHeaders(r, "GET", "/api/items/stream", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	expectedBody := `{"error":"Failed to query Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsFlushesInChunks(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	items := make([]models.Item, 1200)
+	for i := range items {
+		items[i] = mockRecords[mockRecord1]
+		items[i].ID = i + 1
+	}
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockRows(mockDBPool, items))
+	mockDBPool.ExpectCommit()
+	w := performRequestWithHeaders(r, "GET", "/api/items/stream", map[string]string{
+		"Accept": "application/x-ndjson",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if !w.Flushed {
+		t.Errorf("Expected the response to be flushed while streaming")
+	}
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != len(items) {
+		t.Fatalf("Expected %d lines, but got %d", len(items), len(lines))
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], `{"id":`+strconv.Itoa(len(items))+`,`) {
+		t.Errorf("Expected the last line to hold Item %d, but got %s", len(items), lines[len(lines)-1])
+	}
+}
+
+func TestStreamItemsStopsWhenClientGoesAway(t *testing.T) {
+	r, mockDBPool := getBulkRouter()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1], mockRecords[mockRecord2]}))
+	mockDBPool.ExpectRollback()
+	req := httptest.NewRequest("GET", "/api/items/stream", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected nothing to be written, but got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pashagolub/pgxmock/v3"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/models"
+	"example-server/routes"
+	"example-server/tenant"
+)
+
+// HELPERS
+
+func getTenantRouter(t *testing.T) (*gin.Engine, pgxmock.PgxPoolIface, mockKeys) {
+	t.Helper()
+	deps, mockDBPool := getMockDependencies()
+	keys := getMockKeys(t)
+	r := gin.New()
+	routes.SetupItemsAPIRoutes(r, deps,
+		middleware.Authenticate(getMockVerifier(t, keys), deps.APIKeys),
+		middleware.Tenant(),
+	)
+	return r, mockDBPool, keys
+}
+
+func getTenantToken(t *testing.T, keys mockKeys, tenantID, scope string) string {
+	t.Helper()
+	claims := getMockClaims()
+	claims["scope"] = scope
+	if tenantID == "" {
+		delete(claims, "tenant_id")
+	} else {
+		claims["tenant_id"] = tenantID
+	}
+	return signToken(t, jwt.SigningMethodRS256, keys.rsaKey, "rsa", claims)
+}
+
+// TESTS
+
+func TestTenantResolve(t *testing.T) {
+	testCases := map[string]struct {
+		credentialTenant string
+		headerTenant     string
+		crossTenant      bool
+		expectedTenant   string
+		expectedErr      error
+	}{
+		"credentials":         {credentialTenant: "tenant-a", expectedTenant: "tenant-a"},
+		"header":              {headerTenant: "tenant-b", expectedErr: tenant.ErrorTenantRequired},
+		"cross-tenant header": {headerTenant: "tenant-b", crossTenant: true, expectedTenant: "tenant-b"},
+		"matching header":     {credentialTenant: "tenant-a", headerTenant: "tenant-a", expectedTenant: "tenant-a"},
+		"mismatched header":   {credentialTenant: "tenant-a", headerTenant: "tenant-b", crossTenant: true, expectedErr: tenant.ErrorTenantMismatch},
+		"missing":             {crossTenant: true, expectedErr: tenant.ErrorMissingTenant},
+		"invalid characters":  {headerTenant: "tenant a", crossTenant: true, expectedErr: tenant.ErrorInvalidTenant},
+	}
+	for name, tc := range testCases {
+		tenantID, err := tenant.Resolve(tc.credentialTenant, tc.headerTenant, tc.crossTenant)
+		if !errors.Is(err, tc.expectedErr) || tenantID != tc.expectedTenant {
+			t.Errorf("%s: expected (%q, %v), but got (%q, %v)", name, tc.expectedTenant, tc.expectedErr, tenantID, err)
+		}
+	}
+}
+
+func TestTenantCrossTenantReadReturns404(t *testing.T) {
+	r, mockDBPool, keys := getTenantRouter(t)
+	// item 1 belongs to tenant-a, so tenant-b's scoped query finds nothing
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockRows(mockDBPool, nil))
+	mockDBPool.ExpectRollback()
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "tenant-b", "items:read"),
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	expectedBody := `{"error":"Item not found"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantCrossTenantListOnlyReturnsOwnItems(t *testing.T) {
+	r, mockDBPool, keys := getTenantRouter(t)
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = ANY(.+) AND tenant_id = (.+)").
+		WithArgs([]int{1, 2}, "tenant-b").
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord2]}))
+	mockDBPool.ExpectCommit()
+	w := performRequestWithHeaders(r, "GET", "/api/items?item_ids=1&item_ids=2", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "tenant-b", "items:read"),
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectedBody := `{"data":[{"id":2,"uuid":"550e8400-e29b-41d4-a716-446655440001","created_at":"2021-01-01T00:00:00Z","name":"tree-fiddy","price":3.5}],"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantHeaderIgnoredWithoutTenantClaim(t *testing.T) {
+	r, _, keys := getTenantRouter(t)
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "", "items:read"),
+		tenant.Header:   "tenant-b",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"Credentials are not bound to a tenant"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestTenantFromHeaderWithCrossTenantScope(t *testing.T) {
+	r, mockDBPool, keys := getTenantRouter(t)
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]}))
+	mockDBPool.ExpectCommit()
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "", "items:read "+auth.CrossTenantScope),
+		tenant.Header:   "tenant-b",
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantHeaderCannotOverrideTenantClaim(t *testing.T) {
+	r, _, keys := getTenantRouter(t)
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "tenant-a", "items:read"),
+		tenant.Header:   "tenant-b",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"Tenant does not match credentials"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestTenantMissing(t *testing.T) {
+	r, _, keys := getTenantRouter(t)
+	w := performRequestWithHeaders(r, "GET", "/api/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, keys, "", "items:read "+auth.CrossTenantScope),
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"Missing tenant"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
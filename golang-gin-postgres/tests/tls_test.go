@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"example-server/auth"
+	"example-server/middleware"
+	"example-server/tlsconfig"
+)
+
+// HELPERS
+
+type mockCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var mockSerial int64
+
+func newMockCA(t *testing.T, name string) mockCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %s", err)
+	}
+	mockSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(mockSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return mockCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a server certificate for localhost, or a client certificate
+func (ca mockCA) issue(t *testing.T, subject pkix.Name, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	mockSerial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(mockSerial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeKeyPair writes cert as PEM files, returning their paths
+func writeKeyPair(t *testing.T, dir string, cert tls.Certificate) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %s", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %s", path, err)
+	}
+}
+
+// startTLSServer serves handler with config as serverd and the gin main do
+func startTLSServer(t *testing.T, handler http.Handler, config tlsconfig.Config) (string, *tlsconfig.Reloader) {
+	t.Helper()
+	reloader, err := tlsconfig.NewReloader(config)
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %s", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	server := &http.Server{Handler: handler, TLSConfig: reloader.TLSConfig()}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String(), reloader
+}
+
+func getTLSClient(ca mockCA, certs ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, ServerName: "localhost"},
+	}}
+}
+
+func getWhoamiRouter(t *testing.T, keys mockKeys) *gin.Engine {
+	t.Helper()
+	r := gin.New()
+	r.GET("/whoami", middleware.Authenticate(getMockVerifier(t, keys), nil), func(g *gin.Context) {
+		principal, _ := auth.FromContext(g.Request.Context())
+		g.JSON(http.StatusOK, gin.H{
+			"method": principal.Method,
+			"sub":    principal.Subject,
+			"scopes": principal.Scopes,
+			"tenant": principal.TenantID,
+		})
+	})
+	return r
+}
+
+func getBody(t *testing.T, client *http.Client, url string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// TESTS
+
+func TestTLSServesCertificate(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), ca.issue(t, pkix.Name{CommonName: "localhost"}, true))
+	url, _ := startTLSServer(t, getWhoamiRouter(t, getMockKeys(t)), tlsconfig.Config{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: time.Second,
+	})
+	token := signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", getMockClaims())
+	resp, body := getBody(t, getTLSClient(ca), url+"/whoami", map[string]string{"Authorization": "Bearer " + token})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"sub":"user-1"`) {
+		t.Errorf("Unexpected response %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestTLSReloadsChangedCertificate(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	dir := t.TempDir()
+	first := ca.issue(t, pkix.Name{CommonName: "localhost"}, true)
+	certFile, keyFile := writeKeyPair(t, dir, first)
+	url, reloader := startTLSServer(t, gin.New(), tlsconfig.Config{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+	// keep a connection open across the reload
+	client := getTLSClient(ca)
+	resp, _ := getBody(t, client, url+"/", nil)
+	if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Fatalf("Expected the first certificate")
+	}
+	second := ca.issue(t, pkix.Name{CommonName: "localhost"}, true)
+	writeKeyPair(t, dir, second)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, _ := getBody(t, getTLSClient(ca), url+"/", nil)
+		if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(second.Leaf.SerialNumber) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Certificate was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	resp, _ = getBody(t, client, url+"/", nil)
+	if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Errorf("Expected the established connection to be kept")
+	}
+}
+
+func TestTLSKeepsCertificateOnInvalidReload(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), ca.issue(t, pkix.Name{CommonName: "localhost"}, true))
+	url, reloader := startTLSServer(t, gin.New(), tlsconfig.Config{CertFile: certFile, KeyFile: keyFile})
+	writeFile(t, certFile, []byte("not a certificate"))
+	if err := reloader.Reload(); !errors.Is(err, tlsconfig.ErrorInvalidCertificate) {
+		t.Errorf("Expected ErrorInvalidCertificate, but got %v", err)
+	}
+	if resp, _ := getBody(t, getTLSClient(ca), url+"/", nil); resp.TLS == nil {
+		t.Errorf("Expected the previous certificate to be served")
+	}
+}
+
+func TestMTLSMapsClientCertificateToPrincipal(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, ca.issue(t, pkix.Name{CommonName: "localhost"}, true))
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.pem)
+	url, _ := startTLSServer(t, getWhoamiRouter(t, getMockKeys(t)), tlsconfig.Config{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+	})
+	clientCert := ca.issue(t, pkix.Name{
+		CommonName:         "billing-service",
+		Organization:       []string{"tenant-a"},
+		OrganizationalUnit: []string{"items:read", "items:write"},
+	}, false)
+	resp, body := getBody(t, getTLSClient(ca, clientCert), url+"/whoami", nil)
+	expectedBody := `{"method":"client_cert","scopes":["items:read","items:write"],"sub":"billing-service","tenant":"tenant-a"}`
+	if resp.StatusCode != http.StatusOK || body != expectedBody {
+		t.Errorf("Expected %s, but got %d: %s", expectedBody, resp.StatusCode, body)
+	}
+	// Handshakes without a certificate, or with one from another CA, fail
+	otherCA := newMockCA(t, "other-ca")
+	for _, client := range []*http.Client{
+		getTLSClient(ca),
+		getTLSClient(ca, otherCA.issue(t, pkix.Name{CommonName: "intruder"}, false)),
+	} {
+		if resp, err := client.Get(url + "/whoami"); err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected the handshake to fail, but got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestMTLSOptionalClientCertificate(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, ca.issue(t, pkix.Name{CommonName: "localhost"}, true))
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.pem)
+	url, _ := startTLSServer(t, getWhoamiRouter(t, getMockKeys(t)), tlsconfig.Config{
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		ClientCAFile:       caFile,
+		ClientCertOptional: true,
+	})
+	token := signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", getMockClaims())
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	// A bearer token authenticates without a certificate and wins over one
+	clientCert := ca.issue(t, pkix.Name{CommonName: "billing-service"}, false)
+	for _, client := range []*http.Client{getTLSClient(ca), getTLSClient(ca, clientCert)} {
+		resp, body := getBody(t, client, url+"/whoami", headers)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"method":"jwt"`) {
+			t.Errorf("Unexpected response %d: %s", resp.StatusCode, body)
+		}
+	}
+	resp, _ := getBody(t, getTLSClient(ca), url+"/whoami", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestTLSConfigFromEnv(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "tls.crt")
+	t.Setenv("TLS_KEY_FILE", "")
+	if tlsconfig.ConfigFromEnv().Enabled() {
+		t.Errorf("Expected TLS to need both a certificate and a key")
+	}
+	t.Setenv("TLS_KEY_FILE", "tls.key")
+	t.Setenv("TLS_RELOAD_INTERVAL", "1m")
+	config := tlsconfig.ConfigFromEnv()
+	if !config.Enabled() || config.ReloadInterval != time.Minute {
+		t.Errorf("Unexpected TLS config %+v", config)
+	}
+	if _, err := tlsconfig.NewReloader(config); !errors.Is(err, tlsconfig.ErrorInvalidCertificate) {
+		t.Errorf("Expected ErrorInvalidCertificate, but got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"example-server/database"
+	"example-server/logger"
+	"example-server/models"
+	"example-server/routes"
+)
+
+const (
+	mockTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	mockParentId    = "00f067aa0ba902b7"
+	mockTraceparent = "00-" + mockTraceId + "-" + mockParentId + "-01"
+)
+
+// HELPERS
+
+func getTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	// record spans in memory
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return tp, recorder
+}
+
+// TESTS
+
+func TestTracingGinMiddlewareContinuesW3CTrace(t *testing.T) {
+	tp, recorder := getTracerProvider()
+	// setup router with tracing middleware
+	r := gin.Default()
+	r.Use(otelgin.Middleware(
+		"test",
+		otelgin.WithTracerProvider(tp),
+		otelgin.WithPropagators(propagation.TraceContext{}),
+	))
+	r.GET("/status", routes.HandleStatus)
+	// exec request with traceparent header
+	req, _ := http.NewRequest("GET", "/status", nil)
+	req.Header.Set("traceparent", mockTraceparent)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	// assert server span continues the incoming trace
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, but got %d", len(spans))
+	}
+	span := spans[0]
+	if span.SpanContext().TraceID().String() != mockTraceId {
+		t.Errorf("Expected trace id %s, but got %s", mockTraceId, span.SpanContext().TraceID())
+	}
+	if span.Parent().SpanID().String() != mockParentId {
+		t.Errorf("Expected parent span id %s, but got %s", mockParentId, span.Parent().SpanID())
+	}
+	if span.Name() != "/status" {
+		t.Errorf("Expected span name /status, but got %s", span.Name())
+	}
+}
+
+func TestTracingRequestContextReachesHandlers(t *testing.T) {
+	tp, recorder := getTracerProvider()
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	rows := getMockRows(mockDBPool, []models.Item{mockRecords[mockRecord1]})
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(rows)
+	mockDBPool.ExpectCommit()
+	// setup router with tracing middleware and a handler-level span check
+	var handlerTraceId string
+	r := gin.Default()
+	r.Use(withMockTenant)
+	r.Use(otelgin.Middleware("test", otelgin.WithTracerProvider(tp)))
+	r.GET("/api/items/:id", func(g *gin.Context) {
+		handlerTraceId = trace.SpanContextFromContext(g.Request.Context()).TraceID().String()
+		routes.HandleGetItem(deps)(g)
+	})
+	w := performRequest(r, "GET", "/api/items/1")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	// assert request context carried the server span
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, but got %d", len(spans))
+	}
+	if handlerTraceId != spans[0].SpanContext().TraceID().String() {
+		t.Errorf("Expected handler trace id %s, but got %s", spans[0].SpanContext().TraceID(), handlerTraceId)
+	}
+}
+
+func TestTracingQueryTracer(t *testing.T) {
+	tp, recorder := getTracerProvider()
+	tracer := database.NewQueryTracer(tp)
+	// start a parent span and trace a named query
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	ctx = database.WithQueryName(ctx, "item.fetch_by_id")
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	parent.End()
+	// assert query span is a named child of the parent and records the error
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+	querySpan := spans[0]
+	if querySpan.Name() != "item.fetch_by_id" {
+		t.Errorf("Expected span name item.fetch_by_id, but got %s", querySpan.Name())
+	}
+	if querySpan.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected query span to be a child of the parent span")
+	}
+	if querySpan.Status().Code != codes.Error {
+		t.Errorf("Expected span status %s, but got %s", codes.Error, querySpan.Status().Code)
+	}
+}
+
+func TestTracingLogHookInjectsTraceIds(t *testing.T) {
+	tp, _ := getTracerProvider()
+	// setup logger writing to a buffer
+	var buf bytes.Buffer
+	l := zerolog.New(&buf).Hook(logger.TraceHook{})
+	// log with and without a span in context
+	ctx, span := tp.Tracer("test").Start(context.Background(), "parent")
+	l.Info().Ctx(ctx).Msg("with span")
+	span.End()
+	l.Info().Ctx(context.Background()).Msg("without span")
+	// assert only the first line carries ids
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, but got %d", len(lines))
+	}
+	var withSpan, withoutSpan map[string]interface{}
+	_ = json.Unmarshal(lines[0], &withSpan)
+	_ = json.Unmarshal(lines[1], &withoutSpan)
+	if withSpan["trace_id"] != span.SpanContext().TraceID().String() {
+		t.Errorf("Expected trace_id %s, but got %v", span.SpanContext().TraceID(), withSpan["trace_id"])
+	}
+	if withSpan["span_id"] != span.SpanContext().SpanID().String() {
+		t.Errorf("Expected span_id %s, but got %v", span.SpanContext().SpanID(), withSpan["span_id"])
+	}
+	if _, ok := withoutSpan["trace_id"]; ok {
+		t.Errorf("Expected no trace_id without a span, but got %v", withoutSpan["trace_id"])
+	}
+}
@@ -0,0 +1,472 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pashagolub/pgxmock/v3"
+
+	"example-server/dependencies"
+	"example-server/models"
+	"example-server/repos"
+	"example-server/routes"
+	"example-server/webhook"
+)
+
+// MOCKS
+
+const mockWebhookSecret = "whsec_test"
+
+var mockWebhook = models.WebhookSubscription{
+	ID:        1,
+	URL:       "https://example.com/hooks/items",
+	Secret:    mockWebhookSecret,
+	Events:    []string{models.WebhookEventItemCreated},
+	Active:    true,
+	CreatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	UpdatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+}
+
+var mockWebhookPayload = `{"event":"item.created","tenant_id":"tenant-a","occurred_at":"2021-01-01T00:00:00Z",` +
+	`"data":{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14}}`
+
+// HELPERS
+
+func getWebhookRows(mockDBPool pgxmock.PgxPoolIface, subscriptions ...models.WebhookSubscription) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{"id", "url", "secret", "events", "active", "created_at", "updated_at"})
+	for _, s := range subscriptions {
+		rows.AddRow(s.ID, s.URL, s.Secret, s.Events, s.Active, s.CreatedAt, s.UpdatedAt)
+	}
+	return rows
+}
+
+func getWebhookDeliveryRows(mockDBPool pgxmock.PgxPoolIface, status string, attempts int) *pgxmock.Rows {
+	createdAt := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var lastStatusCode *int
+	var lastError *string
+	if attempts > 0 {
+		code, message := 500, "unexpected status 500 Internal Server Error"
+		lastStatusCode, lastError = &code, &message
+	}
+	return mockDBPool.NewRows([]string{
+		"id", "subscription_id", "event", "payload", "status", "attempts", "next_attempt_at",
+		"last_attempt_at", "last_status_code", "last_error", "created_at", "delivered_at",
+	}).AddRow(
+		int64(7), 1, models.WebhookEventItemCreated, json.RawMessage(mockWebhookPayload), status, attempts, createdAt,
+		&createdAt, lastStatusCode, lastError, createdAt, (*time.Time)(nil),
+	)
+}
+
+func getWebhooksRouter(deps *dependencies.Dependencies) *gin.Engine {
+	r := gin.New()
+	routes.SetupWebhooksAPIRoutes(r, deps, withMockTenant)
+	return r
+}
+
+func getMockWebhookConfig() webhook.Config {
+	return webhook.Config{
+		PollInterval: time.Hour,
+		BatchSize:    10,
+		Timeout:      5 * time.Second,
+		MaxAttempts:  3,
+		BackoffBase:  time.Minute,
+		BackoffMax:   time.Hour,
+		// Receivers are httptest servers on loopback
+		AllowPrivateNetworks: true,
+	}
+}
+
+// expectAllTenantsTx expects the transaction the dispatcher's queries run in
+func expectAllTenantsTx(mockDBPool pgxmock.PgxPoolIface) {
+	mockDBPool.ExpectBegin()
+	mockDBPool.ExpectExec("SELECT set_config\\('app.all_tenants', 'on', true\\)").
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+}
+
+// expectWebhookClaim hands out one delivery to url on its given attempt
+func expectWebhookClaim(mockDBPool pgxmock.PgxPoolIface, url string, attempts int) {
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectQuery("UPDATE webhook_deliveries d SET attempts = (.+) FOR UPDATE OF d SKIP LOCKED\\) RETURNING (.+)").
+		WithArgs(10, float64(10)).
+		WillReturnRows(mockDBPool.NewRows([]string{"id", "event", "payload", "attempts", "url", "secret"}).
+			AddRow(int64(7), models.WebhookEventItemCreated, json.RawMessage(mockWebhookPayload), attempts, url, mockWebhookSecret))
+	mockDBPool.ExpectCommit()
+}
+
+// receivedWebhook is what the test receiver got
+type receivedWebhook struct {
+	header http.Header
+	body   string
+	err    error
+}
+
+// getWebhookReceiver answers deliveries with status, verifying their
+// signature
+func getWebhookReceiver(t *testing.T, status int) (*httptest.Server, chan receivedWebhook) {
+	received := make(chan receivedWebhook, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- receivedWebhook{
+			header: r.Header,
+			body:   string(body),
+			err:    webhook.Verify(mockWebhookSecret, r.Header, body, time.Minute),
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+// TESTS
+
+func TestCreateWebhook201(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO webhook_subscriptions (.+) VALUES (.+) RETURNING (.+)").
+		WithArgs(mockTenant, mockWebhook.URL, pgxmock.AnyArg(), mockWebhook.Events, true).
+		WillReturnRows(getWebhookRows(mockDBPool, mockWebhook))
+	mockDBPool.ExpectCommit()
+	w := performRequest(getWebhooksRouter(deps), "POST", "/api/webhooks",
+		`{"data":{"url":"https://example.com/hooks/items","events":["item.created"]}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	// The secret is random and only returned here
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Secret string          `json:"secret"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response %s: %s", w.Body.String(), err)
+	}
+	expectedData := `{"id":1,"url":"https://example.com/hooks/items","events":["item.created"],"active":true,` +
+		`"created_at":"2021-01-01T00:00:00Z","updated_at":"2021-01-01T00:00:00Z"}`
+	if string(response.Data) != expectedData {
+		t.Errorf("Expected %s, but got %s", expectedData, response.Data)
+	}
+	if !strings.HasPrefix(response.Secret, "whsec_") || len(response.Secret) != 49 {
+		t.Errorf("Expected a whsec_ secret, but got %q", response.Secret)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestCreateWebhook400InvalidData(t *testing.T) {
+	deps, _ := getMockDependencies()
+	for name, body := range map[string]string{
+		"missing url":   `{"data":{"events":["item.created"]}}`,
+		"not http":      `{"data":{"url":"ftp://example.com/hooks"}}`,
+		"unknown event": `{"data":{"url":"https://example.com/hooks","events":["item.renamed"]}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := performRequest(getWebhooksRouter(deps), "POST", "/api/webhooks", body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+			}
+			expectedBody := `{"error":"Invalid webhook data"}`
+			if w.Body.String() != expectedBody {
+				t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateWebhook404(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("UPDATE webhook_subscriptions SET (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(mockWebhook.URL, []string{}, false, 2, mockTenant).
+		WillReturnRows(getWebhookRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	w := performRequest(getWebhooksRouter(deps), "PUT", "/api/webhooks/2",
+		`{"data":{"url":"https://example.com/hooks/items","active":false}}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	expectedBody := `{"error":"Webhook not found"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestGetWebhookDeliveries(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM webhook_subscriptions WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getWebhookRows(mockDBPool, mockWebhook))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM webhook_deliveries WHERE subscription_id = (.+) ORDER BY id DESC LIMIT (.+)").
+		WithArgs(1, mockTenant, 5).
+		WillReturnRows(getWebhookDeliveryRows(mockDBPool, models.WebhookDeliveryDead, 3))
+	mockDBPool.ExpectCommit()
+	w := performRequest(getWebhooksRouter(deps), "GET", "/api/webhooks/1/deliveries?limit=5")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":[{"id":7,"subscription_id":1,"event":"item.created","payload":` + mockWebhookPayload +
+		`,"status":"dead","attempts":3,"next_attempt_at":"2021-01-01T00:00:00Z","last_attempt_at":"2021-01-01T00:00:00Z",` +
+		`"last_status_code":500,"last_error":"unexpected status 500 Internal Server Error",` +
+		`"created_at":"2021-01-01T00:00:00Z","delivered_at":null}]}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestGetWebhookDeliveries400InvalidLimit(t *testing.T) {
+	deps, _ := getMockDependencies()
+	w := performRequest(getWebhooksRouter(deps), "GET", "/api/webhooks/1/deliveries?limit=101")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"Invalid limit"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestRetryWebhookDelivery(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT status FROM webhook_deliveries WHERE id = (.+) FOR UPDATE").
+		WithArgs(int64(7), 1, mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"status"}).AddRow(models.WebhookDeliveryDead))
+	mockDBPool.ExpectQuery("UPDATE webhook_deliveries SET status = (.+), attempts = 0, (.+) RETURNING (.+)").
+		WithArgs(models.WebhookDeliveryPending, int64(7)).
+		WillReturnRows(getWebhookDeliveryRows(mockDBPool, models.WebhookDeliveryPending, 0))
+	mockDBPool.ExpectCommit()
+	w := performRequest(getWebhooksRouter(deps), "POST", "/api/webhooks/1/deliveries/7/retry")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"status":"pending","attempts":0`) {
+		t.Errorf("Expected a pending delivery, but got %s", w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRetryWebhookDelivery409Delivered(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT status FROM webhook_deliveries WHERE id = (.+) FOR UPDATE").
+		WithArgs(int64(7), 1, mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"status"}).AddRow(models.WebhookDeliveryDelivered))
+	mockDBPool.ExpectRollback()
+	w := performRequest(getWebhooksRouter(deps), "POST", "/api/webhooks/1/deliveries/7/retry")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusConflict, w.Code)
+	}
+	expectedBody := `{"error":"Webhook delivery already delivered"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestWebhookDispatcherDelivers(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	receiver, received := getWebhookReceiver(t, http.StatusNoContent)
+	expectWebhookClaim(mockDBPool, receiver.URL, 1)
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), delivered_at = (.+) AND status = 'pending' AND attempts = (.+)").
+		WithArgs(models.WebhookDeliveryDelivered, http.StatusNoContent, int64(7), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockDBPool.ExpectCommit()
+	dispatcher := webhook.NewDispatcher(mockDBPool, getMockWebhookConfig())
+	claimed, err := dispatcher.DispatchDue(context.Background())
+	if err != nil || claimed != 1 {
+		t.Fatalf("Expected 1 claimed delivery, but got %d, %v", claimed, err)
+	}
+	// assert the receiver got the signed payload
+	delivery := <-received
+	if delivery.err != nil {
+		t.Errorf("Expected a valid signature, but got %s", delivery.err)
+	}
+	if delivery.body != mockWebhookPayload {
+		t.Errorf("Expected %s, but got %s", mockWebhookPayload, delivery.body)
+	}
+	expectedHeaders := map[string]string{
+		"Content-Type":          "application/json",
+		webhook.HeaderID:        "7",
+		webhook.HeaderEvent:     models.WebhookEventItemCreated,
+		webhook.HeaderTimestamp: delivery.header.Get(webhook.HeaderTimestamp),
+	}
+	for key, value := range expectedHeaders {
+		if delivery.header.Get(key) != value || value == "" {
+			t.Errorf("Expected %s header %q, but got %q", key, value, delivery.header.Get(key))
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestWebhookOutcomeFencedToClaim(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// the lease expired and another dispatcher claimed attempt 2 meanwhile
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), delivered_at = (.+) AND status = 'pending' AND attempts = (.+)").
+		WithArgs(models.WebhookDeliveryDelivered, http.StatusNoContent, int64(7), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockDBPool.ExpectCommit()
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), next_attempt_at = (.+) AND status = 'pending' AND attempts = (.+)").
+		WithArgs(models.WebhookDeliveryDead, float64(0), (*int)(nil), "timeout", int64(7), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mockDBPool.ExpectCommit()
+	ctx := context.Background()
+	if err := repos.RecordWebhookDelivered(ctx, mockDBPool, 7, 1, http.StatusNoContent); !errors.Is(err, repos.ErrorWebhookLeaseLost) {
+		t.Errorf("Expected %v, but got %v", repos.ErrorWebhookLeaseLost, err)
+	}
+	if err := repos.RecordWebhookFailed(ctx, mockDBPool, 7, 1, 0, "timeout", -1); !errors.Is(err, repos.ErrorWebhookLeaseLost) {
+		t.Errorf("Expected %v, but got %v", repos.ErrorWebhookLeaseLost, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestWebhookDispatcherRetriesWithBackoff(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	receiver, received := getWebhookReceiver(t, http.StatusInternalServerError)
+	expectWebhookClaim(mockDBPool, receiver.URL, 2)
+	expectAllTenantsTx(mockDBPool)
+	// the second failure waits twice the base backoff
+	statusCode := http.StatusInternalServerError
+	mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), next_attempt_at = (.+) AND status = 'pending' AND attempts = (.+)").
+		WithArgs(models.WebhookDeliveryPending, float64(120), &statusCode, "unexpected status 500 Internal Server Error", int64(7), 2).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockDBPool.ExpectCommit()
+	dispatcher := webhook.NewDispatcher(mockDBPool, getMockWebhookConfig())
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	<-received
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestWebhookDispatcherDeadLettersAfterLastAttempt(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// nothing listens on a closed receiver
+	receiver, _ := getWebhookReceiver(t, http.StatusOK)
+	receiver.Close()
+	expectWebhookClaim(mockDBPool, receiver.URL, 3)
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), next_attempt_at = (.+) AND status = 'pending' AND attempts = (.+)").
+		WithArgs(models.WebhookDeliveryDead, float64(0), (*int)(nil), pgxmock.AnyArg(), int64(7), 3).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockDBPool.ExpectCommit()
+	dispatcher := webhook.NewDispatcher(mockDBPool, getMockWebhookConfig())
+	if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestWebhookDispatcherDeniesPrivateAddresses(t *testing.T) {
+	receiver, received := getWebhookReceiver(t, http.StatusOK)
+	for _, url := range []string{
+		receiver.URL,
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/",
+		"http://192.168.1.1:8080/",
+		"http://[::1]/",
+		"http://0.0.0.0/",
+	} {
+		t.Run(url, func(t *testing.T) {
+			_, mockDBPool := getMockDependencies()
+			expectWebhookClaim(mockDBPool, url, 1)
+			expectAllTenantsTx(mockDBPool)
+			mockDBPool.ExpectExec("UPDATE webhook_deliveries SET status = (.+), next_attempt_at = (.+) AND status = 'pending' AND attempts = (.+)").
+				WithArgs(models.WebhookDeliveryPending, float64(60), (*int)(nil), privateAddressError{}, int64(7), 1).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			mockDBPool.ExpectCommit()
+			config := getMockWebhookConfig()
+			config.AllowPrivateNetworks = false
+			dispatcher := webhook.NewDispatcher(mockDBPool, config)
+			if _, err := dispatcher.DispatchDue(context.Background()); err != nil {
+				t.Fatalf("Expected no error, but got %s", err)
+			}
+			if err := mockDBPool.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled DB expectations: %s", err)
+			}
+		})
+	}
+	select {
+	case <-received:
+		t.Errorf("Expected the loopback receiver not to be reached")
+	default:
+	}
+}
+
+// privateAddressError matches the recorded error of a delivery denied by
+// webhook.ErrorPrivateAddress
+type privateAddressError struct{}
+
+func (privateAddressError) Match(v any) bool {
+	message, ok := v.(string)
+	return ok && strings.HasSuffix(message, webhook.ErrorPrivateAddress.Error())
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	config := getMockWebhookConfig()
+	for attempt, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		6:  32 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	} {
+		if backoff := config.Backoff(attempt); backoff != expected {
+			t.Errorf("Expected backoff %s after attempt %d, but got %s", expected, attempt, backoff)
+		}
+	}
+}
+
+func TestWebhookVerify(t *testing.T) {
+	body := []byte(mockWebhookPayload)
+	now := time.Now().Unix()
+	stale := time.Now().Add(-time.Hour).Unix()
+	tests := []struct {
+		name      string
+		timestamp int64
+		signature string
+		expected  error
+	}{
+		{"valid", now, webhook.Sign(mockWebhookSecret, now, body), nil},
+		{"other secret", now, webhook.Sign("whsec_other", now, body), webhook.ErrorInvalidSignature},
+		{"other timestamp", now, webhook.Sign(mockWebhookSecret, now-1, body), webhook.ErrorInvalidSignature},
+		{"stale", stale, webhook.Sign(mockWebhookSecret, stale, body), webhook.ErrorStaleTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(webhook.HeaderTimestamp, strconv.FormatInt(tt.timestamp, 10))
+			header.Set(webhook.HeaderSignature, tt.signature)
+			if err := webhook.Verify(mockWebhookSecret, header, body, 5*time.Minute); err != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"example-server/changefeed"
+	"example-server/middleware"
+	"example-server/routes"
+	"example-server/ws"
+)
+
+// HELPERS
+
+// getWebSocketURL serves /ws for mockTenant, returning its ws:// URL
+func getWebSocketURL(t *testing.T, listener *changefeed.Listener) string {
+	t.Helper()
+	t.Setenv("EVENTS_HEARTBEAT_INTERVAL", "1h")
+	deps, _ := getMockDependencies()
+	deps.Changes = listener
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupWebSocketRoutes(r, deps, withMockTenant)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func dialWebSocket(t *testing.T, url string) *ws.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := ws.Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", url, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func readMessage(t *testing.T, client *ws.Client) (ws.Message, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return client.Read(ctx)
+}
+
+func expectMessage(t *testing.T, client *ws.Client, expected string) {
+	t.Helper()
+	message, err := readMessage(t, client)
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", expected, err)
+	}
+	// Compare as sent over the wire
+	actual, _ := json.Marshal(message)
+	if string(actual) != expected {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+}
+
+// expectClose reads until the server hangs up with code
+func expectClose(t *testing.T, client *ws.Client, code int) {
+	t.Helper()
+	for {
+		_, err := readMessage(t, client)
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != code {
+			t.Errorf("Expected close code %d, but got %v", code, err)
+		}
+		return
+	}
+}
+
+// TESTS
+
+func TestWebSocketSubscribe(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	client := dialWebSocket(t, getWebSocketURL(t, listener))
+	if _, err := client.Subscribe(1, 2); err != nil {
+		t.Fatalf("Error subscribing: %s", err)
+	}
+	expectMessage(t, client, `{"type":"subscribe","id":"1","item_ids":[1,2]}`)
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 3, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: "tenant-b"})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: mockTenant})
+	expectMessage(t, client, `{"type":"event","event":{"op":"updated","id":2,"tenant_id":"tenant-a"}}`)
+	if _, err := client.Unsubscribe(2); err != nil {
+		t.Fatalf("Error unsubscribing: %s", err)
+	}
+	expectMessage(t, client, `{"type":"unsubscribe","id":"2","item_ids":[1]}`)
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 2, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	expectMessage(t, client, `{"type":"event","event":{"op":"deleted","id":1,"tenant_id":"tenant-a"}}`)
+	if _, err := client.Ping(); err != nil {
+		t.Fatalf("Error pinging: %s", err)
+	}
+	expectMessage(t, client, `{"type":"pong","id":"3"}`)
+}
+
+func TestWebSocketRejectsInvalidRequests(t *testing.T) {
+	t.Setenv("WS_MAX_SUBSCRIPTIONS", "2")
+	client := dialWebSocket(t, getWebSocketURL(t, changefeed.NewListener(nil)))
+	client.Subscribe()
+	expectMessage(t, client, `{"type":"error","id":"1","error":"missing item_ids"}`)
+	client.Subscribe(1, 2, 3)
+	expectMessage(t, client, `{"type":"error","id":"2","error":"too many subscriptions"}`)
+	client.Subscribe(1, 2, 2)
+	expectMessage(t, client, `{"type":"subscribe","id":"3","item_ids":[1,2]}`)
+	// Raw frames
+	conn, _, err := websocket.DefaultDialer.Dial(getWebSocketURL(t, changefeed.NewListener(nil)), nil)
+	if err != nil {
+		t.Fatalf("Error dialing: %s", err)
+	}
+	defer conn.Close()
+	for message, expected := range map[string]string{
+		`not json`:                  `{"type":"error","error":"invalid message"}`,
+		`{"type":"shout","id":"a"}`: `{"type":"error","id":"a","error":"unknown message type"}`,
+	} {
+		conn.WriteMessage(websocket.TextMessage, []byte(message))
+		_, actual, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Error reading reply to %s: %s", message, err)
+		}
+		if strings.TrimSpace(string(actual)) != expected {
+			t.Errorf("Expected %s, but got %s", expected, actual)
+		}
+	}
+}
+
+func TestWebSocketDisconnectsSlowConsumers(t *testing.T) {
+	t.Setenv("WS_SEND_BUFFER", "1")
+	listener := changefeed.NewListener(nil)
+	client := dialWebSocket(t, getWebSocketURL(t, listener))
+	client.Subscribe(1)
+	expectMessage(t, client, `{"type":"subscribe","id":"1","item_ids":[1]}`)
+	// Publish faster than a single message queue drains
+	for i := 0; i < 1000; i++ {
+		listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: mockTenant})
+	}
+	expectClose(t, client, websocket.ClosePolicyViolation)
+}
+
+func TestWebSocketClosesWhenListenerStops(t *testing.T) {
+	listener := changefeed.NewListener(func(ctx context.Context) (changefeed.Conn, error) {
+		return nil, ctx.Err()
+	})
+	client := dialWebSocket(t, getWebSocketURL(t, listener))
+	// The subscription exists once the first request is answered
+	client.Ping()
+	expectMessage(t, client, `{"type":"pong","id":"1"}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	listener.Run(ctx)
+	expectClose(t, client, websocket.CloseGoingAway)
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	deps, _ := getMockDependencies()
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	routes.SetupWebSocketRoutes(r, deps, withMockTenant)
+	w := performRequestWithHeaders(r, "GET", "/ws", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusUpgradeRequired {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusUpgradeRequired, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Upgrade": "websocket"})
+	expectedBody := `{"error":"WebSocket upgrade required","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
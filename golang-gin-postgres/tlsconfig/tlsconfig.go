@@ -0,0 +1,158 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrorInvalidCertificate = errors.New("invalid TLS certificate")
+	ErrorInvalidClientCA    = errors.New("invalid client CA bundle")
+)
+
+// Config enables TLS when CertFile and KeyFile are set, and client
+// certificate verification (mTLS) when ClientCAFile is also set
+type Config struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// ClientCertOptional lets clients without a certificate connect and
+	// authenticate with a token or API key instead
+	ClientCertOptional bool
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration
+}
+
+// ConfigFromEnv reads the TLS_* environment variables
+func ConfigFromEnv() Config {
+	interval, err := time.ParseDuration(os.Getenv("TLS_RELOAD_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return Config{
+		CertFile:           os.Getenv("TLS_CERT_FILE"),
+		KeyFile:            os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile:       os.Getenv("TLS_CLIENT_CA_FILE"),
+		ClientCertOptional: os.Getenv("TLS_CLIENT_CERT_OPTIONAL") == "true",
+		ReloadInterval:     interval,
+	}
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+func (c Config) files() []string {
+	files := []string{c.CertFile, c.KeyFile}
+	if c.ClientCAFile != "" {
+		files = append(files, c.ClientCAFile)
+	}
+	return files
+}
+
+// Reloader serves the current certificate and client CAs, reloading them
+// when the files change or on SIGHUP. New handshakes use the new files while
+// established connections carry on.
+type Reloader struct {
+	config  Config
+	current atomic.Pointer[tls.Config]
+}
+
+func NewReloader(config Config) (*Reloader, error) {
+	r := &Reloader{config: config}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files, keeping the previous certificate when they are invalid
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return errors.Wrap(ErrorInvalidCertificate, err.Error())
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(ErrorInvalidClientCA, err.Error())
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return errors.Wrap(ErrorInvalidClientCA, "no certificates found")
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if r.config.ClientCertOptional {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	r.current.Store(tlsConfig)
+	return nil
+}
+
+// TLSConfig returns a config for http.Server that hands each handshake the
+// latest certificate and client CAs
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Watch reloads on SIGHUP and whenever a file's modification time or size
+// changes, until ctx is done
+func (r *Reloader) Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(r.config.ReloadInterval)
+	defer ticker.Stop()
+	stamps := r.stamps()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Info().Msg("SIGHUP received, reloading TLS certificates")
+		case <-ticker.C:
+			current := r.stamps()
+			if current == stamps {
+				continue
+			}
+			stamps = current
+			log.Info().Msg("TLS files changed, reloading certificates")
+		}
+		if err := r.Reload(); err != nil {
+			log.Error().Err(err).Msg("Failed to reload TLS certificates, keeping the previous ones")
+		}
+	}
+}
+
+// stamps fingerprints the files by modification time and size
+func (r *Reloader) stamps() string {
+	var stamps string
+	for _, file := range r.config.files() {
+		if info, err := os.Stat(file); err == nil {
+			stamps += info.ModTime().String() + "/" + strconv.FormatInt(info.Size(), 10) + ";"
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Supported OTEL_TRACES_EXPORTER values
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+const defaultServiceName = "example-server"
+
+// SetupTracing configures W3C trace context propagation and, unless the
+// exporter is "none", a global tracer provider. The returned func flushes and
+// shuts the provider down.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	exporterName := getExporterName()
+	exporter, err := newExporter(ctx, exporterName)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		log.Info().Msg("Tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	otel.SetTracerProvider(tp)
+	log.Info().Str("exporter", exporterName).Msg("Tracing setup complete")
+	return tp.Shutdown, nil
+}
+
+// ServiceName returns the service name reported on spans
+func ServiceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return defaultServiceName
+}
+
+func getExporterName() string {
+	if name := os.Getenv("OTEL_TRACES_EXPORTER"); name != "" {
+		return name
+	}
+	return ExporterNone
+}
+
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case ExporterOTLP:
+		// Endpoint and headers are read from the standard OTEL_EXPORTER_OTLP_* variables
+		return otlptracehttp.New(ctx)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", name)
+	}
+}
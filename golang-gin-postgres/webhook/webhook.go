@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"example-server/database"
+	"example-server/models"
+	"example-server/repos"
+)
+
+var (
+	ErrorInvalidSignature = errors.New("invalid webhook signature")
+	ErrorStaleTimestamp   = errors.New("stale webhook timestamp")
+	ErrorPrivateAddress   = errors.New("webhook address is not public")
+)
+
+// Headers sent with every delivery
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const secretPrefix = "whsec"
+
+// GenerateSecret returns a new random signing secret for a subscription
+func GenerateSecret() (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	return secretPrefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// Sign returns the X-Webhook-Signature of body sent at timestamp, an
+// HMAC-SHA256 keyed with secret over "<timestamp>.<body>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery the way receivers should: the signature must match
+// and the timestamp be within tolerance of now, which stops replays
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrorInvalidSignature
+	}
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(expected)) {
+		return ErrorInvalidSignature
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrorStaleTimestamp
+	}
+	return nil
+}
+
+type Config struct {
+	// PollInterval is how often due deliveries are looked for
+	PollInterval time.Duration
+	// BatchSize is how many deliveries are claimed and sent at once
+	BatchSize int
+	// Timeout bounds each delivery request
+	Timeout time.Duration
+	// MaxAttempts is how many attempts a delivery gets before it is dead
+	MaxAttempts int
+	// Retries wait BackoffBase, doubling per attempt up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// AllowPrivateNetworks lets deliveries reach loopback, private and
+	// link-local addresses, for local development only
+	AllowPrivateNetworks bool
+}
+
+// ConfigFromEnv reads WEBHOOK_POLL_INTERVAL (default 1s), WEBHOOK_BATCH_SIZE
+// (default 10), WEBHOOK_TIMEOUT (default 10s), WEBHOOK_MAX_ATTEMPTS (default
+// 8), WEBHOOK_BACKOFF_BASE (default 30s), WEBHOOK_BACKOFF_MAX (default 6h)
+// and WEBHOOK_ALLOW_PRIVATE_NETWORKS (default false)
+func ConfigFromEnv() Config {
+	return Config{
+		PollInterval:         durationFromEnv("WEBHOOK_POLL_INTERVAL", time.Second),
+		BatchSize:            intFromEnv("WEBHOOK_BATCH_SIZE", 10),
+		Timeout:              durationFromEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts:          intFromEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+		BackoffBase:          durationFromEnv("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+		BackoffMax:           durationFromEnv("WEBHOOK_BACKOFF_MAX", 6*time.Hour),
+		AllowPrivateNetworks: os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true",
+	}
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func intFromEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// Backoff is how long to wait after the given failed attempt, from 1
+func (c Config) Backoff(attempt int) time.Duration {
+	backoff := c.BackoffBase
+	for i := 1; i < attempt && backoff < c.BackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, c.BackoffMax)
+}
+
+// Dispatcher sends the deliveries written along with Item changes. Every
+// replica may run one: deliveries are claimed with SKIP LOCKED and leased for
+// twice the timeout, so one whose dispatcher died is sent again, making
+// delivery at least once.
+type Dispatcher struct {
+	dbPool database.PgxPoolIface
+	client *http.Client
+	config Config
+}
+
+func NewDispatcher(dbPool database.PgxPoolIface, config Config) *Dispatcher {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = denyPrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the receiver, escaping the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+		// Receivers must answer themselves rather than send deliveries on
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Dispatcher{dbPool: dbPool, client: client, config: config}
+}
+
+// denyPrivateAddress stops subscriptions from reaching the internal network,
+// such as the cloud metadata service at 169.254.169.254. It runs on the
+// resolved address of every connection, so DNS rebinding can't get around it.
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return errors.Wrap(ErrorPrivateAddress, host)
+	}
+	return nil
+}
+
+// Run dispatches due deliveries every poll interval until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	log.Info().Dur("pollInterval", d.config.PollInterval).Msg("Dispatching webhooks")
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Keep going while there is a backlog
+		for ctx.Err() == nil {
+			sent, err := d.DispatchDue(ctx)
+			if err != nil || sent < d.config.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// DispatchDue claims a batch of due deliveries and sends them concurrently,
+// returning how many were claimed
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	dispatches, err := repos.ClaimWebhookDeliveries(ctx, d.dbPool, d.config.BatchSize, 2*d.config.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, dispatch := range dispatches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.dispatch(ctx, dispatch)
+		}()
+	}
+	wg.Wait()
+	return len(dispatches), nil
+}
+
+// dispatch sends one delivery and records the outcome. Recording errors are
+// logged by repos, the lease then makes the delivery due again. A delivery
+// claimed again meanwhile is left to that claim.
+func (d *Dispatcher) dispatch(ctx context.Context, dispatch *models.WebhookDispatch) {
+	logger := log.With().Int64("deliveryId", dispatch.ID).Str("event", dispatch.Event).Int("attempt", dispatch.Attempts).Logger()
+	statusCode, err := d.send(ctx, dispatch)
+	if ctx.Err() != nil {
+		// Shutting down, the lease makes the delivery due again
+		return
+	}
+	var recordErr error
+	if err == nil {
+		logger.Info().Int("statusCode", statusCode).Msg("Webhook delivered")
+		recordErr = repos.RecordWebhookDelivered(ctx, d.dbPool, dispatch.ID, dispatch.Attempts, statusCode)
+	} else {
+		retryIn := time.Duration(-1)
+		if dispatch.Attempts < d.config.MaxAttempts {
+			retryIn = d.config.Backoff(dispatch.Attempts)
+			logger.Warn().Err(err).Int("statusCode", statusCode).Dur("retryIn", retryIn).Msg("Webhook delivery failed")
+		} else {
+			logger.Error().Err(err).Int("statusCode", statusCode).Msg("Webhook delivery dead after last attempt")
+		}
+		recordErr = repos.RecordWebhookFailed(ctx, d.dbPool, dispatch.ID, dispatch.Attempts, statusCode, err.Error(), retryIn)
+	}
+	if errors.Is(recordErr, repos.ErrorWebhookLeaseLost) {
+		logger.Warn().Msg("Webhook delivery lease lost to another claim, outcome not recorded")
+	}
+}
+
+// send POSTs the signed payload, any 2xx response counts as delivered
+func (d *Dispatcher) send(ctx context.Context, dispatch *models.WebhookDispatch) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dispatch.URL, bytes.NewReader(dispatch.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "example-server-webhooks/1")
+	req.Header.Set(HeaderID, strconv.FormatInt(dispatch.ID, 10))
+	req.Header.Set(HeaderEvent, dispatch.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(dispatch.Secret, timestamp, dispatch.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
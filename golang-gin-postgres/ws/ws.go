@@ -0,0 +1,282 @@
+package ws
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+
+	"example-server/changefeed"
+)
+
+var (
+	ErrorSlowConsumer         = errors.New("client fell behind on item events")
+	ErrorInvalidMessage       = errors.New("invalid message")
+	ErrorUnknownType          = errors.New("unknown message type")
+	ErrorMissingItemIds       = errors.New("missing item_ids")
+	ErrorTooManySubscriptions = errors.New("too many subscriptions")
+)
+
+// MessageType tells what a Message is for
+type MessageType string
+
+const (
+	// Sent by clients, and echoed back with the subscribed item_ids once done
+	TypeSubscribe   MessageType = "subscribe"
+	TypeUnsubscribe MessageType = "unsubscribe"
+	// Sent by clients, answered with a pong
+	TypePing MessageType = "ping"
+	TypePong MessageType = "pong"
+	// Sent by the server
+	TypeEvent MessageType = "event"
+	TypeError MessageType = "error"
+)
+
+// Message is a JSON text frame of the protocol, in either direction.
+// Replies carry the ID of the request they answer.
+type Message struct {
+	Type    MessageType       `json:"type"`
+	ID      string            `json:"id,omitempty"`
+	ItemIDs []int             `json:"item_ids,omitempty"`
+	Event   *changefeed.Event `json:"event,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+const (
+	DefaultSendBuffer       = 64
+	DefaultMaxSubscriptions = 1000
+	// MaxMessageBytes caps client messages, larger ones close the connection
+	MaxMessageBytes = 64 << 10
+	writeTimeout    = 10 * time.Second
+)
+
+type Config struct {
+	// SendBuffer is how many messages a client may fall behind by before it
+	// is disconnected
+	SendBuffer       int
+	MaxSubscriptions int
+	// Heartbeat is how often the server pings, clients that don't answer
+	// within two heartbeats are disconnected
+	Heartbeat time.Duration
+}
+
+// ConfigFromEnv reads WS_SEND_BUFFER (default 64), WS_MAX_SUBSCRIPTIONS
+// (default 1000) and EVENTS_HEARTBEAT_INTERVAL
+func ConfigFromEnv() Config {
+	config := Config{
+		SendBuffer:       DefaultSendBuffer,
+		MaxSubscriptions: DefaultMaxSubscriptions,
+		Heartbeat:        changefeed.HeartbeatFromEnv(),
+	}
+	if sendBuffer, err := strconv.Atoi(os.Getenv("WS_SEND_BUFFER")); err == nil && sendBuffer > 0 {
+		config.SendBuffer = sendBuffer
+	}
+	if maxSubscriptions, err := strconv.Atoi(os.Getenv("WS_MAX_SUBSCRIPTIONS")); err == nil && maxSubscriptions > 0 {
+		config.MaxSubscriptions = maxSubscriptions
+	}
+	return config
+}
+
+// upgrader keeps the default origin check: browsers may only connect from
+// the server's own origin, other clients send no Origin
+var upgrader = websocket.Upgrader{}
+
+// Serve upgrades the request, which must have been authenticated, and pushes
+// the changes to tenantID's Items the client subscribes to until either side
+// goes away. It returns why the connection ended, nil when the client closed
+// it; failed upgrades have already been answered.
+func Serve(w http.ResponseWriter, r *http.Request, changes *changefeed.Listener, tenantID string, config Config) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	s := &session{
+		conn:    conn,
+		config:  config,
+		send:    make(chan Message, config.SendBuffer),
+		done:    make(chan struct{}),
+		itemIds: map[int]bool{},
+	}
+	subscription := changes.Subscribe(tenantID)
+	defer subscription.Close()
+	go s.writeLoop()
+	go s.forward(subscription)
+	s.readLoop()
+	return s.err
+}
+
+// session is one connection. Its reader handles requests, forward filters
+// the change feed, and the writer alone writes messages, taking them from a
+// bounded queue so a slow client can't hold up the feed.
+type session struct {
+	conn   *websocket.Conn
+	config Config
+	send   chan Message
+	done   chan struct{}
+	once   sync.Once
+	err    error
+	// mu guards itemIds and orders queueing, so a subscription is
+	// acknowledged before the events it lets through
+	mu      sync.Mutex
+	itemIds map[int]bool
+}
+
+// end stops the session once, telling the client why with a close frame
+func (s *session) end(err error, code int, reason string) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+		message := websocket.FormatCloseMessage(code, reason)
+		_ = s.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+		_ = s.conn.Close()
+	})
+}
+
+// enqueue hands message to the writer, or ends the session when the client
+// is too far behind to take it
+func (s *session) enqueue(message Message) bool {
+	select {
+	case <-s.done:
+		return false
+	case s.send <- message:
+		return true
+	default:
+		s.end(ErrorSlowConsumer, websocket.ClosePolicyViolation, "slow consumer")
+		return false
+	}
+}
+
+func (s *session) readLoop() {
+	pongWait := 2 * s.config.Heartbeat
+	s.conn.SetReadLimit(MaxMessageBytes)
+	_ = s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				err = nil
+			}
+			s.end(err, websocket.CloseNormalClosure, "")
+			return
+		}
+		s.mu.Lock()
+		ok := s.enqueue(s.handle(data))
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// handle answers a client message, it must be called with s.mu held
+func (s *session) handle(data []byte) Message {
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return Message{Type: TypeError, Error: ErrorInvalidMessage.Error()}
+	}
+	switch message.Type {
+	case TypeSubscribe, TypeUnsubscribe:
+		itemIds, err := s.update(message.Type, message.ItemIDs)
+		if err != nil {
+			return Message{Type: TypeError, ID: message.ID, Error: err.Error()}
+		}
+		return Message{Type: message.Type, ID: message.ID, ItemIDs: itemIds}
+	case TypePing:
+		return Message{Type: TypePong, ID: message.ID}
+	}
+	return Message{Type: TypeError, ID: message.ID, Error: ErrorUnknownType.Error()}
+}
+
+// update adds or removes itemIds, returning the Items now subscribed to
+func (s *session) update(messageType MessageType, itemIds []int) ([]int, error) {
+	if len(itemIds) == 0 {
+		return nil, ErrorMissingItemIds
+	}
+	if messageType == TypeSubscribe {
+		added := map[int]bool{}
+		for _, itemId := range itemIds {
+			if !s.itemIds[itemId] {
+				added[itemId] = true
+			}
+		}
+		if len(s.itemIds)+len(added) > s.config.MaxSubscriptions {
+			return nil, ErrorTooManySubscriptions
+		}
+	}
+	for _, itemId := range itemIds {
+		if messageType == TypeSubscribe {
+			s.itemIds[itemId] = true
+		} else {
+			delete(s.itemIds, itemId)
+		}
+	}
+	subscribed := make([]int, 0, len(s.itemIds))
+	for itemId := range s.itemIds {
+		subscribed = append(subscribed, itemId)
+	}
+	slices.Sort(subscribed)
+	return subscribed, nil
+}
+
+// forward queues the changes to subscribed Items until the feed ends
+func (s *session) forward(subscription *changefeed.Subscription) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				err := subscription.Err()
+				if errors.Is(err, changefeed.ErrorSlowSubscriber) {
+					s.end(err, websocket.ClosePolicyViolation, "slow consumer")
+				} else {
+					s.end(err, websocket.CloseGoingAway, "item events stopped")
+				}
+				return
+			}
+			s.mu.Lock()
+			ok = !s.itemIds[event.ID] || s.enqueue(Message{Type: TypeEvent, Event: &event})
+			s.mu.Unlock()
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (s *session) writeLoop() {
+	ticker := time.NewTicker(s.config.Heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			err = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		case message := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err = s.conn.WriteJSON(message)
+		}
+		// A client that stops reading shows up as a write timeout
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			s.end(ErrorSlowConsumer, websocket.ClosePolicyViolation, "slow consumer")
+			return
+		}
+		if err != nil {
+			s.end(err, websocket.CloseInternalServerErr, "")
+			return
+		}
+	}
+}
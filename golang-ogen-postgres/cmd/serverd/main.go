@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,29 +10,114 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 
+	"example-server/internal/admin"
+	"example-server/internal/auth"
+	"example-server/internal/bulk"
+	"example-server/internal/cache"
+	"example-server/internal/changefeed"
 	"example-server/internal/database"
 	"example-server/internal/dependencies"
+	"example-server/internal/health"
 	"example-server/internal/logger"
+	"example-server/internal/middleware"
+	"example-server/internal/migrate"
 	"example-server/internal/openapi"
 	"example-server/internal/openapi/ogen"
+	"example-server/internal/operations"
+	"example-server/internal/outbox"
+	"example-server/internal/ratelimit"
+	"example-server/internal/scheduler"
+	"example-server/internal/tlsconfig"
+	"example-server/internal/tracing"
+	"example-server/internal/webhook"
+	"example-server/internal/ws"
+	"example-server/migrations"
 )
 
 func main() {
 	// Initialize logger
 	logger.SetupGlobalLogger()
 
+	migrateOnStart := flag.Bool("migrate-on-start", false, "apply pending migrations before serving, one replica at a time")
+	flag.Parse()
+
 	// Create context that listens for the interrupt signal from the OS
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	// Run `serverd migrate ...` instead of serving
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Setup tracing
+	shutdownTracing, err := tracing.SetupTracing(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+	defer shutdownTracing(context.Background())
+
 	// Setup dependencies
 	dbPool, _ := database.SetupDB()
+	itemCache, err := cache.New(cache.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup cache")
+	}
 	deps := dependencies.NewDependencies(
 		dbPool,
+		database.NewQueryMetrics(prometheus.DefaultRegisterer),
+		cache.NewItemCache(itemCache, cache.NewMetrics(prometheus.DefaultRegisterer)),
 	)
 	defer deps.CleanupDependencies()
+	// Apply pending migrations before anything uses the schema
+	migrator, err := migrate.New(deps.DBPool, migrations.FS)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load migrations")
+	}
+	if *migrateOnStart {
+		if _, err := migrator.Up(ctx, 0); err != nil {
+			log.Fatal().Err(err).Msg("Failed to migrate database")
+		}
+	}
+	// Listen for Item changes on a connection of its own
+	deps.Changes = changefeed.NewListener(changefeed.Connect(os.Getenv("DATABASE_URL")))
+	go deps.Changes.Run(ctx)
+	// Send webhook deliveries written along with Item changes
+	go webhook.NewDispatcher(deps.DBPool, webhook.ConfigFromEnv()).Run(ctx)
+	// Publish Item events written to the outbox along with Item changes
+	outboxConfig := outbox.ConfigFromEnv()
+	publisher, err := outbox.NewPublisher(outboxConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup outbox publisher")
+	}
+	defer publisher.Close()
+	go outbox.NewRelay(deps.DBPool, publisher, outboxConfig, outbox.NewMetrics(prometheus.DefaultRegisterer)).Run(ctx)
+	// Run queued long-running operations such as async imports
+	go operations.NewRunner(deps.DBPool, operations.ConfigFromEnv()).Run(ctx)
+	// Run periodic maintenance tasks on their schedules
+	scheduleConfig, err := scheduler.ConfigFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load schedules")
+	}
+	taskScheduler, err := scheduler.New(
+		deps.DBPool,
+		scheduleConfig,
+		scheduler.Tasks(deps.DBPool),
+		scheduler.NewMetrics(prometheus.DefaultRegisterer),
+	)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup scheduler")
+	}
+	go taskScheduler.Run(ctx)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -39,22 +125,124 @@ func main() {
 		port = "8000"
 	}
 
+	// Setup JWT verification
+	verifier, err := auth.NewVerifier(ctx, auth.ConfigFromEnv())
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup authentication")
+	}
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load authorization policy")
+	}
+
+	// Setup per-client rate limiting
+	rateLimits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load rate limits")
+	}
+	trustedProxies, err := ratelimit.TrustedProxiesFromEnv()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse trusted proxies")
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), rateLimits)
+
 	// Create OGEN server for items API
-	itemsOgenServer, err := ogen.NewServer(&openapi.ItemsService{Deps: deps})
+	itemsService := &openapi.ItemsService{Deps: deps}
+	securityHandler := &openapi.SecurityHandler{Verifier: verifier, APIKeys: deps.APIKeys, Policy: policy}
+	itemsOgenServer, err := ogen.NewServer(
+		itemsService,
+		securityHandler,
+		ogen.WithTracerProvider(otel.GetTracerProvider()),
+		ogen.WithErrorHandler(openapi.ErrorHandler),
+		ogen.WithMiddleware(
+			openapi.RateLimitMiddleware(limiter, trustedProxies),
+			openapi.TenantMiddleware,
+		),
+	)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create OGEN server")
 	}
 
+	// Route Prometheus metrics alongside the items API
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("GET /readyz", &health.Readiness{Migrator: migrator})
+	// Limit client IPs before authentication, and callers after it
+	limitClientIP := func(next http.Handler) http.Handler {
+		return openapi.ClientIPRateLimit(next, itemsOgenServer, itemsService, limiter, trustedProxies)
+	}
+	mux.Handle("/", limitClientIP(ratelimit.WithResponseHeader(itemsOgenServer)))
+
+	// Route the Item stream, item event stream and WebSocket next to the
+	// items API, as ogen can't stream them
+	streamGuard := &openapi.StreamGuard{
+		Service:        itemsService,
+		Security:       securityHandler,
+		Limiter:        limiter,
+		TrustedProxies: trustedProxies,
+	}
+	mux.Handle("GET /items/stream", limitClientIP(&openapi.ItemStreamHandler{
+		Guard:   streamGuard,
+		MaxRows: bulk.StreamMaxRowsFromEnv(),
+	}))
+	mux.Handle("GET /items/events", limitClientIP(&openapi.ItemEventsHandler{
+		Guard:     streamGuard,
+		Heartbeat: changefeed.HeartbeatFromEnv(),
+	}))
+	mux.Handle("GET /ws", limitClientIP(&openapi.WebSocketHandler{Guard: streamGuard, Config: ws.ConfigFromEnv()}))
+
+	// Route the admin API, enabled when ADMIN_TOKEN is set
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		mux.Handle("/admin/", admin.NewHandler(deps, adminToken))
+	} else {
+		log.Warn().Msg("ADMIN_TOKEN not set, admin API disabled")
+	}
+
+	// Wrap with request ID, access log, tracing, CORS, security header, body
+	// size and compression middleware
+	compressed := middleware.Compress(mux, middleware.CompressionConfigFromEnv())
+	limitBody := func(limit int64) http.Handler {
+		return middleware.MaxBodySize(middleware.Decompress(compressed, limit), limit)
+	}
+	handler := middleware.ForImports(
+		limitBody(middleware.ImportMaxBodyBytesFromEnv()),
+		limitBody(middleware.MaxBodyBytesFromEnv()),
+	)
+	handler = middleware.CORS(handler, middleware.CORSConfigFromEnv())
+	handler = middleware.SecurityHeaders(handler, middleware.HSTSMaxAgeFromEnv())
+	handler = middleware.AccessLog(handler, itemsOgenServer)
+	handler = middleware.RequestID(handler)
+	handler = tracing.HTTPMiddleware(handler)
+
 	// Create HTTP server for items API
 	itemsHttpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%s", port),
-		Handler: itemsOgenServer,
+		Handler: handler,
+	}
+
+	// Serve TLS when TLS_CERT_FILE and TLS_KEY_FILE are set, reloading
+	// certificates on change or SIGHUP
+	tlsConfig := tlsconfig.ConfigFromEnv()
+	if tlsConfig.Enabled() {
+		reloader, err := tlsconfig.NewReloader(tlsConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load TLS certificates")
+		}
+		go reloader.Watch(ctx)
+		itemsHttpServer.TLSConfig = reloader.TLSConfig()
 	}
 
 	// Start items API server in a goroutine
 	go func() {
-		log.Info().Str("port", port).Msg("Starting server")
-		if err := itemsHttpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig.Enabled() {
+			log.Info().Str("port", port).Bool("mtls", tlsConfig.ClientCAFile != "").Msg("Starting server with TLS")
+			err = itemsHttpServer.ListenAndServeTLS("", "")
+		} else {
+			log.Info().Str("port", port).Msg("Starting server")
+			err = itemsHttpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("Failed to start server")
 		}
 	}()
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/migrate"
+	"example-server/migrations"
+)
+
+const migrateUsage = `usage: serverd migrate <command>
+
+commands:
+  up [N]      apply all pending migrations, or the next N
+  down N|all  revert the last N applied migrations, or all of them
+  status      print the schema version
+  force V     record version V as applied and clean, 0 for none, after
+              fixing a failed migration by hand`
+
+var errorUsage = errors.New(migrateUsage)
+
+// runMigrate runs `serverd migrate ...` against DATABASE_URL
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errorUsage
+	}
+	dbPool, _ := database.SetupDB()
+	defer dbPool.Close()
+	migrator, err := migrate.New(dbPool, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n := 0
+		if len(args) > 1 {
+			if n, err = countArg(args[1:]); err != nil {
+				return err
+			}
+		}
+		applied, err := migrator.Up(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		if len(args) != 2 {
+			return errorUsage
+		}
+		n := 0
+		if args[1] != "all" {
+			if n, err = countArg(args[1:]); err != nil {
+				return err
+			}
+		}
+		reverted, err := migrator.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d of %d", status.Version, status.Latest)
+		if status.Dirty {
+			fmt.Print(" (dirty)")
+		} else if status.Pending() {
+			fmt.Print(" (pending)")
+		}
+		fmt.Println()
+	case "force":
+		if len(args) != 2 {
+			return errorUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return errors.Errorf("invalid version %q", args[1])
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("forced version %d\n", version)
+	default:
+		return errorUsage
+	}
+	return nil
+}
+
+// countArg parses the single positive count of up and down
+func countArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errorUsage
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, errors.Errorf("invalid count %q", args[0])
+	}
+	return n, nil
+}
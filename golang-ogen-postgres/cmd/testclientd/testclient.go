@@ -3,20 +3,125 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"example-server/internal/auth"
 	"example-server/internal/openapi/ogen"
+	"example-server/internal/operations"
+	"example-server/internal/ws"
 
 	"github.com/fatih/color"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ogen-go/ogen/ogenerrors"
 )
 
 func timeId() int64 {
 	return time.Now().UnixNano()
 }
 
+// tokenSource authenticates with API_KEY, AUTH_TOKEN, or a short-lived HS256
+// token signed with AUTH_JWT_HS256_SECRET, holding the AUTH_SCOPE scopes or
+// every scope of the authorization policy
+type tokenSource struct {
+	token  string
+	apiKey string
+}
+
+func newTokenSource() (*tokenSource, error) {
+	if apiKey := os.Getenv("API_KEY"); apiKey != "" {
+		return &tokenSource{apiKey: apiKey}, nil
+	}
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		return &tokenSource{token: token}, nil
+	}
+	scope := os.Getenv("AUTH_SCOPE")
+	if scope == "" {
+		policy, err := auth.PolicyFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		scope = strings.Join(policy.Scopes(), " ")
+	}
+	claims := jwt.MapClaims{
+		"sub":       "testclient",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"tenant_id": "default",
+		"scope":     scope,
+	}
+	if tenantID := os.Getenv("TENANT_ID"); tenantID != "" {
+		claims["tenant_id"] = tenantID
+	}
+	if issuer := os.Getenv("AUTH_JWT_ISSUER"); issuer != "" {
+		claims["iss"] = issuer
+	}
+	if audience := os.Getenv("AUTH_JWT_AUDIENCE"); audience != "" {
+		claims["aud"] = audience
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("AUTH_JWT_HS256_SECRET")))
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSource{token: token}, nil
+}
+
+func (s *tokenSource) BearerAuth(ctx context.Context, operationName ogen.OperationName) (ogen.BearerAuth, error) {
+	if s.token == "" {
+		return ogen.BearerAuth{}, ogenerrors.ErrSkipClientSecurity
+	}
+	return ogen.BearerAuth{Token: s.token}, nil
+}
+
+func (s *tokenSource) ApiKeyAuth(ctx context.Context, operationName ogen.OperationName) (ogen.ApiKeyAuth, error) {
+	if s.apiKey == "" {
+		return ogen.ApiKeyAuth{}, ogenerrors.ErrSkipClientSecurity
+	}
+	return ogen.ApiKeyAuth{APIKey: s.apiKey}, nil
+}
+
+// ClientCertAuth is left to the transport's TLS client certificate
+func (s *tokenSource) ClientCertAuth(ctx context.Context, operationName ogen.OperationName, req *http.Request) error {
+	return ogenerrors.ErrSkipClientSecurity
+}
+
+// header authenticates requests made outside the ogen client
+func (s *tokenSource) header() http.Header {
+	header := http.Header{}
+	if s.apiKey != "" {
+		header.Set("X-API-Key", s.apiKey)
+	} else {
+		header.Set("Authorization", "Bearer "+s.token)
+	}
+	if tenantID := os.Getenv("TENANT_ID"); tenantID != "" {
+		header.Set("X-Tenant-ID", tenantID)
+	}
+	return header
+}
+
+// tenantTransport sends TENANT_ID as the X-Tenant-ID header, for
+// cross-tenant credentials; others must name their own tenant
+type tenantTransport struct {
+	tenantID string
+}
+
+func (t *tenantTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Tenant-ID", t.tenantID)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
 func run(ctx context.Context) error {
-	client, err := ogen.NewClient("http://localhost:8000")
+	tokens, err := newTokenSource()
+	if err != nil {
+		return fmt.Errorf("failed to create token: %v", err)
+	}
+	var opts []ogen.ClientOption
+	if tenantID := os.Getenv("TENANT_ID"); tenantID != "" {
+		opts = append(opts, ogen.WithClient(&http.Client{Transport: &tenantTransport{tenantID: tenantID}}))
+	}
+	client, err := ogen.NewClient("http://localhost:8000", tokens, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %v", err)
 	}
@@ -35,6 +140,12 @@ func run(ctx context.Context) error {
 	if err := testDeleteItem(ctx, client); err != nil {
 		return err
 	}
+	if err := testBulkDeleteItems(ctx, client); err != nil {
+		return err
+	}
+	if err := testItemEvents(ctx, client, tokens); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -121,6 +232,83 @@ func testDeleteItem(ctx context.Context, client *ogen.Client) error {
 	return nil
 }
 
+// testBulkDeleteItems deletes a new Item and a missing one in the
+// background and polls the operation until it is finished
+func testBulkDeleteItems(ctx context.Context, client *ogen.Client) error {
+	createRes, err := client.CreateItem(ctx, &ogen.ItemCreateRequest{
+		Data: ogen.ItemIn{
+			Name:  fmt.Sprintf("Item-%d", timeId()),
+			Price: 19.99,
+		},
+	})
+	if err != nil {
+		color.New(color.FgRed).Println("Error creating item for bulk delete:", err)
+		return err
+	}
+	itemCreated := createRes.(*ogen.ItemCreateResponse).Data
+	accepted, err := client.BulkDeleteItems(ctx, &ogen.BulkDeleteRequest{
+		Data: ogen.BulkDeleteIn{Ids: []int64{itemCreated.ID, 0}},
+	})
+	if err != nil {
+		color.New(color.FgRed).Println("Error bulk deleting items:", err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	operation, err := operations.WaitAccepted(ctx, client, accepted, 500*time.Millisecond, func(operation *ogen.Operation) {
+		fmt.Printf("Operation %d %s: %d%%\n", operation.ID, operation.Status, operation.Progress)
+	})
+	if err != nil {
+		color.New(color.FgRed).Println("Error waiting for bulk delete:", err)
+		return err
+	}
+	if operation.Status != ogen.OperationStatusSucceeded {
+		err := fmt.Errorf("bulk delete %s: %s", operation.Status, operation.Error.Or(""))
+		color.New(color.FgRed).Println(err)
+		return err
+	}
+	color.New(color.FgGreen).Println(operation.Result)
+	return nil
+}
+
+// testItemEvents subscribes to Item 1 over the WebSocket and waits for the
+// event of updating it
+func testItemEvents(ctx context.Context, client *ogen.Client, tokens *tokenSource) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := ws.Dial(ctx, "ws://localhost:8000/ws", tokens.header())
+	if err != nil {
+		color.New(color.FgRed).Println("Error connecting to item events:", err)
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Subscribe(1); err != nil {
+		color.New(color.FgRed).Println("Error subscribing to item events:", err)
+		return err
+	}
+	for {
+		message, err := conn.Read(ctx)
+		if err != nil {
+			color.New(color.FgRed).Println("Error reading item events:", err)
+			return err
+		}
+		switch message.Type {
+		case ws.TypeError:
+			err := fmt.Errorf("item events: %s", message.Error)
+			color.New(color.FgRed).Println(err)
+			return err
+		case ws.TypeSubscribe:
+			// Only changes made after the subscription is acknowledged arrive
+			if err := testUpdateItem(ctx, client); err != nil {
+				return err
+			}
+		case ws.TypeEvent:
+			color.New(color.FgGreen).Println(*message.Event)
+			return nil
+		}
+	}
+}
+
 func main() {
 	ctx := context.Background()
 	err := run(ctx)
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+	"example-server/internal/jobs"
+	"example-server/internal/logger"
+	"example-server/internal/tracing"
+	"example-server/internal/webhook"
+)
+
+func main() {
+	// Initialize logger
+	logger.SetupGlobalLogger()
+
+	// Create context that listens for the interrupt signal from the OS
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Setup tracing
+	shutdownTracing, err := tracing.SetupTracing(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to setup tracing")
+	}
+	defer shutdownTracing(context.Background())
+
+	// Setup database with query metrics
+	dbPool, _ := database.SetupDB()
+	instrumentedPool := database.NewInstrumentedPool(dbPool, database.NewQueryMetrics(prometheus.DefaultRegisterer))
+	defer instrumentedPool.Close()
+
+	// Register job handlers
+	registry := jobs.NewRegistry()
+	jobs.Handle(registry, webhook.PruneDeliveries, webhook.HandlePruneDeliveries(instrumentedPool))
+
+	// Get metrics port from environment or use default
+	port := os.Getenv("WORKER_METRICS_PORT")
+	if port == "" {
+		port = "9100"
+	}
+
+	// Serve Prometheus metrics
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	metricsServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", port),
+		Handler: mux,
+	}
+	go func() {
+		log.Info().Str("port", port).Msg("Serving worker metrics")
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal().Err(err).Msg("Failed to start metrics server")
+		}
+	}()
+
+	// Run jobs until interrupted, letting running jobs finish
+	pool := jobs.NewPool(instrumentedPool, registry, jobs.ConfigFromEnv(), jobs.NewMetrics(prometheus.DefaultRegisterer))
+	pool.Run(ctx)
+	log.Info().Msg("Shutting down worker...")
+
+	// Create a deadline to wait for
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Shutdown metrics server gracefully
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Fatal().Err(err).Msg("Metrics server forced to shutdown")
+	}
+
+	log.Info().Msg("Worker exited properly")
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/logger"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+)
+
+// NewHandler serves the admin API under /admin/, guarded by the admin token
+func NewHandler(deps *dependencies.Dependencies, adminToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/loglevel", handleGetLogLevel)
+	mux.HandleFunc("PUT /admin/loglevel", handleSetLogLevel)
+	mux.HandleFunc("POST /admin/apikeys", handleCreateAPIKey(deps))
+	mux.HandleFunc("GET /admin/apikeys", handleGetAPIKeys(deps))
+	mux.HandleFunc("DELETE /admin/apikeys/{id}", handleRevokeAPIKey(deps))
+	mux.HandleFunc("GET /admin/jobs", handleGetJobs(deps))
+	mux.HandleFunc("GET /admin/jobs/{id}", handleGetJob(deps))
+	mux.HandleFunc("POST /admin/jobs/{id}/retry", handleRetryJob(deps))
+	mux.HandleFunc("GET /admin/scheduled-tasks", handleGetScheduledTasks(deps))
+	return middleware.AdminAuth(mux, adminToken)
+}
+
+func handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, models.LogLevelResponse{Level: zerolog.GlobalLevel().String()})
+}
+
+func handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var logLevelRequest models.LogLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&logLevelRequest); err != nil {
+		middleware.WriteDecodeError(w, r, err, "Invalid JSON payload")
+		return
+	}
+	level, err := logger.ParseLevel(logLevelRequest.Level)
+	if err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, "Invalid log level")
+		return
+	}
+	previous := logger.SetLevel(level)
+	writeJSON(w, http.StatusOK, models.LogLevelResponse{Level: level.String(), Previous: previous.String()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
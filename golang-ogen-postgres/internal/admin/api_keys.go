@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"example-server/internal/auth"
+	"example-server/internal/dependencies"
+	"example-server/internal/logger"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+	"example-server/internal/tenant"
+)
+
+func handleCreateAPIKey(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// Parse and validate request
+		var createAPIKeyRequest models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&createAPIKeyRequest); err != nil {
+			middleware.WriteDecodeError(w, r, err, "Invalid JSON payload")
+			return
+		}
+		apiKeyIn := createAPIKeyRequest.Data
+		if apiKeyIn.Owner == "" || len(apiKeyIn.Owner) > 100 || tenant.Validate(apiKeyIn.TenantID) != nil {
+			middleware.WriteError(w, r, http.StatusBadRequest, "Invalid API key data")
+			return
+		}
+		// Generate key and store its hash
+		key, prefix, keyHash, err := auth.GenerateAPIKey()
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error generating API key")
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		apiKey, err := repos.InsertAPIKey(ctx, deps.DBPool, prefix, keyHash, apiKeyIn)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to create API key")
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int("apiKeyId", apiKey.ID).
+			Str("owner", apiKey.Owner).
+			Str("tenant_id", apiKey.TenantID).
+			Msg("API key created")
+		writeJSON(w, http.StatusCreated, models.CreateAPIKeyResponse{Data: apiKey, Key: key})
+	}
+}
+
+func handleGetAPIKeys(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKeys, err := repos.FetchAPIKeys(r.Context(), deps.DBPool)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to query API keys")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.GetAPIKeysResponse{Data: apiKeys})
+	}
+}
+
+func handleRevokeAPIKey(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		apiKeyId, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusBadRequest, "Invalid API key ID")
+			return
+		}
+		apiKey, err := repos.RevokeAPIKey(ctx, deps.DBPool, apiKeyId)
+		if err != nil {
+			if errors.Is(err, repos.ErrorAPIKeyNotFound) {
+				middleware.WriteError(w, r, http.StatusNotFound, "API key not found")
+				return
+			}
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to revoke API key")
+			return
+		}
+		// Stop accepting the key on this instance right away
+		deps.APIKeys.Invalidate(apiKey.Prefix)
+		logger.FromContext(ctx).Info().
+			Int("apiKeyId", apiKey.ID).
+			Msg("API key revoked")
+		writeJSON(w, http.StatusOK, models.RevokeAPIKeyResponse{Data: apiKey})
+	}
+}
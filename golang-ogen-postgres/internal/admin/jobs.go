@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/logger"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+var jobStatuses = map[string]bool{
+	models.JobPending: true,
+	models.JobRunning: true,
+	models.JobDone:    true,
+	models.JobFailed:  true,
+}
+
+func handleGetJobs(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		status := query.Get("status")
+		if status != "" && !jobStatuses[status] {
+			middleware.WriteError(w, r, http.StatusBadRequest, "Invalid job status")
+			return
+		}
+		limit := 50
+		if value := query.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 100 {
+				middleware.WriteError(w, r, http.StatusBadRequest, "Invalid limit")
+				return
+			}
+		}
+		jobs, err := repos.FetchJobs(r.Context(), deps.DBPool, status, query.Get("kind"), limit)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to query jobs")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.GetJobsResponse{Data: jobs})
+	}
+}
+
+func handleGetJob(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusBadRequest, "Invalid job ID")
+			return
+		}
+		job, err := repos.FetchJobById(r.Context(), deps.DBPool, jobId)
+		if err != nil {
+			if errors.Is(err, repos.ErrorJobNotFound) {
+				middleware.WriteError(w, r, http.StatusNotFound, "Job not found")
+				return
+			}
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to query job")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.JobResponse{Data: job})
+	}
+}
+
+func handleRetryJob(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		jobId, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusBadRequest, "Invalid job ID")
+			return
+		}
+		job, err := repos.RetryJob(ctx, deps.DBPool, jobId)
+		if err != nil {
+			switch {
+			case errors.Is(err, repos.ErrorJobNotFound):
+				middleware.WriteError(w, r, http.StatusNotFound, "Job not found")
+			case errors.Is(err, repos.ErrorJobNotFailed):
+				middleware.WriteError(w, r, http.StatusConflict, "Only failed jobs can be retried")
+			case errors.Is(err, repos.ErrorJobExists):
+				middleware.WriteError(w, r, http.StatusConflict, "A job with the same unique key is already queued")
+			default:
+				middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to retry job")
+			}
+			return
+		}
+		logger.FromContext(ctx).Info().
+			Int64("jobId", job.ID).
+			Str("kind", job.Kind).
+			Msg("Job retried")
+		writeJSON(w, http.StatusOK, models.JobResponse{Data: job})
+	}
+}
@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"net/http"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+func handleGetScheduledTasks(deps *dependencies.Dependencies) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tasks, err := repos.FetchScheduledTasks(r.Context(), deps.DBPool)
+		if err != nil {
+			middleware.WriteError(w, r, http.StatusInternalServerError, "Failed to query scheduled tasks")
+			return
+		}
+		writeJSON(w, http.StatusOK, models.GetScheduledTasksResponse{Data: tasks})
+	}
+}
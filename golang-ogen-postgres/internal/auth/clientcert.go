@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// ClientCertificate returns the client certificate verified during the TLS
+// handshake, if any
+func ClientCertificate(state *tls.ConnectionState) (*x509.Certificate, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return state.VerifiedChains[0][0], true
+}
+
+// PrincipalFromCertificate maps a verified client certificate subject to a
+// principal: the common name is the subject, organizational units are scopes
+// and the first organization is the tenant
+func PrincipalFromCertificate(cert *x509.Certificate) *Principal {
+	principal := &Principal{
+		Method:    MethodClientCert,
+		Subject:   cert.Subject.CommonName,
+		Issuer:    cert.Issuer.String(),
+		Scopes:    cert.Subject.OrganizationalUnit,
+		ExpiresAt: cert.NotAfter,
+		Claims: map[string]interface{}{
+			"cert_subject": cert.Subject.String(),
+			"cert_serial":  cert.SerialNumber.Text(16),
+		},
+	}
+	if len(cert.Subject.Organization) > 0 {
+		principal.TenantID = cert.Subject.Organization[0]
+	}
+	return principal
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrorForbidden     = errors.New("forbidden")
+	ErrorInvalidPolicy = errors.New("invalid authorization policy")
+)
+
+//go:embed policy.yaml
+var defaultPolicy []byte
+
+// Policy maps operations to the scopes they require
+type Policy struct {
+	Operations map[string][]string `yaml:"operations"`
+}
+
+// ForbiddenError reports the scopes a principal lacks for an operation
+type ForbiddenError struct {
+	Operation     string
+	MissingScopes []string
+}
+
+func (e *ForbiddenError) Error() string {
+	if len(e.MissingScopes) == 0 {
+		return fmt.Sprintf("operation %s is not allowed by the policy", e.Operation)
+	}
+	return "missing required scopes: " + strings.Join(e.MissingScopes, ", ")
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return ErrorForbidden
+}
+
+// PolicyFromEnv loads AUTH_POLICY_FILE, falling back to the built-in policy
+func PolicyFromEnv() (*Policy, error) {
+	if path := os.Getenv("AUTH_POLICY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(ErrorInvalidPolicy, err.Error())
+		}
+		return ParsePolicy(data)
+	}
+	return ParsePolicy(defaultPolicy)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, errors.Wrap(ErrorInvalidPolicy, err.Error())
+	}
+	if len(policy.Operations) == 0 {
+		return nil, errors.Wrap(ErrorInvalidPolicy, "no operations")
+	}
+	for operation, scopes := range policy.Operations {
+		for _, scope := range scopes {
+			if strings.TrimSpace(scope) == "" {
+				return nil, errors.Wrapf(ErrorInvalidPolicy, "empty scope for %s", operation)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Scopes lists every scope the policy requires, sorted
+func (p *Policy) Scopes() []string {
+	seen := map[string]bool{}
+	var scopes []string
+	for _, required := range p.Operations {
+		for _, scope := range required {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// Authorize checks that principal holds every scope the operation requires;
+// operations missing from the policy are denied
+func (p *Policy) Authorize(principal *Principal, operation string) error {
+	required, ok := p.Operations[operation]
+	if !ok {
+		return &ForbiddenError{Operation: operation}
+	}
+	var missing []string
+	for _, scope := range required {
+		if !principal.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) > 0 {
+		return &ForbiddenError{Operation: operation, MissingScopes: missing}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 )
 
 type PgxPoolIface interface {
@@ -19,10 +20,25 @@ type PgxPoolIface interface {
 	Close()
 }
 
+// Queryer runs queries on a pool or in a transaction, for writes that callers
+// may want to make part of their own transaction
+type Queryer interface {
+	Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(context.Context, string, ...interface{}) pgx.Row
+	Query(context.Context, string, ...interface{}) (pgx.Rows, error)
+}
+
 func SetupDB() (PgxPoolIface, error) {
 	var dbpool *pgxpool.Pool
 	var err error
-	dbpool, err = pgxpool.New(context.Background(), os.Getenv("DATABASE_URL"))
+	config, err := pgxpool.ParseConfig(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse database config")
+		os.Exit(1)
+	}
+	// Trace queries with the global tracer provider
+	config.ConnConfig.Tracer = NewQueryTracer(otel.GetTracerProvider())
+	dbpool, err = pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 		os.Exit(1)
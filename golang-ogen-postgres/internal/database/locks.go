@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Advisory lock keys, one per job that must only run in one replica at a time
+const (
+	// LockOutboxRelay keeps outbox events in order by having a single relay
+	LockOutboxRelay int64 = 0x6f7574626f78
+	// LockScheduledTasks prefixes the keys of ScheduledTaskLock
+	LockScheduledTasks int64 = 0x73636864 << 32
+	// LockMigrations has replicas migrating on start take turns
+	LockMigrations int64 = 0x6d696772617465
+)
+
+// ScheduledTaskLock is the advisory lock key of the scheduled task name,
+// which only one replica runs at a time
+func ScheduledTaskLock(name string) int64 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(name))
+	return LockScheduledTasks | int64(hash.Sum32())
+}
+
+// AdvisoryXactLock waits for the advisory lock key and holds it until tx ends
+func AdvisoryXactLock(ctx context.Context, tx pgx.Tx, key int64) error {
+	_, err := tx.Exec(WithQueryName(ctx, "advisory_lock.wait"), "SELECT pg_advisory_xact_lock($1)", key)
+	return err
+}
+
+// TryAdvisoryXactLock takes the advisory lock key until tx ends, reporting
+// false without waiting when another transaction holds it
+func TryAdvisoryXactLock(ctx context.Context, tx pgx.Tx, key int64) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(
+		WithQueryName(ctx, "advisory_lock.try"),
+		"SELECT pg_try_advisory_xact_lock($1)",
+		key,
+	).Scan(&locked)
+	return locked, err
+}
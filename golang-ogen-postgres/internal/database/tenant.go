@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithTenantTx runs fn in a transaction scoped to tenantID. The tenant is
+// set with set_config(..., true), the parameterized form of SET LOCAL, so it
+// only lasts until the transaction ends and is read by the row level
+// security policies.
+func WithTenantTx(ctx context.Context, dbPool PgxPoolIface, tenantID string, fn func(tx pgx.Tx) error) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(
+		WithQueryName(ctx, "tenant.set"),
+		"SELECT set_config('app.tenant_id', $1, true)",
+		tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// WithAllTenantsTx runs fn in a transaction that row level security policies
+// opting in with app.all_tenants let see every tenant's rows, for background
+// workers such as the webhook dispatcher. Request handlers use WithTenantTx.
+func WithAllTenantsTx(ctx context.Context, dbPool PgxPoolIface, fn func(tx pgx.Tx) error) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(
+		WithQueryName(ctx, "tenant.set_all"),
+		"SELECT set_config('app.all_tenants', 'on', true)",
+	)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -1,21 +1,44 @@
 package dependencies
 
 import (
+	"example-server/internal/auth"
+	"example-server/internal/cache"
+	"example-server/internal/changefeed"
 	"example-server/internal/database"
 )
 
 type Dependencies struct {
-	DBPool database.PgxPoolIface
+	DBPool  database.PgxPoolIface
+	APIKeys *auth.APIKeyAuthenticator
+	// Items is nil when caching is disabled
+	Items *cache.ItemCache
+	// Changes is set once the Item change listener is started
+	Changes *changefeed.Listener
 }
 
 func NewDependencies(
 	pgxPool database.PgxPoolIface,
+	queryMetrics *database.QueryMetrics,
+	itemCache *cache.ItemCache,
 ) *Dependencies {
+	// Instrument DB queries if metrics are enabled
+	if queryMetrics != nil {
+		pgxPool = database.NewInstrumentedPool(pgxPool, queryMetrics)
+	}
+	// Read Items through the cache if enabled
+	if itemCache != nil {
+		pgxPool = cache.NewPool(pgxPool, itemCache)
+	}
 	return &Dependencies{
-		DBPool: pgxPool,
+		DBPool:  pgxPool,
+		APIKeys: auth.NewAPIKeyAuthenticator(pgxPool, auth.APIKeyCacheTTLFromEnv()),
+		Items:   itemCache,
 	}
 }
 
 func (deps *Dependencies) CleanupDependencies() {
 	deps.DBPool.Close()
+	if deps.Items != nil {
+		deps.Items.Close()
+	}
 }
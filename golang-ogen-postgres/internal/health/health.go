@@ -0,0 +1,57 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"example-server/internal/logger"
+	"example-server/internal/migrate"
+)
+
+const (
+	StatusReady               = "ready"
+	StatusDatabaseUnavailable = "database_unavailable"
+	StatusSchemaDirty         = "schema_dirty"
+	StatusSchemaPending       = "schema_pending"
+)
+
+// ReadinessResponse is the body of the readiness endpoint
+type ReadinessResponse struct {
+	Status string          `json:"status"`
+	Schema *migrate.Status `json:"schema,omitempty"`
+}
+
+// Readiness reports whether this replica can take traffic: the database
+// answers and its schema is clean and at least at the latest migration
+// the binary knows. A newer schema is fine, as during a rolling deploy.
+type Readiness struct {
+	Migrator *migrate.Migrator
+}
+
+func (h *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	schema, err := h.Migrator.Status(r.Context())
+	if err != nil {
+		logger.FromContext(r.Context()).Warn().Err(err).Msg("Readiness check failed")
+		writeJSON(w, http.StatusServiceUnavailable, ReadinessResponse{Status: StatusDatabaseUnavailable})
+		return
+	}
+	response := ReadinessResponse{Status: StatusReady, Schema: &schema}
+	switch {
+	case schema.Dirty:
+		response.Status = StatusSchemaDirty
+	case schema.Pending():
+		response.Status = StatusSchemaPending
+	}
+	code := http.StatusOK
+	if response.Status != StatusReady {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, response)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
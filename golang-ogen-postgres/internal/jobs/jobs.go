@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+var ErrorInvalidPayload = errors.New("invalid job payload")
+
+// DefaultMaxAttempts is how many attempts jobs of a Kind without MaxAttempts
+// get
+const DefaultMaxAttempts = 5
+
+// Kind names a type of job and the arguments T its jobs carry as JSON
+type Kind[T any] struct {
+	Name string
+	// MaxAttempts defaults to DefaultMaxAttempts
+	MaxAttempts int
+}
+
+type EnqueueOptions struct {
+	// RunAt schedules the job, it is due right away when zero
+	RunAt time.Time
+	// UniqueKey skips enqueuing with repos.ErrorJobExists while a pending or
+	// running job of the kind has the same key
+	UniqueKey string
+}
+
+// Enqueue adds a job with args, on a pool or in a transaction so that the job
+// only runs if it commits
+func (k Kind[T]) Enqueue(ctx context.Context, q database.Queryer, args T, options EnqueueOptions) (*models.Job, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, errors.Wrap(ErrorInvalidPayload, err.Error())
+	}
+	jobIn := models.JobIn{Kind: k.Name, Payload: payload, MaxAttempts: k.MaxAttempts}
+	if jobIn.MaxAttempts <= 0 {
+		jobIn.MaxAttempts = DefaultMaxAttempts
+	}
+	if !options.RunAt.IsZero() {
+		jobIn.RunAt = &options.RunAt
+	}
+	if options.UniqueKey != "" {
+		jobIn.UniqueKey = &options.UniqueKey
+	}
+	return repos.InsertJob(ctx, q, jobIn)
+}
+
+// handlerFunc runs a claimed job
+type handlerFunc func(ctx context.Context, job *models.Job) error
+
+// Registry maps job kinds to their handlers, a Pool only claims jobs of
+// registered kinds
+type Registry struct {
+	handlers map[string]handlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[string]handlerFunc{}}
+}
+
+// Handle registers handle for jobs of kind, decoding their payload into its
+// args. A payload that doesn't decode fails the job without retrying.
+func Handle[T any](r *Registry, kind Kind[T], handle func(ctx context.Context, job *models.Job, args T) error) {
+	r.handlers[kind.Name] = func(ctx context.Context, job *models.Job) error {
+		var args T
+		if err := json.Unmarshal(job.Payload, &args); err != nil {
+			return Permanent(errors.Wrap(ErrorInvalidPayload, err.Error()))
+		}
+		return handle(ctx, job, args)
+	}
+}
+
+// Kinds returns the registered kinds, sorted
+func (r *Registry) Kinds() []string {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error as not worth retrying, failing the job
+// right away
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+type Config struct {
+	// Concurrency is how many jobs run at once
+	Concurrency int
+	// PollInterval is how often due jobs are looked for
+	PollInterval time.Duration
+	// Timeout bounds each job, whose lease is twice as long
+	Timeout time.Duration
+	// Retries wait BackoffBase, doubling per attempt up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// ShutdownTimeout is how long running jobs get to finish on shutdown
+	// before they are stopped and handed back
+	ShutdownTimeout time.Duration
+}
+
+// ConfigFromEnv reads JOBS_CONCURRENCY (default 4), JOBS_POLL_INTERVAL
+// (default 1s), JOBS_TIMEOUT (default 5m), JOBS_BACKOFF_BASE (default 10s),
+// JOBS_BACKOFF_MAX (default 1h) and JOBS_SHUTDOWN_TIMEOUT (default 30s)
+func ConfigFromEnv() Config {
+	return Config{
+		Concurrency:     intFromEnv("JOBS_CONCURRENCY", 4),
+		PollInterval:    durationFromEnv("JOBS_POLL_INTERVAL", time.Second),
+		Timeout:         durationFromEnv("JOBS_TIMEOUT", 5*time.Minute),
+		BackoffBase:     durationFromEnv("JOBS_BACKOFF_BASE", 10*time.Second),
+		BackoffMax:      durationFromEnv("JOBS_BACKOFF_MAX", time.Hour),
+		ShutdownTimeout: durationFromEnv("JOBS_SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func intFromEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// Backoff is how long to wait after the given failed attempt, from 1
+func (c Config) Backoff(attempt int) time.Duration {
+	backoff := c.BackoffBase
+	for i := 1; i < attempt && backoff < c.BackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, c.BackoffMax)
+}
@@ -0,0 +1,226 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+var ErrorLeaseExpired = errors.New("job lease expired on its last attempt")
+
+// Job outcome labels
+const (
+	OutcomeDone     = "done"
+	OutcomeRetrying = "retrying"
+	OutcomeFailed   = "failed"
+	OutcomeReleased = "released"
+	// The job was claimed again after its lease expired, the outcome is left
+	// to that claim
+	OutcomeLeaseLost = "lease_lost"
+)
+
+// recordTimeout bounds recording a job's outcome, which happens after its
+// context may be done
+const recordTimeout = 5 * time.Second
+
+type Metrics struct {
+	processed *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	running   prometheus.Gauge
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		processed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "jobs_processed_total",
+				Help: "Number of jobs run by kind and outcome.",
+			},
+			[]string{"kind", "outcome"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "job_duration_seconds",
+				Help:    "Time taken to run a job, by kind.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"kind"},
+		),
+		running: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "jobs_running",
+				Help: "Number of jobs running in this worker.",
+			},
+		),
+	}
+	reg.MustRegister(m.processed, m.duration, m.running)
+	return m
+}
+
+// Pool runs jobs of the registered kinds, up to the configured concurrency.
+// Any number of pools may share the jobs table: jobs are claimed with SKIP
+// LOCKED and leased for twice the timeout, so one whose worker died runs
+// again, making jobs run at least once.
+type Pool struct {
+	dbPool   database.PgxPoolIface
+	registry *Registry
+	config   Config
+	metrics  *Metrics
+	slots    chan struct{}
+	wg       sync.WaitGroup
+	// jobCtx outlives the ctx given to Run so that shutdown lets running jobs
+	// finish, stopJobs cancels it once they took too long
+	jobCtx   context.Context
+	stopJobs context.CancelFunc
+}
+
+// NewPool returns a Pool, metrics may be nil
+func NewPool(dbPool database.PgxPoolIface, registry *Registry, config Config, metrics *Metrics) *Pool {
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	return &Pool{
+		dbPool:   dbPool,
+		registry: registry,
+		config:   config,
+		metrics:  metrics,
+		slots:    make(chan struct{}, config.Concurrency),
+		jobCtx:   jobCtx,
+		stopJobs: stopJobs,
+	}
+}
+
+// Run starts due jobs every poll interval until ctx is done, then shuts down
+func (p *Pool) Run(ctx context.Context) {
+	log.Info().
+		Strs("kinds", p.registry.Kinds()).
+		Int("concurrency", p.config.Concurrency).
+		Dur("pollInterval", p.config.PollInterval).
+		Msg("Running jobs")
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.Shutdown()
+			return
+		case <-ticker.C:
+		}
+		// Keep going while there is a backlog and free slots
+		for ctx.Err() == nil {
+			started, err := p.RunDue(ctx)
+			if err != nil || started == 0 {
+				break
+			}
+		}
+	}
+}
+
+// RunDue claims as many due jobs as there are free slots and starts them,
+// returning how many were started
+func (p *Pool) RunDue(ctx context.Context) (int, error) {
+	free := cap(p.slots) - len(p.slots)
+	if free == 0 {
+		return 0, nil
+	}
+	jobs, err := repos.ClaimJobs(ctx, p.dbPool, p.registry.Kinds(), free, 2*p.config.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range jobs {
+		p.slots <- struct{}{}
+		p.wg.Add(1)
+		go p.work(job)
+	}
+	return len(jobs), nil
+}
+
+// Shutdown waits for running jobs to finish, up to the shutdown timeout, then
+// stops them and hands them back to be claimed again. Run must have returned
+// or not be called anymore.
+func (p *Pool) Shutdown() {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(p.config.ShutdownTimeout):
+		log.Warn().Dur("shutdownTimeout", p.config.ShutdownTimeout).Msg("Stopping running jobs")
+		p.stopJobs()
+		<-done
+	}
+	p.stopJobs()
+}
+
+// work runs a claimed job and records the outcome. Recording errors are
+// logged by repos, the lease then makes the job due again. A job claimed
+// again meanwhile is left to that claim.
+func (p *Pool) work(job *models.Job) {
+	defer func() {
+		<-p.slots
+		p.wg.Done()
+	}()
+	logger := log.With().Int64("jobId", job.ID).Str("kind", job.Kind).Int("attempt", job.Attempts).Logger()
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// Its worker died or hung on the last attempt
+		err = Permanent(ErrorLeaseExpired)
+	} else {
+		err = p.run(job)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	var outcome string
+	var recordErr error
+	switch {
+	case err == nil:
+		logger.Info().Msg("Job done")
+		outcome, recordErr = OutcomeDone, repos.CompleteJob(ctx, p.dbPool, job.ID, job.Attempts)
+	case p.jobCtx.Err() != nil:
+		logger.Warn().Err(err).Msg("Job stopped by shutdown")
+		outcome, recordErr = OutcomeReleased, repos.ReleaseJob(ctx, p.dbPool, job.ID, job.Attempts)
+	case job.Attempts < job.MaxAttempts && !isPermanent(err):
+		retryIn := p.config.Backoff(job.Attempts)
+		logger.Warn().Err(err).Dur("retryIn", retryIn).Msg("Job failed")
+		outcome, recordErr = OutcomeRetrying, repos.FailJob(ctx, p.dbPool, job.ID, job.Attempts, err.Error(), retryIn)
+	default:
+		logger.Error().Err(err).Msg("Job failed for good")
+		outcome, recordErr = OutcomeFailed, repos.FailJob(ctx, p.dbPool, job.ID, job.Attempts, err.Error(), -1)
+	}
+	if errors.Is(recordErr, repos.ErrorJobLeaseLost) {
+		logger.Warn().Str("outcome", outcome).Msg("Job lease lost to another claim, outcome not recorded")
+		outcome = OutcomeLeaseLost
+	}
+	p.count(job.Kind, outcome)
+}
+
+// run calls the job's handler within the timeout, turning panics into errors
+func (p *Pool) run(job *models.Job) (err error) {
+	ctx, cancel := context.WithTimeout(p.jobCtx, p.config.Timeout)
+	defer cancel()
+	if p.metrics != nil {
+		p.metrics.running.Inc()
+		defer p.metrics.running.Dec()
+		defer prometheus.NewTimer(p.metrics.duration.WithLabelValues(job.Kind)).ObserveDuration()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return p.registry.handlers[job.Kind](ctx, job)
+}
+
+func (p *Pool) count(kind, outcome string) {
+	if p.metrics != nil {
+		p.metrics.processed.WithLabelValues(kind, outcome).Inc()
+	}
+}
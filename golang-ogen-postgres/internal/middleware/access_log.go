@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"example-server/internal/logger"
+	"example-server/internal/openapi/ogen"
+)
+
+// responseRecorder captures the status code and body size written by a handler
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack logs the connection as switched protocols, e.g. for a WebSocket
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// AccessLog writes one structured line per request once it has been served.
+// Routes are resolved against the ogen server so lines carry the path pattern.
+func AccessLog(next http.Handler, server *ogen.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		route := ""
+		if found, ok := server.FindPath(r.Method, r.URL); ok {
+			route = found.PathPattern()
+		}
+		l := logger.FromContext(r.Context())
+		var e *zerolog.Event
+		switch {
+		case rw.status >= http.StatusInternalServerError:
+			e = l.Error()
+		case rw.status >= http.StatusBadRequest:
+			e = l.Warn()
+		default:
+			e = l.Info()
+		}
+		e.Str("method", r.Method).
+			Str("route", route).
+			Str("path", r.URL.Path).
+			Int("status", rw.status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", rw.bytes).
+			Str("client_ip", clientIP(r)).
+			Msg("Request served")
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"example-server/internal/logger"
+)
+
+// AdminAuth requires the configured admin token as a bearer token
+func AdminAuth(next http.Handler, adminToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			logger.FromContext(r.Context()).Warn().
+				Str("path", r.URL.Path).
+				Msg("Unauthorized admin request")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			WriteError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteError writes an ErrorResponse-shaped body, including the request ID when set
+func WriteError(w http.ResponseWriter, r *http.Request, code int, errMsg string) {
+	body := map[string]string{"error": errMsg}
+	if requestId := logger.RequestIdFromContext(r.Context()); requestId != "" {
+		body["request_id"] = requestId
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"example-server/internal/logger"
+)
+
+const (
+	DefaultMaxBodyBytes       = 1 << 20
+	DefaultImportMaxBodyBytes = 32 << 20
+)
+
+// importPaths are the routes taking whole files as bodies
+var importPaths = map[string]bool{
+	"/items/import":       true,
+	"/items/import/async": true,
+}
+
+// MaxBodyBytesFromEnv reads MAX_BODY_BYTES, defaulting to 1 MiB
+func MaxBodyBytesFromEnv() int64 {
+	return bodyBytesFromEnv("MAX_BODY_BYTES", DefaultMaxBodyBytes)
+}
+
+// ImportMaxBodyBytesFromEnv reads IMPORT_MAX_BODY_BYTES, the limit of the
+// import routes, defaulting to 32 MiB
+func ImportMaxBodyBytesFromEnv() int64 {
+	return bodyBytesFromEnv("IMPORT_MAX_BODY_BYTES", DefaultImportMaxBodyBytes)
+}
+
+func bodyBytesFromEnv(key string, defaultValue int64) int64 {
+	limit, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil || limit <= 0 {
+		return defaultValue
+	}
+	return limit
+}
+
+// ForImports serves POSTs to the import routes with importHandler and other
+// requests with handler, so imports can be given a body limit of their own
+func ForImports(importHandler, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && importPaths[r.URL.Path] {
+			importHandler.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// MaxBodySize rejects request bodies over limit bytes with 413. Declared
+// lengths are checked upfront; chunked bodies fail with *http.MaxBytesError
+// once a handler reads past the limit, see WriteDecodeError.
+func MaxBodySize(next http.Handler, limit int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			logger.FromContext(r.Context()).Warn().
+				Int64("content_length", r.ContentLength).
+				Msg("Request body too large")
+			WriteError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteDecodeError reports bodies cut off by MaxBodySize with 413 and other
+// decode errors with 400 and errMsg
+func WriteDecodeError(w http.ResponseWriter, r *http.Request, err error, errMsg string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	WriteError(w, r, http.StatusBadRequest, errMsg)
+}
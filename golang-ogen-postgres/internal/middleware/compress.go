@@ -0,0 +1,317 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"example-server/internal/logger"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressionConfig lists the response encodings in order of preference and
+// the smallest body worth compressing
+type CompressionConfig struct {
+	Encodings []string
+	MinBytes  int
+}
+
+// CompressionConfigFromEnv reads COMPRESSION_ENCODINGS (default "zstd,gzip",
+// "none" disables compression) and COMPRESSION_MIN_BYTES (default 1024)
+func CompressionConfigFromEnv() CompressionConfig {
+	config := CompressionConfig{Encodings: []string{EncodingZstd, EncodingGzip}, MinBytes: 1024}
+	if encodings, ok := os.LookupEnv("COMPRESSION_ENCODINGS"); ok {
+		config.Encodings = nil
+		for _, encoding := range splitList(strings.ToLower(encodings)) {
+			if encoding == EncodingGzip || encoding == EncodingZstd {
+				config.Encodings = append(config.Encodings, encoding)
+			}
+		}
+	}
+	if minBytes, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_BYTES")); err == nil && minBytes >= 0 {
+		config.MinBytes = minBytes
+	}
+	return config
+}
+
+// Compress encodes responses with the preferred encoding the client accepts.
+// Bodies are buffered up to MinBytes, so small responses go out unencoded.
+func Compress(next http.Handler, config CompressionConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(config.Encodings) == 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), config.Encodings)
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: config.MinBytes, status: http.StatusOK}
+		defer writer.close(r)
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// Decompress decodes gzip and zstd request bodies, limiting the decoded size
+// to maxBytes so a small compressed body cannot expand without bound. Other
+// encodings are rejected with 415.
+func Decompress(next http.Handler, maxBytes int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := newDecoder(encoding, r.Body)
+		if err != nil {
+			logger.FromContext(r.Context()).Warn().
+				Str("content_encoding", encoding).
+				Msg("Unsupported request encoding")
+			w.Header().Set("Accept-Encoding", "gzip, zstd")
+			WriteError(w, r, http.StatusUnsupportedMediaType, "Unsupported content encoding")
+			return
+		}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		r.Body = http.MaxBytesReader(w, body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// negotiateEncoding picks the highest weighted encoding from Accept-Encoding,
+// breaking ties by the order of supported
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				weight = parsed
+			}
+		}
+		weights[name] = weight
+	}
+	best, bestWeight := "", 0.0
+	for _, encoding := range supported {
+		weight, ok := weights[encoding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+		if ok && weight > bestWeight {
+			best, bestWeight = encoding, weight
+		}
+	}
+	return best
+}
+
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		writer, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return writer
+	}}
+)
+
+func getEncoder(encoding string, w io.Writer) encoder {
+	if encoding == EncodingZstd {
+		writer := zstdWriters.Get().(*zstd.Encoder)
+		writer.Reset(w)
+		return writer
+	}
+	writer := gzipWriters.Get().(*gzip.Writer)
+	writer.Reset(w)
+	return writer
+}
+
+func putEncoder(e encoder) {
+	switch writer := e.(type) {
+	case *zstd.Encoder:
+		writer.Reset(nil)
+		zstdWriters.Put(writer)
+	case *gzip.Writer:
+		writer.Reset(nil)
+		gzipWriters.Put(writer)
+	}
+}
+
+func newDecoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		return &decodingBody{body: body, open: func() (io.Reader, func(), error) {
+			reader, err := gzip.NewReader(body)
+			return reader, func() {}, err
+		}}, nil
+	case EncodingZstd:
+		return &decodingBody{body: body, open: func() (io.Reader, func(), error) {
+			reader, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, nil, err
+			}
+			return reader, reader.Close, nil
+		}}, nil
+	}
+	return nil, http.ErrNotSupported
+}
+
+// decodingBody starts decoding on the first read, so a corrupt header shows
+// up as a decode error in the handler rather than in the middleware
+type decodingBody struct {
+	body    io.ReadCloser
+	open    func() (io.Reader, func(), error)
+	reader  io.Reader
+	release func()
+	err     error
+}
+
+func (d *decodingBody) Read(p []byte) (int, error) {
+	if d.reader == nil && d.err == nil {
+		d.reader, d.release, d.err = d.open()
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.reader.Read(p)
+}
+
+func (d *decodingBody) Close() error {
+	if d.release != nil {
+		d.release()
+	}
+	return d.body.Close()
+}
+
+// compressWriter holds back the status and the first minBytes of the body,
+// then either encodes everything or, when the handler wrote less, sends it as is
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minBytes    int
+	status      int
+	wroteHeader bool
+	buffer      []byte
+	encoder     encoder
+	bypass      bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	if w.bypass {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= w.minBytes {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// Flush sends what has been written so far, compressing it when possible,
+// so streamed responses are not held back by the threshold
+func (w *compressWriter) Flush() {
+	if !w.bypass && w.encoder == nil {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over, e.g. for a WebSocket, leaving the
+// response alone from then on
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.bypass = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// start decides on the encoding and sends the status once the body is known
+// to be large enough, or is flushed
+func (w *compressWriter) start() error {
+	buffer := w.buffer
+	w.buffer = nil
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" ||
+		w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		w.bypass = true
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(buffer)
+		return err
+	}
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.encoder = getEncoder(w.encoding, w.ResponseWriter)
+	_, err := w.encoder.Write(buffer)
+	return err
+}
+
+func (w *compressWriter) close(r *http.Request) {
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			logger.FromContext(r.Context()).Warn().Err(err).Msg("Failed to finish compressed response")
+		}
+		putEncoder(w.encoder)
+		w.encoder = nil
+		return
+	}
+	if w.bypass || !w.wroteHeader {
+		return
+	}
+	w.bypass = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buffer) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buffer)
+		w.buffer = nil
+	}
+}
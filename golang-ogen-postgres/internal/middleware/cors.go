@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CORSConfig configures cross-origin requests; CORS headers are only sent to
+// AllowedOrigins, where "*" allows any origin
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge lets browsers cache preflight responses
+	MaxAge time.Duration
+}
+
+// CORSConfigFromEnv reads the CORS_* environment variables; CORS is disabled
+// unless CORS_ALLOWED_ORIGINS is set
+func CORSConfigFromEnv() CORSConfig {
+	config := CORSConfig{
+		AllowedOrigins:   splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		AllowedMethods:   splitList(os.Getenv("CORS_ALLOWED_METHODS")),
+		AllowedHeaders:   splitList(os.Getenv("CORS_ALLOWED_HEADERS")),
+		ExposedHeaders:   splitList(os.Getenv("CORS_EXPOSED_HEADERS")),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+	}
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = []string{"Authorization", "Content-Type", "X-API-Key", RequestIdHeader, "X-Tenant-ID"}
+	}
+	if len(config.ExposedHeaders) == 0 {
+		config.ExposedHeaders = []string{
+			RequestIdHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+		}
+	}
+	maxAge, err := time.ParseDuration(os.Getenv("CORS_MAX_AGE"))
+	if err != nil {
+		maxAge = 10 * time.Minute
+	}
+	config.MaxAge = maxAge
+	// Browsers reject credentials with a wildcard origin
+	if config.AllowCredentials && config.allowsAnyOrigin() {
+		log.Warn().Msg("CORS_ALLOW_CREDENTIALS ignored with a wildcard origin")
+		config.AllowCredentials = false
+	}
+	return config
+}
+
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS adds CORS headers for allowed origins and answers preflight requests
+// with 204, or 403 for other origins, before next runs
+func CORS(next http.Handler, config CORSConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !config.allowsOrigin(origin) {
+			if preflight {
+				WriteError(w, r, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if config.allowsAnyOrigin() {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			if config.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if len(config.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
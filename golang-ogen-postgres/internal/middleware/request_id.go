@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"example-server/internal/logger"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// Accept caller-provided IDs only if they are short and log-safe
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID accepts or generates an X-Request-ID, echoes it on the response
+// and attaches a request-scoped logger to the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = uuid.NewString()
+		}
+		w.Header().Set(RequestIdHeader, requestId)
+		ctx := logger.NewRequestContext(r.Context(), requestId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
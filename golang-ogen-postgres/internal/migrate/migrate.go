@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"context"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+)
+
+var (
+	ErrorInvalidMigration = errors.New("invalid migration")
+	ErrorUnknownVersion   = errors.New("unknown migration version")
+	ErrorDirty            = errors.New("database is dirty, fix the failed migration and force its version")
+	ErrorNoDown           = errors.New("migration has no down file")
+)
+
+// fileName is <version>_<name>.<up|down>.sql, as the migrate CLI names them
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is the schema version of the database next to the migrations
+type Status struct {
+	// Version is the last applied migration, 0 for none
+	Version int `json:"version"`
+	// Dirty is set while a migration runs, and stays set if it failed
+	Dirty bool `json:"dirty"`
+	// Latest is the version of the last known migration
+	Latest int `json:"latest"`
+}
+
+// Pending reports whether migrations are left to apply
+func (s Status) Pending() bool {
+	return s.Version < s.Latest
+}
+
+// Migrator applies the migrations of a directory like the migrate CLI does,
+// sharing its schema_migrations table so either can take over: a single row
+// holds the version, marked dirty while a migration runs.
+type Migrator struct {
+	dbPool     database.PgxPoolIface
+	migrations []*Migration
+}
+
+// New reads the migrations in the root of fsys
+func New(dbPool database.PgxPoolIface, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Wrap(ErrorInvalidMigration, err.Error())
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return nil, errors.Wrapf(ErrorInvalidMigration, "%s: invalid version", entry.Name())
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, errors.Wrapf(ErrorInvalidMigration, "%s: version %d is also %s", entry.Name(), version, migration.Name)
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, errors.Wrap(ErrorInvalidMigration, err.Error())
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+	m := &Migrator{dbPool: dbPool}
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, errors.Wrapf(ErrorInvalidMigration, "version %d has no up file", migration.Version)
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return m, nil
+}
+
+// Latest is the version of the last migration, 0 for none
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status reads the schema version. A database never migrated is at 0.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	status := Status{Latest: m.Latest()}
+	err := m.dbPool.QueryRow(
+		database.WithQueryName(ctx, "schema_migrations.fetch"),
+		"SELECT version, dirty FROM schema_migrations LIMIT 1",
+	).Scan(&status.Version, &status.Dirty)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && pgErr.Code == "42P01":
+		// No migration applied, or none ever run
+		return status, nil
+	case err != nil:
+		return status, err
+	}
+	// The migrate CLI records a failed first down migration as -1
+	status.Version = max(status.Version, 0)
+	return status, nil
+}
+
+// Up applies up to n pending migrations, all of them when n is 0, and
+// returns how many it applied
+func (m *Migrator) Up(ctx context.Context, n int) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, false, func(status Status) error {
+		for _, migration := range m.migrations {
+			if migration.Version <= status.Version {
+				continue
+			}
+			if n > 0 && applied == n {
+				break
+			}
+			if err := m.apply(ctx, migration.Version, migration.Version, migration.Up); err != nil {
+				return errors.Wrapf(err, "migrating up to %d_%s", migration.Version, migration.Name)
+			}
+			log.Info().Int("version", migration.Version).Str("name", migration.Name).Msg("Applied migration")
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last n applied migrations, all of them when n is 0, and
+// returns how many it reverted
+func (m *Migrator) Down(ctx context.Context, n int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, false, func(status Status) error {
+		for i := len(m.migrations) - 1; i >= 0 && (n == 0 || reverted < n); i-- {
+			migration := m.migrations[i]
+			if migration.Version > status.Version {
+				continue
+			}
+			if migration.Down == "" {
+				return errors.Wrapf(ErrorNoDown, "%d_%s", migration.Version, migration.Name)
+			}
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, migration.Version, previous, migration.Down); err != nil {
+				return errors.Wrapf(err, "migrating down from %d_%s", migration.Version, migration.Name)
+			}
+			log.Info().Int("version", migration.Version).Str("name", migration.Name).Msg("Reverted migration")
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records version as applied and clean without running anything, to
+// recover from a failed migration once the database has been fixed by hand.
+// Version 0 records that no migration is applied.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return errors.Wrapf(ErrorUnknownVersion, "%d", version)
+	}
+	return m.withLock(ctx, true, func(Status) error {
+		return m.setVersion(ctx, version, false)
+	})
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
+
+// withLock runs fn with the migrations lock held, once the schema_migrations
+// table exists and, unless forcing, isn't dirty. Replicas wait for each
+// other; the lock is held by a transaction of its own, as migrations may not
+// run in one.
+func (m *Migrator) withLock(ctx context.Context, force bool, fn func(status Status) error) error {
+	tx, err := m.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := database.AdvisoryXactLock(ctx, tx, database.LockMigrations); err != nil {
+		return err
+	}
+	_, err = m.dbPool.Exec(
+		database.WithQueryName(ctx, "schema_migrations.create"),
+		"CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)",
+	)
+	if err != nil {
+		return err
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if !force {
+		if status.Dirty {
+			return errors.Wrapf(ErrorDirty, "version %d", status.Version)
+		}
+		if status.Version != 0 && m.find(status.Version) == nil {
+			return errors.Wrapf(ErrorUnknownVersion, "database is at %d", status.Version)
+		}
+	}
+	if err := fn(status); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// apply runs the SQL of the migration at version, recording target as the
+// version, dirty until the SQL succeeded
+func (m *Migrator) apply(ctx context.Context, version, target int, sql string) error {
+	if err := m.setVersion(ctx, target, true); err != nil {
+		return err
+	}
+	// Without arguments the statements of a file run in one go
+	if _, err := m.dbPool.Exec(database.WithQueryName(ctx, "migration."+strconv.Itoa(version)), sql); err != nil {
+		return err
+	}
+	return m.setVersion(ctx, target, false)
+}
+
+// setVersion replaces the row of schema_migrations. A clean version 0 is no
+// row, a dirty one -1, as the migrate CLI records them.
+func (m *Migrator) setVersion(ctx context.Context, version int, dirty bool) error {
+	ctx = database.WithQueryName(ctx, "schema_migrations.set")
+	tx, err := m.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "TRUNCATE schema_migrations"); err != nil {
+		return err
+	}
+	if version > 0 || dirty {
+		if version == 0 {
+			version = -1
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)", version, dirty); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
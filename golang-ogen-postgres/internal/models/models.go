@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Domain Models
 
@@ -16,3 +19,285 @@ type Item struct {
 	Name      string    `json:"name" example:"foo" format:"string"`
 	Price     float32   `json:"price" example:"3.14" format:"float64"`
 }
+
+// Bulk Models
+
+type ImportRowError struct {
+	Line  int    `json:"line" example:"3"`
+	Error string `json:"error" example:"invalid price"`
+}
+
+type ImportReport struct {
+	Inserted int              `json:"inserted" example:"10"`
+	Updated  int              `json:"updated" example:"2"`
+	Skipped  int              `json:"skipped" example:"1"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// Webhook Models
+
+// Item events, named after the change, sent to webhooks and through the
+// outbox
+const (
+	WebhookEventItemCreated = "item.created"
+	WebhookEventItemUpdated = "item.updated"
+	WebhookEventItemDeleted = "item.deleted"
+)
+
+// Webhook delivery statuses: pending until delivered, or dead once out of
+// attempts
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+type WebhookSubscriptionIn struct {
+	URL string `json:"url" example:"https://example.com/hooks/items"`
+	// Events to send, all when empty
+	Events []string `json:"events" example:"item.created"`
+	// Active defaults to true, inactive subscriptions get no deliveries
+	Active *bool `json:"active,omitempty" example:"true"`
+}
+
+type WebhookSubscription struct {
+	ID        int       `json:"id" example:"1" format:"int64"`
+	URL       string    `json:"url" example:"https://example.com/hooks/items"`
+	Secret    string    `json:"-" log:"redact"`
+	Events    []string  `json:"events" example:"item.created"`
+	Active    bool      `json:"active" example:"true"`
+	CreatedAt time.Time `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	UpdatedAt time.Time `json:"updated_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id" example:"1" format:"int64"`
+	SubscriptionID int             `json:"subscription_id" example:"1" format:"int64"`
+	Event          string          `json:"event" example:"item.created"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status" example:"pending"`
+	Attempts       int             `json:"attempts" example:"1"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastStatusCode *int            `json:"last_status_code" example:"500"`
+	LastError      *string         `json:"last_error" example:"unexpected status 500 Internal Server Error"`
+	CreatedAt      time.Time       `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	DeliveredAt    *time.Time      `json:"delivered_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+// WebhookPayload is the signed JSON body POSTed to subscribers
+type WebhookPayload struct {
+	Event      string    `json:"event" example:"item.created"`
+	TenantID   string    `json:"tenant_id" example:"acme"`
+	OccurredAt time.Time `json:"occurred_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	Data       *Item     `json:"data"`
+}
+
+// WebhookDispatch is a claimed delivery with what the dispatcher needs to
+// send it
+type WebhookDispatch struct {
+	ID       int64
+	Event    string
+	Payload  json.RawMessage
+	Attempts int
+	URL      string
+	Secret   string `log:"redact"`
+}
+
+// Outbox Models
+
+// OutboxEvent is a domain event waiting in the outbox to be published
+type OutboxEvent struct {
+	ID            int64
+	TenantID      string
+	AggregateType string
+	AggregateID   int
+	EventType     string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+}
+
+// Operation Models
+
+// Operation types
+const (
+	OperationItemImport     = "item.import"
+	OperationItemBulkDelete = "item.bulk_delete"
+)
+
+// Operation statuses: queued until claimed, running while leased, then
+// succeeded, failed or canceled
+const (
+	OperationQueued    = "queued"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCanceled  = "canceled"
+)
+
+// Operation is a long-running request run in the background, its input and
+// result are JSON of its type
+type Operation struct {
+	ID        int64
+	TenantID  string
+	Type      string
+	Status    string
+	Input     json.RawMessage
+	Total     int
+	Processed int
+	Result    json.RawMessage
+	Error     *string
+	// Attempts counts the claims of the operation, the last one being the
+	// current
+	Attempts    int
+	MaxAttempts int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// Progress is the percentage of the work done
+func (o *Operation) Progress() int {
+	if o.Total == 0 {
+		if o.Status == OperationSucceeded {
+			return 100
+		}
+		return 0
+	}
+	return o.Processed * 100 / o.Total
+}
+
+type BulkDeleteReport struct {
+	Deleted  int   `json:"deleted"`
+	NotFound []int `json:"not_found"`
+}
+
+// Job Models
+
+// Job statuses: pending until run, running while leased, then done, or failed
+// once out of attempts
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// JobIn is a job to enqueue
+type JobIn struct {
+	Kind    string
+	Payload json.RawMessage
+	// UniqueKey, when set, skips enqueuing while a pending or running job of
+	// the kind has it
+	UniqueKey *string
+	// RunAt defaults to now
+	RunAt       *time.Time
+	MaxAttempts int
+}
+
+// Job is a unit of background work of a kind, with its arguments as payload
+type Job struct {
+	ID          int64           `json:"id" example:"1" format:"int64"`
+	Kind        string          `json:"kind" example:"webhook.prune_deliveries"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status" example:"failed"`
+	UniqueKey   *string         `json:"unique_key" example:"daily"`
+	Attempts    int             `json:"attempts" example:"5"`
+	MaxAttempts int             `json:"max_attempts" example:"5"`
+	RunAt       time.Time       `json:"run_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LockedUntil *time.Time      `json:"locked_until" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastError   *string         `json:"last_error" example:"context deadline exceeded"`
+	CreatedAt   time.Time       `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	UpdatedAt   time.Time       `json:"updated_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	FinishedAt  *time.Time      `json:"finished_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type GetJobsResponse struct {
+	Data []*Job `json:"data"`
+}
+
+type JobResponse struct {
+	Data *Job `json:"data"`
+}
+
+// Scheduled Task Models
+
+// Scheduled task outcomes
+const (
+	ScheduledTaskSucceeded = "succeeded"
+	ScheduledTaskFailed    = "failed"
+)
+
+// ScheduledTask is the state of a periodic task of the scheduler
+type ScheduledTask struct {
+	Name           string     `json:"name" example:"webhook.prune_deliveries"`
+	Schedule       string     `json:"schedule" example:"0 3 * * *"`
+	NextRunAt      time.Time  `json:"next_run_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastRunAt      *time.Time `json:"last_run_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastDurationMs *int64     `json:"last_duration_ms" example:"120"`
+	LastOutcome    *string    `json:"last_outcome" example:"succeeded"`
+	LastError      *string    `json:"last_error" example:"context deadline exceeded"`
+	UpdatedAt      time.Time  `json:"updated_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+// ScheduledTaskRun is the outcome of running a scheduled task
+type ScheduledTaskRun struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	Err       error
+	// NextRunAt is when the task is due again
+	NextRunAt time.Time
+}
+
+type GetScheduledTasksResponse struct {
+	Data []*ScheduledTask `json:"data"`
+}
+
+// Admin Models
+
+type LogLevelRequest struct {
+	Level string `json:"level" example:"debug"`
+}
+
+type LogLevelResponse struct {
+	Level    string `json:"level" example:"debug"`
+	Previous string `json:"previous,omitempty" example:"info"`
+}
+
+type APIKeyIn struct {
+	Owner     string     `json:"owner" example:"billing-service"`
+	TenantID  string     `json:"tenant_id" example:"acme"`
+	Scopes    []string   `json:"scopes" example:"items:read"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2030-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id" example:"1" format:"int64"`
+	Prefix     string     `json:"prefix" example:"3f9a1c2b"`
+	KeyHash    []byte     `json:"-" log:"redact"`
+	Owner      string     `json:"owner" example:"billing-service"`
+	TenantID   string     `json:"tenant_id" example:"acme"`
+	Scopes     []string   `json:"scopes" example:"items:read"`
+	CreatedAt  time.Time  `json:"created_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	LastUsedAt *time.Time `json:"last_used_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+	ExpiresAt  *time.Time `json:"expires_at" example:"2030-01-01T00:00:00.000Z" format:"date-time"`
+	RevokedAt  *time.Time `json:"revoked_at" example:"2021-01-01T00:00:00.000Z" format:"date-time"`
+}
+
+type CreateAPIKeyRequest struct {
+	Data APIKeyIn `json:"data"`
+}
+
+type CreateAPIKeyResponse struct {
+	Data *APIKey `json:"data"`
+	// Key is only returned on creation
+	Key string `json:"key"`
+}
+
+type GetAPIKeysResponse struct {
+	Data []*APIKey `json:"data"`
+}
+
+type RevokeAPIKeyResponse struct {
+	Data *APIKey `json:"data"`
+}
@@ -0,0 +1,137 @@
+package openapi
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"example-server/internal/bulk"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/repos"
+)
+
+func (s *ItemsService) ExportItems(
+	ctx context.Context,
+	params ogen.ExportItemsParams,
+) (ogen.ExportItemsRes, error) {
+	format := bulk.Format(params.Format.Or(ogen.ExportItemsFormatCsv))
+	logger.FromContext(ctx).Info().Str("format", string(format)).Msg("Handling items export request")
+	// Stream Items
+	reader, err := s.streamItems(ctx, format)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Error exporting items")
+		return nil, s.NewError(ctx, err)
+	}
+	disposition := ogen.NewOptString(`attachment; filename="items.` + string(format) + `"`)
+	if format == bulk.FormatNDJSON {
+		return &ogen.ExportItemsOKApplicationXNdjsonHeaders{
+			ContentDisposition: disposition,
+			Response:           ogen.ExportItemsOKApplicationXNdjson{Data: reader},
+		}, nil
+	}
+	return &ogen.ExportItemsOKTextCsvHeaders{
+		ContentDisposition: disposition,
+		Response:           ogen.ExportItemsOKTextCsv{Data: reader},
+	}, nil
+}
+
+// streamItems encodes Items into a pipe as ogen copies it to the client. It
+// waits for the first bytes, so failures before any output still get an
+// error status; later ones can only cut the file off. The pipe is closed
+// once ctx is done, which stops the query if the client went away.
+func (s *ItemsService) streamItems(ctx context.Context, format bulk.Format) (io.Reader, error) {
+	pipeReader, pipeWriter := io.Pipe()
+	stop := context.AfterFunc(ctx, func() {
+		pipeReader.CloseWithError(ctx.Err())
+	})
+	go func() {
+		defer stop()
+		writer := bulk.NewWriter(pipeWriter, format)
+		numItems := 0
+		err := repos.StreamItems(ctx, s.Deps.DBPool, func(item *models.Item) error {
+			numItems++
+			return writer.Write(item)
+		})
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			logger.FromContext(ctx).Error().Err(err).Int("numItems", numItems).Msg("Error streaming items")
+		} else {
+			logger.FromContext(ctx).Info().Int("numItems", numItems).Msg("Exported items")
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+	reader := bufio.NewReader(pipeReader)
+	if _, err := reader.Peek(1); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (s *ItemsService) ImportItems(
+	ctx context.Context,
+	req ogen.ImportItemsReq,
+	params ogen.ImportItemsParams,
+) (*ogen.ItemImportResponse, error) {
+	onConflict := bulk.OnConflict(params.OnConflict.Or(ogen.ImportItemsOnConflictUpdate))
+	logger.FromContext(ctx).Info().Str("onConflict", string(onConflict)).Msg("Handling items import request")
+	var format bulk.Format
+	var body io.Reader
+	switch req := req.(type) {
+	case *ogen.ImportItemsReqTextCsv:
+		format, body = bulk.FormatCSV, req
+	case *ogen.ImportItemsReqApplicationXNdjson:
+		format, body = bulk.FormatNDJSON, req
+	}
+	// Read rows, keeping invalid ones for the report
+	rows, rowErrors, err := readImport(ctx, body, format)
+	if err != nil {
+		return nil, s.NewError(ctx, err)
+	}
+	// Import Items
+	report, err := repos.ImportItems(ctx, s.Deps.DBPool, rows, onConflict)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Int("numRows", len(rows)).Msg("Error importing items")
+		return nil, s.NewError(ctx, err)
+	}
+	logger.FromContext(ctx).Info().
+		Int("inserted", report.Inserted).
+		Int("updated", report.Updated).
+		Int("skipped", report.Skipped).
+		Int("errors", len(rowErrors)).
+		Msg("Imported items")
+	// Convert models.ImportRowError to ogen.ImportRowError
+	errorsOut := make([]ogen.ImportRowError, 0, len(rowErrors))
+	for _, rowError := range rowErrors {
+		errorsOut = append(errorsOut, ogen.ImportRowError{Line: rowError.Line, Error: rowError.Error})
+	}
+	return &ogen.ItemImportResponse{
+		Data: ogen.ImportReport{
+			Inserted: report.Inserted,
+			Updated:  report.Updated,
+			Skipped:  report.Skipped,
+			Errors:   errorsOut,
+		},
+	}, nil
+}
+
+// readImport reads the rows of an import file, keeping invalid ones for the
+// report. Files that can't be read are ErrorInvalidFile unless the reason is
+// worth telling.
+func readImport(ctx context.Context, body io.Reader, format bulk.Format) ([]bulk.Row, []models.ImportRowError, error) {
+	rows, rowErrors, err := bulk.ReadItems(body, format)
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Msg("Invalid import file")
+		var maxBytesErr *http.MaxBytesError
+		if !errors.As(err, &maxBytesErr) && !errors.Is(err, bulk.ErrorInvalidHeader) {
+			err = bulk.ErrorInvalidFile
+		}
+		return nil, nil, err
+	}
+	return rows, rowErrors, nil
+}
@@ -0,0 +1,114 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example-server/internal/changefeed"
+	"example-server/internal/logger"
+)
+
+var (
+	ErrorInvalidItemId     = errors.New("invalid item id")
+	ErrorEventsUnavailable = errors.New("item events unavailable")
+)
+
+// ItemEventsOperation names GET /items/events in the policy and rate limits
+const ItemEventsOperation = "ItemEvents"
+
+// ItemEventsHandler serves GET /items/events, a Server-Sent Events stream of
+// the tenant's Item changes
+type ItemEventsHandler struct {
+	Guard     *StreamGuard
+	Heartbeat time.Duration
+}
+
+func (h *ItemEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, tenantID, ok := h.Guard.Check(w, r, ItemEventsOperation)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	changes := h.Guard.Service.Deps.Changes
+	if changes == nil {
+		h.Guard.writeError(w, r, ErrorEventsUnavailable)
+		return
+	}
+	// Parse Item IDs
+	var itemIds map[int]bool
+	if itemIdsStrArr, ok := r.URL.Query()["item_ids"]; ok {
+		itemIds = make(map[int]bool, len(itemIdsStrArr))
+		for _, itemIdStr := range itemIdsStrArr {
+			itemId, err := strconv.Atoi(itemIdStr)
+			if err != nil {
+				logger.FromContext(ctx).Warn().Msg("Invalid Item ID received on /items/events")
+				h.Guard.writeError(w, r, ErrorInvalidItemId)
+				return
+			}
+			itemIds[itemId] = true
+		}
+	}
+	// Subscribe, resuming after Last-Event-ID when sent
+	var subscription *changefeed.Subscription
+	complete := true
+	if lastEventId := r.Header.Get("Last-Event-ID"); lastEventId != "" {
+		seq, ok := changes.ParseEventID(lastEventId)
+		subscription, complete = changes.SubscribeAfter(tenantID, seq)
+		complete = complete && ok
+	} else {
+		subscription = changes.Subscribe(tenantID)
+	}
+	defer subscription.Close()
+	// Stream events
+	w.Header().Set("Content-Type", "text/event-stream;charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	if !complete {
+		fmt.Fprint(w, "event:reset\ndata:{}\n\n")
+	}
+	if err := controller.Flush(); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Item events can't be streamed")
+		return
+	}
+	ticker := time.NewTicker(h.Heartbeat)
+	defer ticker.Stop()
+	numEvents := 0
+	for {
+		select {
+		case <-ctx.Done():
+			logger.FromContext(ctx).Info().
+				Int("numEvents", numEvents).
+				Msg("Streamed item events")
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-subscription.Events():
+			if !ok {
+				logger.FromContext(ctx).Warn().
+					Err(subscription.Err()).
+					Int("numEvents", numEvents).
+					Msg("Item event stream ended")
+				return
+			}
+			if itemIds != nil && !itemIds[event.ID] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.FromContext(ctx).Error().Err(err).Msg("Error encoding item event")
+				return
+			}
+			numEvents++
+			fmt.Fprintf(w, "id:%s\nevent:%s\ndata:%s\n\n", changes.EventID(event), event.Op, data)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
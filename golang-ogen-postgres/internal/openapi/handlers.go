@@ -2,15 +2,22 @@ package openapi
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
+	"github.com/ogen-go/ogen/ogenerrors"
 
+	"example-server/internal/auth"
+	"example-server/internal/bulk"
 	"example-server/internal/dependencies"
+	"example-server/internal/logger"
+	"example-server/internal/middleware"
 	"example-server/internal/models"
 	"example-server/internal/openapi/ogen"
+	"example-server/internal/ratelimit"
 	"example-server/internal/repos"
+	"example-server/internal/tenant"
 )
 
 type ItemsService struct {
@@ -18,16 +25,100 @@ type ItemsService struct {
 }
 
 func (s *ItemsService) NewError(ctx context.Context, err error) *ogen.ErrorResponseStatusCode {
+	// Authenticated but not allowed by the policy, as a problem body
+	var forbiddenErr *auth.ForbiddenError
+	if errors.As(err, &forbiddenErr) {
+		return &ogen.ErrorResponseStatusCode{
+			StatusCode: http.StatusForbidden,
+			Response: ogen.ErrorResponse{
+				Error:         "Forbidden",
+				RequestID:     requestIdFromContext(ctx),
+				Type:          ogen.NewOptString("about:blank"),
+				Title:         ogen.NewOptString("Forbidden"),
+				Status:        ogen.NewOptInt(http.StatusForbidden),
+				Detail:        ogen.NewOptString(forbiddenErr.Error()),
+				MissingScopes: forbiddenErr.MissingScopes,
+			},
+		}
+	}
+	// Missing or rejected credentials
+	var securityErr *ogenerrors.SecurityError
+	if errors.As(err, &securityErr) {
+		return &ogen.ErrorResponseStatusCode{
+			StatusCode: http.StatusUnauthorized,
+			Response: ogen.ErrorResponse{
+				Error:     "Unauthorized",
+				RequestID: requestIdFromContext(ctx),
+			},
+		}
+	}
+	// Bodies cut off by middleware.MaxBodySize while a handler reads them
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &ogen.ErrorResponseStatusCode{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Response: ogen.ErrorResponse{
+				Error:     "Request body too large",
+				RequestID: requestIdFromContext(ctx),
+			},
+		}
+	}
 	return &ogen.ErrorResponseStatusCode{
-		StatusCode: http.StatusInternalServerError,
-		Response:   ogen.ErrorResponse{Error: err.Error()},
+		StatusCode: errorStatusCode(err),
+		Response: ogen.ErrorResponse{
+			Error:     err.Error(),
+			RequestID: requestIdFromContext(ctx),
+		},
+	}
+}
+
+// errorStatusCode maps repos, tenant, rate limit, bulk and event errors to their HTTP status
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, repos.ErrorItemNotFound), errors.Is(err, repos.ErrorWebhookNotFound),
+		errors.Is(err, repos.ErrorWebhookDeliveryNotFound), errors.Is(err, repos.ErrorOperationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repos.ErrorItemExists), errors.Is(err, repos.ErrorWebhookDeliveryDelivered),
+		errors.Is(err, repos.ErrorOperationFinished):
+		return http.StatusConflict
+	case errors.Is(err, tenant.ErrorTenantMismatch), errors.Is(err, tenant.ErrorTenantRequired):
+		return http.StatusForbidden
+	case errors.Is(err, tenant.ErrorMissingTenant), errors.Is(err, tenant.ErrorInvalidTenant),
+		errors.Is(err, bulk.ErrorInvalidHeader), errors.Is(err, bulk.ErrorInvalidFile),
+		errors.Is(err, ErrorInvalidItemId), errors.Is(err, ErrorTooManyItemIds), errors.Is(err, ErrorInvalidQueryParam):
+		return http.StatusBadRequest
+	case errors.Is(err, ratelimit.ErrorRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrorEventsUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrorUpgradeRequired):
+		return http.StatusUpgradeRequired
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorHandler reports request bodies cut off by middleware.MaxBodySize with
+// 413 and leaves other decode errors to ogen
+func ErrorHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		middleware.WriteError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	ogenerrors.DefaultErrorHandler(ctx, w, r, err)
+}
+
+func requestIdFromContext(ctx context.Context) ogen.OptString {
+	if requestId := logger.RequestIdFromContext(ctx); requestId != "" {
+		return ogen.NewOptString(requestId)
 	}
+	return ogen.OptString{}
 }
 
 func (s *ItemsService) Ping(
 	ctx context.Context,
 ) (*ogen.PingResponse, error) {
-	log.Info().Msg("Handling ping request")
+	logger.FromContext(ctx).Info().Msg("Handling ping request")
 	return &ogen.PingResponse{
 		Message: "pong",
 	}, nil
@@ -37,18 +128,18 @@ func (s *ItemsService) CreateItem(
 	ctx context.Context,
 	req *ogen.ItemCreateRequest,
 ) (ogen.CreateItemRes, error) {
-	log.Info().Interface("ItemCreateRequest", req).Msg("Handling item create request")
+	logger.FromContext(ctx).Info().Interface("ItemCreateRequest", req).Msg("Handling item create request")
 	// Insert item
 	itemIn := req.Data
-	item, err := repos.InsertItem(s.Deps.DBPool, models.ItemIn{
+	item, err := repos.InsertItem(ctx, s.Deps.DBPool, models.ItemIn{
 		Name:  itemIn.Name,
 		Price: itemIn.Price,
 	})
 	if err != nil {
-		log.Error().Err(err).Interface("ItemCreateRequest", req).Msg("Error inserting item")
+		logger.FromContext(ctx).Error().Err(err).Interface("ItemCreateRequest", req).Msg("Error inserting item")
 		return nil, s.NewError(ctx, err)
 	}
-	log.Debug().Interface("item", item).Msg("Item created")
+	logger.FromContext(ctx).Debug().Interface("item", item).Msg("Item created")
 	// Convert models.Item to ogen.Item
 	itemOut := ogen.Item{
 		ID:        int64(item.ID),
@@ -73,15 +164,15 @@ func (s *ItemsService) GetItem(
 	ctx context.Context,
 	params ogen.GetItemParams,
 ) (ogen.GetItemRes, error) {
-	log.Info().Interface("GetItemParams", params).Msg("Handling item get request")
+	logger.FromContext(ctx).Info().Interface("GetItemParams", params).Msg("Handling item get request")
 	// Fetch item
 	itemId := params.ItemId
-	item, err := repos.FetchItemById(s.Deps.DBPool, itemId)
+	item, err := repos.FetchItemById(ctx, s.Deps.DBPool, itemId)
 	if err != nil {
-		log.Error().Err(err).Interface("GetItemParams", params).Msg("Error getting item")
+		logger.FromContext(ctx).Error().Err(err).Interface("GetItemParams", params).Msg("Error getting item")
 		return nil, s.NewError(ctx, err)
 	}
-	log.Debug().Interface("item", item).Msg("Item fetched")
+	logger.FromContext(ctx).Debug().Interface("item", item).Msg("Item fetched")
 	// Convert models.Item to ogen.Item
 	itemOut := ogen.Item{
 		ID:        int64(item.ID),
@@ -107,19 +198,19 @@ func (s *ItemsService) UpdateItem(
 	req *ogen.ItemUpdateRequest,
 	params ogen.UpdateItemParams,
 ) (ogen.UpdateItemRes, error) {
-	log.Info().Interface("ItemUpdateRequest", req).Msg("Handling item update request")
+	logger.FromContext(ctx).Info().Interface("ItemUpdateRequest", req).Msg("Handling item update request")
 	// Update item
 	itemId := params.ItemId
 	itemIn := req.Data
-	item, err := repos.UpdateItem(s.Deps.DBPool, itemId, models.ItemIn{
+	item, err := repos.UpdateItem(ctx, s.Deps.DBPool, itemId, models.ItemIn{
 		Name:  itemIn.Name,
 		Price: itemIn.Price,
 	})
 	if err != nil {
-		log.Error().Err(err).Interface("ItemUpdateRequest", req).Msg("Error updating item")
+		logger.FromContext(ctx).Error().Err(err).Interface("ItemUpdateRequest", req).Msg("Error updating item")
 		return nil, s.NewError(ctx, err)
 	}
-	log.Debug().Interface("item", item).Msg("Item updated")
+	logger.FromContext(ctx).Debug().Interface("item", item).Msg("Item updated")
 	// Convert models.Item to ogen.Item
 	itemOut := ogen.Item{
 		ID:        int64(item.ID),
@@ -144,15 +235,15 @@ func (s *ItemsService) DeleteItem(
 	ctx context.Context,
 	params ogen.DeleteItemParams,
 ) (ogen.DeleteItemRes, error) {
-	log.Info().Interface("DeleteItemParams", params).Msg("Handling item delete request")
+	logger.FromContext(ctx).Info().Interface("DeleteItemParams", params).Msg("Handling item delete request")
 	// Delete item
 	itemId := params.ItemId
-	item, err := repos.DeleteItem(s.Deps.DBPool, itemId)
+	item, err := repos.DeleteItem(ctx, s.Deps.DBPool, itemId)
 	if err != nil {
-		log.Error().Err(err).Interface("DeleteItemParams", params).Msg("Error deleting item")
+		logger.FromContext(ctx).Error().Err(err).Interface("DeleteItemParams", params).Msg("Error deleting item")
 		return nil, s.NewError(ctx, err)
 	}
-	log.Debug().Interface("item", item).Msg("Item deleted")
+	logger.FromContext(ctx).Debug().Interface("item", item).Msg("Item deleted")
 	// Return empty response
 	return &ogen.DeleteItemNoContent{}, nil
 }
@@ -0,0 +1,178 @@
+package openapi
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example-server/internal/bulk"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+var (
+	ErrorTooManyItemIds    = errors.New("too many item ids")
+	ErrorInvalidQueryParam = errors.New("invalid query parameters")
+)
+
+// StreamItemsOperation names GET /items/stream in the policy and rate limits
+const StreamItemsOperation = "StreamItems"
+
+// streamFlushRows is how many Items are written between flushes
+const streamFlushRows = 500
+
+// ItemStreamHandler serves GET /items/stream, which streams the tenant's
+// Items by offset and limit, or by ids. ogen can only stream opaque bodies
+// such as the export's, not the {"data": [...]} envelope, so it is routed
+// next to the ogen server.
+type ItemStreamHandler struct {
+	Guard *StreamGuard
+	// MaxRows caps the Items of one response, see bulk.StreamMaxRowsFromEnv
+	MaxRows int
+}
+
+func (h *ItemStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, _, ok := h.Guard.Check(w, r, StreamItemsOperation)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	dbPool := h.Guard.Service.Deps.DBPool
+	maxRows := h.MaxRows
+	if maxRows <= 0 {
+		maxRows = bulk.DefaultStreamMaxRows
+	}
+	format := bulk.FormatJSON
+	if acceptsNDJSON(r) {
+		format = bulk.FormatNDJSON
+	}
+	query := r.URL.Query()
+	var stream func(fn func(item *models.Item) error) error
+	if itemIdsStrArr, ok := query["item_ids"]; ok {
+		// Parse Item IDs
+		if len(itemIdsStrArr) > maxRows {
+			logger.FromContext(ctx).Warn().
+				Int("numItemIds", len(itemIdsStrArr)).
+				Msg("Too many Item IDs received on /items/stream")
+			h.Guard.writeError(w, r, ErrorTooManyItemIds)
+			return
+		}
+		itemIds := make([]int, len(itemIdsStrArr))
+		for i, itemIdStr := range itemIdsStrArr {
+			itemId, err := strconv.Atoi(itemIdStr)
+			if err != nil {
+				logger.FromContext(ctx).Warn().Msg("Invalid Item ID received on /items/stream")
+				h.Guard.writeError(w, r, ErrorInvalidItemId)
+				return
+			}
+			itemIds[i] = itemId
+		}
+		stream = func(fn func(item *models.Item) error) error {
+			return repos.StreamItemsByIds(ctx, dbPool, itemIds, fn)
+		}
+	} else {
+		// Parse query params and validate, capping limit at maxRows
+		offset, offsetErr := strconv.Atoi(queryOr(query.Get("offset"), "0"))
+		limit, limitErr := strconv.Atoi(queryOr(query.Get("limit"), strconv.Itoa(maxRows)))
+		if offsetErr != nil || limitErr != nil || offset < 0 || limit < 1 {
+			logger.FromContext(ctx).Warn().Msg("Invalid query parameters received on /items/stream")
+			h.Guard.writeError(w, r, ErrorInvalidQueryParam)
+			return
+		}
+		limit = min(limit, maxRows)
+		stream = func(fn func(item *models.Item) error) error {
+			return repos.StreamPaginatedItems(ctx, dbPool, offset, limit, fn)
+		}
+	}
+	// Stream Items
+	numItems, err := h.writeItems(w, r, format, stream)
+	if err != nil {
+		logger.FromContext(ctx).Error().
+			Err(err).
+			Int("numItems", numItems).
+			Msg("Error streaming items")
+		return
+	}
+	logger.FromContext(ctx).Info().
+		Int("numItems", numItems).
+		Str("format", string(format)).
+		Msg("Streamed items")
+}
+
+// writeItems writes the Items stream yields in format, flushing every
+// streamFlushRows rows. The writers buffer, so errors before anything is
+// sent still get an error response; later ones can only cut the response
+// off. A client that went away is logged and not treated as an error.
+func (h *ItemStreamHandler) writeItems(
+	w http.ResponseWriter,
+	r *http.Request,
+	format bulk.Format,
+	stream func(fn func(item *models.Item) error) error,
+) (int, error) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", format.ContentType())
+	body := &sentWriter{ResponseWriter: w}
+	controller := http.NewResponseController(w)
+	writer := bulk.NewWriter(body, format)
+	numItems := 0
+	err := stream(func(item *models.Item) error {
+		if err := writer.Write(item); err != nil {
+			return err
+		}
+		numItems++
+		if numItems%streamFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			return controller.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil && ctx.Err() != nil {
+		logger.FromContext(ctx).Info().
+			Err(err).
+			Int("numItems", numItems).
+			Msg("Client went away while streaming items")
+		return numItems, nil
+	}
+	if err != nil && !body.sent {
+		w.Header().Del("Content-Type")
+		h.Guard.writeError(w, r, err)
+	}
+	return numItems, err
+}
+
+// sentWriter records whether any of the body was written
+type sentWriter struct {
+	http.ResponseWriter
+	sent bool
+}
+
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.ResponseWriter.Write(p)
+}
+
+// acceptsNDJSON reports whether r's Accept header names NDJSON
+func acceptsNDJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == bulk.FormatNDJSON.ContentType() {
+			return true
+		}
+	}
+	return false
+}
+
+func queryOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -9,10 +9,22 @@ type DeleteItemRes interface {
 	deleteItemRes()
 }
 
+type ExportItemsRes interface {
+	exportItemsRes()
+}
+
 type GetItemRes interface {
 	getItemRes()
 }
 
+type ImportItemsAsyncReq interface {
+	importItemsAsyncReq()
+}
+
+type ImportItemsReq interface {
+	importItemsReq()
+}
+
 type UpdateItemRes interface {
 	updateItemRes()
 }
@@ -6,9 +6,22 @@ package ogen
 type OperationName = string
 
 const (
-	CreateItemOperation OperationName = "CreateItem"
-	DeleteItemOperation OperationName = "DeleteItem"
-	GetItemOperation    OperationName = "GetItem"
-	PingOperation       OperationName = "Ping"
-	UpdateItemOperation OperationName = "UpdateItem"
+	BulkDeleteItemsOperation       OperationName = "BulkDeleteItems"
+	CancelOperationOperation       OperationName = "CancelOperation"
+	CreateItemOperation            OperationName = "CreateItem"
+	CreateWebhookOperation         OperationName = "CreateWebhook"
+	DeleteItemOperation            OperationName = "DeleteItem"
+	DeleteWebhookOperation         OperationName = "DeleteWebhook"
+	ExportItemsOperation           OperationName = "ExportItems"
+	GetItemOperation               OperationName = "GetItem"
+	GetOperationOperation          OperationName = "GetOperation"
+	GetWebhookOperation            OperationName = "GetWebhook"
+	ImportItemsOperation           OperationName = "ImportItems"
+	ImportItemsAsyncOperation      OperationName = "ImportItemsAsync"
+	ListWebhookDeliveriesOperation OperationName = "ListWebhookDeliveries"
+	ListWebhooksOperation          OperationName = "ListWebhooks"
+	PingOperation                  OperationName = "Ping"
+	RetryWebhookDeliveryOperation  OperationName = "RetryWebhookDelivery"
+	UpdateItemOperation            OperationName = "UpdateItem"
+	UpdateWebhookOperation         OperationName = "UpdateWebhook"
 )
@@ -4,9 +4,11 @@ package ogen
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/go-faster/errors"
+	"github.com/go-faster/jx"
 	"github.com/google/uuid"
 )
 
@@ -14,6 +16,91 @@ func (s *ErrorResponseStatusCode) Error() string {
 	return fmt.Sprintf("code %d: %+v", s.StatusCode, s.Response)
 }
 
+type ApiKeyAuth struct {
+	APIKey string
+}
+
+// GetAPIKey returns the value of APIKey.
+func (s *ApiKeyAuth) GetAPIKey() string {
+	return s.APIKey
+}
+
+// SetAPIKey sets the value of APIKey.
+func (s *ApiKeyAuth) SetAPIKey(val string) {
+	s.APIKey = val
+}
+
+type BearerAuth struct {
+	Token string
+}
+
+// GetToken returns the value of Token.
+func (s *BearerAuth) GetToken() string {
+	return s.Token
+}
+
+// SetToken sets the value of Token.
+func (s *BearerAuth) SetToken(val string) {
+	s.Token = val
+}
+
+// Ref: #/components/schemas/BulkDeleteIn
+type BulkDeleteIn struct {
+	Ids []int64 `json:"ids"`
+}
+
+// GetIds returns the value of Ids.
+func (s *BulkDeleteIn) GetIds() []int64 {
+	return s.Ids
+}
+
+// SetIds sets the value of Ids.
+func (s *BulkDeleteIn) SetIds(val []int64) {
+	s.Ids = val
+}
+
+// Ref: #/components/schemas/BulkDeleteReport
+type BulkDeleteReport struct {
+	Deleted int `json:"deleted"`
+	// Ids that had no Item.
+	NotFound []int64 `json:"not_found"`
+}
+
+// GetDeleted returns the value of Deleted.
+func (s *BulkDeleteReport) GetDeleted() int {
+	return s.Deleted
+}
+
+// GetNotFound returns the value of NotFound.
+func (s *BulkDeleteReport) GetNotFound() []int64 {
+	return s.NotFound
+}
+
+// SetDeleted sets the value of Deleted.
+func (s *BulkDeleteReport) SetDeleted(val int) {
+	s.Deleted = val
+}
+
+// SetNotFound sets the value of NotFound.
+func (s *BulkDeleteReport) SetNotFound(val []int64) {
+	s.NotFound = val
+}
+
+// Ref: #/components/schemas/BulkDeleteRequest
+type BulkDeleteRequest struct {
+	Data BulkDeleteIn `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *BulkDeleteRequest) GetData() BulkDeleteIn {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *BulkDeleteRequest) SetData(val BulkDeleteIn) {
+	s.Data = val
+}
+
 // DeleteItemNoContent is response for DeleteItem operation.
 type DeleteItemNoContent struct{}
 
@@ -24,9 +111,20 @@ type DeleteItemNotFound struct{}
 
 func (*DeleteItemNotFound) deleteItemRes() {}
 
+// DeleteWebhookNoContent is response for DeleteWebhook operation.
+type DeleteWebhookNoContent struct{}
+
 // Ref: #/components/schemas/ErrorResponse
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// ID of the request, also returned in the X-Request-ID header.
+	RequestID OptString `json:"request_id"`
+	// RFC 7807 problem type, set on authorization failures.
+	Type          OptString `json:"type"`
+	Title         OptString `json:"title"`
+	Status        OptInt    `json:"status"`
+	Detail        OptString `json:"detail"`
+	MissingScopes []string  `json:"missing_scopes"`
 }
 
 // GetError returns the value of Error.
@@ -34,11 +132,71 @@ func (s *ErrorResponse) GetError() string {
 	return s.Error
 }
 
+// GetRequestID returns the value of RequestID.
+func (s *ErrorResponse) GetRequestID() OptString {
+	return s.RequestID
+}
+
+// GetType returns the value of Type.
+func (s *ErrorResponse) GetType() OptString {
+	return s.Type
+}
+
+// GetTitle returns the value of Title.
+func (s *ErrorResponse) GetTitle() OptString {
+	return s.Title
+}
+
+// GetStatus returns the value of Status.
+func (s *ErrorResponse) GetStatus() OptInt {
+	return s.Status
+}
+
+// GetDetail returns the value of Detail.
+func (s *ErrorResponse) GetDetail() OptString {
+	return s.Detail
+}
+
+// GetMissingScopes returns the value of MissingScopes.
+func (s *ErrorResponse) GetMissingScopes() []string {
+	return s.MissingScopes
+}
+
 // SetError sets the value of Error.
 func (s *ErrorResponse) SetError(val string) {
 	s.Error = val
 }
 
+// SetRequestID sets the value of RequestID.
+func (s *ErrorResponse) SetRequestID(val OptString) {
+	s.RequestID = val
+}
+
+// SetType sets the value of Type.
+func (s *ErrorResponse) SetType(val OptString) {
+	s.Type = val
+}
+
+// SetTitle sets the value of Title.
+func (s *ErrorResponse) SetTitle(val OptString) {
+	s.Title = val
+}
+
+// SetStatus sets the value of Status.
+func (s *ErrorResponse) SetStatus(val OptInt) {
+	s.Status = val
+}
+
+// SetDetail sets the value of Detail.
+func (s *ErrorResponse) SetDetail(val OptString) {
+	s.Detail = val
+}
+
+// SetMissingScopes sets the value of MissingScopes.
+func (s *ErrorResponse) SetMissingScopes(val []string) {
+	s.MissingScopes = val
+}
+
 func (*ErrorResponse) createItemRes() {}
 func (*ErrorResponse) updateItemRes() {}
 
@@ -68,11 +226,357 @@ func (s *ErrorResponseStatusCode) SetResponse(val ErrorResponse) {
 	s.Response = val
 }
 
+type ExportItemsFormat string
+
+const (
+	ExportItemsFormatCsv    ExportItemsFormat = "csv"
+	ExportItemsFormatNdjson ExportItemsFormat = "ndjson"
+)
+
+// AllValues returns all ExportItemsFormat values.
+func (ExportItemsFormat) AllValues() []ExportItemsFormat {
+	return []ExportItemsFormat{
+		ExportItemsFormatCsv,
+		ExportItemsFormatNdjson,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ExportItemsFormat) MarshalText() ([]byte, error) {
+	switch s {
+	case ExportItemsFormatCsv:
+		return []byte(s), nil
+	case ExportItemsFormatNdjson:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ExportItemsFormat) UnmarshalText(data []byte) error {
+	switch ExportItemsFormat(data) {
+	case ExportItemsFormatCsv:
+		*s = ExportItemsFormatCsv
+		return nil
+	case ExportItemsFormatNdjson:
+		*s = ExportItemsFormatNdjson
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+type ExportItemsOKApplicationXNdjson struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ExportItemsOKApplicationXNdjson) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+// ExportItemsOKApplicationXNdjsonHeaders wraps ExportItemsOKApplicationXNdjson with response headers.
+type ExportItemsOKApplicationXNdjsonHeaders struct {
+	ContentDisposition OptString
+	Response           ExportItemsOKApplicationXNdjson
+}
+
+// GetContentDisposition returns the value of ContentDisposition.
+func (s *ExportItemsOKApplicationXNdjsonHeaders) GetContentDisposition() OptString {
+	return s.ContentDisposition
+}
+
+// GetResponse returns the value of Response.
+func (s *ExportItemsOKApplicationXNdjsonHeaders) GetResponse() ExportItemsOKApplicationXNdjson {
+	return s.Response
+}
+
+// SetContentDisposition sets the value of ContentDisposition.
+func (s *ExportItemsOKApplicationXNdjsonHeaders) SetContentDisposition(val OptString) {
+	s.ContentDisposition = val
+}
+
+// SetResponse sets the value of Response.
+func (s *ExportItemsOKApplicationXNdjsonHeaders) SetResponse(val ExportItemsOKApplicationXNdjson) {
+	s.Response = val
+}
+
+func (*ExportItemsOKApplicationXNdjsonHeaders) exportItemsRes() {}
+
+type ExportItemsOKTextCsv struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ExportItemsOKTextCsv) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+// ExportItemsOKTextCsvHeaders wraps ExportItemsOKTextCsv with response headers.
+type ExportItemsOKTextCsvHeaders struct {
+	ContentDisposition OptString
+	Response           ExportItemsOKTextCsv
+}
+
+// GetContentDisposition returns the value of ContentDisposition.
+func (s *ExportItemsOKTextCsvHeaders) GetContentDisposition() OptString {
+	return s.ContentDisposition
+}
+
+// GetResponse returns the value of Response.
+func (s *ExportItemsOKTextCsvHeaders) GetResponse() ExportItemsOKTextCsv {
+	return s.Response
+}
+
+// SetContentDisposition sets the value of ContentDisposition.
+func (s *ExportItemsOKTextCsvHeaders) SetContentDisposition(val OptString) {
+	s.ContentDisposition = val
+}
+
+// SetResponse sets the value of Response.
+func (s *ExportItemsOKTextCsvHeaders) SetResponse(val ExportItemsOKTextCsv) {
+	s.Response = val
+}
+
+func (*ExportItemsOKTextCsvHeaders) exportItemsRes() {}
+
 // GetItemNotFound is response for GetItem operation.
 type GetItemNotFound struct{}
 
 func (*GetItemNotFound) getItemRes() {}
 
+type ImportItemsAsyncOnConflict string
+
+const (
+	ImportItemsAsyncOnConflictUpdate ImportItemsAsyncOnConflict = "update"
+	ImportItemsAsyncOnConflictSkip   ImportItemsAsyncOnConflict = "skip"
+)
+
+// AllValues returns all ImportItemsAsyncOnConflict values.
+func (ImportItemsAsyncOnConflict) AllValues() []ImportItemsAsyncOnConflict {
+	return []ImportItemsAsyncOnConflict{
+		ImportItemsAsyncOnConflictUpdate,
+		ImportItemsAsyncOnConflictSkip,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ImportItemsAsyncOnConflict) MarshalText() ([]byte, error) {
+	switch s {
+	case ImportItemsAsyncOnConflictUpdate:
+		return []byte(s), nil
+	case ImportItemsAsyncOnConflictSkip:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ImportItemsAsyncOnConflict) UnmarshalText(data []byte) error {
+	switch ImportItemsAsyncOnConflict(data) {
+	case ImportItemsAsyncOnConflictUpdate:
+		*s = ImportItemsAsyncOnConflictUpdate
+		return nil
+	case ImportItemsAsyncOnConflictSkip:
+		*s = ImportItemsAsyncOnConflictSkip
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+type ImportItemsAsyncReqApplicationXNdjson struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ImportItemsAsyncReqApplicationXNdjson) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+func (*ImportItemsAsyncReqApplicationXNdjson) importItemsAsyncReq() {}
+
+type ImportItemsAsyncReqTextCsv struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ImportItemsAsyncReqTextCsv) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+func (*ImportItemsAsyncReqTextCsv) importItemsAsyncReq() {}
+
+type ImportItemsOnConflict string
+
+const (
+	ImportItemsOnConflictUpdate ImportItemsOnConflict = "update"
+	ImportItemsOnConflictSkip   ImportItemsOnConflict = "skip"
+)
+
+// AllValues returns all ImportItemsOnConflict values.
+func (ImportItemsOnConflict) AllValues() []ImportItemsOnConflict {
+	return []ImportItemsOnConflict{
+		ImportItemsOnConflictUpdate,
+		ImportItemsOnConflictSkip,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s ImportItemsOnConflict) MarshalText() ([]byte, error) {
+	switch s {
+	case ImportItemsOnConflictUpdate:
+		return []byte(s), nil
+	case ImportItemsOnConflictSkip:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *ImportItemsOnConflict) UnmarshalText(data []byte) error {
+	switch ImportItemsOnConflict(data) {
+	case ImportItemsOnConflictUpdate:
+		*s = ImportItemsOnConflictUpdate
+		return nil
+	case ImportItemsOnConflictSkip:
+		*s = ImportItemsOnConflictSkip
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+type ImportItemsReqApplicationXNdjson struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ImportItemsReqApplicationXNdjson) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+func (*ImportItemsReqApplicationXNdjson) importItemsReq() {}
+
+type ImportItemsReqTextCsv struct {
+	Data io.Reader
+}
+
+// Read reads data from the Data reader.
+//
+// Kept to satisfy the io.Reader interface.
+func (s ImportItemsReqTextCsv) Read(p []byte) (n int, err error) {
+	if s.Data == nil {
+		return 0, io.EOF
+	}
+	return s.Data.Read(p)
+}
+
+func (*ImportItemsReqTextCsv) importItemsReq() {}
+
+// Ref: #/components/schemas/ImportReport
+type ImportReport struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	// Rows whose name already existed and was left unchanged.
+	Skipped int              `json:"skipped"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+// GetInserted returns the value of Inserted.
+func (s *ImportReport) GetInserted() int {
+	return s.Inserted
+}
+
+// GetUpdated returns the value of Updated.
+func (s *ImportReport) GetUpdated() int {
+	return s.Updated
+}
+
+// GetSkipped returns the value of Skipped.
+func (s *ImportReport) GetSkipped() int {
+	return s.Skipped
+}
+
+// GetErrors returns the value of Errors.
+func (s *ImportReport) GetErrors() []ImportRowError {
+	return s.Errors
+}
+
+// SetInserted sets the value of Inserted.
+func (s *ImportReport) SetInserted(val int) {
+	s.Inserted = val
+}
+
+// SetUpdated sets the value of Updated.
+func (s *ImportReport) SetUpdated(val int) {
+	s.Updated = val
+}
+
+// SetSkipped sets the value of Skipped.
+func (s *ImportReport) SetSkipped(val int) {
+	s.Skipped = val
+}
+
+// SetErrors sets the value of Errors.
+func (s *ImportReport) SetErrors(val []ImportRowError) {
+	s.Errors = val
+}
+
+// Ref: #/components/schemas/ImportRowError
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// GetLine returns the value of Line.
+func (s *ImportRowError) GetLine() int {
+	return s.Line
+}
+
+// GetError returns the value of Error.
+func (s *ImportRowError) GetError() string {
+	return s.Error
+}
+
+// SetLine sets the value of Line.
+func (s *ImportRowError) SetLine(val int) {
+	s.Line = val
+}
+
+// SetError sets the value of Error.
+func (s *ImportRowError) SetError(val string) {
+	s.Error = val
+}
+
 // Ref: #/components/schemas/Item
 type Item struct {
 	ID        int64     `json:"id"`
@@ -203,6 +707,21 @@ func (s *ItemGetResponse) SetMeta(val ItemMeta) {
 
 func (*ItemGetResponse) getItemRes() {}
 
+// Ref: #/components/schemas/ItemImportResponse
+type ItemImportResponse struct {
+	Data ImportReport `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *ItemImportResponse) GetData() ImportReport {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *ItemImportResponse) SetData(val ImportReport) {
+	s.Data = val
+}
+
 // Ref: #/components/schemas/ItemIn
 type ItemIn struct {
 	Name  string  `json:"name"`
@@ -342,24 +861,728 @@ func (s *ItemUpdateResponse) SetMeta(val ItemMeta) {
 
 func (*ItemUpdateResponse) updateItemRes() {}
 
-// NewOptItemMetaItemStatus returns new OptItemMetaItemStatus with value set to v.
-func NewOptItemMetaItemStatus(v ItemMetaItemStatus) OptItemMetaItemStatus {
-	return OptItemMetaItemStatus{
+// NewNilDateTime returns new NilDateTime with value set to v.
+func NewNilDateTime(v time.Time) NilDateTime {
+	return NilDateTime{
 		Value: v,
-		Set:   true,
 	}
 }
 
-// OptItemMetaItemStatus is optional ItemMetaItemStatus.
-type OptItemMetaItemStatus struct {
-	Value ItemMetaItemStatus
-	Set   bool
+// NilDateTime is nullable time.Time.
+type NilDateTime struct {
+	Value time.Time
+	Null  bool
 }
 
-// IsSet returns true if OptItemMetaItemStatus was set.
-func (o OptItemMetaItemStatus) IsSet() bool { return o.Set }
+// SetTo sets value to v.
+func (o *NilDateTime) SetTo(v time.Time) {
+	o.Null = false
+	o.Value = v
+}
 
-// Reset unsets value.
+// IsNull returns true if value is Null.
+func (o NilDateTime) IsNull() bool { return o.Null }
+
+// SetToNull sets value to null.
+func (o *NilDateTime) SetToNull() {
+	o.Null = true
+	var v time.Time
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o NilDateTime) Get() (v time.Time, ok bool) {
+	if o.Null {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o NilDateTime) Or(d time.Time) time.Time {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewNilInt returns new NilInt with value set to v.
+func NewNilInt(v int) NilInt {
+	return NilInt{
+		Value: v,
+	}
+}
+
+// NilInt is nullable int.
+type NilInt struct {
+	Value int
+	Null  bool
+}
+
+// SetTo sets value to v.
+func (o *NilInt) SetTo(v int) {
+	o.Null = false
+	o.Value = v
+}
+
+// IsNull returns true if value is Null.
+func (o NilInt) IsNull() bool { return o.Null }
+
+// SetToNull sets value to null.
+func (o *NilInt) SetToNull() {
+	o.Null = true
+	var v int
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o NilInt) Get() (v int, ok bool) {
+	if o.Null {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o NilInt) Or(d int) int {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewNilString returns new NilString with value set to v.
+func NewNilString(v string) NilString {
+	return NilString{
+		Value: v,
+	}
+}
+
+// NilString is nullable string.
+type NilString struct {
+	Value string
+	Null  bool
+}
+
+// SetTo sets value to v.
+func (o *NilString) SetTo(v string) {
+	o.Null = false
+	o.Value = v
+}
+
+// IsNull returns true if value is Null.
+func (o NilString) IsNull() bool { return o.Null }
+
+// SetToNull sets value to null.
+func (o *NilString) SetToNull() {
+	o.Null = true
+	var v string
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o NilString) Get() (v string, ok bool) {
+	if o.Null {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o NilString) Or(d string) string {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// Ref: #/components/schemas/Operation
+type Operation struct {
+	ID   int64         `json:"id"`
+	Type OperationType `json:"type"`
+	// Queued until a worker starts it, then running until succeeded, failed or canceled.
+	Status OperationStatus `json:"status"`
+	// Percentage of the work done.
+	Progress  int                `json:"progress"`
+	Processed int                `json:"processed"`
+	Total     int                `json:"total"`
+	Result    OptOperationResult `json:"result"`
+	// Why the operation failed.
+	Error      NilString   `json:"error"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	FinishedAt NilDateTime `json:"finished_at"`
+}
+
+// GetID returns the value of ID.
+func (s *Operation) GetID() int64 {
+	return s.ID
+}
+
+// GetType returns the value of Type.
+func (s *Operation) GetType() OperationType {
+	return s.Type
+}
+
+// GetStatus returns the value of Status.
+func (s *Operation) GetStatus() OperationStatus {
+	return s.Status
+}
+
+// GetProgress returns the value of Progress.
+func (s *Operation) GetProgress() int {
+	return s.Progress
+}
+
+// GetProcessed returns the value of Processed.
+func (s *Operation) GetProcessed() int {
+	return s.Processed
+}
+
+// GetTotal returns the value of Total.
+func (s *Operation) GetTotal() int {
+	return s.Total
+}
+
+// GetResult returns the value of Result.
+func (s *Operation) GetResult() OptOperationResult {
+	return s.Result
+}
+
+// GetError returns the value of Error.
+func (s *Operation) GetError() NilString {
+	return s.Error
+}
+
+// GetCreatedAt returns the value of CreatedAt.
+func (s *Operation) GetCreatedAt() time.Time {
+	return s.CreatedAt
+}
+
+// GetUpdatedAt returns the value of UpdatedAt.
+func (s *Operation) GetUpdatedAt() time.Time {
+	return s.UpdatedAt
+}
+
+// GetFinishedAt returns the value of FinishedAt.
+func (s *Operation) GetFinishedAt() NilDateTime {
+	return s.FinishedAt
+}
+
+// SetID sets the value of ID.
+func (s *Operation) SetID(val int64) {
+	s.ID = val
+}
+
+// SetType sets the value of Type.
+func (s *Operation) SetType(val OperationType) {
+	s.Type = val
+}
+
+// SetStatus sets the value of Status.
+func (s *Operation) SetStatus(val OperationStatus) {
+	s.Status = val
+}
+
+// SetProgress sets the value of Progress.
+func (s *Operation) SetProgress(val int) {
+	s.Progress = val
+}
+
+// SetProcessed sets the value of Processed.
+func (s *Operation) SetProcessed(val int) {
+	s.Processed = val
+}
+
+// SetTotal sets the value of Total.
+func (s *Operation) SetTotal(val int) {
+	s.Total = val
+}
+
+// SetResult sets the value of Result.
+func (s *Operation) SetResult(val OptOperationResult) {
+	s.Result = val
+}
+
+// SetError sets the value of Error.
+func (s *Operation) SetError(val NilString) {
+	s.Error = val
+}
+
+// SetCreatedAt sets the value of CreatedAt.
+func (s *Operation) SetCreatedAt(val time.Time) {
+	s.CreatedAt = val
+}
+
+// SetUpdatedAt sets the value of UpdatedAt.
+func (s *Operation) SetUpdatedAt(val time.Time) {
+	s.UpdatedAt = val
+}
+
+// SetFinishedAt sets the value of FinishedAt.
+func (s *Operation) SetFinishedAt(val NilDateTime) {
+	s.FinishedAt = val
+}
+
+// OperationAcceptedHeaders wraps OperationResponse with response headers.
+type OperationAcceptedHeaders struct {
+	Location string
+	Response OperationResponse
+}
+
+// GetLocation returns the value of Location.
+func (s *OperationAcceptedHeaders) GetLocation() string {
+	return s.Location
+}
+
+// GetResponse returns the value of Response.
+func (s *OperationAcceptedHeaders) GetResponse() OperationResponse {
+	return s.Response
+}
+
+// SetLocation sets the value of Location.
+func (s *OperationAcceptedHeaders) SetLocation(val string) {
+	s.Location = val
+}
+
+// SetResponse sets the value of Response.
+func (s *OperationAcceptedHeaders) SetResponse(val OperationResponse) {
+	s.Response = val
+}
+
+// Ref: #/components/schemas/OperationResponse
+type OperationResponse struct {
+	Data Operation `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *OperationResponse) GetData() Operation {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *OperationResponse) SetData(val Operation) {
+	s.Data = val
+}
+
+// The ImportReport of item.import or the BulkDeleteReport of item.bulk_delete.
+// Ref: #/components/schemas/OperationResult
+// OperationResult represents sum type.
+type OperationResult struct {
+	Type             OperationResultType // switch on this field
+	ImportReport     ImportReport
+	BulkDeleteReport BulkDeleteReport
+}
+
+// OperationResultType is oneOf type of OperationResult.
+type OperationResultType string
+
+// Possible values for OperationResultType.
+const (
+	ImportReportOperationResult     OperationResultType = "ImportReport"
+	BulkDeleteReportOperationResult OperationResultType = "BulkDeleteReport"
+)
+
+// IsImportReport reports whether OperationResult is ImportReport.
+func (s OperationResult) IsImportReport() bool { return s.Type == ImportReportOperationResult }
+
+// IsBulkDeleteReport reports whether OperationResult is BulkDeleteReport.
+func (s OperationResult) IsBulkDeleteReport() bool { return s.Type == BulkDeleteReportOperationResult }
+
+// SetImportReport sets OperationResult to ImportReport.
+func (s *OperationResult) SetImportReport(v ImportReport) {
+	s.Type = ImportReportOperationResult
+	s.ImportReport = v
+}
+
+// GetImportReport returns ImportReport and true boolean if OperationResult is ImportReport.
+func (s OperationResult) GetImportReport() (v ImportReport, ok bool) {
+	if !s.IsImportReport() {
+		return v, false
+	}
+	return s.ImportReport, true
+}
+
+// NewImportReportOperationResult returns new OperationResult from ImportReport.
+func NewImportReportOperationResult(v ImportReport) OperationResult {
+	var s OperationResult
+	s.SetImportReport(v)
+	return s
+}
+
+// SetBulkDeleteReport sets OperationResult to BulkDeleteReport.
+func (s *OperationResult) SetBulkDeleteReport(v BulkDeleteReport) {
+	s.Type = BulkDeleteReportOperationResult
+	s.BulkDeleteReport = v
+}
+
+// GetBulkDeleteReport returns BulkDeleteReport and true boolean if OperationResult is BulkDeleteReport.
+func (s OperationResult) GetBulkDeleteReport() (v BulkDeleteReport, ok bool) {
+	if !s.IsBulkDeleteReport() {
+		return v, false
+	}
+	return s.BulkDeleteReport, true
+}
+
+// NewBulkDeleteReportOperationResult returns new OperationResult from BulkDeleteReport.
+func NewBulkDeleteReportOperationResult(v BulkDeleteReport) OperationResult {
+	var s OperationResult
+	s.SetBulkDeleteReport(v)
+	return s
+}
+
+// Queued until a worker starts it, then running until succeeded, failed or canceled.
+type OperationStatus string
+
+const (
+	OperationStatusQueued    OperationStatus = "queued"
+	OperationStatusRunning   OperationStatus = "running"
+	OperationStatusSucceeded OperationStatus = "succeeded"
+	OperationStatusFailed    OperationStatus = "failed"
+	OperationStatusCanceled  OperationStatus = "canceled"
+)
+
+// AllValues returns all OperationStatus values.
+func (OperationStatus) AllValues() []OperationStatus {
+	return []OperationStatus{
+		OperationStatusQueued,
+		OperationStatusRunning,
+		OperationStatusSucceeded,
+		OperationStatusFailed,
+		OperationStatusCanceled,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s OperationStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case OperationStatusQueued:
+		return []byte(s), nil
+	case OperationStatusRunning:
+		return []byte(s), nil
+	case OperationStatusSucceeded:
+		return []byte(s), nil
+	case OperationStatusFailed:
+		return []byte(s), nil
+	case OperationStatusCanceled:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *OperationStatus) UnmarshalText(data []byte) error {
+	switch OperationStatus(data) {
+	case OperationStatusQueued:
+		*s = OperationStatusQueued
+		return nil
+	case OperationStatusRunning:
+		*s = OperationStatusRunning
+		return nil
+	case OperationStatusSucceeded:
+		*s = OperationStatusSucceeded
+		return nil
+	case OperationStatusFailed:
+		*s = OperationStatusFailed
+		return nil
+	case OperationStatusCanceled:
+		*s = OperationStatusCanceled
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+type OperationType string
+
+const (
+	OperationTypeItemImport     OperationType = "item.import"
+	OperationTypeItemBulkDelete OperationType = "item.bulk_delete"
+)
+
+// AllValues returns all OperationType values.
+func (OperationType) AllValues() []OperationType {
+	return []OperationType{
+		OperationTypeItemImport,
+		OperationTypeItemBulkDelete,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s OperationType) MarshalText() ([]byte, error) {
+	switch s {
+	case OperationTypeItemImport:
+		return []byte(s), nil
+	case OperationTypeItemBulkDelete:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *OperationType) UnmarshalText(data []byte) error {
+	switch OperationType(data) {
+	case OperationTypeItemImport:
+		*s = OperationTypeItemImport
+		return nil
+	case OperationTypeItemBulkDelete:
+		*s = OperationTypeItemBulkDelete
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+// NewOptBool returns new OptBool with value set to v.
+func NewOptBool(v bool) OptBool {
+	return OptBool{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptBool is optional bool.
+type OptBool struct {
+	Value bool
+	Set   bool
+}
+
+// IsSet returns true if OptBool was set.
+func (o OptBool) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptBool) Reset() {
+	var v bool
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptBool) SetTo(v bool) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptBool) Get() (v bool, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptBool) Or(d bool) bool {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptExportItemsFormat returns new OptExportItemsFormat with value set to v.
+func NewOptExportItemsFormat(v ExportItemsFormat) OptExportItemsFormat {
+	return OptExportItemsFormat{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptExportItemsFormat is optional ExportItemsFormat.
+type OptExportItemsFormat struct {
+	Value ExportItemsFormat
+	Set   bool
+}
+
+// IsSet returns true if OptExportItemsFormat was set.
+func (o OptExportItemsFormat) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptExportItemsFormat) Reset() {
+	var v ExportItemsFormat
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptExportItemsFormat) SetTo(v ExportItemsFormat) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptExportItemsFormat) Get() (v ExportItemsFormat, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptExportItemsFormat) Or(d ExportItemsFormat) ExportItemsFormat {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptImportItemsAsyncOnConflict returns new OptImportItemsAsyncOnConflict with value set to v.
+func NewOptImportItemsAsyncOnConflict(v ImportItemsAsyncOnConflict) OptImportItemsAsyncOnConflict {
+	return OptImportItemsAsyncOnConflict{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptImportItemsAsyncOnConflict is optional ImportItemsAsyncOnConflict.
+type OptImportItemsAsyncOnConflict struct {
+	Value ImportItemsAsyncOnConflict
+	Set   bool
+}
+
+// IsSet returns true if OptImportItemsAsyncOnConflict was set.
+func (o OptImportItemsAsyncOnConflict) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptImportItemsAsyncOnConflict) Reset() {
+	var v ImportItemsAsyncOnConflict
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptImportItemsAsyncOnConflict) SetTo(v ImportItemsAsyncOnConflict) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptImportItemsAsyncOnConflict) Get() (v ImportItemsAsyncOnConflict, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptImportItemsAsyncOnConflict) Or(d ImportItemsAsyncOnConflict) ImportItemsAsyncOnConflict {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptImportItemsOnConflict returns new OptImportItemsOnConflict with value set to v.
+func NewOptImportItemsOnConflict(v ImportItemsOnConflict) OptImportItemsOnConflict {
+	return OptImportItemsOnConflict{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptImportItemsOnConflict is optional ImportItemsOnConflict.
+type OptImportItemsOnConflict struct {
+	Value ImportItemsOnConflict
+	Set   bool
+}
+
+// IsSet returns true if OptImportItemsOnConflict was set.
+func (o OptImportItemsOnConflict) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptImportItemsOnConflict) Reset() {
+	var v ImportItemsOnConflict
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptImportItemsOnConflict) SetTo(v ImportItemsOnConflict) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptImportItemsOnConflict) Get() (v ImportItemsOnConflict, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptImportItemsOnConflict) Or(d ImportItemsOnConflict) ImportItemsOnConflict {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptInt returns new OptInt with value set to v.
+func NewOptInt(v int) OptInt {
+	return OptInt{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptInt is optional int.
+type OptInt struct {
+	Value int
+	Set   bool
+}
+
+// IsSet returns true if OptInt was set.
+func (o OptInt) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptInt) Reset() {
+	var v int
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptInt) SetTo(v int) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptInt) Get() (v int, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptInt) Or(d int) int {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptItemMetaItemStatus returns new OptItemMetaItemStatus with value set to v.
+func NewOptItemMetaItemStatus(v ItemMetaItemStatus) OptItemMetaItemStatus {
+	return OptItemMetaItemStatus{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptItemMetaItemStatus is optional ItemMetaItemStatus.
+type OptItemMetaItemStatus struct {
+	Value ItemMetaItemStatus
+	Set   bool
+}
+
+// IsSet returns true if OptItemMetaItemStatus was set.
+func (o OptItemMetaItemStatus) IsSet() bool { return o.Set }
+
+// Reset unsets value.
 func (o *OptItemMetaItemStatus) Reset() {
 	var v ItemMetaItemStatus
 	o.Value = v
@@ -367,13 +1590,105 @@ func (o *OptItemMetaItemStatus) Reset() {
 }
 
 // SetTo sets value to v.
-func (o *OptItemMetaItemStatus) SetTo(v ItemMetaItemStatus) {
+func (o *OptItemMetaItemStatus) SetTo(v ItemMetaItemStatus) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptItemMetaItemStatus) Get() (v ItemMetaItemStatus, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptItemMetaItemStatus) Or(d ItemMetaItemStatus) ItemMetaItemStatus {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptOperationResult returns new OptOperationResult with value set to v.
+func NewOptOperationResult(v OperationResult) OptOperationResult {
+	return OptOperationResult{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptOperationResult is optional OperationResult.
+type OptOperationResult struct {
+	Value OperationResult
+	Set   bool
+}
+
+// IsSet returns true if OptOperationResult was set.
+func (o OptOperationResult) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptOperationResult) Reset() {
+	var v OperationResult
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptOperationResult) SetTo(v OperationResult) {
+	o.Set = true
+	o.Value = v
+}
+
+// Get returns value and boolean that denotes whether value was set.
+func (o OptOperationResult) Get() (v OperationResult, ok bool) {
+	if !o.Set {
+		return v, false
+	}
+	return o.Value, true
+}
+
+// Or returns value if set, or given parameter if does not.
+func (o OptOperationResult) Or(d OperationResult) OperationResult {
+	if v, ok := o.Get(); ok {
+		return v
+	}
+	return d
+}
+
+// NewOptString returns new OptString with value set to v.
+func NewOptString(v string) OptString {
+	return OptString{
+		Value: v,
+		Set:   true,
+	}
+}
+
+// OptString is optional string.
+type OptString struct {
+	Value string
+	Set   bool
+}
+
+// IsSet returns true if OptString was set.
+func (o OptString) IsSet() bool { return o.Set }
+
+// Reset unsets value.
+func (o *OptString) Reset() {
+	var v string
+	o.Value = v
+	o.Set = false
+}
+
+// SetTo sets value to v.
+func (o *OptString) SetTo(v string) {
 	o.Set = true
 	o.Value = v
 }
 
 // Get returns value and boolean that denotes whether value was set.
-func (o OptItemMetaItemStatus) Get() (v ItemMetaItemStatus, ok bool) {
+func (o OptString) Get() (v string, ok bool) {
 	if !o.Set {
 		return v, false
 	}
@@ -381,7 +1696,7 @@ func (o OptItemMetaItemStatus) Get() (v ItemMetaItemStatus, ok bool) {
 }
 
 // Or returns value if set, or given parameter if does not.
-func (o OptItemMetaItemStatus) Or(d ItemMetaItemStatus) ItemMetaItemStatus {
+func (o OptString) Or(d string) string {
 	if v, ok := o.Get(); ok {
 		return v
 	}
@@ -407,3 +1722,466 @@ func (s *PingResponse) SetMessage(val string) {
 type UpdateItemNotFound struct{}
 
 func (*UpdateItemNotFound) updateItemRes() {}
+
+// Ref: #/components/schemas/Webhook
+type Webhook struct {
+	ID        int64          `json:"id"`
+	URL       string         `json:"url"`
+	Events    []WebhookEvent `json:"events"`
+	Active    bool           `json:"active"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// GetID returns the value of ID.
+func (s *Webhook) GetID() int64 {
+	return s.ID
+}
+
+// GetURL returns the value of URL.
+func (s *Webhook) GetURL() string {
+	return s.URL
+}
+
+// GetEvents returns the value of Events.
+func (s *Webhook) GetEvents() []WebhookEvent {
+	return s.Events
+}
+
+// GetActive returns the value of Active.
+func (s *Webhook) GetActive() bool {
+	return s.Active
+}
+
+// GetCreatedAt returns the value of CreatedAt.
+func (s *Webhook) GetCreatedAt() time.Time {
+	return s.CreatedAt
+}
+
+// GetUpdatedAt returns the value of UpdatedAt.
+func (s *Webhook) GetUpdatedAt() time.Time {
+	return s.UpdatedAt
+}
+
+// SetID sets the value of ID.
+func (s *Webhook) SetID(val int64) {
+	s.ID = val
+}
+
+// SetURL sets the value of URL.
+func (s *Webhook) SetURL(val string) {
+	s.URL = val
+}
+
+// SetEvents sets the value of Events.
+func (s *Webhook) SetEvents(val []WebhookEvent) {
+	s.Events = val
+}
+
+// SetActive sets the value of Active.
+func (s *Webhook) SetActive(val bool) {
+	s.Active = val
+}
+
+// SetCreatedAt sets the value of CreatedAt.
+func (s *Webhook) SetCreatedAt(val time.Time) {
+	s.CreatedAt = val
+}
+
+// SetUpdatedAt sets the value of UpdatedAt.
+func (s *Webhook) SetUpdatedAt(val time.Time) {
+	s.UpdatedAt = val
+}
+
+// Ref: #/components/schemas/WebhookCreateRequest
+type WebhookCreateRequest struct {
+	Data WebhookIn `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookCreateRequest) GetData() WebhookIn {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookCreateRequest) SetData(val WebhookIn) {
+	s.Data = val
+}
+
+// Ref: #/components/schemas/WebhookCreateResponse
+type WebhookCreateResponse struct {
+	Data Webhook `json:"data"`
+	// Signs deliveries, only returned on creation.
+	Secret string `json:"secret"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookCreateResponse) GetData() Webhook {
+	return s.Data
+}
+
+// GetSecret returns the value of Secret.
+func (s *WebhookCreateResponse) GetSecret() string {
+	return s.Secret
+}
+
+// SetData sets the value of Data.
+func (s *WebhookCreateResponse) SetData(val Webhook) {
+	s.Data = val
+}
+
+// SetSecret sets the value of Secret.
+func (s *WebhookCreateResponse) SetSecret(val string) {
+	s.Secret = val
+}
+
+// Ref: #/components/schemas/WebhookDelivery
+type WebhookDelivery struct {
+	ID             int64        `json:"id"`
+	SubscriptionID int64        `json:"subscription_id"`
+	Event          WebhookEvent `json:"event"`
+	// The signed JSON body POSTed to the webhook.
+	Payload jx.Raw `json:"payload"`
+	// Pending until delivered, or dead once out of attempts.
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	LastAttemptAt  NilDateTime           `json:"last_attempt_at"`
+	LastStatusCode NilInt                `json:"last_status_code"`
+	LastError      NilString             `json:"last_error"`
+	CreatedAt      time.Time             `json:"created_at"`
+	DeliveredAt    NilDateTime           `json:"delivered_at"`
+}
+
+// GetID returns the value of ID.
+func (s *WebhookDelivery) GetID() int64 {
+	return s.ID
+}
+
+// GetSubscriptionID returns the value of SubscriptionID.
+func (s *WebhookDelivery) GetSubscriptionID() int64 {
+	return s.SubscriptionID
+}
+
+// GetEvent returns the value of Event.
+func (s *WebhookDelivery) GetEvent() WebhookEvent {
+	return s.Event
+}
+
+// GetPayload returns the value of Payload.
+func (s *WebhookDelivery) GetPayload() jx.Raw {
+	return s.Payload
+}
+
+// GetStatus returns the value of Status.
+func (s *WebhookDelivery) GetStatus() WebhookDeliveryStatus {
+	return s.Status
+}
+
+// GetAttempts returns the value of Attempts.
+func (s *WebhookDelivery) GetAttempts() int {
+	return s.Attempts
+}
+
+// GetNextAttemptAt returns the value of NextAttemptAt.
+func (s *WebhookDelivery) GetNextAttemptAt() time.Time {
+	return s.NextAttemptAt
+}
+
+// GetLastAttemptAt returns the value of LastAttemptAt.
+func (s *WebhookDelivery) GetLastAttemptAt() NilDateTime {
+	return s.LastAttemptAt
+}
+
+// GetLastStatusCode returns the value of LastStatusCode.
+func (s *WebhookDelivery) GetLastStatusCode() NilInt {
+	return s.LastStatusCode
+}
+
+// GetLastError returns the value of LastError.
+func (s *WebhookDelivery) GetLastError() NilString {
+	return s.LastError
+}
+
+// GetCreatedAt returns the value of CreatedAt.
+func (s *WebhookDelivery) GetCreatedAt() time.Time {
+	return s.CreatedAt
+}
+
+// GetDeliveredAt returns the value of DeliveredAt.
+func (s *WebhookDelivery) GetDeliveredAt() NilDateTime {
+	return s.DeliveredAt
+}
+
+// SetID sets the value of ID.
+func (s *WebhookDelivery) SetID(val int64) {
+	s.ID = val
+}
+
+// SetSubscriptionID sets the value of SubscriptionID.
+func (s *WebhookDelivery) SetSubscriptionID(val int64) {
+	s.SubscriptionID = val
+}
+
+// SetEvent sets the value of Event.
+func (s *WebhookDelivery) SetEvent(val WebhookEvent) {
+	s.Event = val
+}
+
+// SetPayload sets the value of Payload.
+func (s *WebhookDelivery) SetPayload(val jx.Raw) {
+	s.Payload = val
+}
+
+// SetStatus sets the value of Status.
+func (s *WebhookDelivery) SetStatus(val WebhookDeliveryStatus) {
+	s.Status = val
+}
+
+// SetAttempts sets the value of Attempts.
+func (s *WebhookDelivery) SetAttempts(val int) {
+	s.Attempts = val
+}
+
+// SetNextAttemptAt sets the value of NextAttemptAt.
+func (s *WebhookDelivery) SetNextAttemptAt(val time.Time) {
+	s.NextAttemptAt = val
+}
+
+// SetLastAttemptAt sets the value of LastAttemptAt.
+func (s *WebhookDelivery) SetLastAttemptAt(val NilDateTime) {
+	s.LastAttemptAt = val
+}
+
+// SetLastStatusCode sets the value of LastStatusCode.
+func (s *WebhookDelivery) SetLastStatusCode(val NilInt) {
+	s.LastStatusCode = val
+}
+
+// SetLastError sets the value of LastError.
+func (s *WebhookDelivery) SetLastError(val NilString) {
+	s.LastError = val
+}
+
+// SetCreatedAt sets the value of CreatedAt.
+func (s *WebhookDelivery) SetCreatedAt(val time.Time) {
+	s.CreatedAt = val
+}
+
+// SetDeliveredAt sets the value of DeliveredAt.
+func (s *WebhookDelivery) SetDeliveredAt(val NilDateTime) {
+	s.DeliveredAt = val
+}
+
+// Ref: #/components/schemas/WebhookDeliveryListResponse
+type WebhookDeliveryListResponse struct {
+	Data []WebhookDelivery `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookDeliveryListResponse) GetData() []WebhookDelivery {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookDeliveryListResponse) SetData(val []WebhookDelivery) {
+	s.Data = val
+}
+
+// Ref: #/components/schemas/WebhookDeliveryResponse
+type WebhookDeliveryResponse struct {
+	Data WebhookDelivery `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookDeliveryResponse) GetData() WebhookDelivery {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookDeliveryResponse) SetData(val WebhookDelivery) {
+	s.Data = val
+}
+
+// Pending until delivered, or dead once out of attempts.
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatusDead      WebhookDeliveryStatus = "dead"
+)
+
+// AllValues returns all WebhookDeliveryStatus values.
+func (WebhookDeliveryStatus) AllValues() []WebhookDeliveryStatus {
+	return []WebhookDeliveryStatus{
+		WebhookDeliveryStatusPending,
+		WebhookDeliveryStatusDelivered,
+		WebhookDeliveryStatusDead,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s WebhookDeliveryStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case WebhookDeliveryStatusPending:
+		return []byte(s), nil
+	case WebhookDeliveryStatusDelivered:
+		return []byte(s), nil
+	case WebhookDeliveryStatusDead:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *WebhookDeliveryStatus) UnmarshalText(data []byte) error {
+	switch WebhookDeliveryStatus(data) {
+	case WebhookDeliveryStatusPending:
+		*s = WebhookDeliveryStatusPending
+		return nil
+	case WebhookDeliveryStatusDelivered:
+		*s = WebhookDeliveryStatusDelivered
+		return nil
+	case WebhookDeliveryStatusDead:
+		*s = WebhookDeliveryStatusDead
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+// Ref: #/components/schemas/WebhookEvent
+type WebhookEvent string
+
+const (
+	WebhookEventItemCreated WebhookEvent = "item.created"
+	WebhookEventItemUpdated WebhookEvent = "item.updated"
+	WebhookEventItemDeleted WebhookEvent = "item.deleted"
+)
+
+// AllValues returns all WebhookEvent values.
+func (WebhookEvent) AllValues() []WebhookEvent {
+	return []WebhookEvent{
+		WebhookEventItemCreated,
+		WebhookEventItemUpdated,
+		WebhookEventItemDeleted,
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s WebhookEvent) MarshalText() ([]byte, error) {
+	switch s {
+	case WebhookEventItemCreated:
+		return []byte(s), nil
+	case WebhookEventItemUpdated:
+		return []byte(s), nil
+	case WebhookEventItemDeleted:
+		return []byte(s), nil
+	default:
+		return nil, errors.Errorf("invalid value: %q", s)
+	}
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *WebhookEvent) UnmarshalText(data []byte) error {
+	switch WebhookEvent(data) {
+	case WebhookEventItemCreated:
+		*s = WebhookEventItemCreated
+		return nil
+	case WebhookEventItemUpdated:
+		*s = WebhookEventItemUpdated
+		return nil
+	case WebhookEventItemDeleted:
+		*s = WebhookEventItemDeleted
+		return nil
+	default:
+		return errors.Errorf("invalid value: %q", data)
+	}
+}
+
+// Ref: #/components/schemas/WebhookIn
+type WebhookIn struct {
+	// Http or https URL deliveries are POSTed to.
+	URL string `json:"url"`
+	// Events to send, all when empty.
+	Events []WebhookEvent `json:"events"`
+	// Inactive webhooks get no deliveries.
+	Active OptBool `json:"active"`
+}
+
+// GetURL returns the value of URL.
+func (s *WebhookIn) GetURL() string {
+	return s.URL
+}
+
+// GetEvents returns the value of Events.
+func (s *WebhookIn) GetEvents() []WebhookEvent {
+	return s.Events
+}
+
+// GetActive returns the value of Active.
+func (s *WebhookIn) GetActive() OptBool {
+	return s.Active
+}
+
+// SetURL sets the value of URL.
+func (s *WebhookIn) SetURL(val string) {
+	s.URL = val
+}
+
+// SetEvents sets the value of Events.
+func (s *WebhookIn) SetEvents(val []WebhookEvent) {
+	s.Events = val
+}
+
+// SetActive sets the value of Active.
+func (s *WebhookIn) SetActive(val OptBool) {
+	s.Active = val
+}
+
+// Ref: #/components/schemas/WebhookListResponse
+type WebhookListResponse struct {
+	Data []Webhook `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookListResponse) GetData() []Webhook {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookListResponse) SetData(val []Webhook) {
+	s.Data = val
+}
+
+// Ref: #/components/schemas/WebhookResponse
+type WebhookResponse struct {
+	Data Webhook `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookResponse) GetData() Webhook {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookResponse) SetData(val Webhook) {
+	s.Data = val
+}
+
+// Ref: #/components/schemas/WebhookUpdateRequest
+type WebhookUpdateRequest struct {
+	Data WebhookIn `json:"data"`
+}
+
+// GetData returns the value of Data.
+func (s *WebhookUpdateRequest) GetData() WebhookIn {
+	return s.Data
+}
+
+// SetData sets the value of Data.
+func (s *WebhookUpdateRequest) SetData(val WebhookIn) {
+	s.Data = val
+}
@@ -8,36 +8,121 @@ import (
 
 // Handler handles operations described by OpenAPI v3 specification.
 type Handler interface {
+	// BulkDeleteItems implements bulkDeleteItems operation.
+	//
+	// Deletes Items by id in the background. Poll the operation at the Location header; its result is
+	// the BulkDeleteReport.
+	//
+	// POST /items/bulk-delete
+	BulkDeleteItems(ctx context.Context, req *BulkDeleteRequest) (*OperationAcceptedHeaders, error)
+	// CancelOperation implements cancelOperation operation.
+	//
+	// Cancels a queued or running operation. A running one stops after its current chunk, keeping the
+	// work done so far; finished operations can't be canceled.
+	//
+	// DELETE /operations/{operationId}
+	CancelOperation(ctx context.Context, params CancelOperationParams) (*OperationResponse, error)
 	// CreateItem implements createItem operation.
 	//
 	// Creates Item.
 	//
 	// POST /items
 	CreateItem(ctx context.Context, req *ItemCreateRequest) (CreateItemRes, error)
+	// CreateWebhook implements createWebhook operation.
+	//
+	// Subscribes a URL to Item events of the tenant. The signing secret is only returned in this
+	// response.
+	//
+	// POST /webhooks
+	CreateWebhook(ctx context.Context, req *WebhookCreateRequest) (*WebhookCreateResponse, error)
 	// DeleteItem implements deleteItem operation.
 	//
 	// Deletes Item.
 	//
 	// DELETE /items/{itemId}
 	DeleteItem(ctx context.Context, params DeleteItemParams) (DeleteItemRes, error)
+	// DeleteWebhook implements deleteWebhook operation.
+	//
+	// Deletes a webhook and its delivery log; pending deliveries are not sent.
+	//
+	// DELETE /webhooks/{webhookId}
+	DeleteWebhook(ctx context.Context, params DeleteWebhookParams) error
+	// ExportItems implements exportItems operation.
+	//
+	// Streams all Items as CSV or NDJSON.
+	//
+	// GET /items/export
+	ExportItems(ctx context.Context, params ExportItemsParams) (ExportItemsRes, error)
 	// GetItem implements getItem operation.
 	//
 	// Returns a single Item by id.
 	//
 	// GET /items/{itemId}
 	GetItem(ctx context.Context, params GetItemParams) (GetItemRes, error)
+	// GetOperation implements getOperation operation.
+	//
+	// Returns the status and progress of an operation, and its result or error once finished.
+	//
+	// GET /operations/{operationId}
+	GetOperation(ctx context.Context, params GetOperationParams) (*OperationResponse, error)
+	// GetWebhook implements getWebhook operation.
+	//
+	// Returns a webhook by id without its secret.
+	//
+	// GET /webhooks/{webhookId}
+	GetWebhook(ctx context.Context, params GetWebhookParams) (*WebhookResponse, error)
+	// ImportItems implements importItems operation.
+	//
+	// Loads Items from CSV (with name and price columns) or NDJSON. Existing names are updated, or left
+	// alone with on_conflict=skip. Invalid rows are reported by line and do not stop the import.
+	//
+	// POST /items/import
+	ImportItems(ctx context.Context, req ImportItemsReq, params ImportItemsParams) (*ItemImportResponse, error)
+	// ImportItemsAsync implements importItemsAsync operation.
+	//
+	// Validates the file like importItems, then loads the valid rows in the background. Poll the
+	// operation at the Location header until it is succeeded, failed or canceled; its result is the
+	// ImportReport.
+	//
+	// POST /items/import/async
+	ImportItemsAsync(ctx context.Context, req ImportItemsAsyncReq, params ImportItemsAsyncParams) (*OperationAcceptedHeaders, error)
+	// ListWebhookDeliveries implements listWebhookDeliveries operation.
+	//
+	// Returns the delivery log of a webhook, newest first: status, attempts and the last response or
+	// error.
+	//
+	// GET /webhooks/{webhookId}/deliveries
+	ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) (*WebhookDeliveryListResponse, error)
+	// ListWebhooks implements listWebhooks operation.
+	//
+	// Returns the webhooks of the tenant without their secrets.
+	//
+	// GET /webhooks
+	ListWebhooks(ctx context.Context) (*WebhookListResponse, error)
 	// Ping implements ping operation.
 	//
 	// Check if the service is running.
 	//
 	// GET /ping
 	Ping(ctx context.Context) (*PingResponse, error)
+	// RetryWebhookDelivery implements retryWebhookDelivery operation.
+	//
+	// Sends a dead or pending delivery again right away, with a fresh set of attempts.
+	//
+	// POST /webhooks/{webhookId}/deliveries/{deliveryId}/retry
+	RetryWebhookDelivery(ctx context.Context, params RetryWebhookDeliveryParams) (*WebhookDeliveryResponse, error)
 	// UpdateItem implements updateItem operation.
 	//
 	// Updates a single Item by id.
 	//
 	// PATCH /items/{itemId}
 	UpdateItem(ctx context.Context, req *ItemUpdateRequest, params UpdateItemParams) (UpdateItemRes, error)
+	// UpdateWebhook implements updateWebhook operation.
+	//
+	// Replaces the URL, events and active flag of a webhook, keeping its secret.
+	//
+	// PUT /webhooks/{webhookId}
+	UpdateWebhook(ctx context.Context, req *WebhookUpdateRequest, params UpdateWebhookParams) (*WebhookResponse, error)
 	// NewError creates *ErrorResponseStatusCode from error returned by handler.
 	//
 	// Used for common default response.
@@ -47,18 +132,20 @@ type Handler interface {
 // Server implements http server based on OpenAPI v3 specification and
 // calls Handler to handle requests.
 type Server struct {
-	h Handler
+	h   Handler
+	sec SecurityHandler
 	baseServer
 }
 
 // NewServer creates new Server.
-func NewServer(h Handler, opts ...ServerOption) (*Server, error) {
+func NewServer(h Handler, sec SecurityHandler, opts ...ServerOption) (*Server, error) {
 	s, err := newServerConfig(opts...).baseServer()
 	if err != nil {
 		return nil, err
 	}
 	return &Server{
 		h:          h,
+		sec:        sec,
 		baseServer: s,
 	}, nil
 }
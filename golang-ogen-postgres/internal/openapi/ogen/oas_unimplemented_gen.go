@@ -13,6 +13,26 @@ type UnimplementedHandler struct{}
 
 var _ Handler = UnimplementedHandler{}
 
+// BulkDeleteItems implements bulkDeleteItems operation.
+//
+// Deletes Items by id in the background. Poll the operation at the Location header; its result is
+// the BulkDeleteReport.
+//
+// POST /items/bulk-delete
+func (UnimplementedHandler) BulkDeleteItems(ctx context.Context, req *BulkDeleteRequest) (r *OperationAcceptedHeaders, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// CancelOperation implements cancelOperation operation.
+//
+// Cancels a queued or running operation. A running one stops after its current chunk, keeping the
+// work done so far; finished operations can't be canceled.
+//
+// DELETE /operations/{operationId}
+func (UnimplementedHandler) CancelOperation(ctx context.Context, params CancelOperationParams) (r *OperationResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // CreateItem implements createItem operation.
 //
 // Creates Item.
@@ -22,6 +42,16 @@ func (UnimplementedHandler) CreateItem(ctx context.Context, req *ItemCreateReque
 	return r, ht.ErrNotImplemented
 }
 
+// CreateWebhook implements createWebhook operation.
+//
+// Subscribes a URL to Item events of the tenant. The signing secret is only returned in this
+// response.
+//
+// POST /webhooks
+func (UnimplementedHandler) CreateWebhook(ctx context.Context, req *WebhookCreateRequest) (r *WebhookCreateResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // DeleteItem implements deleteItem operation.
 //
 // Deletes Item.
@@ -31,6 +61,24 @@ func (UnimplementedHandler) DeleteItem(ctx context.Context, params DeleteItemPar
 	return r, ht.ErrNotImplemented
 }
 
+// DeleteWebhook implements deleteWebhook operation.
+//
+// Deletes a webhook and its delivery log; pending deliveries are not sent.
+//
+// DELETE /webhooks/{webhookId}
+func (UnimplementedHandler) DeleteWebhook(ctx context.Context, params DeleteWebhookParams) error {
+	return ht.ErrNotImplemented
+}
+
+// ExportItems implements exportItems operation.
+//
+// Streams all Items as CSV or NDJSON.
+//
+// GET /items/export
+func (UnimplementedHandler) ExportItems(ctx context.Context, params ExportItemsParams) (r ExportItemsRes, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // GetItem implements getItem operation.
 //
 // Returns a single Item by id.
@@ -40,6 +88,64 @@ func (UnimplementedHandler) GetItem(ctx context.Context, params GetItemParams) (
 	return r, ht.ErrNotImplemented
 }
 
+// GetOperation implements getOperation operation.
+//
+// Returns the status and progress of an operation, and its result or error once finished.
+//
+// GET /operations/{operationId}
+func (UnimplementedHandler) GetOperation(ctx context.Context, params GetOperationParams) (r *OperationResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// GetWebhook implements getWebhook operation.
+//
+// Returns a webhook by id without its secret.
+//
+// GET /webhooks/{webhookId}
+func (UnimplementedHandler) GetWebhook(ctx context.Context, params GetWebhookParams) (r *WebhookResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// ImportItems implements importItems operation.
+//
+// Loads Items from CSV (with name and price columns) or NDJSON. Existing names are updated, or left
+// alone with on_conflict=skip. Invalid rows are reported by line and do not stop the import.
+//
+// POST /items/import
+func (UnimplementedHandler) ImportItems(ctx context.Context, req ImportItemsReq, params ImportItemsParams) (r *ItemImportResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// ImportItemsAsync implements importItemsAsync operation.
+//
+// Validates the file like importItems, then loads the valid rows in the background. Poll the
+// operation at the Location header until it is succeeded, failed or canceled; its result is the
+// ImportReport.
+//
+// POST /items/import/async
+func (UnimplementedHandler) ImportItemsAsync(ctx context.Context, req ImportItemsAsyncReq, params ImportItemsAsyncParams) (r *OperationAcceptedHeaders, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// ListWebhookDeliveries implements listWebhookDeliveries operation.
+//
+// Returns the delivery log of a webhook, newest first: status, attempts and the last response or
+// error.
+//
+// GET /webhooks/{webhookId}/deliveries
+func (UnimplementedHandler) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) (r *WebhookDeliveryListResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
+// ListWebhooks implements listWebhooks operation.
+//
+// Returns the webhooks of the tenant without their secrets.
+//
+// GET /webhooks
+func (UnimplementedHandler) ListWebhooks(ctx context.Context) (r *WebhookListResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // Ping implements ping operation.
 //
 // Check if the service is running.
@@ -49,6 +155,15 @@ func (UnimplementedHandler) Ping(ctx context.Context) (r *PingResponse, _ error)
 	return r, ht.ErrNotImplemented
 }
 
+// RetryWebhookDelivery implements retryWebhookDelivery operation.
+//
+// Sends a dead or pending delivery again right away, with a fresh set of attempts.
+//
+// POST /webhooks/{webhookId}/deliveries/{deliveryId}/retry
+func (UnimplementedHandler) RetryWebhookDelivery(ctx context.Context, params RetryWebhookDeliveryParams) (r *WebhookDeliveryResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // UpdateItem implements updateItem operation.
 //
 // Updates a single Item by id.
@@ -58,6 +173,15 @@ func (UnimplementedHandler) UpdateItem(ctx context.Context, req *ItemUpdateReque
 	return r, ht.ErrNotImplemented
 }
 
+// UpdateWebhook implements updateWebhook operation.
+//
+// Replaces the URL, events and active flag of a webhook, keeping its secret.
+//
+// PUT /webhooks/{webhookId}
+func (UnimplementedHandler) UpdateWebhook(ctx context.Context, req *WebhookUpdateRequest, params UpdateWebhookParams) (r *WebhookResponse, _ error) {
+	return r, ht.ErrNotImplemented
+}
+
 // NewError creates *ErrorResponseStatusCode from error returned by handler.
 //
 // Used for common default response.
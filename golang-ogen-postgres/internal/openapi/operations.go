@@ -0,0 +1,161 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"example-server/internal/bulk"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/operations"
+	"example-server/internal/repos"
+)
+
+func (s *ItemsService) ImportItemsAsync(
+	ctx context.Context,
+	req ogen.ImportItemsAsyncReq,
+	params ogen.ImportItemsAsyncParams,
+) (*ogen.OperationAcceptedHeaders, error) {
+	onConflict := bulk.OnConflict(params.OnConflict.Or(ogen.ImportItemsAsyncOnConflictUpdate))
+	logger.FromContext(ctx).Info().Str("onConflict", string(onConflict)).Msg("Handling async items import request")
+	var format bulk.Format
+	var body io.Reader
+	switch req := req.(type) {
+	case *ogen.ImportItemsAsyncReqTextCsv:
+		format, body = bulk.FormatCSV, req
+	case *ogen.ImportItemsAsyncReqApplicationXNdjson:
+		format, body = bulk.FormatNDJSON, req
+	}
+	// Read rows now so invalid files fail the request
+	rows, rowErrors, err := readImport(ctx, body, format)
+	if err != nil {
+		return nil, s.NewError(ctx, err)
+	}
+	// Queue the import
+	operation, err := operations.EnqueueImport(ctx, s.Deps.DBPool, rows, rowErrors, onConflict)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Int("numRows", len(rows)).Msg("Error queuing items import")
+		return nil, s.NewError(ctx, err)
+	}
+	logger.FromContext(ctx).Info().Int64("operationId", operation.ID).Int("numRows", len(rows)).Msg("Items import queued")
+	return operationAccepted(operation), nil
+}
+
+func (s *ItemsService) BulkDeleteItems(
+	ctx context.Context,
+	req *ogen.BulkDeleteRequest,
+) (*ogen.OperationAcceptedHeaders, error) {
+	logger.FromContext(ctx).Info().Int("numIds", len(req.Data.Ids)).Msg("Handling items bulk delete request")
+	itemIds := make([]int, 0, len(req.Data.Ids))
+	for _, itemId := range req.Data.Ids {
+		itemIds = append(itemIds, int(itemId))
+	}
+	// Queue the deletion
+	operation, err := operations.EnqueueBulkDelete(ctx, s.Deps.DBPool, itemIds)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Error queuing items bulk delete")
+		return nil, s.NewError(ctx, err)
+	}
+	logger.FromContext(ctx).Info().Int64("operationId", operation.ID).Msg("Items bulk delete queued")
+	return operationAccepted(operation), nil
+}
+
+func (s *ItemsService) GetOperation(
+	ctx context.Context,
+	params ogen.GetOperationParams,
+) (*ogen.OperationResponse, error) {
+	operation, err := repos.FetchOperationById(ctx, s.Deps.DBPool, params.OperationId)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("GetOperationParams", params).Msg("Error getting operation")
+		return nil, s.NewError(ctx, err)
+	}
+	return &ogen.OperationResponse{Data: operationOut(operation)}, nil
+}
+
+func (s *ItemsService) CancelOperation(
+	ctx context.Context,
+	params ogen.CancelOperationParams,
+) (*ogen.OperationResponse, error) {
+	logger.FromContext(ctx).Info().Interface("CancelOperationParams", params).Msg("Handling operation cancel request")
+	operation, err := repos.CancelOperation(ctx, s.Deps.DBPool, params.OperationId)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("CancelOperationParams", params).Msg("Error canceling operation")
+		return nil, s.NewError(ctx, err)
+	}
+	logger.FromContext(ctx).Info().Int64("operationId", operation.ID).Msg("Operation canceled")
+	return &ogen.OperationResponse{Data: operationOut(operation)}, nil
+}
+
+// operationAccepted is the 202 response pointing at operation
+func operationAccepted(operation *models.Operation) *ogen.OperationAcceptedHeaders {
+	return &ogen.OperationAcceptedHeaders{
+		Location: "/operations/" + strconv.FormatInt(operation.ID, 10),
+		Response: ogen.OperationResponse{Data: operationOut(operation)},
+	}
+}
+
+func operationOut(operation *models.Operation) ogen.Operation {
+	operationOut := ogen.Operation{
+		ID:         operation.ID,
+		Type:       ogen.OperationType(operation.Type),
+		Status:     ogen.OperationStatus(operation.Status),
+		Progress:   operation.Progress(),
+		Processed:  operation.Processed,
+		Total:      operation.Total,
+		Error:      ogen.NilString{Null: true},
+		CreatedAt:  operation.CreatedAt,
+		UpdatedAt:  operation.UpdatedAt,
+		FinishedAt: ogen.NilDateTime{Null: true},
+	}
+	if operation.Error != nil {
+		operationOut.Error = ogen.NewNilString(*operation.Error)
+	}
+	if operation.FinishedAt != nil {
+		operationOut.FinishedAt = ogen.NewNilDateTime(*operation.FinishedAt)
+	}
+	if result, ok := operationResultOut(operation); ok {
+		operationOut.Result = ogen.NewOptOperationResult(result)
+	}
+	return operationOut
+}
+
+// operationResultOut decodes the result so far of the operation's type
+func operationResultOut(operation *models.Operation) (ogen.OperationResult, bool) {
+	if operation.Result == nil {
+		return ogen.OperationResult{}, false
+	}
+	switch operation.Type {
+	case models.OperationItemImport:
+		var report models.ImportReport
+		if err := json.Unmarshal(operation.Result, &report); err != nil {
+			return ogen.OperationResult{}, false
+		}
+		errorsOut := make([]ogen.ImportRowError, 0, len(report.Errors))
+		for _, rowError := range report.Errors {
+			errorsOut = append(errorsOut, ogen.ImportRowError{Line: rowError.Line, Error: rowError.Error})
+		}
+		return ogen.NewImportReportOperationResult(ogen.ImportReport{
+			Inserted: report.Inserted,
+			Updated:  report.Updated,
+			Skipped:  report.Skipped,
+			Errors:   errorsOut,
+		}), true
+	case models.OperationItemBulkDelete:
+		var report models.BulkDeleteReport
+		if err := json.Unmarshal(operation.Result, &report); err != nil {
+			return ogen.OperationResult{}, false
+		}
+		notFound := make([]int64, 0, len(report.NotFound))
+		for _, itemId := range report.NotFound {
+			notFound = append(notFound, int64(itemId))
+		}
+		return ogen.NewBulkDeleteReportOperationResult(ogen.BulkDeleteReport{
+			Deleted:  report.Deleted,
+			NotFound: notFound,
+		}), true
+	}
+	return ogen.OperationResult{}, false
+}
@@ -0,0 +1,63 @@
+package openapi
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/ogen-go/ogen/middleware"
+
+	"example-server/internal/auth"
+	"example-server/internal/logger"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/ratelimit"
+)
+
+// ClientIPRateLimit takes a token from the client IP's bucket before the
+// SecurityHandler authenticates the request, which RateLimitMiddleware runs
+// after, and rejects the request with ErrorRateLimited once it is empty.
+// Requests are matched to operations on server, those outside it, such as
+// the streaming handlers, use the default operation limit to decide whether
+// they count.
+func ClientIPRateLimit(next http.Handler, server *ogen.Server, service *ItemsService, limiter *ratelimit.Limiter, trustedProxies []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var operation string
+		if route, ok := server.FindRoute(r.Method, r.URL.Path); ok {
+			operation = route.Name()
+		}
+		clientIP := ratelimit.ClientIP(r, trustedProxies)
+		result := limiter.AllowClientIP(r.Context(), operation, clientIP)
+		if !result.Allowed {
+			ratelimit.SetHeaders(w.Header(), result)
+			logger.FromContext(r.Context()).Warn().
+				Str("operation", operation).
+				Str("client", "ip:"+clientIP).
+				Msg("Rate limited request")
+			writeError(service, w, r, ratelimit.ErrorRateLimited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitMiddleware takes a token from the caller's bucket for the
+// operation, keyed by API key, JWT subject or client IP, and rejects the
+// request with ErrorRateLimited once it is empty. RateLimit-* headers are set
+// when the server is wrapped with ratelimit.WithResponseHeader.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, trustedProxies []netip.Prefix) middleware.Middleware {
+	return func(req middleware.Request, next middleware.Next) (middleware.Response, error) {
+		principal, _ := auth.FromContext(req.Context)
+		client := ratelimit.ClientKey(principal, ratelimit.ClientIP(req.Raw, trustedProxies))
+		result := limiter.Allow(req.Context, req.OperationName, client)
+		if header, ok := ratelimit.HeaderFromContext(req.Context); ok {
+			ratelimit.SetHeaders(header, result)
+		}
+		if !result.Allowed {
+			logger.FromContext(req.Context).Warn().
+				Str("operation", req.OperationName).
+				Str("client", client).
+				Msg("Rate limited request")
+			return middleware.Response{}, ratelimit.ErrorRateLimited
+		}
+		return next(req)
+	}
+}
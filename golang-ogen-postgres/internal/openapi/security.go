@@ -0,0 +1,122 @@
+package openapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ogen-go/ogen/ogenerrors"
+
+	"example-server/internal/auth"
+	"example-server/internal/logger"
+	"example-server/internal/openapi/ogen"
+)
+
+// SecurityHandler verifies the bearerAuth JWT, apiKeyAuth key or clientCertAuth
+// certificate, checks the operation against the policy and stores the
+// principal on the request context
+type SecurityHandler struct {
+	Verifier *auth.Verifier
+	APIKeys  *auth.APIKeyAuthenticator
+	Policy   *auth.Policy
+}
+
+func (h *SecurityHandler) HandleBearerAuth(
+	ctx context.Context,
+	operationName ogen.OperationName,
+	t ogen.BearerAuth,
+) (context.Context, error) {
+	principal, err := h.Verifier.Verify(ctx, t.Token)
+	return h.authorize(ctx, operationName, principal, err)
+}
+
+func (h *SecurityHandler) HandleApiKeyAuth(
+	ctx context.Context,
+	operationName ogen.OperationName,
+	t ogen.ApiKeyAuth,
+) (context.Context, error) {
+	if h.APIKeys == nil {
+		return ctx, auth.ErrorInvalidAPIKey
+	}
+	principal, err := h.APIKeys.Authenticate(ctx, t.APIKey)
+	return h.authorize(ctx, operationName, principal, err)
+}
+
+// HandleClientCertAuth authenticates with the client certificate verified
+// during the mTLS handshake, unless a token or API key already did
+func (h *SecurityHandler) HandleClientCertAuth(
+	ctx context.Context,
+	operationName ogen.OperationName,
+	req *http.Request,
+) (context.Context, error) {
+	if _, ok := auth.FromContext(ctx); ok {
+		return ctx, nil
+	}
+	cert, ok := auth.ClientCertificate(req.TLS)
+	if !ok {
+		return ctx, ogenerrors.ErrSkipServerSecurity
+	}
+	return h.authorize(ctx, operationName, auth.PrincipalFromCertificate(cert), nil)
+}
+
+func (h *SecurityHandler) authorize(
+	ctx context.Context,
+	operationName ogen.OperationName,
+	principal *auth.Principal,
+	err error,
+) (context.Context, error) {
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).
+			Str("operation", operationName).
+			Msg("Unauthenticated request")
+		return ctx, err
+	}
+	if h.Policy != nil {
+		if err := h.Policy.Authorize(principal, operationName); err != nil {
+			logger.FromContext(ctx).Warn().Err(err).
+				Str("operation", operationName).
+				Str("subject", principal.Subject).
+				Msg("Forbidden request")
+			return ctx, err
+		}
+	}
+	return auth.NewContext(ctx, principal), nil
+}
+
+// Authenticate runs the security schemes on a request served next to the
+// ogen server, in the order ogen tries them: bearer token, API key, client
+// certificate. Errors are wrapped in an ogenerrors.SecurityError, which
+// NewError reports like ogen's.
+func (h *SecurityHandler) Authenticate(
+	ctx context.Context,
+	operationName ogen.OperationName,
+	req *http.Request,
+) (context.Context, error) {
+	var security string
+	var err error
+	switch {
+	case req.Header.Get("Authorization") != "":
+		security = "bearerAuth"
+		var token string
+		if token, err = auth.BearerToken(req.Header.Get("Authorization")); err == nil {
+			ctx, err = h.HandleBearerAuth(ctx, operationName, ogen.BearerAuth{Token: token})
+		}
+	case req.Header.Get("X-API-Key") != "":
+		security = "apiKeyAuth"
+		ctx, err = h.HandleApiKeyAuth(ctx, operationName, ogen.ApiKeyAuth{APIKey: req.Header.Get("X-API-Key")})
+	default:
+		security = "clientCertAuth"
+		ctx, err = h.HandleClientCertAuth(ctx, operationName, req)
+		if errors.Is(err, ogenerrors.ErrSkipServerSecurity) {
+			err = auth.ErrorMissingToken
+		}
+	}
+	if err != nil {
+		return ctx, &ogenerrors.SecurityError{
+			OperationContext: ogenerrors.OperationContext{Name: operationName},
+			Security:         security,
+			Err:              err,
+		}
+	}
+	return ctx, nil
+}
@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"net/http"
+	"net/netip"
+
+	"example-server/internal/auth"
+	"example-server/internal/logger"
+	"example-server/internal/ratelimit"
+	"example-server/internal/tenant"
+)
+
+// StreamGuard checks requests to the streaming handlers, which can't be
+// ogen operations and are routed next to the ogen server. It does what the
+// SecurityHandler, RateLimitMiddleware and TenantMiddleware do for
+// operations, and answers with the same errors.
+type StreamGuard struct {
+	Service        *ItemsService
+	Security       *SecurityHandler
+	Limiter        *ratelimit.Limiter
+	TrustedProxies []netip.Prefix
+}
+
+// Check authenticates, authorizes and rate limits r as operationName and
+// resolves its tenant, returning r with both on its context. ok is false
+// once the error has been written.
+func (g *StreamGuard) Check(
+	w http.ResponseWriter,
+	r *http.Request,
+	operationName string,
+) (_ *http.Request, tenantID string, ok bool) {
+	ctx, err := g.Security.Authenticate(r.Context(), operationName, r)
+	if err != nil {
+		g.writeError(w, r, err)
+		return r, "", false
+	}
+	principal, _ := auth.FromContext(ctx)
+	if g.Limiter != nil {
+		client := ratelimit.ClientKey(principal, ratelimit.ClientIP(r, g.TrustedProxies))
+		result := g.Limiter.Allow(ctx, operationName, client)
+		ratelimit.SetHeaders(w.Header(), result)
+		if !result.Allowed {
+			logger.FromContext(ctx).Warn().
+				Str("operation", operationName).
+				Str("client", client).
+				Msg("Rate limited request")
+			g.writeError(w, r, ratelimit.ErrorRateLimited)
+			return r, "", false
+		}
+	}
+	var credentialTenant string
+	var crossTenant bool
+	if principal != nil {
+		credentialTenant = principal.TenantID
+		crossTenant = principal.HasScope(auth.CrossTenantScope)
+	}
+	tenantID, err = tenant.Resolve(credentialTenant, r.Header.Get(tenant.Header), crossTenant)
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).
+			Str("operation", operationName).
+			Msg("Rejected tenant")
+		g.writeError(w, r, err)
+		return r, "", false
+	}
+	return r.WithContext(tenant.NewContext(ctx, tenantID)), tenantID, true
+}
+
+func (g *StreamGuard) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(g.Service, w, r, err)
+}
+
+// writeError writes err as the ogen server would, see NewError
+func writeError(service *ItemsService, w http.ResponseWriter, r *http.Request, err error) {
+	errResponse := service.NewError(r.Context(), err)
+	body, err := errResponse.Response.MarshalJSON()
+	if err != nil {
+		logger.FromContext(r.Context()).Error().Err(err).Msg("Error encoding error response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errResponse.StatusCode)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	"github.com/ogen-go/ogen/middleware"
+
+	"example-server/internal/auth"
+	"example-server/internal/logger"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/tenant"
+)
+
+// TenantMiddleware resolves the tenant of item operations from the
+// principal's tenant, or the X-Tenant-ID header for cross-tenant principals,
+// and stores it on the request context; it runs after the SecurityHandler
+func TenantMiddleware(req middleware.Request, next middleware.Next) (middleware.Response, error) {
+	if req.OperationName == ogen.PingOperation {
+		return next(req)
+	}
+	var credentialTenant string
+	var crossTenant bool
+	if principal, ok := auth.FromContext(req.Context); ok {
+		credentialTenant = principal.TenantID
+		crossTenant = principal.HasScope(auth.CrossTenantScope)
+	}
+	tenantID, err := tenant.Resolve(credentialTenant, req.Raw.Header.Get(tenant.Header), crossTenant)
+	if err != nil {
+		logger.FromContext(req.Context).Warn().Err(err).
+			Str("operation", req.OperationName).
+			Msg("Rejected tenant")
+		return middleware.Response{}, err
+	}
+	req.Context = tenant.NewContext(req.Context, tenantID)
+	return next(req)
+}
@@ -0,0 +1,176 @@
+package openapi
+
+import (
+	"context"
+
+	"github.com/go-faster/jx"
+
+	"example-server/internal/logger"
+	"example-server/internal/models"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/repos"
+	"example-server/internal/webhook"
+)
+
+// defaultWebhookDeliveriesLimit matches the limit default in openapi-schema.yaml
+const defaultWebhookDeliveriesLimit = 50
+
+func (s *ItemsService) CreateWebhook(
+	ctx context.Context,
+	req *ogen.WebhookCreateRequest,
+) (*ogen.WebhookCreateResponse, error) {
+	logger.FromContext(ctx).Info().Str("url", req.Data.URL).Msg("Handling webhook create request")
+	// Generate the signing secret
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error generating webhook secret")
+		return nil, s.NewError(ctx, repos.ErrorWebhookInsert)
+	}
+	subscription, err := repos.InsertWebhookSubscription(ctx, s.Deps.DBPool, secret, webhookSubscriptionIn(req.Data))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Error creating webhook")
+		return nil, s.NewError(ctx, err)
+	}
+	logger.FromContext(ctx).Info().Int("webhookId", subscription.ID).Msg("Webhook created")
+	return &ogen.WebhookCreateResponse{
+		Data:   webhookOut(subscription),
+		Secret: secret,
+	}, nil
+}
+
+func (s *ItemsService) ListWebhooks(ctx context.Context) (*ogen.WebhookListResponse, error) {
+	subscriptions, err := repos.FetchWebhookSubscriptions(ctx, s.Deps.DBPool)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Msg("Error listing webhooks")
+		return nil, s.NewError(ctx, err)
+	}
+	webhooks := make([]ogen.Webhook, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		webhooks = append(webhooks, webhookOut(subscription))
+	}
+	return &ogen.WebhookListResponse{Data: webhooks}, nil
+}
+
+func (s *ItemsService) GetWebhook(
+	ctx context.Context,
+	params ogen.GetWebhookParams,
+) (*ogen.WebhookResponse, error) {
+	subscription, err := repos.FetchWebhookSubscriptionById(ctx, s.Deps.DBPool, params.WebhookId)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("GetWebhookParams", params).Msg("Error getting webhook")
+		return nil, s.NewError(ctx, err)
+	}
+	return &ogen.WebhookResponse{Data: webhookOut(subscription)}, nil
+}
+
+func (s *ItemsService) UpdateWebhook(
+	ctx context.Context,
+	req *ogen.WebhookUpdateRequest,
+	params ogen.UpdateWebhookParams,
+) (*ogen.WebhookResponse, error) {
+	logger.FromContext(ctx).Info().Interface("UpdateWebhookParams", params).Msg("Handling webhook update request")
+	subscription, err := repos.UpdateWebhookSubscription(ctx, s.Deps.DBPool, params.WebhookId, webhookSubscriptionIn(req.Data))
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("UpdateWebhookParams", params).Msg("Error updating webhook")
+		return nil, s.NewError(ctx, err)
+	}
+	return &ogen.WebhookResponse{Data: webhookOut(subscription)}, nil
+}
+
+func (s *ItemsService) DeleteWebhook(
+	ctx context.Context,
+	params ogen.DeleteWebhookParams,
+) error {
+	logger.FromContext(ctx).Info().Interface("DeleteWebhookParams", params).Msg("Handling webhook delete request")
+	if _, err := repos.DeleteWebhookSubscription(ctx, s.Deps.DBPool, params.WebhookId); err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("DeleteWebhookParams", params).Msg("Error deleting webhook")
+		return s.NewError(ctx, err)
+	}
+	return nil
+}
+
+func (s *ItemsService) ListWebhookDeliveries(
+	ctx context.Context,
+	params ogen.ListWebhookDeliveriesParams,
+) (*ogen.WebhookDeliveryListResponse, error) {
+	limit := params.Limit.Or(defaultWebhookDeliveriesLimit)
+	deliveries, err := repos.FetchWebhookDeliveries(ctx, s.Deps.DBPool, params.WebhookId, limit)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("ListWebhookDeliveriesParams", params).Msg("Error listing webhook deliveries")
+		return nil, s.NewError(ctx, err)
+	}
+	deliveriesOut := make([]ogen.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveriesOut = append(deliveriesOut, webhookDeliveryOut(delivery))
+	}
+	return &ogen.WebhookDeliveryListResponse{Data: deliveriesOut}, nil
+}
+
+func (s *ItemsService) RetryWebhookDelivery(
+	ctx context.Context,
+	params ogen.RetryWebhookDeliveryParams,
+) (*ogen.WebhookDeliveryResponse, error) {
+	logger.FromContext(ctx).Info().Interface("RetryWebhookDeliveryParams", params).Msg("Handling webhook delivery retry request")
+	delivery, err := repos.RetryWebhookDelivery(ctx, s.Deps.DBPool, params.WebhookId, params.DeliveryId)
+	if err != nil {
+		logger.FromContext(ctx).Error().Err(err).Interface("RetryWebhookDeliveryParams", params).Msg("Error retrying webhook delivery")
+		return nil, s.NewError(ctx, err)
+	}
+	return &ogen.WebhookDeliveryResponse{Data: webhookDeliveryOut(delivery)}, nil
+}
+
+// webhookSubscriptionIn converts ogen.WebhookIn, which ogen has validated
+// against the schema, to models.WebhookSubscriptionIn
+func webhookSubscriptionIn(in ogen.WebhookIn) models.WebhookSubscriptionIn {
+	events := make([]string, 0, len(in.Events))
+	for _, event := range in.Events {
+		events = append(events, string(event))
+	}
+	active := in.Active.Or(true)
+	return models.WebhookSubscriptionIn{URL: in.URL, Events: events, Active: &active}
+}
+
+func webhookOut(subscription *models.WebhookSubscription) ogen.Webhook {
+	events := make([]ogen.WebhookEvent, 0, len(subscription.Events))
+	for _, event := range subscription.Events {
+		events = append(events, ogen.WebhookEvent(event))
+	}
+	return ogen.Webhook{
+		ID:        int64(subscription.ID),
+		URL:       subscription.URL,
+		Events:    events,
+		Active:    subscription.Active,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+	}
+}
+
+func webhookDeliveryOut(delivery *models.WebhookDelivery) ogen.WebhookDelivery {
+	out := ogen.WebhookDelivery{
+		ID:             delivery.ID,
+		SubscriptionID: int64(delivery.SubscriptionID),
+		Event:          ogen.WebhookEvent(delivery.Event),
+		Payload:        jx.Raw(delivery.Payload),
+		Status:         ogen.WebhookDeliveryStatus(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		LastAttemptAt:  ogen.NilDateTime{Null: true},
+		LastStatusCode: ogen.NilInt{Null: true},
+		LastError:      ogen.NilString{Null: true},
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    ogen.NilDateTime{Null: true},
+	}
+	if delivery.LastAttemptAt != nil {
+		out.LastAttemptAt = ogen.NewNilDateTime(*delivery.LastAttemptAt)
+	}
+	if delivery.LastStatusCode != nil {
+		out.LastStatusCode = ogen.NewNilInt(*delivery.LastStatusCode)
+	}
+	if delivery.LastError != nil {
+		out.LastError = ogen.NewNilString(*delivery.LastError)
+	}
+	if delivery.DeliveredAt != nil {
+		out.DeliveredAt = ogen.NewNilDateTime(*delivery.DeliveredAt)
+	}
+	return out
+}
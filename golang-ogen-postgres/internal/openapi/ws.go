@@ -0,0 +1,47 @@
+package openapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"example-server/internal/logger"
+	"example-server/internal/ws"
+)
+
+var ErrorUpgradeRequired = errors.New("websocket upgrade required")
+
+// WebSocketOperation names GET /ws in the policy and rate limits
+const WebSocketOperation = "WebSocket"
+
+// WebSocketHandler serves GET /ws, pushing the changes to the Items a client
+// subscribes to, see ws.Serve. The upgrade request is checked by the Guard.
+type WebSocketHandler struct {
+	Guard  *StreamGuard
+	Config ws.Config
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		w.Header().Set("Upgrade", "websocket")
+		h.Guard.writeError(w, r, ErrorUpgradeRequired)
+		return
+	}
+	r, tenantID, ok := h.Guard.Check(w, r, WebSocketOperation)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	changes := h.Guard.Service.Deps.Changes
+	if changes == nil {
+		h.Guard.writeError(w, r, ErrorEventsUnavailable)
+		return
+	}
+	logger.FromContext(ctx).Info().Msg("WebSocket connected")
+	if err := ws.Serve(w, r, changes, tenantID, h.Config); err != nil {
+		logger.FromContext(ctx).Warn().Err(err).Msg("WebSocket closed")
+		return
+	}
+	logger.FromContext(ctx).Info().Msg("WebSocket closed")
+}
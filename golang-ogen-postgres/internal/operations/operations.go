@@ -0,0 +1,323 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/bulk"
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+	"example-server/internal/tenant"
+)
+
+var (
+	ErrorUnknownType  = errors.New("unknown operation type")
+	ErrorLeaseExpired = errors.New("operation lease expired on its last attempt")
+)
+
+// errCanceled stops an operation that was canceled while running
+var errCanceled = errors.New("operation canceled")
+
+// importInput is the input of an item.import operation, its rows already
+// validated
+type importInput struct {
+	OnConflict bulk.OnConflict         `json:"on_conflict"`
+	Rows       []importRow             `json:"rows"`
+	Errors     []models.ImportRowError `json:"errors"`
+}
+
+type importRow struct {
+	Line  int     `json:"line"`
+	Name  string  `json:"name"`
+	Price float32 `json:"price"`
+}
+
+// bulkDeleteInput is the input of an item.bulk_delete operation
+type bulkDeleteInput struct {
+	IDs []int `json:"ids"`
+}
+
+// EnqueueImport queues importing rows of the tenant in ctx, rowErrors being
+// the invalid rows to report
+func EnqueueImport(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	rows []bulk.Row,
+	rowErrors []models.ImportRowError,
+	onConflict bulk.OnConflict,
+) (*models.Operation, error) {
+	input := importInput{OnConflict: onConflict, Rows: make([]importRow, 0, len(rows)), Errors: rowErrors}
+	for _, row := range rows {
+		input.Rows = append(input.Rows, importRow{Line: row.Line, Name: row.Item.Name, Price: row.Item.Price})
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	return repos.InsertOperation(ctx, dbPool, models.OperationItemImport, payload, len(input.Rows))
+}
+
+// EnqueueBulkDelete queues deleting the Items with itemIds of the tenant in
+// ctx, repeated ids counting once
+func EnqueueBulkDelete(ctx context.Context, dbPool database.PgxPoolIface, itemIds []int) (*models.Operation, error) {
+	input := bulkDeleteInput{IDs: make([]int, 0, len(itemIds))}
+	seen := map[int]bool{}
+	for _, itemId := range itemIds {
+		if !seen[itemId] {
+			seen[itemId] = true
+			input.IDs = append(input.IDs, itemId)
+		}
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	return repos.InsertOperation(ctx, dbPool, models.OperationItemBulkDelete, payload, len(input.IDs))
+}
+
+type Config struct {
+	// Concurrency is how many operations a server runs at once
+	Concurrency int
+	// PollInterval is how often queued operations are looked for
+	PollInterval time.Duration
+	// ChunkSize is how many rows or ids are processed per transaction,
+	// progress is recorded after each chunk
+	ChunkSize int
+	// Lease is how long a worker may go without recording progress before
+	// another one takes the operation over
+	Lease time.Duration
+}
+
+// ConfigFromEnv reads OPERATIONS_CONCURRENCY (default 2),
+// OPERATIONS_POLL_INTERVAL (default 1s), OPERATIONS_CHUNK_SIZE (default 500)
+// and OPERATIONS_LEASE (default 1m)
+func ConfigFromEnv() Config {
+	return Config{
+		Concurrency:  intFromEnv("OPERATIONS_CONCURRENCY", 2),
+		PollInterval: durationFromEnv("OPERATIONS_POLL_INTERVAL", time.Second),
+		ChunkSize:    intFromEnv("OPERATIONS_CHUNK_SIZE", 500),
+		Lease:        durationFromEnv("OPERATIONS_LEASE", time.Minute),
+	}
+}
+
+func durationFromEnv(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func intFromEnv(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// Runner runs queued operations in a server's goroutines. Every replica may
+// run one: operations are claimed with SKIP LOCKED and leased, and as
+// progress is recorded per chunk a replica taking over an operation whose
+// worker died resumes after the last recorded chunk. That chunk may then be
+// applied twice, which imports and deletes tolerate.
+type Runner struct {
+	dbPool database.PgxPoolIface
+	config Config
+	slots  chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewRunner(dbPool database.PgxPoolIface, config Config) *Runner {
+	return &Runner{dbPool: dbPool, config: config, slots: make(chan struct{}, config.Concurrency)}
+}
+
+// Run starts queued operations every poll interval until ctx is done, then
+// waits for the running ones to stop. Their current chunk is rolled back and
+// the lease hands them to another replica.
+func (r *Runner) Run(ctx context.Context) {
+	log.Info().Int("concurrency", r.config.Concurrency).Dur("pollInterval", r.config.PollInterval).Msg("Running operations")
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.Wait()
+			return
+		case <-ticker.C:
+		}
+		// Keep going while there is a backlog and free slots
+		for ctx.Err() == nil {
+			started, err := r.RunDue(ctx)
+			if err != nil || started == 0 {
+				break
+			}
+		}
+	}
+}
+
+// RunDue claims as many operations as there are free slots and starts them,
+// returning how many were started
+func (r *Runner) RunDue(ctx context.Context) (int, error) {
+	free := cap(r.slots) - len(r.slots)
+	if free == 0 {
+		return 0, nil
+	}
+	operations, err := repos.ClaimOperations(ctx, r.dbPool, free, r.config.Lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, operation := range operations {
+		r.slots <- struct{}{}
+		r.wg.Add(1)
+		go func() {
+			defer func() {
+				<-r.slots
+				r.wg.Done()
+			}()
+			r.run(ctx, operation)
+		}()
+	}
+	return len(operations), nil
+}
+
+// Wait returns once the started operations stopped
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// run runs a claimed operation as its tenant and records the outcome.
+// Recording errors are logged by repos, the lease then hands the operation
+// to another worker. An operation claimed again meanwhile is left to that
+// claim.
+func (r *Runner) run(ctx context.Context, operation *models.Operation) {
+	ctx = tenant.NewContext(ctx, operation.TenantID)
+	logger := log.With().Int64("operationId", operation.ID).Str("type", operation.Type).
+		Int("attempt", operation.Attempts).Logger()
+	logger.Info().Int("processed", operation.Processed).Int("total", operation.Total).Msg("Running operation")
+	var result any
+	var err error
+	switch {
+	case operation.Attempts > operation.MaxAttempts:
+		// Its worker died or hung on the last attempt
+		err = ErrorLeaseExpired
+	case operation.Type == models.OperationItemImport:
+		result, err = r.runImport(ctx, operation)
+	case operation.Type == models.OperationItemBulkDelete:
+		result, err = r.runBulkDelete(ctx, operation)
+	default:
+		err = errors.Wrapf(ErrorUnknownType, "%q", operation.Type)
+	}
+	switch {
+	case errors.Is(err, errCanceled):
+		logger.Info().Msg("Operation canceled")
+	case errors.Is(err, repos.ErrorOperationLeaseLost):
+		// Another worker took the operation over and records its outcome
+	case ctx.Err() != nil:
+		// Shutting down, the lease hands the operation to another worker
+	case err != nil:
+		logger.Error().Err(err).Msg("Operation failed")
+		errMsg := err.Error()
+		err = repos.FinishOperation(ctx, r.dbPool, operation.ID, operation.Attempts, nil, &errMsg)
+	default:
+		logger.Info().Msg("Operation succeeded")
+		payload, _ := json.Marshal(result)
+		err = repos.FinishOperation(ctx, r.dbPool, operation.ID, operation.Attempts, payload, nil)
+	}
+	if errors.Is(err, repos.ErrorOperationLeaseLost) {
+		logger.Warn().Msg("Operation lease lost to another claim, outcome not recorded")
+	}
+}
+
+func (r *Runner) runImport(ctx context.Context, operation *models.Operation) (*models.ImportReport, error) {
+	var input importInput
+	if err := json.Unmarshal(operation.Input, &input); err != nil {
+		return nil, err
+	}
+	// Carry on from the report so far when resuming
+	report := &models.ImportReport{Errors: input.Errors}
+	if operation.Result != nil {
+		if err := json.Unmarshal(operation.Result, report); err != nil {
+			return nil, err
+		}
+	}
+	err := r.process(ctx, operation, report, func(start, end int) error {
+		rows := make([]bulk.Row, 0, end-start)
+		for _, row := range input.Rows[start:end] {
+			rows = append(rows, bulk.Row{Line: row.Line, Item: models.ItemIn{Name: row.Name, Price: row.Price}})
+		}
+		chunkReport, err := repos.ImportItems(ctx, r.dbPool, rows, input.OnConflict)
+		if err != nil {
+			return err
+		}
+		report.Inserted += chunkReport.Inserted
+		report.Updated += chunkReport.Updated
+		report.Skipped += chunkReport.Skipped
+		return nil
+	})
+	return report, err
+}
+
+func (r *Runner) runBulkDelete(ctx context.Context, operation *models.Operation) (*models.BulkDeleteReport, error) {
+	var input bulkDeleteInput
+	if err := json.Unmarshal(operation.Input, &input); err != nil {
+		return nil, err
+	}
+	// Carry on from the report so far when resuming
+	report := &models.BulkDeleteReport{NotFound: []int{}}
+	if operation.Result != nil {
+		if err := json.Unmarshal(operation.Result, report); err != nil {
+			return nil, err
+		}
+	}
+	err := r.process(ctx, operation, report, func(start, end int) error {
+		itemIds := input.IDs[start:end]
+		items, err := repos.DeleteItems(ctx, r.dbPool, itemIds)
+		if err != nil {
+			return err
+		}
+		deleted := make(map[int]bool, len(items))
+		for _, item := range items {
+			deleted[item.ID] = true
+		}
+		for _, itemId := range itemIds {
+			if !deleted[itemId] {
+				report.NotFound = append(report.NotFound, itemId)
+			}
+		}
+		report.Deleted += len(items)
+		return nil
+	})
+	return report, err
+}
+
+// process calls step for each chunk of the operation's remaining work, and
+// records progress and result after each. It returns errCanceled once the
+// operation was canceled and repos.ErrorOperationLeaseLost once another
+// worker claimed it.
+func (r *Runner) process(ctx context.Context, operation *models.Operation, result any, step func(start, end int) error) error {
+	for start := operation.Processed; start < operation.Total; start += r.config.ChunkSize {
+		end := min(start+r.config.ChunkSize, operation.Total)
+		if err := step(start, end); err != nil {
+			return err
+		}
+		payload, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		running, err := repos.RecordOperationProgress(ctx, r.dbPool, operation.ID, operation.Attempts, end, payload, r.config.Lease)
+		if err != nil {
+			return err
+		}
+		if !running {
+			return errCanceled
+		}
+	}
+	return nil
+}
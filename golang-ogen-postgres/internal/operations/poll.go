@@ -0,0 +1,60 @@
+package operations
+
+import (
+	"context"
+	"time"
+
+	"example-server/internal/openapi/ogen"
+)
+
+// Finished reports whether an operation with status is done changing
+func Finished(status ogen.OperationStatus) bool {
+	switch status {
+	case ogen.OperationStatusSucceeded, ogen.OperationStatusFailed, ogen.OperationStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Wait polls the operation with client every interval until it is finished
+// and returns it. onProgress, when not nil, is called with every polled
+// state. Give ctx a deadline to bound the wait.
+func Wait(
+	ctx context.Context,
+	client *ogen.Client,
+	operationId int64,
+	interval time.Duration,
+	onProgress func(operation *ogen.Operation),
+) (*ogen.Operation, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		response, err := client.GetOperation(ctx, ogen.GetOperationParams{OperationId: operationId})
+		if err != nil {
+			return nil, err
+		}
+		operation := &response.Data
+		if onProgress != nil {
+			onProgress(operation)
+		}
+		if Finished(operation.Status) {
+			return operation, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitAccepted waits for the operation of a 202 response
+func WaitAccepted(
+	ctx context.Context,
+	client *ogen.Client,
+	accepted *ogen.OperationAcceptedHeaders,
+	interval time.Duration,
+	onProgress func(operation *ogen.Operation),
+) (*ogen.Operation, error) {
+	return Wait(ctx, client, accepted.Response.Data.ID, interval, onProgress)
+}
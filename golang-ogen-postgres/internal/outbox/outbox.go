@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrorInvalidPublisher = errors.New("invalid outbox publisher, expected log or nats")
+
+// Publishers
+const (
+	PublisherLog  = "log"
+	PublisherNATS = "nats"
+)
+
+// Message headers, besides the event type and tenant in the payload
+const (
+	// HeaderMessageID is the outbox id, the same on every redelivery, which
+	// JetStream uses to drop duplicates
+	HeaderMessageID = "Nats-Msg-Id"
+	// HeaderKey orders messages: ones with the same key are published in order
+	HeaderKey = "Outbox-Key"
+)
+
+// Message is an outbox event as sent to the message bus
+type Message struct {
+	ID      int64
+	Subject string
+	Key     string
+	Payload []byte
+}
+
+// Publisher sends Messages to a message bus. Publish may buffer, and Flush
+// returns once the bus has every Message published before it, so a Message
+// is only acknowledged to the outbox after a successful Flush.
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+type Config struct {
+	// Publisher is PublisherLog or PublisherNATS
+	Publisher string
+	// NATSURL is the nats://[user:password@]host:port the NATS publisher uses
+	NATSURL string
+	// SubjectPrefix is put before the event type to make the subject
+	SubjectPrefix string
+	// PollInterval is how often the outbox is drained
+	PollInterval time.Duration
+	// BatchSize is how many events are published per transaction
+	BatchSize int
+	// PublishTimeout bounds publishing and flushing a batch
+	PublishTimeout time.Duration
+}
+
+// ConfigFromEnv reads OUTBOX_PUBLISHER (default log), NATS_URL (default
+// nats://localhost:4222), OUTBOX_SUBJECT_PREFIX (default events),
+// OUTBOX_POLL_INTERVAL (default 1s), OUTBOX_BATCH_SIZE (default 100) and
+// OUTBOX_PUBLISH_TIMEOUT (default 5s)
+func ConfigFromEnv() Config {
+	config := Config{
+		Publisher:      strings.ToLower(strings.TrimSpace(os.Getenv("OUTBOX_PUBLISHER"))),
+		NATSURL:        os.Getenv("NATS_URL"),
+		SubjectPrefix:  os.Getenv("OUTBOX_SUBJECT_PREFIX"),
+		PollInterval:   time.Second,
+		BatchSize:      100,
+		PublishTimeout: 5 * time.Second,
+	}
+	if config.Publisher == "" {
+		config.Publisher = PublisherLog
+	}
+	if config.NATSURL == "" {
+		config.NATSURL = "nats://localhost:4222"
+	}
+	if config.SubjectPrefix == "" {
+		config.SubjectPrefix = "events"
+	}
+	if interval, err := time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL")); err == nil && interval > 0 {
+		config.PollInterval = interval
+	}
+	if batchSize, err := strconv.Atoi(os.Getenv("OUTBOX_BATCH_SIZE")); err == nil && batchSize > 0 {
+		config.BatchSize = batchSize
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("OUTBOX_PUBLISH_TIMEOUT")); err == nil && timeout > 0 {
+		config.PublishTimeout = timeout
+	}
+	return config
+}
+
+// NewPublisher returns the Publisher config asks for
+func NewPublisher(config Config) (Publisher, error) {
+	switch config.Publisher {
+	case PublisherLog:
+		return NewLogPublisher(os.Stdout), nil
+	case PublisherNATS:
+		return NewNATSPublisher(config.NATSURL, config.PublishTimeout)
+	}
+	return nil, errors.Wrapf(ErrorInvalidPublisher, "%q", config.Publisher)
+}
+
+// LogPublisher writes Messages as JSON lines, for development and for
+// piping into another process
+type LogPublisher struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewLogPublisher(out io.Writer) *LogPublisher {
+	return &LogPublisher{out: out}
+}
+
+type logMessage struct {
+	ID      int64           `json:"id"`
+	Subject string          `json:"subject"`
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, message Message) error {
+	line, err := json.Marshal(logMessage{
+		ID:      message.ID,
+		Subject: message.Subject,
+		Key:     message.Key,
+		Payload: message.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.out.Write(append(line, '\n'))
+	return err
+}
+
+func (p *LogPublisher) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (p *LogPublisher) Close() error {
+	return nil
+}
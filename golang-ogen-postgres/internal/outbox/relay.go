@@ -0,0 +1,192 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+// Publish outcome labels
+const (
+	OutcomePublished = "published"
+	OutcomeFailed    = "failed"
+)
+
+type Metrics struct {
+	published    *prometheus.CounterVec
+	publishDelay prometheus.Histogram
+	pending      prometheus.Gauge
+	lag          prometheus.Gauge
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		published: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "outbox_events_total",
+				Help: "Number of outbox events handed to the publisher by outcome.",
+			},
+			[]string{"outcome"},
+		),
+		publishDelay: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "outbox_publish_delay_seconds",
+				Help:    "Time from writing outbox events to their publishing being confirmed.",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		pending: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "outbox_pending_events",
+				Help: "Number of outbox events waiting to be published.",
+			},
+		),
+		lag: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "outbox_lag_seconds",
+				Help: "Age of the oldest outbox event waiting to be published.",
+			},
+		),
+	}
+	reg.MustRegister(m.published, m.publishDelay, m.pending, m.lag)
+	return m
+}
+
+// Event is the payload of a published Message
+type Event struct {
+	// ID is the outbox id, the same on every redelivery
+	ID         int64           `json:"id"`
+	Event      string          `json:"event"`
+	TenantID   string          `json:"tenant_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Relay drains the outbox into a Publisher. Delivery is at least once: events
+// are deleted once the Publisher flushed them, and published again when
+// anything fails before that commits. Events are published in outbox order,
+// and after one fails later events with the same key wait for the next
+// batch, so each Item's events stay in order.
+type Relay struct {
+	dbPool    database.PgxPoolIface
+	publisher Publisher
+	config    Config
+	metrics   *Metrics
+}
+
+// NewRelay returns a Relay, metrics may be nil
+func NewRelay(dbPool database.PgxPoolIface, publisher Publisher, config Config, metrics *Metrics) *Relay {
+	return &Relay{dbPool: dbPool, publisher: publisher, config: config, metrics: metrics}
+}
+
+// Run relays the outbox every poll interval until ctx is done, updating the
+// lag metrics each time
+func (r *Relay) Run(ctx context.Context) {
+	log.Info().Str("publisher", r.config.Publisher).Dur("pollInterval", r.config.PollInterval).Msg("Relaying outbox")
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Keep going while there is a backlog
+		for ctx.Err() == nil {
+			published, err := r.RelayDue(ctx)
+			if err != nil || published < r.config.BatchSize {
+				break
+			}
+		}
+		r.RecordLag(ctx)
+	}
+}
+
+// RelayDue publishes a batch of outbox events, returning how many were
+// published
+func (r *Relay) RelayDue(ctx context.Context) (int, error) {
+	return repos.RelayOutboxEvents(ctx, r.dbPool, r.config.BatchSize, r.publish)
+}
+
+// RecordLag sets the pending events and lag gauges
+func (r *Relay) RecordLag(ctx context.Context) {
+	if r.metrics == nil {
+		return
+	}
+	pending, lag, err := repos.FetchOutboxLag(ctx, r.dbPool)
+	if err != nil {
+		return
+	}
+	r.metrics.pending.Set(float64(pending))
+	r.metrics.lag.Set(lag)
+}
+
+// publish hands events to the publisher in order and returns the ids of the
+// ones it confirmed
+func (r *Relay) publish(ctx context.Context, events []*models.OutboxEvent) []int64 {
+	ctx, cancel := context.WithTimeout(ctx, r.config.PublishTimeout)
+	defer cancel()
+	var published []*models.OutboxEvent
+	failedKeys := map[string]bool{}
+	for _, event := range events {
+		message := r.message(event)
+		if failedKeys[message.Key] {
+			continue
+		}
+		if err := r.publisher.Publish(ctx, message); err != nil {
+			log.Warn().Err(err).Int64("outboxId", event.ID).Str("key", message.Key).Msg("Error publishing outbox event")
+			failedKeys[message.Key] = true
+			r.count(OutcomeFailed, 1)
+			continue
+		}
+		published = append(published, event)
+	}
+	if len(published) == 0 {
+		return nil
+	}
+	if err := r.publisher.Flush(ctx); err != nil {
+		log.Warn().Err(err).Int("events", len(published)).Msg("Error flushing outbox events")
+		r.count(OutcomeFailed, len(published))
+		return nil
+	}
+	ids := make([]int64, 0, len(published))
+	for _, event := range published {
+		ids = append(ids, event.ID)
+		if r.metrics != nil {
+			r.metrics.publishDelay.Observe(time.Since(event.CreatedAt).Seconds())
+		}
+	}
+	r.count(OutcomePublished, len(published))
+	return ids
+}
+
+// message makes the Message of event, keyed by its aggregate
+func (r *Relay) message(event *models.OutboxEvent) Message {
+	payload, _ := json.Marshal(Event{
+		ID:         event.ID,
+		Event:      event.EventType,
+		TenantID:   event.TenantID,
+		OccurredAt: event.CreatedAt,
+		Data:       event.Payload,
+	})
+	return Message{
+		ID:      event.ID,
+		Subject: r.config.SubjectPrefix + "." + event.EventType,
+		Key:     event.TenantID + "/" + event.AggregateType + "/" + strconv.Itoa(event.AggregateID),
+		Payload: payload,
+	}
+}
+
+func (r *Relay) count(outcome string, n int) {
+	if r.metrics != nil {
+		r.metrics.published.WithLabelValues(outcome).Add(float64(n))
+	}
+}
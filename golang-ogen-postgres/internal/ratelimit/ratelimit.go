@@ -0,0 +1,297 @@
+package ratelimit
+
+import (
+	"context"
+	_ "embed"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"example-server/internal/auth"
+	"example-server/internal/logger"
+)
+
+var (
+	ErrorRateLimited  = errors.New("too many requests")
+	ErrorInvalidLimit = errors.New("invalid rate limit config")
+	ErrorInvalidProxy = errors.New("invalid trusted proxy")
+)
+
+//go:embed limits.yaml
+var defaultConfig []byte
+
+// Limit allows Rate requests per Period with bursts of up to Burst requests
+type Limit struct {
+	Rate   int           `yaml:"rate"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
+}
+
+// Unlimited reports whether the limit is disabled
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// perSecond is the bucket refill rate
+func (l Limit) perSecond() float64 {
+	return float64(l.Rate) / l.Period.Seconds()
+}
+
+// take removes a token from a bucket refilled up to now
+func (l Limit) take(tokens float64) (float64, Result) {
+	result := Result{Limit: l.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - tokens) / l.perSecond())
+	}
+	result.Remaining = int(tokens)
+	result.Reset = secondsToDuration((float64(l.Burst) - tokens) / l.perSecond())
+	return tokens, result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Config holds the default limit and per-operation overrides
+type Config struct {
+	Default    Limit            `yaml:"default"`
+	Operations map[string]Limit `yaml:"operations"`
+	// ClientIP limits each client IP across operations before requests are
+	// authenticated, so failed authentications are limited too
+	ClientIP Limit `yaml:"client_ip"`
+}
+
+// ConfigFromEnv loads RATE_LIMIT_FILE, falling back to the built-in limits
+func ConfigFromEnv() (*Config, error) {
+	if path := os.Getenv("RATE_LIMIT_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(ErrorInvalidLimit, err.Error())
+		}
+		return ParseConfig(data)
+	}
+	return ParseConfig(defaultConfig)
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(ErrorInvalidLimit, err.Error())
+	}
+	var err error
+	if config.Default, err = normalizeLimit(config.Default); err != nil {
+		return nil, errors.Wrapf(err, "default")
+	}
+	if config.ClientIP, err = normalizeLimit(config.ClientIP); err != nil {
+		return nil, errors.Wrapf(err, "client_ip")
+	}
+	for operation, limit := range config.Operations {
+		if config.Operations[operation], err = normalizeLimit(limit); err != nil {
+			return nil, errors.Wrapf(err, "%s", operation)
+		}
+	}
+	return &config, nil
+}
+
+// normalizeLimit defaults Period to a minute and Burst to Rate
+func normalizeLimit(limit Limit) (Limit, error) {
+	if limit.Unlimited() {
+		return Limit{}, nil
+	}
+	if limit.Period == 0 {
+		limit.Period = time.Minute
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.Rate
+	}
+	if limit.Period < 0 || limit.Burst < 0 {
+		return Limit{}, errors.Wrap(ErrorInvalidLimit, "negative period or burst")
+	}
+	return limit, nil
+}
+
+// LimitFor returns the limit of operation, or the default
+func (c *Config) LimitFor(operation string) Limit {
+	if limit, ok := c.Operations[operation]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+// Result describes a bucket after a request took, or failed to take, a token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets; implementations backed by Redis or Postgres let
+// several instances share quotas
+type Store interface {
+	// Take removes a token from the bucket of key, refilling it at limit
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type Limiter struct {
+	store  Store
+	config *Config
+}
+
+func NewLimiter(store Store, config *Config) *Limiter {
+	return &Limiter{store: store, config: config}
+}
+
+// Allow takes a token for client on operation. Store errors are logged and
+// let the request through.
+func (l *Limiter) Allow(ctx context.Context, operation, client string) Result {
+	limit := l.config.LimitFor(operation)
+	if limit.Unlimited() {
+		return Result{Allowed: true}
+	}
+	result, err := l.store.Take(ctx, operation+" "+client, limit)
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).
+			Str("operation", operation).
+			Msg("Rate limit store failed, allowing request")
+		return Result{Allowed: true}
+	}
+	return result
+}
+
+// AllowClientIP takes a token for clientIP before the request to operation is
+// authenticated. Operations without a limit, such as Ping, take none. Store
+// errors are logged and let the request through.
+func (l *Limiter) AllowClientIP(ctx context.Context, operation, clientIP string) Result {
+	limit := l.config.ClientIP
+	if limit.Unlimited() || l.config.LimitFor(operation).Unlimited() {
+		return Result{Allowed: true}
+	}
+	result, err := l.store.Take(ctx, "client_ip "+clientIP, limit)
+	if err != nil {
+		logger.FromContext(ctx).Warn().Err(err).
+			Str("operation", operation).
+			Msg("Rate limit store failed, allowing request")
+		return Result{Allowed: true}
+	}
+	return result
+}
+
+// ClientKey identifies the caller by API key, JWT subject or IP address
+func ClientKey(principal *auth.Principal, clientIP string) string {
+	if principal != nil {
+		if prefix, ok := principal.Claims["api_key_prefix"].(string); ok && principal.Method == auth.MethodAPIKey {
+			return "key:" + prefix
+		}
+		if principal.Subject != "" {
+			return "sub:" + principal.Issuer + "/" + principal.Subject
+		}
+	}
+	return "ip:" + clientIP
+}
+
+// SetHeaders writes the RateLimit-* headers, and Retry-After once limited
+func SetHeaders(header http.Header, result Result) {
+	if result.Limit == 0 {
+		return
+	}
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+	if !result.Allowed {
+		header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// TrustedProxiesFromEnv parses TRUSTED_PROXIES, comma-separated IPs and CIDRs
+// whose X-Forwarded-For header is believed; none by default
+func TrustedProxiesFromEnv() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, errors.Wrap(ErrorInvalidProxy, err.Error())
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, errors.Wrap(ErrorInvalidProxy, err.Error())
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// ClientIP returns the remote address of r or, when it is a trusted proxy,
+// the right-most X-Forwarded-For address that is not
+func ClientIP(r *http.Request, trusted []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(addr, trusted) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	return addr.Unmap().String()
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type responseHeaderKey struct{}
+
+// WithResponseHeader exposes the response headers to ogen middleware, which
+// only sees the request
+func WithResponseHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), responseHeaderKey{}, w.Header())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// HeaderFromContext returns the response headers stored by WithResponseHeader
+func HeaderFromContext(ctx context.Context) (http.Header, bool) {
+	header, ok := ctx.Value(responseHeaderKey{}).(http.Header)
+	return header, ok
+}
@@ -0,0 +1,133 @@
+package repos
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+)
+
+var (
+	ErrorAPIKeyNotFound = errors.New("API key not found")
+	ErrorAPIKeyInsert   = errors.New("Error inserting API key")
+	ErrorAPIKeysQuery   = errors.New("Error querying API keys")
+	ErrorAPIKeyUpdate   = errors.New("Error updating API key")
+)
+
+const apiKeyColumns = "id, prefix, key_hash, owner, tenant_id, scopes, created_at, last_used_at, expires_at, revoked_at"
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	err := row.Scan(
+		&apiKey.ID, &apiKey.Prefix, &apiKey.KeyHash, &apiKey.Owner, &apiKey.TenantID, &apiKey.Scopes,
+		&apiKey.CreatedAt, &apiKey.LastUsedAt, &apiKey.ExpiresAt, &apiKey.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func InsertAPIKey(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	prefix string,
+	keyHash []byte,
+	apiKeyIn models.APIKeyIn,
+) (*models.APIKey, error) {
+	// Insert API key, storing only the hash
+	ctx = database.WithQueryName(ctx, "api_key.insert")
+	scopes := apiKeyIn.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	apiKey, err := scanAPIKey(dbPool.QueryRow(
+		ctx,
+		"INSERT INTO api_keys (prefix, key_hash, owner, tenant_id, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) "+
+			"RETURNING "+apiKeyColumns,
+		prefix, keyHash, apiKeyIn.Owner, apiKeyIn.TenantID, scopes, apiKeyIn.ExpiresAt,
+	))
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error inserting API key")
+		return nil, ErrorAPIKeyInsert
+	}
+	database.RecordDomainEvent(dbPool, "api_key", "created")
+	return apiKey, nil
+}
+
+func FetchAPIKeys(ctx context.Context, dbPool database.PgxPoolIface) ([]*models.APIKey, error) {
+	// Fetch all API keys
+	ctx = database.WithQueryName(ctx, "api_key.fetch_all")
+	rows, err := dbPool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying API keys")
+		return nil, ErrorAPIKeysQuery
+	}
+	defer rows.Close()
+	apiKeys := []*models.APIKey{}
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error scanning API key")
+			return nil, ErrorAPIKeysQuery
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	if err := rows.Err(); err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error iterating API keys")
+		return nil, ErrorAPIKeysQuery
+	}
+	return apiKeys, nil
+}
+
+func FetchAPIKeyByPrefix(ctx context.Context, dbPool database.PgxPoolIface, prefix string) (*models.APIKey, error) {
+	// Fetch API key by its public prefix
+	ctx = database.WithQueryName(ctx, "api_key.fetch_by_prefix")
+	apiKey, err := scanAPIKey(dbPool.QueryRow(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = $1",
+		prefix,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrorAPIKeyNotFound
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying API key")
+		return nil, ErrorAPIKeysQuery
+	}
+	return apiKey, nil
+}
+
+func RevokeAPIKey(ctx context.Context, dbPool database.PgxPoolIface, apiKeyId int) (*models.APIKey, error) {
+	// Revoke API key, keeping the original revocation time if already revoked
+	ctx = database.WithQueryName(ctx, "api_key.revoke")
+	apiKey, err := scanAPIKey(dbPool.QueryRow(
+		ctx,
+		"UPDATE api_keys SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP) WHERE id = $1 RETURNING "+apiKeyColumns,
+		apiKeyId,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrorAPIKeyNotFound
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error revoking API key")
+		return nil, ErrorAPIKeyUpdate
+	}
+	database.RecordDomainEvent(dbPool, "api_key", "revoked")
+	return apiKey, nil
+}
+
+func TouchAPIKey(ctx context.Context, dbPool database.PgxPoolIface, apiKeyId int) error {
+	// Record API key usage
+	ctx = database.WithQueryName(ctx, "api_key.touch")
+	_, err := dbPool.Exec(ctx, "UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", apiKeyId)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error updating API key last use")
+		return ErrorAPIKeyUpdate
+	}
+	return nil
+}
@@ -7,9 +7,11 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pkg/errors"
 
+	"example-server/internal/cache"
 	"example-server/internal/database"
 	"example-server/internal/logger"
 	"example-server/internal/models"
+	"example-server/internal/tenant"
 )
 
 var (
@@ -21,108 +23,245 @@ var (
 	ErrorItemExists   = errors.New("Item already exists")
 )
 
-func InsertItem(dbPool database.PgxPoolIface, itemIn models.ItemIn) (*models.Item, error) {
+// withTenantTx runs fn in a transaction scoped to the request tenant. Row
+// level security isolates tenants; queries also filter on tenant_id since
+// superusers bypass RLS. Transaction failures outside fn are logged and
+// reported as txErr.
+func withTenantTx(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	txErr error,
+	fn func(tx pgx.Tx, tenantID string) error,
+) error {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.ErrorMissingTenant
+	}
+	var fnErr error
+	err := database.WithTenantTx(ctx, dbPool, tenantID, func(tx pgx.Tx) error {
+		fnErr = fn(tx, tenantID)
+		return fnErr
+	})
+	if err != nil && fnErr == nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error in tenant transaction")
+		return txErr
+	}
+	return err
+}
+
+func InsertItem(ctx context.Context, dbPool database.PgxPoolIface, itemIn models.ItemIn) (*models.Item, error) {
 	// Insert Item
-	var itemId int
-	err := dbPool.QueryRow(
-		context.Background(),
-		"INSERT INTO item (name, price) VALUES ($1, $2) RETURNING id",
-		itemIn.Name,
-		itemIn.Price,
-	).Scan(&itemId)
-	// Handle Item insert error
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			// Duplicate entry error handling
-			if pgErr.Code == "23505" {
-				return nil, ErrorItemExists
+	ctx = database.WithQueryName(ctx, "item.insert")
+	var item *models.Item
+	err := withTenantTx(ctx, dbPool, ErrorCreateItem, func(tx pgx.Tx, tenantID string) error {
+		var itemId int
+		err := tx.QueryRow(
+			ctx,
+			"INSERT INTO item (tenant_id, name, price) VALUES ($1, $2, $3) RETURNING id",
+			tenantID,
+			itemIn.Name,
+			itemIn.Price,
+		).Scan(&itemId)
+		// Handle Item insert error
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				// Duplicate entry error handling
+				if pgErr.Code == "23505" {
+					return ErrorItemExists
+				}
 			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error inserting Item")
+			return ErrorCreateItem
 		}
-		logger.LogErrorWithStacktrace(err, "Error inserting Item")
-		return nil, ErrorCreateItem
+		// Fetch Item by ID
+		item, err = fetchItemById(ctx, tx, tenantID, itemId)
+		if err != nil {
+			return err
+		}
+		return recordItemChange(ctx, tx, tenantID, models.WebhookEventItemCreated, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "item", "created")
+	return item, nil
+}
+
+func FetchItemById(ctx context.Context, dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
+	// Read through the Item cache when the pool has one
+	if items := cache.ItemsFromPool(dbPool); items != nil {
+		return items.Fetch(ctx, itemId, func(ctx context.Context) (*models.Item, error) {
+			return loadItemById(ctx, dbPool, itemId)
+		})
 	}
+	return loadItemById(ctx, dbPool, itemId)
+}
+
+func loadItemById(ctx context.Context, dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
 	// Fetch Item by ID
-	item, err := FetchItemById(dbPool, itemId)
+	var item *models.Item
+	err := withTenantTx(ctx, dbPool, ErrorItemsQuery, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		item, err = fetchItemById(ctx, tx, tenantID, itemId)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return item, nil
 }
 
-func FetchItemById(dbPool database.PgxPoolIface, itemId int) (*models.Item, error) {
-	// Fetch Item by ID
+func fetchItemById(ctx context.Context, tx pgx.Tx, tenantID string, itemId int) (*models.Item, error) {
+	ctx = database.WithQueryName(ctx, "item.fetch_by_id")
 	var item models.Item
-	err := dbPool.QueryRow(
-		context.Background(),
-		"SELECT id, uuid, created_at, name, price FROM item WHERE id = $1",
-		itemId,
+	err := tx.QueryRow(
+		ctx,
+		"SELECT id, uuid, created_at, name, price FROM item WHERE id = $1 AND tenant_id = $2",
+		itemId, tenantID,
 	).Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price)
-	// Handle Item fetch error
+	// Handle Item fetch error, other tenants' Items are not found either
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, ErrorItemNotFound
 		}
-		logger.LogErrorWithStacktrace(err, "Error querying Item")
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying Item")
 		return nil, ErrorItemsQuery
 	}
 	return &item, nil
 }
 
 func UpdateItem(
+	ctx context.Context,
 	dbPool database.PgxPoolIface,
 	itemId int,
 	itemIn models.ItemIn,
 ) (*models.Item, error) {
 	// Update Item
+	ctx = database.WithQueryName(ctx, "item.update")
 	var item models.Item
-	err := dbPool.QueryRow(
-		context.Background(),
-		"UPDATE item SET name = $1, price = $2 WHERE id = $3 RETURNING id, uuid, created_at, name, price",
-		itemIn.Name,
-		itemIn.Price,
-		itemId,
-	).Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price)
-	// Handle Item update error
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, ErrorItemNotFound
-		}
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) {
-			// Duplicate entry error handling
-			if pgErr.Code == "23505" {
-				return nil, ErrorItemExists
+	err := withTenantTx(ctx, dbPool, ErrorUpdateItem, func(tx pgx.Tx, tenantID string) error {
+		err := tx.QueryRow(
+			ctx,
+			"UPDATE item SET name = $1, price = $2 WHERE id = $3 AND tenant_id = $4 RETURNING id, uuid, created_at, name, price",
+			itemIn.Name,
+			itemIn.Price,
+			itemId,
+			tenantID,
+		).Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price)
+		// Handle Item update error
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorItemNotFound
+			}
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				// Duplicate entry error handling
+				if pgErr.Code == "23505" {
+					return ErrorItemExists
+				}
 			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error updating Item")
+			return ErrorUpdateItem
 		}
-		logger.LogErrorWithStacktrace(err, "Error updating Item")
-		return nil, ErrorUpdateItem
+		return recordItemChange(ctx, tx, tenantID, models.WebhookEventItemUpdated, &item)
+	})
+	if err != nil {
+		return nil, err
 	}
+	invalidateItems(ctx, dbPool, itemId)
+	database.RecordDomainEvent(dbPool, "item", "updated")
 	return &item, nil
 }
 
 func DeleteItem(
+	ctx context.Context,
 	dbPool database.PgxPoolIface,
 	itemId int,
 ) (*models.Item, error) {
-	// Fetch Item by ID
-	item, fetchErr := FetchItemById(dbPool, itemId)
-	if fetchErr != nil {
-		return nil, fetchErr
+	var item *models.Item
+	err := withTenantTx(ctx, dbPool, ErrorDeleteItem, func(tx pgx.Tx, tenantID string) error {
+		// Fetch Item by ID
+		var err error
+		item, err = fetchItemById(ctx, tx, tenantID, itemId)
+		if err != nil {
+			return err
+		}
+		// Delete Item if it exists
+		_, err = tx.Exec(
+			database.WithQueryName(ctx, "item.delete"),
+			"DELETE FROM item WHERE id = $1 AND tenant_id = $2",
+			itemId,
+			tenantID,
+		)
+		// Handle Item delete error
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error deleting Item")
+			return ErrorDeleteItem
+		}
+		return recordItemChange(ctx, tx, tenantID, models.WebhookEventItemDeleted, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidateItems(ctx, dbPool, itemId)
+	database.RecordDomainEvent(dbPool, "item", "deleted")
+	return item, nil
+}
+
+// DeleteItems deletes the tenant's Items with the given ids in one
+// transaction, returning the ones that existed
+func DeleteItems(ctx context.Context, dbPool database.PgxPoolIface, itemIds []int) ([]*models.Item, error) {
+	items := []*models.Item{}
+	err := withTenantTx(ctx, dbPool, ErrorDeleteItem, func(tx pgx.Tx, tenantID string) error {
+		rows, err := tx.Query(
+			database.WithQueryName(ctx, "item.delete_many"),
+			"DELETE FROM item WHERE tenant_id = $1 AND id = ANY($2) RETURNING id, uuid, created_at, name, price",
+			tenantID, itemIds,
+		)
+		// Handle Items delete error
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error deleting Items")
+			return ErrorDeleteItem
+		}
+		for rows.Next() {
+			var item models.Item
+			if err := rows.Scan(&item.ID, &item.UUID, &item.CreatedAt, &item.Name, &item.Price); err != nil {
+				rows.Close()
+				logger.LogErrorWithStacktrace(ctx, err, "Error scanning deleted Item")
+				return ErrorDeleteItem
+			}
+			items = append(items, &item)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error deleting Items")
+			return ErrorDeleteItem
+		}
+		// Record the changes once the rows are read, the connection is busy
+		// until then
+		for _, item := range items {
+			if err := recordItemChange(ctx, tx, tenantID, models.WebhookEventItemDeleted, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if item == nil {
-		return nil, ErrorItemNotFound
+	deletedIds := make([]int, 0, len(items))
+	for _, item := range items {
+		deletedIds = append(deletedIds, item.ID)
+		database.RecordDomainEvent(dbPool, "item", "deleted")
 	}
-	// Delete Item if it exists
-	_, deleteErr := dbPool.Exec(
-		context.Background(),
-		"DELETE FROM item WHERE id = $1",
-		itemId,
-	)
-	// Handle Item delete error
-	if deleteErr != nil {
-		logger.LogErrorWithStacktrace(deleteErr, "Error deleting Item")
-		return nil, ErrorDeleteItem
+	invalidateItems(ctx, dbPool, deletedIds...)
+	return items, nil
+}
+
+// invalidateItems drops changed Items from the Item cache, if any
+func invalidateItems(ctx context.Context, dbPool database.PgxPoolIface, itemIds ...int) {
+	if items := cache.ItemsFromPool(dbPool); items != nil {
+		items.Invalidate(ctx, itemIds...)
 	}
-	return item, nil
 }
@@ -0,0 +1,252 @@
+package repos
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+)
+
+var (
+	ErrorJobNotFound  = errors.New("Job not found")
+	ErrorJobExists    = errors.New("Job with the same unique key already queued")
+	ErrorJobNotFailed = errors.New("Job has not failed")
+	ErrorJobInsert    = errors.New("Error inserting job")
+	ErrorJobsQuery    = errors.New("Error querying jobs")
+	ErrorJobUpdate    = errors.New("Error updating job")
+	ErrorJobLeaseLost = errors.New("Job lease lost to another claim")
+)
+
+const jobColumns = "id, kind, payload, status, unique_key, attempts, max_attempts, run_at, locked_until, " +
+	"last_error, created_at, updated_at, finished_at"
+
+func scanJob(row pgx.Row) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(
+		&job.ID, &job.Kind, &job.Payload, &job.Status, &job.UniqueKey, &job.Attempts, &job.MaxAttempts,
+		&job.RunAt, &job.LockedUntil, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func scanJobs(rows pgx.Rows) ([]*models.Job, error) {
+	defer rows.Close()
+	jobs := []*models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// InsertJob enqueues jobIn on a pool, or in a transaction so the job only
+// runs if it commits. A pending or running job of the same kind with the same
+// unique key makes it ErrorJobExists.
+func InsertJob(ctx context.Context, q database.Queryer, jobIn models.JobIn) (*models.Job, error) {
+	ctx = database.WithQueryName(ctx, "job.insert")
+	job, err := scanJob(q.QueryRow(
+		ctx,
+		"INSERT INTO jobs (kind, payload, unique_key, run_at, max_attempts) "+
+			"VALUES ($1, $2, $3, COALESCE($4, CURRENT_TIMESTAMP), $5) "+
+			"ON CONFLICT (kind, unique_key) WHERE status IN ('pending', 'running') DO NOTHING RETURNING "+jobColumns,
+		jobIn.Kind, jobIn.Payload, jobIn.UniqueKey, jobIn.RunAt, jobIn.MaxAttempts,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrorJobExists
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error inserting job")
+		return nil, ErrorJobInsert
+	}
+	return job, nil
+}
+
+// ClaimJobs leases up to limit due jobs of kinds to the caller, oldest run_at
+// first. Workers claim with SKIP LOCKED so they never wait on each other, and
+// running jobs whose lease expired, their worker having died, are claimed
+// again.
+func ClaimJobs(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	kinds []string,
+	limit int,
+	lease time.Duration,
+) ([]*models.Job, error) {
+	ctx = database.WithQueryName(ctx, "job.claim")
+	rows, err := dbPool.Query(
+		ctx,
+		"UPDATE jobs SET status = 'running', attempts = attempts + 1, "+
+			"locked_until = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP "+
+			"WHERE id IN (SELECT id FROM jobs WHERE kind = ANY($1) AND ("+
+			"(status = 'pending' AND run_at <= CURRENT_TIMESTAMP) OR "+
+			"(status = 'running' AND locked_until < CURRENT_TIMESTAMP)"+
+			") ORDER BY run_at, id LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING "+jobColumns,
+		kinds, limit, lease.Seconds(),
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error claiming jobs")
+		return nil, ErrorJobsQuery
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error scanning claimed jobs")
+		return nil, ErrorJobsQuery
+	}
+	return jobs, nil
+}
+
+// jobLease fences updates of a claimed job to the claim that made them:
+// once its lease expired and another worker claimed it, attempts moved on
+const jobLease = "status = 'running' AND attempts = "
+
+// CompleteJob marks a job done when it is still claimed on the given attempt,
+// or returns ErrorJobLeaseLost
+func CompleteJob(ctx context.Context, dbPool database.PgxPoolIface, jobId int64, attempt int) error {
+	ctx = database.WithQueryName(ctx, "job.complete")
+	tag, err := dbPool.Exec(
+		ctx,
+		"UPDATE jobs SET status = 'done', locked_until = NULL, updated_at = CURRENT_TIMESTAMP, "+
+			"finished_at = CURRENT_TIMESTAMP WHERE id = $1 AND "+jobLease+"$2",
+		jobId, attempt,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error completing job")
+		return ErrorJobUpdate
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrorJobLeaseLost
+	}
+	database.RecordDomainEvent(dbPool, "job", "done")
+	return nil
+}
+
+// FailJob records the error of a job still claimed on the given attempt,
+// making it due again in retryIn, or failed when retryIn is negative. It
+// returns ErrorJobLeaseLost once the job was claimed again.
+func FailJob(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	jobId int64,
+	attempt int,
+	errMsg string,
+	retryIn time.Duration,
+) error {
+	ctx = database.WithQueryName(ctx, "job.fail")
+	status, event := models.JobPending, "retrying"
+	if retryIn < 0 {
+		status, event, retryIn = models.JobFailed, "failed", 0
+	}
+	tag, err := dbPool.Exec(
+		ctx,
+		"UPDATE jobs SET status = $1, run_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', locked_until = NULL, "+
+			"last_error = $3, updated_at = CURRENT_TIMESTAMP, "+
+			"finished_at = CASE WHEN $1 = 'failed' THEN CURRENT_TIMESTAMP END WHERE id = $4 AND "+jobLease+"$5",
+		status, retryIn.Seconds(), errMsg, jobId, attempt,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error failing job")
+		return ErrorJobUpdate
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrorJobLeaseLost
+	}
+	database.RecordDomainEvent(dbPool, "job", event)
+	return nil
+}
+
+// ReleaseJob hands back a job still claimed on the given attempt that was
+// stopped by a shutdown, due now and without counting the attempt. It returns
+// ErrorJobLeaseLost once the job was claimed again.
+func ReleaseJob(ctx context.Context, dbPool database.PgxPoolIface, jobId int64, attempt int) error {
+	ctx = database.WithQueryName(ctx, "job.release")
+	tag, err := dbPool.Exec(
+		ctx,
+		"UPDATE jobs SET status = 'pending', attempts = attempts - 1, run_at = CURRENT_TIMESTAMP, "+
+			"locked_until = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND "+jobLease+"$2",
+		jobId, attempt,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error releasing job")
+		return ErrorJobUpdate
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrorJobLeaseLost
+	}
+	return nil
+}
+
+// FetchJobs returns up to limit of the newest jobs, filtered by status and
+// kind unless empty
+func FetchJobs(ctx context.Context, dbPool database.PgxPoolIface, status, kind string, limit int) ([]*models.Job, error) {
+	ctx = database.WithQueryName(ctx, "job.fetch_all")
+	rows, err := dbPool.Query(
+		ctx,
+		"SELECT "+jobColumns+" FROM jobs WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2) "+
+			"ORDER BY id DESC LIMIT $3",
+		status, kind, limit,
+	)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying jobs")
+		return nil, ErrorJobsQuery
+	}
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error scanning jobs")
+		return nil, ErrorJobsQuery
+	}
+	return jobs, nil
+}
+
+func FetchJobById(ctx context.Context, dbPool database.PgxPoolIface, jobId int64) (*models.Job, error) {
+	ctx = database.WithQueryName(ctx, "job.fetch")
+	job, err := scanJob(dbPool.QueryRow(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id = $1", jobId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrorJobNotFound
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying job")
+		return nil, ErrorJobsQuery
+	}
+	return job, nil
+}
+
+// RetryJob makes a failed job due now with a fresh set of attempts, keeping
+// its last error until it runs again
+func RetryJob(ctx context.Context, dbPool database.PgxPoolIface, jobId int64) (*models.Job, error) {
+	ctx = database.WithQueryName(ctx, "job.retry")
+	job, err := scanJob(dbPool.QueryRow(
+		ctx,
+		"UPDATE jobs SET status = 'pending', attempts = 0, run_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, "+
+			"finished_at = NULL WHERE id = $1 AND status = 'failed' RETURNING "+jobColumns,
+		jobId,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Tell a missing job from one that hasn't failed
+			if _, err := FetchJobById(ctx, dbPool, jobId); err != nil {
+				return nil, err
+			}
+			return nil, ErrorJobNotFailed
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrorJobExists
+		}
+		logger.LogErrorWithStacktrace(ctx, err, "Error retrying job")
+		return nil, ErrorJobUpdate
+	}
+	database.RecordDomainEvent(dbPool, "job", "retried")
+	return job, nil
+}
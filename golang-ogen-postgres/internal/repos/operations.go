@@ -0,0 +1,303 @@
+package repos
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+)
+
+var (
+	ErrorOperationNotFound  = errors.New("Operation not found")
+	ErrorOperationFinished  = errors.New("Operation already finished")
+	ErrorOperationInsert    = errors.New("Error inserting operation")
+	ErrorOperationsQuery    = errors.New("Error querying operations")
+	ErrorOperationUpdate    = errors.New("Error updating operation")
+	ErrorOperationLeaseLost = errors.New("Operation lease lost to another claim")
+)
+
+const operationColumns = "id, tenant_id, type, status, input, total, processed, result, error, " +
+	"attempts, max_attempts, created_at, updated_at, finished_at"
+
+func scanOperation(row pgx.Row) (*models.Operation, error) {
+	var operation models.Operation
+	err := row.Scan(
+		&operation.ID, &operation.TenantID, &operation.Type, &operation.Status, &operation.Input,
+		&operation.Total, &operation.Processed, &operation.Result, &operation.Error,
+		&operation.Attempts, &operation.MaxAttempts, &operation.CreatedAt, &operation.UpdatedAt, &operation.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// InsertOperation queues an operation of the tenant for the workers
+func InsertOperation(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	operationType string,
+	input []byte,
+	total int,
+) (*models.Operation, error) {
+	ctx = database.WithQueryName(ctx, "operation.insert")
+	var operation *models.Operation
+	err := withTenantTx(ctx, dbPool, ErrorOperationInsert, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		operation, err = scanOperation(tx.QueryRow(
+			ctx,
+			"INSERT INTO operations (tenant_id, type, input, total) VALUES ($1, $2, $3, $4) RETURNING "+operationColumns,
+			tenantID, operationType, input, total,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error inserting operation")
+			return ErrorOperationInsert
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "operation", "queued")
+	return operation, nil
+}
+
+func FetchOperationById(ctx context.Context, dbPool database.PgxPoolIface, operationId int64) (*models.Operation, error) {
+	ctx = database.WithQueryName(ctx, "operation.fetch")
+	var operation *models.Operation
+	err := withTenantTx(ctx, dbPool, ErrorOperationsQuery, func(tx pgx.Tx, tenantID string) error {
+		var err error
+		operation, err = scanOperation(tx.QueryRow(
+			ctx,
+			"SELECT "+operationColumns+" FROM operations WHERE id = $1 AND tenant_id = $2",
+			operationId, tenantID,
+		))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorOperationNotFound
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying operation")
+			return ErrorOperationsQuery
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return operation, nil
+}
+
+// CancelOperation cancels a queued or running operation of the tenant. A
+// running one's worker notices when it next records progress.
+func CancelOperation(ctx context.Context, dbPool database.PgxPoolIface, operationId int64) (*models.Operation, error) {
+	ctx = database.WithQueryName(ctx, "operation.cancel")
+	var operation *models.Operation
+	err := withTenantTx(ctx, dbPool, ErrorOperationUpdate, func(tx pgx.Tx, tenantID string) error {
+		var status string
+		err := tx.QueryRow(
+			ctx,
+			"SELECT status FROM operations WHERE id = $1 AND tenant_id = $2 FOR UPDATE",
+			operationId, tenantID,
+		).Scan(&status)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrorOperationNotFound
+			}
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying operation")
+			return ErrorOperationUpdate
+		}
+		if status != models.OperationQueued && status != models.OperationRunning {
+			return ErrorOperationFinished
+		}
+		operation, err = scanOperation(tx.QueryRow(
+			ctx,
+			"UPDATE operations SET status = $1, locked_until = NULL, updated_at = CURRENT_TIMESTAMP, "+
+				"finished_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING "+operationColumns,
+			models.OperationCanceled, operationId,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error canceling operation")
+			return ErrorOperationUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	database.RecordDomainEvent(dbPool, "operation", "canceled")
+	return operation, nil
+}
+
+// ClaimOperations leases up to limit operations across tenants to the caller,
+// oldest first: queued ones, and running ones whose worker died and let the
+// lease expire. Every claim counts as an attempt.
+func ClaimOperations(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	limit int,
+	lease time.Duration,
+) ([]*models.Operation, error) {
+	ctx = database.WithQueryName(ctx, "operation.claim")
+	operations := []*models.Operation{}
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(
+			ctx,
+			"UPDATE operations SET status = 'running', attempts = attempts + 1, "+
+				"locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP WHERE id IN ("+
+				"SELECT id FROM operations WHERE status = 'queued' OR (status = 'running' AND locked_until < CURRENT_TIMESTAMP) "+
+				"ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED"+
+				") RETURNING "+operationColumns,
+			limit, lease.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			operation, err := scanOperation(rows)
+			if err != nil {
+				return err
+			}
+			operations = append(operations, operation)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error claiming operations")
+		return nil, ErrorOperationsQuery
+	}
+	return operations, nil
+}
+
+// operationLease fences updates of a claimed operation to the claim that made
+// them: once its lease expired and another worker claimed it, attempts moved
+// on
+const operationLease = "status = 'running' AND attempts = "
+
+// operationLeaseLost tells why an update fenced to attempt matched no row:
+// another claim took the operation over, or else it was canceled
+func operationLeaseLost(ctx context.Context, tx pgx.Tx, operationId int64, attempt int) error {
+	var attempts int
+	err := tx.QueryRow(ctx, "SELECT attempts FROM operations WHERE id = $1", operationId).Scan(&attempts)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if err != nil || attempts != attempt {
+		return ErrorOperationLeaseLost
+	}
+	return nil
+}
+
+// RecordOperationProgress stores how much of an operation claimed on the
+// given attempt is done and its result so far, renewing the lease. It reports
+// false when the operation is no longer running, having been canceled, and
+// returns ErrorOperationLeaseLost once it was claimed again.
+func RecordOperationProgress(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	operationId int64,
+	attempt int,
+	processed int,
+	result []byte,
+	lease time.Duration,
+) (bool, error) {
+	ctx = database.WithQueryName(ctx, "operation.progress")
+	var running bool
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			"UPDATE operations SET processed = $1, result = $2, locked_until = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second', "+
+				"updated_at = CURRENT_TIMESTAMP WHERE id = $4 AND "+operationLease+"$5",
+			processed, result, lease.Seconds(), operationId, attempt,
+		)
+		if err != nil {
+			return err
+		}
+		running = tag.RowsAffected() > 0
+		if running {
+			return nil
+		}
+		return operationLeaseLost(ctx, tx, operationId, attempt)
+	})
+	if errors.Is(err, ErrorOperationLeaseLost) {
+		return false, err
+	}
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error recording operation progress")
+		return false, ErrorOperationUpdate
+	}
+	return running, nil
+}
+
+// FinishOperation records the outcome of an operation claimed on the given
+// attempt unless it was canceled meanwhile: succeeded with its result, or
+// failed with errMsg. It returns ErrorOperationLeaseLost once the operation
+// was claimed again.
+func FinishOperation(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	operationId int64,
+	attempt int,
+	result []byte,
+	errMsg *string,
+) error {
+	ctx = database.WithQueryName(ctx, "operation.finish")
+	status := models.OperationSucceeded
+	if errMsg != nil {
+		status = models.OperationFailed
+	}
+	var finished bool
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			"UPDATE operations SET status = $1, result = COALESCE($2, result), error = $3, locked_until = NULL, "+
+				"updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP WHERE id = $4 AND "+operationLease+"$5",
+			status, result, errMsg, operationId, attempt,
+		)
+		if err != nil {
+			return err
+		}
+		finished = tag.RowsAffected() > 0
+		if finished {
+			return nil
+		}
+		return operationLeaseLost(ctx, tx, operationId, attempt)
+	})
+	if errors.Is(err, ErrorOperationLeaseLost) {
+		return err
+	}
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error finishing operation")
+		return ErrorOperationUpdate
+	}
+	if finished {
+		database.RecordDomainEvent(dbPool, "operation", status)
+	}
+	return nil
+}
+
+// PruneOperations deletes operations of every tenant finished more than
+// olderThan ago, returning how many
+func PruneOperations(ctx context.Context, dbPool database.PgxPoolIface, olderThan time.Duration) (int64, error) {
+	ctx = database.WithQueryName(ctx, "operation.prune")
+	var pruned int64
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(
+			ctx,
+			"DELETE FROM operations WHERE finished_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+			olderThan.Seconds(),
+		)
+		pruned = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error pruning operations")
+		return 0, ErrorOperationUpdate
+	}
+	return pruned, nil
+}
@@ -0,0 +1,146 @@
+package repos
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/logger"
+	"example-server/internal/models"
+)
+
+var (
+	ErrorScheduledTasksQuery = errors.New("Error querying scheduled tasks")
+	ErrorScheduledTaskUpdate = errors.New("Error updating scheduled task")
+)
+
+const scheduledTaskColumns = "name, schedule, next_run_at, last_run_at, last_duration_ms, last_outcome, last_error, updated_at"
+
+func scanScheduledTask(row pgx.Row) (*models.ScheduledTask, error) {
+	var task models.ScheduledTask
+	err := row.Scan(
+		&task.Name, &task.Schedule, &task.NextRunAt, &task.LastRunAt, &task.LastDurationMs,
+		&task.LastOutcome, &task.LastError, &task.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// SyncScheduledTask records the schedule of a task and returns its state.
+// New tasks and changed schedules are next due at nextRunAt, otherwise the
+// recorded next run stands, so a run missed while no replica was up happens
+// right away.
+func SyncScheduledTask(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	name, schedule string,
+	nextRunAt time.Time,
+) (*models.ScheduledTask, error) {
+	ctx = database.WithQueryName(ctx, "scheduled_task.sync")
+	task, err := scanScheduledTask(dbPool.QueryRow(
+		ctx,
+		"INSERT INTO scheduled_tasks (name, schedule, next_run_at) VALUES ($1, $2, $3) "+
+			"ON CONFLICT (name) DO UPDATE SET schedule = EXCLUDED.schedule, next_run_at = CASE "+
+			"WHEN scheduled_tasks.schedule <> EXCLUDED.schedule THEN EXCLUDED.next_run_at "+
+			"ELSE scheduled_tasks.next_run_at END, updated_at = CURRENT_TIMESTAMP "+
+			"RETURNING "+scheduledTaskColumns,
+		name, schedule, nextRunAt,
+	))
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error syncing scheduled task")
+		return nil, ErrorScheduledTaskUpdate
+	}
+	return task, nil
+}
+
+// RunScheduledTask calls run if the task is due at now and records the
+// outcome, returning the task's state and whether it ran. Replicas take
+// turns on the task's advisory lock: another one holding it returns a nil
+// task, and one that finds the task already run by another returns its new
+// next run. The lock is held, and the transaction open, while run runs.
+func RunScheduledTask(
+	ctx context.Context,
+	dbPool database.PgxPoolIface,
+	name string,
+	now time.Time,
+	run func(ctx context.Context) models.ScheduledTaskRun,
+) (*models.ScheduledTask, bool, error) {
+	var task *models.ScheduledTask
+	var ran bool
+	err := database.WithAllTenantsTx(ctx, dbPool, func(tx pgx.Tx) error {
+		locked, err := database.TryAdvisoryXactLock(ctx, tx, database.ScheduledTaskLock(name))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error locking scheduled task")
+			return ErrorScheduledTaskUpdate
+		}
+		if !locked {
+			return nil
+		}
+		task, err = scanScheduledTask(tx.QueryRow(
+			database.WithQueryName(ctx, "scheduled_task.fetch"),
+			"SELECT "+scheduledTaskColumns+" FROM scheduled_tasks WHERE name = $1",
+			name,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error querying scheduled task")
+			return ErrorScheduledTasksQuery
+		}
+		if task.NextRunAt.After(now) {
+			return nil
+		}
+		result := run(ctx)
+		ran = true
+		outcome := models.ScheduledTaskSucceeded
+		var errMsg *string
+		if result.Err != nil {
+			outcome = models.ScheduledTaskFailed
+			message := result.Err.Error()
+			errMsg = &message
+		}
+		task, err = scanScheduledTask(tx.QueryRow(
+			database.WithQueryName(ctx, "scheduled_task.record_run"),
+			"UPDATE scheduled_tasks SET next_run_at = $2, last_run_at = $3, last_duration_ms = $4, "+
+				"last_outcome = $5, last_error = $6, updated_at = CURRENT_TIMESTAMP WHERE name = $1 "+
+				"RETURNING "+scheduledTaskColumns,
+			name, result.NextRunAt, result.StartedAt, result.Duration.Milliseconds(), outcome, errMsg,
+		))
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error recording scheduled task run")
+			return ErrorScheduledTaskUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return task, ran, nil
+}
+
+func FetchScheduledTasks(ctx context.Context, dbPool database.PgxPoolIface) ([]*models.ScheduledTask, error) {
+	ctx = database.WithQueryName(ctx, "scheduled_task.fetch_all")
+	rows, err := dbPool.Query(ctx, "SELECT "+scheduledTaskColumns+" FROM scheduled_tasks ORDER BY name")
+	if err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error querying scheduled tasks")
+		return nil, ErrorScheduledTasksQuery
+	}
+	defer rows.Close()
+	tasks := []*models.ScheduledTask{}
+	for rows.Next() {
+		task, err := scanScheduledTask(rows)
+		if err != nil {
+			logger.LogErrorWithStacktrace(ctx, err, "Error scanning scheduled task")
+			return nil, ErrorScheduledTasksQuery
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error scanning scheduled tasks")
+		return nil, ErrorScheduledTasksQuery
+	}
+	return tasks, nil
+}
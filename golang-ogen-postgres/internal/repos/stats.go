@@ -0,0 +1,22 @@
+package repos
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"example-server/internal/database"
+	"example-server/internal/logger"
+)
+
+var ErrorAnalyze = errors.New("Error analyzing tables")
+
+// AnalyzeTables refreshes the planner statistics of the busiest tables
+func AnalyzeTables(ctx context.Context, dbPool database.PgxPoolIface) error {
+	ctx = database.WithQueryName(ctx, "stats.analyze")
+	if _, err := dbPool.Exec(ctx, "ANALYZE item, webhook_deliveries, outbox, jobs, operations"); err != nil {
+		logger.LogErrorWithStacktrace(ctx, err, "Error analyzing tables")
+		return ErrorAnalyze
+	}
+	return nil
+}
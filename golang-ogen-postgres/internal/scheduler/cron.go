@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrorInvalidSchedule = errors.New("invalid schedule")
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	spec                                string
+	minutes, hours, days, months, weeks uint64
+	// Like cron, either day field matching is enough when neither starts
+	// with *
+	anyDay, anyWeekday bool
+}
+
+// field is the range of values a cron field takes, with names for months
+// and weekdays
+type field struct {
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField  = field{min: 0, max: 59}
+	hourField    = field{min: 0, max: 23}
+	dayField     = field{min: 1, max: 31}
+	monthField   = field{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	weekdayField = field{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a cron expression of five fields, minute hour
+// day-of-month month day-of-week, each *, a value, a range a-b or a list of
+// them, optionally stepped with /n. Months and weekdays also take names
+// (jan, sun), and 7 is Sunday too. @yearly, @monthly, @weekly, @daily and
+// @hourly are shorthands.
+func ParseSchedule(spec string) (*Schedule, error) {
+	expression := strings.TrimSpace(spec)
+	if descriptor, ok := descriptors[strings.ToLower(expression)]; ok {
+		expression = descriptor
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.Wrapf(ErrorInvalidSchedule, "%q: expected 5 fields, got %d", spec, len(fields))
+	}
+	schedule := &Schedule{spec: spec, anyDay: strings.HasPrefix(fields[2], "*"), anyWeekday: strings.HasPrefix(fields[4], "*")}
+	var err error
+	for i, target := range []struct {
+		bits  *uint64
+		field field
+	}{
+		{&schedule.minutes, minuteField},
+		{&schedule.hours, hourField},
+		{&schedule.days, dayField},
+		{&schedule.months, monthField},
+		{&schedule.weeks, weekdayField},
+	} {
+		if *target.bits, err = parseField(fields[i], target.field); err != nil {
+			return nil, errors.Wrapf(ErrorInvalidSchedule, "%q: %s", spec, err)
+		}
+	}
+	// Sunday is 0 and 7
+	if schedule.weeks&(1<<7) != 0 {
+		schedule.weeks |= 1
+	}
+	return schedule, nil
+}
+
+// parseField returns the values of a comma-separated field as bits
+func parseField(value string, f field) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+		start, end := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = f.parseValue(bounds[0]); err != nil {
+				return 0, err
+			}
+			if end, err = f.parseValue(bounds[1]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, errors.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			var err error
+			if start, err = f.parseValue(rangePart); err != nil {
+				return 0, err
+			}
+			// a/n runs from a to the end of the range
+			if step == 1 {
+				end = start
+			}
+		}
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) parseValue(value string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(value, name) {
+			return i + f.min, nil
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("%q is not between %d and %d", value, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time the schedule matches after t, in t's location.
+// Schedules that never match, such as 31 February, return the zero time.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Any match is within a few years, leap days within eight
+	limit := t.AddDate(8, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weeks&(1<<uint(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
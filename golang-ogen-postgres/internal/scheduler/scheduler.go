@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"context"
+	_ "embed"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+var (
+	ErrorInvalidConfig = errors.New("invalid schedule config")
+	ErrorUnknownTask   = errors.New("unknown scheduled task")
+)
+
+//go:embed schedules.yaml
+var defaultConfig []byte
+
+// TaskConfig is when and how long a task runs
+type TaskConfig struct {
+	Schedule string `yaml:"schedule"`
+	// Enabled defaults to true
+	Enabled *bool         `yaml:"enabled"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Config holds the schedules of the tasks to run
+type Config struct {
+	// PollInterval is how often due tasks are looked for
+	PollInterval time.Duration         `yaml:"poll_interval"`
+	Tasks        map[string]TaskConfig `yaml:"tasks"`
+}
+
+// ConfigFromEnv loads SCHEDULE_FILE, falling back to the built-in schedules
+func ConfigFromEnv() (*Config, error) {
+	if path := os.Getenv("SCHEDULE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(ErrorInvalidConfig, err.Error())
+		}
+		return ParseConfig(data)
+	}
+	return ParseConfig(defaultConfig)
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(ErrorInvalidConfig, err.Error())
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 15 * time.Second
+	}
+	for name, task := range config.Tasks {
+		schedule, err := ParseSchedule(task.Schedule)
+		if err != nil {
+			return nil, errors.Wrapf(ErrorInvalidConfig, "%s: %s", name, err)
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return nil, errors.Wrapf(ErrorInvalidConfig, "%s: schedule %q never runs", name, task.Schedule)
+		}
+	}
+	return &config, nil
+}
+
+// Func is the work of a scheduled task
+type Func func(ctx context.Context) error
+
+type Metrics struct {
+	runs     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	lastRun  *prometheus.GaugeVec
+	nextRun  *prometheus.GaugeVec
+}
+
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		runs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "scheduled_task_runs_total",
+				Help: "Number of scheduled task runs in this replica, by task and outcome.",
+			},
+			[]string{"task", "outcome"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "scheduled_task_duration_seconds",
+				Help:    "Time taken to run a scheduled task, by task.",
+				Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+			},
+			[]string{"task"},
+		),
+		lastRun: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "scheduled_task_last_run_timestamp_seconds",
+				Help: "Unix time a scheduled task last ran in any replica, by task.",
+			},
+			[]string{"task"},
+		),
+		nextRun: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "scheduled_task_next_run_timestamp_seconds",
+				Help: "Unix time a scheduled task is next due, by task.",
+			},
+			[]string{"task"},
+		),
+	}
+	reg.MustRegister(m.runs, m.duration, m.lastRun, m.nextRun)
+	return m
+}
+
+// record updates the gauges from the shared state of a task
+func (m *Metrics) record(task *models.ScheduledTask) {
+	if task.LastRunAt != nil {
+		m.lastRun.WithLabelValues(task.Name).Set(float64(task.LastRunAt.Unix()))
+	}
+	m.nextRun.WithLabelValues(task.Name).Set(float64(task.NextRunAt.Unix()))
+}
+
+// task is a configured task with when this replica next looks at it
+type task struct {
+	name      string
+	run       Func
+	schedule  *Schedule
+	timeout   time.Duration
+	nextRunAt time.Time
+}
+
+// Scheduler runs periodic tasks on their cron schedules. Every replica may
+// run one: the state of the tasks is shared in the scheduled_tasks table and
+// an advisory lock per task has a single replica run each due run. Tasks of
+// a replica run one at a time, so long work belongs in a job the task
+// enqueues.
+type Scheduler struct {
+	dbPool  database.PgxPoolIface
+	config  *Config
+	tasks   []*task
+	metrics *Metrics
+}
+
+// New schedules the enabled tasks of config, which must all be in funcs
+func New(dbPool database.PgxPoolIface, config *Config, funcs map[string]Func, metrics *Metrics) (*Scheduler, error) {
+	s := &Scheduler{dbPool: dbPool, config: config, metrics: metrics}
+	for name, taskConfig := range config.Tasks {
+		run, ok := funcs[name]
+		if !ok {
+			return nil, errors.Wrapf(ErrorUnknownTask, "%q", name)
+		}
+		if taskConfig.Enabled != nil && !*taskConfig.Enabled {
+			continue
+		}
+		schedule, err := ParseSchedule(taskConfig.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		timeout := taskConfig.Timeout
+		if timeout <= 0 {
+			timeout = 5 * time.Minute
+		}
+		s.tasks = append(s.tasks, &task{name: name, run: run, schedule: schedule, timeout: timeout})
+	}
+	sort.Slice(s.tasks, func(i, j int) bool {
+		return s.tasks[i].name < s.tasks[j].name
+	})
+	return s, nil
+}
+
+// Sync records the schedules and picks up when each task is next due
+func (s *Scheduler) Sync(ctx context.Context) {
+	now := time.Now().UTC()
+	for _, t := range s.tasks {
+		t.nextRunAt = t.schedule.Next(now)
+		state, err := repos.SyncScheduledTask(ctx, s.dbPool, t.name, t.schedule.String(), t.nextRunAt)
+		if err != nil {
+			continue
+		}
+		t.nextRunAt = state.NextRunAt
+		s.metrics.record(state)
+	}
+}
+
+// Run syncs the schedules, then runs due tasks every poll interval until ctx
+// is done
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Info().Int("tasks", len(s.tasks)).Dur("pollInterval", s.config.PollInterval).Msg("Running scheduled tasks")
+	s.Sync(ctx)
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.RunDue(ctx)
+	}
+}
+
+// RunDue runs the tasks that are due, returning how many this replica ran
+func (s *Scheduler) RunDue(ctx context.Context) int {
+	ran := 0
+	for _, t := range s.tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		now := time.Now().UTC()
+		if t.nextRunAt.After(now) {
+			continue
+		}
+		state, taskRan, err := repos.RunScheduledTask(ctx, s.dbPool, t.name, now, func(ctx context.Context) models.ScheduledTaskRun {
+			return s.runTask(ctx, t, now)
+		})
+		if err != nil || state == nil {
+			// Retried next poll, or once the replica holding the lock is done
+			continue
+		}
+		t.nextRunAt = state.NextRunAt
+		s.metrics.record(state)
+		if taskRan {
+			ran++
+		}
+	}
+	return ran
+}
+
+// runTask runs t within its timeout and works out the next run
+func (s *Scheduler) runTask(ctx context.Context, t *task, now time.Time) models.ScheduledTaskRun {
+	logger := log.With().Str("task", t.name).Logger()
+	logger.Info().Msg("Running scheduled task")
+	runCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	started := time.Now()
+	err := t.run(runCtx)
+	duration := time.Since(started)
+	outcome := models.ScheduledTaskSucceeded
+	if err != nil {
+		outcome = models.ScheduledTaskFailed
+		logger.Error().Err(err).Dur("duration", duration).Msg("Scheduled task failed")
+	} else {
+		logger.Info().Dur("duration", duration).Msg("Scheduled task succeeded")
+	}
+	s.metrics.runs.WithLabelValues(t.name, outcome).Inc()
+	s.metrics.duration.WithLabelValues(t.name).Observe(duration.Seconds())
+	return models.ScheduledTaskRun{
+		StartedAt: now,
+		Duration:  duration,
+		Err:       err,
+		NextRunAt: t.schedule.Next(now),
+	}
+}
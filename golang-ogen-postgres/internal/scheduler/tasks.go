@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+	"example-server/internal/jobs"
+	"example-server/internal/repos"
+	"example-server/internal/webhook"
+)
+
+const (
+	// DeliveryRetentionDays is how long delivered webhook deliveries are kept
+	DeliveryRetentionDays = 30
+	// OperationRetention is how long finished operations can still be polled
+	OperationRetention = 7 * 24 * time.Hour
+)
+
+// Tasks are the tasks schedules may name
+func Tasks(dbPool database.PgxPoolIface) map[string]Func {
+	return map[string]Func{
+		// Leave the pruning to workerd, unless a prune is still queued
+		"webhook.prune_deliveries": func(ctx context.Context) error {
+			args := webhook.PruneDeliveriesArgs{RetentionDays: DeliveryRetentionDays}
+			options := jobs.EnqueueOptions{UniqueKey: "scheduled"}
+			_, err := webhook.PruneDeliveries.Enqueue(ctx, dbPool, args, options)
+			if errors.Is(err, repos.ErrorJobExists) {
+				return nil
+			}
+			return err
+		},
+		"operations.prune": func(ctx context.Context) error {
+			pruned, err := repos.PruneOperations(ctx, dbPool, OperationRetention)
+			if err != nil {
+				return err
+			}
+			log.Info().Int64("pruned", pruned).Dur("retention", OperationRetention).Msg("Pruned operations")
+			return nil
+		},
+		"stats.analyze": func(ctx context.Context) error {
+			return repos.AnalyzeTables(ctx, dbPool)
+		},
+	}
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/database"
+	"example-server/internal/jobs"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+)
+
+type PruneDeliveriesArgs struct {
+	// RetentionDays is how long delivered deliveries are kept
+	RetentionDays int `json:"retention_days"`
+}
+
+// PruneDeliveries is the job deleting old delivered deliveries, which would
+// otherwise pile up
+var PruneDeliveries = jobs.Kind[PruneDeliveriesArgs]{Name: "webhook.prune_deliveries", MaxAttempts: 3}
+
+// HandlePruneDeliveries returns the PruneDeliveries handler
+func HandlePruneDeliveries(dbPool database.PgxPoolIface) func(ctx context.Context, job *models.Job, args PruneDeliveriesArgs) error {
+	return func(ctx context.Context, job *models.Job, args PruneDeliveriesArgs) error {
+		if args.RetentionDays <= 0 {
+			return jobs.Permanent(jobs.ErrorInvalidPayload)
+		}
+		pruned, err := repos.PruneWebhookDeliveries(ctx, dbPool, time.Duration(args.RetentionDays)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		log.Info().Int64("pruned", pruned).Int("retentionDays", args.RetentionDays).Msg("Pruned webhook deliveries")
+		return nil
+	}
+}
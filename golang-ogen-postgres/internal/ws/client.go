@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// Client speaks the protocol from the other end, numbering its requests
+type Client struct {
+	conn   *websocket.Conn
+	mu     sync.Mutex
+	nextId int
+}
+
+// Dial connects to a ws:// or wss:// URL, authenticating the upgrade with
+// header, e.g. Authorization or X-API-Key, and X-Tenant-ID
+func Dial(ctx context.Context, url string, header http.Header) (*Client, error) {
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "upgrade failed with %s", resp.Status)
+		}
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Subscribe asks for the changes to itemIds, returning the request ID the
+// server answers with
+func (c *Client) Subscribe(itemIds ...int) (string, error) {
+	return c.request(Message{Type: TypeSubscribe, ItemIDs: itemIds})
+}
+
+func (c *Client) Unsubscribe(itemIds ...int) (string, error) {
+	return c.request(Message{Type: TypeUnsubscribe, ItemIDs: itemIds})
+}
+
+func (c *Client) Ping() (string, error) {
+	return c.request(Message{Type: TypePing})
+}
+
+func (c *Client) request(message Message) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextId++
+	message.ID = strconv.Itoa(c.nextId)
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return message.ID, c.conn.WriteJSON(message)
+}
+
+// Read returns the next reply or event, waiting until the deadline of ctx if
+// it has one. Reading also answers the server's pings, so clients must keep
+// reading to stay connected. A *websocket.CloseError tells why the server
+// hung up.
+func (c *Client) Read(ctx context.Context) (Message, error) {
+	deadline, _ := ctx.Deadline()
+	_ = c.conn.SetReadDeadline(deadline)
+	var message Message
+	err := c.conn.ReadJSON(&message)
+	return message, err
+}
+
+// Close hangs up with a normal close frame
+func (c *Client) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeTimeout))
+	return c.conn.Close()
+}
@@ -0,0 +1,11 @@
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash BYTEA NOT NULL,
+    owner VARCHAR(100) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
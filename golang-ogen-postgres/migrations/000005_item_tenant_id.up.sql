@@ -0,0 +1,13 @@
+-- Existing rows are assigned to the "default" tenant
+ALTER TABLE item ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE item ALTER COLUMN tenant_id SET DEFAULT current_setting('app.tenant_id');
+ALTER TABLE item DROP CONSTRAINT item_name_unique;
+ALTER TABLE item ADD CONSTRAINT item_name_unique UNIQUE (tenant_id, name);
+
+-- Rows are only visible to transactions that set app.tenant_id; FORCE applies
+-- the policy to the table owner as well (superusers still bypass it)
+ALTER TABLE item ENABLE ROW LEVEL SECURITY;
+ALTER TABLE item FORCE ROW LEVEL SECURITY;
+CREATE POLICY item_tenant_isolation ON item
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
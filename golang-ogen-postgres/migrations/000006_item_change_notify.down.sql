@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS item_change_notify ON item;
+DROP FUNCTION IF EXISTS notify_item_change();
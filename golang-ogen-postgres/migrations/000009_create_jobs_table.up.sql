@@ -0,0 +1,24 @@
+-- Background jobs run by workerd: pending until run_at, running while a
+-- worker holds the lease in locked_until, then done, or failed once out of
+-- attempts. Jobs are not tenant scoped, tenant work carries the tenant in its
+-- payload.
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    -- At most one pending or running job per kind and key
+    unique_key VARCHAR(255),
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+CREATE INDEX jobs_pending ON jobs (run_at) WHERE status = 'pending';
+CREATE INDEX jobs_running ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX jobs_status ON jobs (status, id);
+CREATE UNIQUE INDEX jobs_unique_key ON jobs (kind, unique_key) WHERE status IN ('pending', 'running');
@@ -0,0 +1,28 @@
+-- Long-running requests such as imports, run in the background by the
+-- servers: queued until a worker claims it, running while the worker holds
+-- the lease in locked_until, then succeeded, failed or canceled. processed
+-- counts the work done, so a worker taking over resumes there.
+CREATE TABLE operations (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT current_setting('app.tenant_id'),
+    type VARCHAR(32) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'queued',
+    input JSONB NOT NULL,
+    total INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    result JSONB,
+    error TEXT,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+CREATE INDEX operations_unfinished ON operations (id) WHERE status IN ('queued', 'running');
+
+-- Tenants only see their own rows. The workers claim across tenants by
+-- setting app.all_tenants for their transactions instead.
+ALTER TABLE operations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE operations FORCE ROW LEVEL SECURITY;
+CREATE POLICY operations_tenant_isolation ON operations
+    USING (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.all_tenants', true) = 'on')
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.all_tenants', true) = 'on');
@@ -0,0 +1,13 @@
+-- The state of the scheduler's periodic tasks, shared by the replicas so
+-- each run happens once: the replica holding a task's advisory lock runs it
+-- when next_run_at has passed and records the outcome.
+CREATE TABLE scheduled_tasks (
+    name VARCHAR(64) PRIMARY KEY,
+    schedule VARCHAR(64) NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    last_run_at TIMESTAMP,
+    last_duration_ms BIGINT,
+    last_outcome VARCHAR(16),
+    last_error TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- API keys act on a single tenant; existing keys are assigned to the
+-- "default" tenant, like the Items that existed before tenants
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
@@ -0,0 +1,2 @@
+ALTER TABLE operations DROP COLUMN max_attempts;
+ALTER TABLE operations DROP COLUMN attempts;
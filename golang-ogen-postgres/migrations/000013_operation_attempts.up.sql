@@ -0,0 +1,5 @@
+-- Every claim of an operation is an attempt. Updates of the worker are fenced
+-- to the attempt it claimed, and an operation whose lease expired on its
+-- last attempt fails instead of being taken over again.
+ALTER TABLE operations ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE operations ADD COLUMN max_attempts INT NOT NULL DEFAULT 3;
@@ -0,0 +1,7 @@
+// Package migrations embeds the schema migrations, so serverd can run them
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+
+	"example-server/internal/admin"
+	"example-server/internal/auth"
+	"example-server/internal/models"
+	"example-server/internal/tenant"
+)
+
+// HELPERS
+
+func getMockAPIKey(t *testing.T) (string, models.APIKey) {
+	t.Helper()
+	key, prefix, keyHash, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %s", err)
+	}
+	return key, models.APIKey{
+		ID:        1,
+		Prefix:    prefix,
+		KeyHash:   keyHash,
+		Owner:     "billing-service",
+		TenantID:  mockTenant,
+		Scopes:    []string{"items:read"},
+		CreatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func getMockAPIKeyRows(mockDBPool pgxmock.PgxPoolIface, apiKeys ...models.APIKey) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{
+		"id", "prefix", "key_hash", "owner", "tenant_id", "scopes", "created_at", "last_used_at", "expires_at", "revoked_at",
+	})
+	for _, apiKey := range apiKeys {
+		rows.AddRow(
+			apiKey.ID, apiKey.Prefix, apiKey.KeyHash, apiKey.Owner, apiKey.TenantID, apiKey.Scopes,
+			apiKey.CreatedAt, apiKey.LastUsedAt, apiKey.ExpiresAt, apiKey.RevokedAt,
+		)
+	}
+	return rows
+}
+
+func expectAPIKeyLookup(mockDBPool pgxmock.PgxPoolIface, apiKey models.APIKey) {
+	mockDBPool.ExpectQuery("SELECT (.+) FROM api_keys WHERE prefix = (.+)").
+		WithArgs(apiKey.Prefix).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	mockDBPool.ExpectExec("UPDATE api_keys SET last_used_at = (.+) WHERE id = (.+)").
+		WithArgs(apiKey.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+}
+
+// TESTS
+
+func TestAPIKeyAuthenticatorCachesLookups(t *testing.T) {
+	// setup mock dependencies and a single DB lookup
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	// authenticate twice, the second time from the cache
+	for i := 0; i < 2; i++ {
+		principal, err := deps.APIKeys.Authenticate(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+		if principal.Method != auth.MethodAPIKey || principal.Subject != "billing-service" || principal.TenantID != mockTenant {
+			t.Errorf("Expected API key principal for billing-service of %s, but got %+v", mockTenant, principal)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAPIKeyAuthenticatorRejectsRevokedAndExpiredKeys(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	key, apiKey := getMockAPIKey(t)
+	revoked, expired := apiKey, apiKey
+	revoked.RevokedAt = &past
+	expired.ExpiresAt = &past
+	for name, stored := range map[string]models.APIKey{"revoked": revoked, "expired": expired} {
+		deps, mockDBPool := getMockDependencies()
+		expectAPIKeyLookup(mockDBPool, stored)
+		if _, err := deps.APIKeys.Authenticate(context.Background(), key); !errors.Is(err, auth.ErrorInvalidAPIKey) {
+			t.Errorf("Expected %s key to be rejected with %s, but got %v", name, auth.ErrorInvalidAPIKey, err)
+		}
+	}
+}
+
+func TestSecurityHandlerAcceptsAPIKey(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	mockDBPool.ExpectCommit()
+	// exec requests with a valid and an invalid key
+	h := getHandler(t, deps)
+	w := performRequest(h, "GET", "/items/1", map[string]string{"X-API-Key": key})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w = performRequest(h, "GET", "/items/1", map[string]string{"X-API-Key": "not-a-key"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAPIKeyIsBoundToItsTenant(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	key, apiKey := getMockAPIKey(t)
+	apiKey.TenantID = "tenant-b"
+	expectAPIKeyLookup(mockDBPool, apiKey)
+	// item 1 belongs to tenant-a, the key's queries are scoped to tenant-b
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	h := getHandler(t, deps)
+	w := performRequest(h, "GET", "/items/1", map[string]string{"X-API-Key": key})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	// the header can't move the key to another tenant
+	w = performRequest(h, "GET", "/items/1", map[string]string{"X-API-Key": key, tenant.Header: "tenant-a"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminCreateListAndRevokeAPIKeys(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	_, apiKey := getMockAPIKey(t)
+	revoked := apiKey
+	revokedAt := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	revoked.RevokedAt = &revokedAt
+	mockDBPool.ExpectQuery("INSERT INTO api_keys (.+) VALUES (.+) RETURNING (.+)").
+		WithArgs(pgxmock.AnyArg(), pgxmock.AnyArg(), "billing-service", mockTenant, []string{"items:read"}, (*time.Time)(nil)).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM api_keys ORDER BY id").
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, apiKey))
+	mockDBPool.ExpectQuery("UPDATE api_keys SET revoked_at = (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(1).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool, revoked))
+	mockDBPool.ExpectQuery("UPDATE api_keys SET revoked_at = (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(2).
+		WillReturnRows(getMockAPIKeyRows(mockDBPool))
+	h := admin.NewHandler(deps, mockAdminToken)
+	// exec create request
+	w := performAdminRequest(h, "POST", "/admin/apikeys", mockAdminToken, `{"data":{"owner":"billing-service","tenant_id":"tenant-a","scopes":["items:read"]}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"key":"ek_`) || strings.Contains(w.Body.String(), "key_hash") {
+		t.Errorf("Expected the key and no hash in the response, but got %s", w.Body.String())
+	}
+	// exec list request
+	w = performAdminRequest(h, "GET", "/admin/apikeys", mockAdminToken, "")
+	expectedBody := `{"data":[{"id":1,"prefix":"` + apiKey.Prefix + `","owner":"billing-service","tenant_id":"tenant-a","scopes":["items:read"],"created_at":"2021-01-01T00:00:00Z","last_used_at":null,"expires_at":null,"revoked_at":null}]}`
+	if strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	// exec revoke requests
+	w = performAdminRequest(h, "DELETE", "/admin/apikeys/1", mockAdminToken, "")
+	if !strings.Contains(w.Body.String(), `"revoked_at":"2022-01-01T00:00:00Z"`) {
+		t.Errorf("Expected revoked key, but got %s", w.Body.String())
+	}
+	if w := performAdminRequest(h, "DELETE", "/admin/apikeys/2", mockAdminToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminCreateAPIKeyRequiresOwnerAndTenant(t *testing.T) {
+	deps, _ := getMockDependencies()
+	h := admin.NewHandler(deps, mockAdminToken)
+	for _, body := range []string{
+		`{"data":{"tenant_id":"tenant-a","scopes":["items:read"]}}`,
+		`{"data":{"owner":"billing-service","scopes":["items:read"]}}`,
+		`{"data":{"owner":"billing-service","tenant_id":"tenant a","scopes":["items:read"]}}`,
+	} {
+		w := performAdminRequest(h, "POST", "/admin/apikeys", mockAdminToken, body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
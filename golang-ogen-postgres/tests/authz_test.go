@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"example-server/internal/auth"
+	"example-server/internal/middleware"
+	"example-server/internal/openapi/ogen"
+)
+
+// HELPERS
+
+func getScopedToken(t *testing.T, scope string) string {
+	t.Helper()
+	claims := getMockClaims()
+	claims["scope"] = scope
+	return signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", claims)
+}
+
+// TESTS
+
+func TestDefaultPolicyCoversSecuredOperations(t *testing.T) {
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load policy: %s", err)
+	}
+	operations := []ogen.OperationName{
+		ogen.CreateItemOperation,
+		ogen.DeleteItemOperation,
+		ogen.GetItemOperation,
+		ogen.UpdateItemOperation,
+	}
+	for _, operation := range operations {
+		if _, ok := policy.Operations[operation]; !ok {
+			t.Errorf("Expected policy entry for %s", operation)
+		}
+	}
+}
+
+func TestPolicyScopesAuthorizeEveryOperation(t *testing.T) {
+	policy, err := auth.PolicyFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load policy: %s", err)
+	}
+	expected := []string{"items:delete", "items:read", "items:write", "webhooks:read", "webhooks:write"}
+	if scopes := policy.Scopes(); strings.Join(scopes, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected scopes %v, but got %v", expected, scopes)
+	}
+	// the claims cmd/testclientd mints with AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE set
+	token := signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", jwt.MapClaims{
+		"sub":       "testclient",
+		"iss":       mockIssuer,
+		"aud":       mockAudience,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"tenant_id": "default",
+		"scope":     strings.Join(policy.Scopes(), " "),
+	})
+	verifier := getMockVerifier(t, auth.Config{HMACSecret: []byte(mockHMACSecret)})
+	principal, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Expected the token to verify, but got %s", err)
+	}
+	for operation := range policy.Operations {
+		if err := policy.Authorize(principal, operation); err != nil {
+			t.Errorf("Expected %s to be authorized, but got %s", operation, err)
+		}
+	}
+}
+
+func TestAuthorizeRejectsMissingScope(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "DELETE", "/items/1", map[string]string{
+		"Authorization":            "Bearer " + getScopedToken(t, "items:read items:write"),
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"Forbidden","request_id":"abc-123","type":"about:blank","title":"Forbidden","status":403,"detail":"missing required scopes: items:delete","missing_scopes":["items:delete"]}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestAuthorizeUsesPolicyFile(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	policyYaml := "operations:\n  GetItem: [items:read, items:audit]\n"
+	if err := os.WriteFile(policyFile, []byte(policyYaml), 0o600); err != nil {
+		t.Fatalf("Failed to write policy: %s", err)
+	}
+	t.Setenv("AUTH_POLICY_FILE", policyFile)
+	h := getHandler(t, nil)
+	token := getScopedToken(t, "items:read items:write")
+	// a scope added by the file is now required
+	w := performRequest(h, "GET", "/items/1", map[string]string{"Authorization": "Bearer " + token})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	// operations missing from the file are denied
+	w = performRequest(h, "PATCH", "/items/1", map[string]string{"Authorization": "Bearer " + token})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestParsePolicyRejectsInvalidFiles(t *testing.T) {
+	for _, data := range []string{"", "operations: [", "operations:\n  GetItem: ['']\n"} {
+		if _, err := auth.ParsePolicy([]byte(data)); !errors.Is(err, auth.ErrorInvalidPolicy) {
+			t.Errorf("Expected %s for %q, but got %v", auth.ErrorInvalidPolicy, data, err)
+		}
+	}
+}
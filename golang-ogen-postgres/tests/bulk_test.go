@@ -0,0 +1,347 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+
+	"example-server/internal/bulk"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+)
+
+// HELPERS
+
+var mockItem2 = models.Item{
+	ID:        2,
+	UUID:      "550e8400-e29b-41d4-a716-446655440001",
+	CreatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	Name:      "tree-fiddy",
+	Price:     float32(3.50),
+}
+
+func performExportRequest(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	return performRequest(h, "GET", path, map[string]string{
+		"Authorization":            "Bearer " + getMockToken(t),
+		middleware.RequestIdHeader: "abc-123",
+	})
+}
+
+func performImportRequest(t *testing.T, h http.Handler, path, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// expectImport expects the staging table, COPY and merge, returning one row
+// per merged Item with whether it was inserted, numbering Items from 1, and
+// the change each merged Item records
+func expectImport(mockDBPool pgxmock.PgxPoolIface, onConflict string, inserted ...bool) {
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectExec("CREATE TEMP TABLE item_import").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mockDBPool.ExpectCopyFrom(pgx.Identifier{"item_import"}, []string{"line", "name", "price"}).
+		WillReturnResult(int64(len(inserted)))
+	rows := mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price", "inserted"})
+	for i, inserted := range inserted {
+		rows.AddRow(i+1, mockItem.UUID, mockItem.CreatedAt, mockItem.Name, mockItem.Price, inserted)
+	}
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) SELECT (.+) FROM item_import (.+) ON CONFLICT ON CONSTRAINT item_name_unique " + onConflict).
+		WithArgs(mockTenant).
+		WillReturnRows(rows)
+	for _, inserted := range inserted {
+		if inserted {
+			expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+		} else {
+			expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemUpdated)
+		}
+	}
+	mockDBPool.ExpectCommit()
+}
+
+// TESTS
+
+func TestExportItemsCSV(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectCommit()
+	w := performExportRequest(t, getHandler(t, deps), "/items/export")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectHeaders(t, w, map[string]string{
+		"Content-Type":        "text/csv",
+		"Content-Disposition": `attachment; filename="items.csv"`,
+	})
+	expectedBody := "id,uuid,created_at,name,price\n" +
+		"1,550e8400-e29b-41d4-a716-446655440000,2021-01-01T00:00:00Z,pi,3.14\n" +
+		"2,550e8400-e29b-41d4-a716-446655440001,2021-01-01T00:00:00Z,tree-fiddy,3.5\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestExportItemsNDJSON(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectCommit()
+	w := performExportRequest(t, getHandler(t, deps), "/items/export?format=ndjson")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/x-ndjson"})
+	expectedBody := `{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14}` + "\n" +
+		`{"id":2,"uuid":"550e8400-e29b-41d4-a716-446655440001","created_at":"2021-01-01T00:00:00Z","name":"tree-fiddy","price":3.5}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestExportItemsInvalidFormat(t *testing.T) {
+	w := performExportRequest(t, getHandler(t, nil), "/items/export?format=xml")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestExportItemsQueryError(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id$").
+		WithArgs(mockTenant).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	w := performExportRequest(t, getHandler(t, deps), "/items/export")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	expectedBody := `{"error":"Error querying Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestImportItemsCSV(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	// one new name, one changed price, one unchanged price
+	expectImport(mockDBPool, "DO UPDATE", true, false)
+	body := "name,price\n" +
+		"pi,3.14\n" +
+		"tree-fiddy,3.50\n" +
+		"e,2.71\n" +
+		"free,\n" +
+		"pi,1\n" +
+		",1\n"
+	w := performImportRequest(t, getHandler(t, deps), "/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":1,"skipped":1,"errors":[` +
+		`{"line":5,"error":"invalid price"},` +
+		`{"line":6,"error":"duplicate name, first seen on line 2"},` +
+		`{"line":7,"error":"name is required"}]}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsRecordsChanges(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectExec("CREATE TEMP TABLE item_import").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mockDBPool.ExpectCopyFrom(pgx.Identifier{"item_import"}, []string{"line", "name", "price"}).
+		WillReturnResult(2)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) RETURNING id, uuid, created_at, name, price, xmax = 0 AS inserted").
+		WithArgs(mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price", "inserted"}).
+			AddRow(mockItem.ID, mockItem.UUID, mockItem.CreatedAt, mockItem.Name, mockItem.Price, true).
+			AddRow(mockItem2.ID, mockItem2.UUID, mockItem2.CreatedAt, mockItem2.Name, mockItem2.Price, false))
+	// the inserted Item is announced as created, the updated one as updated
+	for _, change := range []struct {
+		event string
+		item  models.Item
+	}{
+		{models.WebhookEventItemCreated, mockItem},
+		{models.WebhookEventItemUpdated, mockItem2},
+	} {
+		payload, _ := json.Marshal(change.item)
+		expectWebhookEnqueue(mockDBPool, mockTenant, change.event)
+		mockDBPool.ExpectExec("INSERT INTO outbox (.+) VALUES (.+)").
+			WithArgs(mockTenant, "item", change.item.ID, change.event, payload).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockDBPool.ExpectCommit()
+	body := "name,price\npi,3.14\ntree-fiddy,3.50\n"
+	w := performImportRequest(t, getHandler(t, deps), "/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsNDJSONSkipConflicts(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectImport(mockDBPool, "DO NOTHING", true)
+	body := `{"name":"pi","price":3.14}` + "\n" +
+		"\n" +
+		`{"name":"e","price":-1}` + "\n" +
+		`not json` + "\n" +
+		`{"id":7,"uuid":"550e8400-e29b-41d4-a716-446655440007","name":"tree-fiddy","price":3.5}`
+	w := performImportRequest(t, getHandler(t, deps), "/items/import?on_conflict=skip", "application/x-ndjson", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":0,"skipped":1,"errors":[` +
+		`{"line":3,"error":"price must not be negative"},` +
+		`{"line":4,"error":"invalid JSON"}]}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsWithoutValidRowsSkipsDB(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	w := performImportRequest(t, getHandler(t, deps), "/items/import", "text/csv", "name,price\n,1\n")
+	expectedBody := `{"data":{"inserted":0,"updated":0,"skipped":0,"errors":[{"line":2,"error":"name is required"}]}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsRejectsInvalidRequests(t *testing.T) {
+	h := getHandler(t, nil)
+	for _, test := range []struct {
+		path, contentType, body string
+		expectedStatusCode      int
+	}{
+		{"/items/import", "application/json", `{}`, http.StatusUnsupportedMediaType},
+		{"/items/import?on_conflict=replace", "text/csv", "name,price\n", http.StatusBadRequest},
+		{"/items/import", "text/csv", "title,cost\npi,3.14\n", http.StatusBadRequest},
+	} {
+		w := performImportRequest(t, h, test.path, test.contentType, test.body)
+		if w.Code != test.expectedStatusCode {
+			t.Errorf("Expected status code %d, but got %d: %s", test.expectedStatusCode, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestImportItemsBodyTooLarge(t *testing.T) {
+	h := middleware.MaxBodySize(getHandler(t, nil), 16)
+	req, _ := http.NewRequest("POST", "/items/import", strings.NewReader("name,price\npi,3.14\ne,2.71\n"))
+	// Hide the length, as the server sees a chunked body
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestImportItemsGetOwnBodyLimit(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectImport(mockDBPool, "DO UPDATE", true, true)
+	h := middleware.ForImports(
+		middleware.MaxBodySize(getHandler(t, deps), 1024),
+		middleware.MaxBodySize(getHandler(t, nil), 16),
+	)
+	body := "name,price\npi,3.14\ne,2.71\n"
+	// the import is within its own limit
+	w := performImportRequest(t, h, "/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	// other routes keep the default limit
+	w = performImportRequest(t, h, "/items", "application/json", `{"data":{"name":"pi","price":3.14}}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsPriceLimit(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectImport(mockDBPool, "DO UPDATE", true)
+	// 99999999.99 fits the column but rounds up to 1e8 as a float32
+	body := "name,price\n" +
+		"pi,99999992\n" +
+		"e,99999999.99\n"
+	w := performImportRequest(t, getHandler(t, deps), "/items/import", "text/csv", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"inserted":1,"updated":0,"skipped":0,"errors":[{"line":3,"error":"price is too large"}]}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestBulkExportCanBeImported(t *testing.T) {
+	var exported strings.Builder
+	writer := bulk.NewWriter(&exported, bulk.FormatNDJSON)
+	for _, item := range []models.Item{mockItem, mockItem2} {
+		if err := writer.Write(&item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	rows, rowErrors, err := bulk.ReadItems(strings.NewReader(exported.String()), bulk.FormatNDJSON)
+	if err != nil || len(rowErrors) != 0 {
+		t.Fatalf("Expected the export to read back, but got %v %v", err, rowErrors)
+	}
+	expected := []bulk.Row{
+		{Line: 1, Item: models.ItemIn{Name: "pi", Price: 3.14}},
+		{Line: 2, Item: models.ItemIn{Name: "tree-fiddy", Price: 3.5}},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, rows)
+	}
+}
@@ -0,0 +1,367 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+
+	"example-server/internal/bulk"
+	"example-server/internal/cache"
+	"example-server/internal/database"
+	"example-server/internal/dependencies"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+	"example-server/internal/tenant"
+)
+
+// HELPERS
+
+func getCachedMockDependencies(c cache.Cache) (*dependencies.Dependencies, pgxmock.PgxPoolIface, *prometheus.Registry) {
+	// setup mock dependencies reading Items through c, with cache and query
+	// metrics on a fresh registry
+	mockDBPool, err := pgxmock.NewPool()
+	if err != nil {
+		panic(err)
+	}
+	reg := prometheus.NewRegistry()
+	deps := dependencies.NewDependencies(
+		mockDBPool,
+		database.NewQueryMetrics(reg),
+		cache.NewItemCache(c, cache.NewMetrics(reg)),
+	)
+	return deps, mockDBPool, reg
+}
+
+func expectFetchItem(mockDBPool pgxmock.PgxPoolIface, item models.Item) {
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(item.ID, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, item))
+	mockDBPool.ExpectCommit()
+}
+
+func getMockRedisCache(t *testing.T) (*cache.RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return cache.NewRedisCache(redis.NewClient(&redis.Options{Addr: server.Addr()}), time.Minute), server
+}
+
+// TESTS
+
+func TestItemCacheServesRepeatedLookups(t *testing.T) {
+	deps, mockDBPool, reg := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	h := getHandler(t, deps)
+	expectFetchItem(mockDBPool, mockItem)
+	headers := map[string]string{"Authorization": "Bearer " + getMockToken(t)}
+	first := performRequest(h, "GET", "/items/1", headers)
+	second := performRequest(h, "GET", "/items/1", headers)
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d and %d", http.StatusOK, first.Code, second.Code)
+	}
+	if !strings.Contains(first.Body.String(), `"name":"pi"`) || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the same Item twice, but got %s and %s", first.Body.String(), second.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "miss"}); got != 1 {
+		t.Errorf("Expected 1 cache miss, but got %v", got)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "hit"}); got != 1 {
+		t.Errorf("Expected 1 cache hit, but got %v", got)
+	}
+}
+
+func TestItemCacheDoesNotCacheMissingItems(t *testing.T) {
+	deps, mockDBPool, _ := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	for i := 0; i < 2; i++ {
+		expectTenantTx(mockDBPool, mockTenant)
+		mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+			WithArgs(1, mockTenant).
+			WillReturnRows(getMockItemRows(mockDBPool))
+		mockDBPool.ExpectRollback()
+		if _, err := repos.FetchItemById(getTenantContext(), deps.DBPool, 1); err != repos.ErrorItemNotFound {
+			t.Fatalf("Expected %s, but got %v", repos.ErrorItemNotFound, err)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestItemCacheInvalidatedByUpdateAndDelete(t *testing.T) {
+	deps, mockDBPool, reg := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	ctx := getTenantContext()
+	expectFetchItem(mockDBPool, mockItem)
+	repos.FetchItemById(ctx, deps.DBPool, 1)
+	// Update
+	updated := mockItem
+	updated.Price = 3.15
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("UPDATE item SET (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(updated.Name, updated.Price, 1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, updated))
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemUpdated)
+	mockDBPool.ExpectCommit()
+	if _, err := repos.UpdateItem(ctx, deps.DBPool, 1, models.ItemIn{Name: updated.Name, Price: updated.Price}); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expectFetchItem(mockDBPool, updated)
+	item, err := repos.FetchItemById(ctx, deps.DBPool, 1)
+	if err != nil || item.Price != updated.Price {
+		t.Fatalf("Expected the updated Item, but got %v, %v", item, err)
+	}
+	// Delete
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, updated))
+	mockDBPool.ExpectExec("DELETE FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemDeleted)
+	mockDBPool.ExpectCommit()
+	if _, err := repos.DeleteItem(ctx, deps.DBPool, 1); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	if _, err := repos.FetchItemById(ctx, deps.DBPool, 1); err != repos.ErrorItemNotFound {
+		t.Fatalf("Expected %s, but got %v", repos.ErrorItemNotFound, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	// Domain events are still recorded through the cache pool
+	if got := getMetricValue(t, reg, "domain_events_total", map[string]string{"entity": "item", "event": "deleted"}); got != 1 {
+		t.Errorf("Expected 1 delete event, but got %v", got)
+	}
+}
+
+func TestItemCacheInvalidatedByImport(t *testing.T) {
+	deps, mockDBPool, _ := getCachedMockDependencies(cache.NewMemoryCache(10, time.Minute))
+	ctx := getTenantContext()
+	expectFetchItem(mockDBPool, mockItem)
+	repos.FetchItemById(ctx, deps.DBPool, 1)
+	// Item 1 is updated by the import
+	expectImport(mockDBPool, "DO UPDATE", false)
+	rows := []bulk.Row{{Line: 2, Item: models.ItemIn{Name: "pi", Price: 3.15}}}
+	if _, err := repos.ImportItems(ctx, deps.DBPool, rows, bulk.OnConflictUpdate); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expectFetchItem(mockDBPool, mockItem)
+	repos.FetchItemById(ctx, deps.DBPool, 1)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestItemCacheCollapsesConcurrentMisses(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	ctx := getTenantContext()
+	const numCallers = 10
+	var arrived sync.WaitGroup
+	arrived.Add(numCallers)
+	var loads atomic.Int32
+	load := func(ctx context.Context) (*models.Item, error) {
+		loads.Add(1)
+		// Hold the load until every caller has asked for the Item
+		arrived.Wait()
+		time.Sleep(20 * time.Millisecond)
+		item := mockItem
+		return &item, nil
+	}
+	var done sync.WaitGroup
+	for i := 0; i < numCallers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			arrived.Done()
+			item, err := items.Fetch(ctx, 1, load)
+			if err != nil || item.Name != "pi" {
+				t.Errorf("Expected Item pi, but got %v, %v", item, err)
+			}
+		}()
+	}
+	done.Wait()
+	if loads.Load() != 1 {
+		t.Errorf("Expected 1 load, but got %d", loads.Load())
+	}
+}
+
+func TestItemCacheSkipsFillInvalidatedWhileLoading(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	ctx := getTenantContext()
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	staleLoad := func(ctx context.Context) (*models.Item, error) {
+		// Read the Item before the update commits
+		item := mockItem
+		close(loading)
+		<-release
+		return &item, nil
+	}
+	done := make(chan *models.Item)
+	go func() {
+		item, _ := items.Fetch(ctx, 1, staleLoad)
+		done <- item
+	}()
+	<-loading
+	// The update commits and invalidates while the load is in flight
+	items.Invalidate(ctx, 1)
+	var loads atomic.Int32
+	freshLoad := func(ctx context.Context) (*models.Item, error) {
+		loads.Add(1)
+		return &models.Item{ID: 1, Name: "updated"}, nil
+	}
+	// Later callers don't join the stale load
+	if item, err := items.Fetch(ctx, 1, freshLoad); err != nil || item.Name != "updated" {
+		t.Errorf("Expected the updated Item, but got %v, %v", item, err)
+	}
+	close(release)
+	if item := <-done; item.Name != "pi" {
+		t.Errorf("Expected the stale caller to get what it read, but got %s", item.Name)
+	}
+	// The updated Item stays cached instead of what the stale load read
+	if item, _ := items.Fetch(ctx, 1, freshLoad); item.Name != "updated" {
+		t.Errorf("Expected the updated Item to be cached, but got %s", item.Name)
+	}
+	if loads.Load() != 1 {
+		t.Errorf("Expected 1 fresh load, but got %d", loads.Load())
+	}
+}
+
+func TestItemCacheKeysByTenant(t *testing.T) {
+	items := cache.NewItemCache(cache.NewMemoryCache(10, time.Minute), nil)
+	loadFor := func(name string) func(ctx context.Context) (*models.Item, error) {
+		return func(ctx context.Context) (*models.Item, error) {
+			return &models.Item{ID: 1, Name: name}, nil
+		}
+	}
+	tenantA := tenant.NewContext(context.Background(), "tenant-a")
+	tenantB := tenant.NewContext(context.Background(), "tenant-b")
+	items.Fetch(tenantA, 1, loadFor("a"))
+	item, _ := items.Fetch(tenantB, 1, loadFor("b"))
+	if item.Name != "b" {
+		t.Errorf("Expected tenant-b's Item, but got %s", item.Name)
+	}
+	// Invalidation is scoped to the tenant too
+	items.Invalidate(tenantB, 1)
+	item, _ = items.Fetch(tenantA, 1, loadFor("reloaded"))
+	if item.Name != "a" {
+		t.Errorf("Expected tenant-a's cached Item, but got %s", item.Name)
+	}
+}
+
+func TestItemCacheFallsBackWhenRedisIsDown(t *testing.T) {
+	redisCache, server := getMockRedisCache(t)
+	deps, mockDBPool, reg := getCachedMockDependencies(redisCache)
+	server.Close()
+	expectFetchItem(mockDBPool, mockItem)
+	if _, err := repos.FetchItemById(getTenantContext(), deps.DBPool, 1); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if got := getMetricValue(t, reg, "cache_requests_total", map[string]string{"cache": "item", "result": "error"}); got != 1 {
+		t.Errorf("Expected 1 cache error, but got %v", got)
+	}
+}
+
+func TestRepoFetchesThroughRedisCache(t *testing.T) {
+	redisCache, server := getMockRedisCache(t)
+	deps, mockDBPool, _ := getCachedMockDependencies(redisCache)
+	ctx := getTenantContext()
+	expectFetchItem(mockDBPool, mockItem)
+	for i := 0; i < 2; i++ {
+		item, err := repos.FetchItemById(ctx, deps.DBPool, 1)
+		if err != nil || item.Name != "pi" {
+			t.Fatalf("Expected Item pi, but got %v, %v", item, err)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	key := "item:" + mockTenant + ":1"
+	if ttl := server.TTL(key); ttl != time.Minute {
+		t.Errorf("Expected %s to expire in 1m, but got %s", key, ttl)
+	}
+	// Expired entries are loaded again
+	server.FastForward(time.Minute)
+	expectFetchItem(mockDBPool, mockItem)
+	if _, err := repos.FetchItemById(ctx, deps.DBPool, 1); err != nil {
+		t.Fatalf("Expected Item pi, but got %v", err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := cache.NewMemoryCache(2, time.Minute)
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("1"))
+	c.Set(ctx, "b", []byte("2"))
+	// Reading a makes b the least recently used
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"))
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Errorf("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, but got %d", c.Len())
+	}
+}
+
+func TestMemoryCacheExpiresEntries(t *testing.T) {
+	c := cache.NewMemoryCache(2, 10*time.Millisecond)
+	ctx := context.Background()
+	c.Set(ctx, "a", []byte("1"))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Errorf("Expected a to have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected expired entries to be dropped on read, but got %d", c.Len())
+	}
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	config := cache.ConfigFromEnv()
+	if config.Backend != cache.BackendMemory || config.TTL != time.Minute || config.MaxEntries != 10000 {
+		t.Errorf("Expected the default config, but got %+v", config)
+	}
+	t.Setenv("CACHE_BACKEND", "Redis")
+	t.Setenv("CACHE_TTL", "5s")
+	t.Setenv("REDIS_URL", "redis://localhost:6379/1")
+	config = cache.ConfigFromEnv()
+	if config.Backend != cache.BackendRedis || config.TTL != 5*time.Second {
+		t.Errorf("Expected the redis config, but got %+v", config)
+	}
+	if c, err := cache.New(config); err != nil {
+		t.Errorf("Expected a Redis cache, but got %v", err)
+	} else {
+		c.Close()
+	}
+	if c, err := cache.New(cache.Config{Backend: cache.BackendNone}); c != nil || err != nil {
+		t.Errorf("Expected no cache, but got %v, %v", c, err)
+	}
+	if _, err := cache.New(cache.Config{Backend: "memcached"}); err == nil {
+		t.Errorf("Expected an invalid backend error")
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/klauspost/compress/zstd"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/middleware"
+)
+
+// HELPERS
+
+var mockLargeBody = strings.Repeat(`{"name":"pi","price":3.14}`, 100)
+
+func getCompressHandler(t *testing.T, deps *dependencies.Dependencies, config middleware.CompressionConfig, maxBodyBytes int64) http.Handler {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, mockLargeBody)
+	})
+	mux.Handle("/", getHandler(t, deps))
+	var handler http.Handler = mux
+	handler = middleware.Compress(handler, config)
+	handler = middleware.Decompress(handler, maxBodyBytes)
+	handler = middleware.MaxBodySize(handler, maxBodyBytes)
+	return middleware.RequestID(handler)
+}
+
+func getMockCompressionConfig() middleware.CompressionConfig {
+	return middleware.CompressionConfig{
+		Encodings: []string{middleware.EncodingZstd, middleware.EncodingGzip},
+		MinBytes:  1024,
+	}
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var reader io.Reader
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to read gzip body: %s", err)
+		}
+		reader = gzipReader
+	case "zstd":
+		zstdReader, err := zstd.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("Failed to read zstd body: %s", err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		reader = w.Body
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decode body: %s", err)
+	}
+	return string(body)
+}
+
+func gzipBody(t *testing.T, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func performEncodedRequest(t *testing.T, h http.Handler, encoding string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/items", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", encoding)
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestCompressNegotiatesEncoding(t *testing.T) {
+	h := getCompressHandler(t, nil, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	for acceptEncoding, expected := range map[string]string{
+		"gzip, zstd":             "zstd",
+		"gzip":                   "gzip",
+		"zstd;q=0.5, gzip;q=0.8": "gzip",
+		"*":                      "zstd",
+		"br":                     "",
+		"gzip;q=0":               "",
+		"":                       "",
+	} {
+		w := performRequest(h, "GET", "/large", map[string]string{"Accept-Encoding": acceptEncoding})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+		}
+		expectHeaders(t, w, map[string]string{
+			"Content-Encoding": expected,
+			"Vary":             "Accept-Encoding",
+		})
+		if body := decodeBody(t, w); body != mockLargeBody {
+			t.Errorf("Expected the original body for %q, but got %d bytes", acceptEncoding, len(body))
+		}
+	}
+}
+
+func TestCompressSkipsSmallResponses(t *testing.T) {
+	h := getCompressHandler(t, nil, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		"Accept-Encoding":          "gzip",
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected no Content-Encoding, but got %s", w.Header().Get("Content-Encoding"))
+	}
+	if !strings.Contains(w.Body.String(), `"request_id":"abc-123"`) {
+		t.Errorf("Expected an unencoded error body, but got %s", w.Body.String())
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	h := getCompressHandler(t, nil, middleware.CompressionConfig{}, middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "GET", "/large", map[string]string{"Accept-Encoding": "gzip"})
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Errorf("Expected an unencoded response, but got headers %v", w.Header())
+	}
+	if w.Body.String() != mockLargeBody {
+		t.Errorf("Expected the original body")
+	}
+}
+
+func TestDecompressGzipRequestBody(t *testing.T) {
+	// the INSERT arguments only match when the body was decoded
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockItem.Name, mockItem.Price).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mockDBPool.ExpectRollback()
+	h := getCompressHandler(t, deps, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performEncodedRequest(t, h, "gzip", gzipBody(t, `{"data":{"name":"pi","price":3.14}}`))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestDecompressRejectsUnsupportedEncoding(t *testing.T) {
+	h := getCompressHandler(t, nil, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performEncodedRequest(t, h, "br", []byte(`{}`))
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+	expectedBody := `{"error":"Unsupported content encoding","request_id":"abc-123"}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestDecompressLimitsDecodedSize(t *testing.T) {
+	h := getCompressHandler(t, nil, getMockCompressionConfig(), 256)
+	// compresses to well under the limit
+	body := gzipBody(t, `{"data":{"name":"`+strings.Repeat("a", 4096)+`","price":3.14}}`)
+	w := performEncodedRequest(t, h, "gzip", body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+}
+
+func TestDecompressRejectsCorruptBody(t *testing.T) {
+	h := getCompressHandler(t, nil, getMockCompressionConfig(), middleware.DefaultMaxBodyBytes)
+	w := performEncodedRequest(t, h, "gzip", []byte(`{"data":{}}`))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestCompressionConfigFromEnv(t *testing.T) {
+	t.Setenv("COMPRESSION_ENCODINGS", "gzip, br")
+	t.Setenv("COMPRESSION_MIN_BYTES", "0")
+	config := middleware.CompressionConfigFromEnv()
+	if len(config.Encodings) != 1 || config.Encodings[0] != "gzip" || config.MinBytes != 0 {
+		t.Errorf("Unexpected compression config %+v", config)
+	}
+	t.Setenv("COMPRESSION_ENCODINGS", "none")
+	if config := middleware.CompressionConfigFromEnv(); len(config.Encodings) != 0 {
+		t.Errorf("Expected compression to be disabled, but got %+v", config)
+	}
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example-server/internal/database"
+	"example-server/internal/dependencies"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+	"example-server/internal/tenant"
+)
+
+// MOCKS
+
+var mockItem = models.Item{
+	ID:        1,
+	UUID:      "550e8400-e29b-41d4-a716-446655440000",
+	CreatedAt: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+	Name:      "pi",
+	Price:     float32(3.14),
+}
+
+// HELPERS
+
+func getInstrumentedMockDependencies() (*dependencies.Dependencies, pgxmock.PgxPoolIface, *prometheus.Registry) {
+	// setup mock dependencies with query metrics on a fresh registry
+	mockDBPool, err := pgxmock.NewPool()
+	if err != nil {
+		panic(err)
+	}
+	reg := prometheus.NewRegistry()
+	deps := dependencies.NewDependencies(
+		mockDBPool,
+		database.NewQueryMetrics(reg),
+		nil,
+	)
+	return deps, mockDBPool, reg
+}
+
+// getTenantContext scopes repos calls to mockTenant
+func getTenantContext() context.Context {
+	return tenant.NewContext(context.Background(), mockTenant)
+}
+
+func getMockItemRows(mockDBPool pgxmock.PgxPoolIface, items ...models.Item) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price"})
+	for _, item := range items {
+		rows.AddRow(item.ID, item.UUID, item.CreatedAt, item.Name, item.Price)
+	}
+	return rows
+}
+
+// getMetricValue returns a counter or gauge value or a histogram sample count
+// for the series matching the given labels
+func getMetricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %s", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched != len(labels) {
+				continue
+			}
+			if metric.GetHistogram() != nil {
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+			if metric.GetGauge() != nil {
+				return metric.GetGauge().GetValue()
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+// TESTS
+
+func TestDBMetricsInsertItem(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockItem.Name, mockItem.Price).
+		WillReturnRows(mockDBPool.NewRows([]string{"id"}).AddRow(mockItem.ID))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(mockItem.ID, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemCreated)
+	mockDBPool.ExpectCommit()
+	// exec repo call
+	_, err := repos.InsertItem(getTenantContext(), deps.DBPool, models.ItemIn{Name: mockItem.Name, Price: mockItem.Price})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	// assert query and domain event metrics
+	for _, query := range []string{"item.insert", "item.fetch_by_id"} {
+		labels := map[string]string{"query": query, "outcome": database.OutcomeOK}
+		if v := getMetricValue(t, reg, "db_query_duration_seconds", labels); v != 1 {
+			t.Errorf("Expected 1 observed %s query, but got %v", query, v)
+		}
+	}
+	eventLabels := map[string]string{"entity": "item", "event": "created"}
+	if v := getMetricValue(t, reg, "domain_events_total", eventLabels); v != 1 {
+		t.Errorf("Expected 1 item created event, but got %v", v)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestDBMetricsFetchItemNotFound(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	// exec repo call
+	_, err := repos.FetchItemById(getTenantContext(), deps.DBPool, 1)
+	if !errors.Is(err, repos.ErrorItemNotFound) {
+		t.Fatalf("Expected %s, but got %v", repos.ErrorItemNotFound, err)
+	}
+	// assert not_found outcome was counted
+	labels := map[string]string{"query": "item.fetch_by_id", "outcome": database.OutcomeNotFound}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 1 {
+		t.Errorf("Expected 1 not_found query, but got %v", v)
+	}
+}
+
+func TestDBMetricsUpdateItemConflict(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("UPDATE item SET (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(mockItem.Name, mockItem.Price, 1, mockTenant).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mockDBPool.ExpectRollback()
+	// exec repo call
+	_, err := repos.UpdateItem(getTenantContext(), deps.DBPool, 1, models.ItemIn{Name: mockItem.Name, Price: mockItem.Price})
+	if !errors.Is(err, repos.ErrorItemExists) {
+		t.Fatalf("Expected %s, but got %v", repos.ErrorItemExists, err)
+	}
+	// assert conflict outcome was counted and no domain event was recorded
+	labels := map[string]string{"query": "item.update", "outcome": database.OutcomeConflict}
+	if v := getMetricValue(t, reg, "db_query_errors_total", labels); v != 1 {
+		t.Errorf("Expected 1 conflict, but got %v", v)
+	}
+	eventLabels := map[string]string{"entity": "item", "event": "updated"}
+	if v := getMetricValue(t, reg, "domain_events_total", eventLabels); v != 0 {
+		t.Errorf("Expected 0 item updated events, but got %v", v)
+	}
+}
+
+func TestDBMetricsDeleteItem(t *testing.T) {
+	// setup instrumented mock dependencies and DB query expectations
+	deps, mockDBPool, reg := getInstrumentedMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	mockDBPool.ExpectExec("DELETE FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemDeleted)
+	mockDBPool.ExpectCommit()
+	// exec repo call
+	if _, err := repos.DeleteItem(getTenantContext(), deps.DBPool, 1); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	// assert delete query and domain event were recorded
+	labels := map[string]string{"query": "item.delete", "outcome": database.OutcomeOK}
+	if v := getMetricValue(t, reg, "db_query_duration_seconds", labels); v != 1 {
+		t.Errorf("Expected 1 observed delete, but got %v", v)
+	}
+	eventLabels := map[string]string{"entity": "item", "event": "deleted"}
+	if v := getMetricValue(t, reg, "domain_events_total", eventLabels); v != 1 {
+		t.Errorf("Expected 1 item deleted event, but got %v", v)
+	}
+}
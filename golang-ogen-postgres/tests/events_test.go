@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example-server/internal/changefeed"
+	"example-server/internal/dependencies"
+	"example-server/internal/middleware"
+	"example-server/internal/openapi"
+	"example-server/internal/ratelimit"
+)
+
+// HELPERS
+
+func getEventsHandler(t *testing.T, listener *changefeed.Listener) *openapi.ItemEventsHandler {
+	t.Helper()
+	deps, _ := getMockDependencies()
+	deps.Changes = listener
+	return &openapi.ItemEventsHandler{Guard: getStreamGuard(t, deps), Heartbeat: time.Hour}
+}
+
+func getStreamGuard(t *testing.T, deps *dependencies.Dependencies) *openapi.StreamGuard {
+	t.Helper()
+	return &openapi.StreamGuard{Service: &openapi.ItemsService{Deps: deps}, Security: getMockSecurityHandler(t)}
+}
+
+// getEventsServer serves handler over a real connection, as streams are
+// read while the handler is still running
+func getEventsServer(t *testing.T, handler http.Handler) *httptest.Server {
+	server := httptest.NewServer(middleware.RequestID(handler))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openEventStream starts reading events once the stream is subscribed
+func openEventStream(t *testing.T, url string, headers map[string]string) *bufio.Reader {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Error opening event stream: %s", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+	expected := map[string]string{
+		"Content-Type":      "text/event-stream;charset=utf-8",
+		"Cache-Control":     "no-cache",
+		"X-Accel-Buffering": "no",
+	}
+	for key, value := range expected {
+		if resp.Header.Get(key) != value {
+			t.Errorf("Expected %s header %q, but got %q", key, value, resp.Header.Get(key))
+		}
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// expectSSE reads the next blank line terminated block of the stream
+func expectSSE(t *testing.T, stream *bufio.Reader, expected string) {
+	t.Helper()
+	var block strings.Builder
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading event stream after %q: %s", block.String(), err)
+		}
+		if line == "\n" {
+			break
+		}
+		block.WriteString(line)
+	}
+	if block.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, block.String())
+	}
+}
+
+// TESTS
+
+func TestItemEventsStream(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, getEventsHandler(t, listener))
+	stream := openEventStream(t, server.URL+"/items/events?item_ids=1&item_ids=3", nil)
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 3, TenantID: "tenant-b"})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 3, TenantID: mockTenant})
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 1})+"\nevent:created\ndata:{\"op\":\"created\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 4})+"\nevent:deleted\ndata:{\"op\":\"deleted\",\"id\":3,\"tenant_id\":\"tenant-a\"}\n")
+}
+
+func TestItemEventsResume(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, getEventsHandler(t, listener))
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: mockTenant})
+	stream := openEventStream(t, server.URL+"/items/events", map[string]string{"Last-Event-ID": listener.EventID(changefeed.Event{Seq: 1})})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 2})+"\nevent:updated\ndata:{\"op\":\"updated\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 3})+"\nevent:deleted\ndata:{\"op\":\"deleted\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+}
+
+func TestItemEventsResetWhenResumeIsUnavailable(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	server := getEventsServer(t, getEventsHandler(t, listener))
+	// Ids past the last event, malformed, or from another process or before a restart
+	other := changefeed.NewListener(nil)
+	other.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	for _, lastEventId := range []string{
+		listener.EventID(changefeed.Event{Seq: 7}),
+		"not-an-id",
+		"1",
+		other.EventID(changefeed.Event{Seq: 1}),
+	} {
+		stream := openEventStream(t, server.URL+"/items/events", map[string]string{"Last-Event-ID": lastEventId})
+		expectSSE(t, stream, "event:reset\ndata:{}\n")
+	}
+}
+
+func TestItemEventsHeartbeat(t *testing.T) {
+	handler := getEventsHandler(t, changefeed.NewListener(nil))
+	handler.Heartbeat = 10 * time.Millisecond
+	server := getEventsServer(t, handler)
+	stream := openEventStream(t, server.URL+"/items/events", nil)
+	expectSSE(t, stream, ": heartbeat\n")
+}
+
+func TestItemEventsEndWithListener(t *testing.T) {
+	listener := changefeed.NewListener(func(ctx context.Context) (changefeed.Conn, error) {
+		return nil, ctx.Err()
+	})
+	server := getEventsServer(t, getEventsHandler(t, listener))
+	stream := openEventStream(t, server.URL+"/items/events", nil)
+	listener.Publish(changefeed.Event{Op: changefeed.OpCreated, ID: 1, TenantID: mockTenant})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	listener.Run(ctx)
+	expectSSE(t, stream, "id:"+listener.EventID(changefeed.Event{Seq: 1})+"\nevent:created\ndata:{\"op\":\"created\",\"id\":1,\"tenant_id\":\"tenant-a\"}\n")
+	if line, err := stream.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected the stream to end, but got %q, %v", line, err)
+	}
+}
+
+func TestItemEventsErrors(t *testing.T) {
+	limits, err := ratelimit.ParseConfig([]byte("default: {rate: 1, period: 1m, burst: 1}"))
+	if err != nil {
+		t.Fatalf("Failed to parse rate limits: %s", err)
+	}
+	limited := getEventsHandler(t, changefeed.NewListener(nil))
+	limited.Guard.Limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), limits)
+	// Use up the bucket
+	performRequest(middleware.RequestID(limited), "GET", "/items/events?item_ids=one", map[string]string{
+		"Authorization": "Bearer " + getMockToken(t),
+	})
+	tests := []struct {
+		name         string
+		handler      *openapi.ItemEventsHandler
+		path         string
+		headers      map[string]string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "missing credentials",
+			handler:      getEventsHandler(t, changefeed.NewListener(nil)),
+			path:         "/items/events",
+			headers:      map[string]string{},
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: `{"error":"Unauthorized","request_id":"abc-123"}`,
+		},
+		{
+			name:         "invalid token",
+			handler:      getEventsHandler(t, changefeed.NewListener(nil)),
+			path:         "/items/events",
+			headers:      map[string]string{"Authorization": "Bearer not-a-token"},
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: `{"error":"Unauthorized","request_id":"abc-123"}`,
+		},
+		{
+			name:         "invalid item id",
+			handler:      getEventsHandler(t, changefeed.NewListener(nil)),
+			path:         "/items/events?item_ids=one",
+			headers:      map[string]string{"Authorization": "Bearer " + getMockToken(t)},
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"invalid item id","request_id":"abc-123"}`,
+		},
+		{
+			name:         "unavailable",
+			handler:      getEventsHandler(t, nil),
+			path:         "/items/events",
+			headers:      map[string]string{"Authorization": "Bearer " + getMockToken(t)},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"error":"item events unavailable","request_id":"abc-123"}`,
+		},
+		{
+			name:         "rate limited",
+			handler:      limited,
+			path:         "/items/events",
+			headers:      map[string]string{"Authorization": "Bearer " + getMockToken(t)},
+			expectedCode: http.StatusTooManyRequests,
+			expectedBody: `{"error":"too many requests","request_id":"abc-123"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.headers[middleware.RequestIdHeader] = "abc-123"
+			w := performRequest(middleware.RequestID(tt.handler), "GET", tt.path, tt.headers)
+			if w.Code != tt.expectedCode {
+				t.Fatalf("Expected status code %d, but got %d", tt.expectedCode, w.Code)
+			}
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected %s, but got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
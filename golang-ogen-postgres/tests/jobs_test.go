@@ -0,0 +1,398 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example-server/internal/admin"
+	"example-server/internal/jobs"
+	"example-server/internal/models"
+	"example-server/internal/repos"
+	"example-server/internal/webhook"
+)
+
+// MOCKS
+
+type mockJobArgs struct {
+	Name string `json:"name"`
+}
+
+var mockJobKind = jobs.Kind[mockJobArgs]{Name: "test.greet", MaxAttempts: 3}
+
+var mockJobCreatedAt = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var mockJob = models.Job{
+	ID:          1,
+	Kind:        mockJobKind.Name,
+	Payload:     json.RawMessage(`{"name":"pi"}`),
+	Status:      models.JobRunning,
+	Attempts:    1,
+	MaxAttempts: 3,
+	RunAt:       mockJobCreatedAt,
+	CreatedAt:   mockJobCreatedAt,
+	UpdatedAt:   mockJobCreatedAt,
+}
+
+// HELPERS
+
+func getJobRows(mockDBPool pgxmock.PgxPoolIface, jobs ...models.Job) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{
+		"id", "kind", "payload", "status", "unique_key", "attempts", "max_attempts", "run_at", "locked_until",
+		"last_error", "created_at", "updated_at", "finished_at",
+	})
+	for _, j := range jobs {
+		rows.AddRow(
+			j.ID, j.Kind, j.Payload, j.Status, j.UniqueKey, j.Attempts, j.MaxAttempts, j.RunAt, j.LockedUntil,
+			j.LastError, j.CreatedAt, j.UpdatedAt, j.FinishedAt,
+		)
+	}
+	return rows
+}
+
+func getMockJobsConfig() jobs.Config {
+	return jobs.Config{
+		Concurrency:     2,
+		PollInterval:    time.Hour,
+		Timeout:         time.Minute,
+		BackoffBase:     10 * time.Second,
+		BackoffMax:      time.Hour,
+		ShutdownTimeout: time.Second,
+	}
+}
+
+func expectClaimJobs(mockDBPool pgxmock.PgxPoolIface, limit int, claimed ...models.Job) {
+	mockDBPool.ExpectQuery("UPDATE jobs SET status = 'running', (.+) FOR UPDATE SKIP LOCKED\\) RETURNING (.+)").
+		WithArgs([]string{mockJobKind.Name}, limit, float64(120)).
+		WillReturnRows(getJobRows(mockDBPool, claimed...))
+}
+
+// runMockJobs claims and runs the claimed jobs with handle, then shuts the pool
+// down
+func runMockJobs(
+	t *testing.T,
+	mockDBPool pgxmock.PgxPoolIface,
+	config jobs.Config,
+	metrics *jobs.Metrics,
+	handle func(ctx context.Context, job *models.Job, args mockJobArgs) error,
+) {
+	t.Helper()
+	registry := jobs.NewRegistry()
+	jobs.Handle(registry, mockJobKind, handle)
+	pool := jobs.NewPool(mockDBPool, registry, config, metrics)
+	if _, err := pool.RunDue(context.Background()); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	pool.Shutdown()
+}
+
+// TESTS
+
+func TestEnqueueJob(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	runAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	uniqueKey := "pi"
+	mockDBPool.ExpectQuery("INSERT INTO jobs (.+) ON CONFLICT (.+) DO NOTHING RETURNING (.+)").
+		WithArgs(mockJobKind.Name, json.RawMessage(`{"name":"pi"}`), &uniqueKey, &runAt, 3).
+		WillReturnRows(getJobRows(mockDBPool, mockJob))
+	mockDBPool.ExpectQuery("INSERT INTO jobs (.+) ON CONFLICT (.+) DO NOTHING RETURNING (.+)").
+		WithArgs(mockJobKind.Name, json.RawMessage(`{"name":"pi"}`), &uniqueKey, (*time.Time)(nil), 3).
+		WillReturnRows(getJobRows(mockDBPool))
+	options := jobs.EnqueueOptions{RunAt: runAt, UniqueKey: uniqueKey}
+	job, err := mockJobKind.Enqueue(context.Background(), mockDBPool, mockJobArgs{Name: "pi"}, options)
+	if err != nil || job.ID != 1 {
+		t.Errorf("Expected job 1, but got %v: %v", job, err)
+	}
+	// a job with the same key is still queued
+	options.RunAt = time.Time{}
+	if _, err := mockJobKind.Enqueue(context.Background(), mockDBPool, mockJobArgs{Name: "pi"}, options); !errors.Is(err, repos.ErrorJobExists) {
+		t.Errorf("Expected %s, but got %v", repos.ErrorJobExists, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPoolRunsJobWithTypedArgs(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	reg := prometheus.NewRegistry()
+	expectClaimJobs(mockDBPool, 2, mockJob)
+	mockDBPool.ExpectExec("UPDATE jobs SET status = 'done', (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(int64(1), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	var got mockJobArgs
+	runMockJobs(t, mockDBPool, getMockJobsConfig(), jobs.NewMetrics(reg), func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+		got = args
+		return nil
+	})
+	if got.Name != "pi" {
+		t.Errorf("Expected args name pi, but got %q", got.Name)
+	}
+	if value := getMetricValue(t, reg, "jobs_processed_total", map[string]string{"kind": mockJobKind.Name, "outcome": jobs.OutcomeDone}); value != 1 {
+		t.Errorf("Expected 1 done job, but got %v", value)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPoolRetriesFailedJobWithBackoff(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	job := mockJob
+	job.Attempts = 2
+	expectClaimJobs(mockDBPool, 2, job)
+	// the second attempt waits twice the base
+	mockDBPool.ExpectExec("UPDATE jobs SET status = (.+), run_at = (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(models.JobPending, float64(20), "boom", int64(1), 2).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	runMockJobs(t, mockDBPool, getMockJobsConfig(), nil, func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+		return errors.New("boom")
+	})
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPoolFailsJobForGood(t *testing.T) {
+	lastAttempt := mockJob
+	lastAttempt.Attempts = 3
+	// its worker died on the last attempt
+	expired := mockJob
+	expired.ID, expired.Attempts = 2, 4
+	invalid := mockJob
+	invalid.ID, invalid.Payload = 3, json.RawMessage(`{"name":1}`)
+	tests := []struct {
+		name    string
+		job     models.Job
+		handle  error
+		lastErr string
+	}{
+		{"last attempt", lastAttempt, errors.New("boom"), "boom"},
+		{"permanent error", mockJob, jobs.Permanent(errors.New("bad input")), "bad input"},
+		{"expired lease", expired, nil, jobs.ErrorLeaseExpired.Error()},
+		{"invalid payload", invalid, nil, "json: cannot unmarshal number into Go struct field mockJobArgs.name of type string: invalid job payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mockDBPool := getMockDependencies()
+			expectClaimJobs(mockDBPool, 2, tt.job)
+			mockDBPool.ExpectExec("UPDATE jobs SET status = (.+), run_at = (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+				WithArgs(models.JobFailed, float64(0), tt.lastErr, tt.job.ID, tt.job.Attempts).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			handled := false
+			runMockJobs(t, mockDBPool, getMockJobsConfig(), nil, func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+				handled = true
+				return tt.handle
+			})
+			if handled != (tt.handle != nil) {
+				t.Errorf("Expected handled to be %v", tt.handle != nil)
+			}
+			if err := mockDBPool.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled DB expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPoolShutdownWaitsForRunningJobs(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimJobs(mockDBPool, 2, mockJob)
+	mockDBPool.ExpectExec("UPDATE jobs SET status = 'done', (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(int64(1), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	runMockJobs(t, mockDBPool, getMockJobsConfig(), nil, func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+		time.Sleep(50 * time.Millisecond)
+		return ctx.Err()
+	})
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPoolShutdownReleasesStoppedJobs(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimJobs(mockDBPool, 2, mockJob)
+	mockDBPool.ExpectExec("UPDATE jobs SET status = 'pending', attempts = attempts - 1, (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(int64(1), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	config := getMockJobsConfig()
+	config.ShutdownTimeout = 10 * time.Millisecond
+	runMockJobs(t, mockDBPool, config, nil, func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPoolLeavesJobClaimedAgainToNewClaim(t *testing.T) {
+	// the job outran its lease and another worker claimed it, moving attempts on
+	tests := []struct {
+		name    string
+		handle  error
+		update  string
+		args    []any
+		outcome string
+	}{
+		{"done", nil, "UPDATE jobs SET status = 'done', (.+) AND attempts = (.+)", []any{int64(1), 1}, jobs.OutcomeDone},
+		{
+			"failed", errors.New("boom"), "UPDATE jobs SET status = (.+), run_at = (.+) AND attempts = (.+)",
+			[]any{models.JobPending, float64(10), "boom", int64(1), 1}, jobs.OutcomeRetrying,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mockDBPool := getMockDependencies()
+			reg := prometheus.NewRegistry()
+			expectClaimJobs(mockDBPool, 2, mockJob)
+			mockDBPool.ExpectExec(tt.update).
+				WithArgs(tt.args...).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			runMockJobs(t, mockDBPool, getMockJobsConfig(), jobs.NewMetrics(reg), func(ctx context.Context, job *models.Job, args mockJobArgs) error {
+				return tt.handle
+			})
+			labels := map[string]string{"kind": mockJobKind.Name, "outcome": jobs.OutcomeLeaseLost}
+			if value := getMetricValue(t, reg, "jobs_processed_total", labels); value != 1 {
+				t.Errorf("Expected 1 job with a lost lease, but got %v", value)
+			}
+			labels["outcome"] = tt.outcome
+			if value := getMetricValue(t, reg, "jobs_processed_total", labels); value != 0 {
+				t.Errorf("Expected no %s job, but got %v", tt.outcome, value)
+			}
+			if err := mockDBPool.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled DB expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestPoolRunStopsOnCancel(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	config := getMockJobsConfig()
+	config.PollInterval = 10 * time.Millisecond
+	expectClaimJobs(mockDBPool, 2)
+	registry := jobs.NewRegistry()
+	jobs.Handle(registry, mockJobKind, func(ctx context.Context, job *models.Job, args mockJobArgs) error { return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		jobs.NewPool(mockDBPool, registry, config, nil).Run(ctx)
+		close(done)
+	}()
+	time.Sleep(15 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return once cancelled")
+	}
+}
+
+func TestJobsConfigBackoff(t *testing.T) {
+	config := getMockJobsConfig()
+	for attempt, expected := range map[int]time.Duration{1: 10 * time.Second, 3: 40 * time.Second, 20: time.Hour} {
+		if backoff := config.Backoff(attempt); backoff != expected {
+			t.Errorf("Expected backoff %s after attempt %d, but got %s", expected, attempt, backoff)
+		}
+	}
+}
+
+func TestPruneWebhookDeliveriesJob(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("DELETE FROM webhook_deliveries WHERE status = (.+) AND delivered_at < (.+)").
+		WithArgs(models.WebhookDeliveryDelivered, float64(30*24*60*60)).
+		WillReturnResult(pgxmock.NewResult("DELETE", 4))
+	mockDBPool.ExpectCommit()
+	handle := webhook.HandlePruneDeliveries(mockDBPool)
+	if err := handle(context.Background(), &mockJob, webhook.PruneDeliveriesArgs{RetentionDays: 30}); err != nil {
+		t.Errorf("Expected no error, but got %s", err)
+	}
+	if err := handle(context.Background(), &mockJob, webhook.PruneDeliveriesArgs{}); !errors.Is(err, jobs.ErrorInvalidPayload) {
+		t.Errorf("Expected %s, but got %v", jobs.ErrorInvalidPayload, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminInspectAndRetryFailedJobs(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	failed := mockJob
+	failed.Status, failed.Attempts = models.JobFailed, 3
+	lastError := "boom"
+	failed.LastError, failed.FinishedAt = &lastError, &mockJobCreatedAt
+	retried := failed
+	retried.Status, retried.Attempts, retried.FinishedAt = models.JobPending, 0, nil
+	mockDBPool.ExpectQuery("SELECT (.+) FROM jobs WHERE (.+) ORDER BY id DESC LIMIT (.+)").
+		WithArgs(models.JobFailed, "", 50).
+		WillReturnRows(getJobRows(mockDBPool, failed))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM jobs WHERE id = (.+)").
+		WithArgs(int64(1)).
+		WillReturnRows(getJobRows(mockDBPool, failed))
+	mockDBPool.ExpectQuery("UPDATE jobs SET status = 'pending', (.+) WHERE id = (.+) AND status = 'failed' RETURNING (.+)").
+		WithArgs(int64(1)).
+		WillReturnRows(getJobRows(mockDBPool, retried))
+	mockDBPool.ExpectQuery("UPDATE jobs SET status = 'pending', (.+) WHERE id = (.+) AND status = 'failed' RETURNING (.+)").
+		WithArgs(int64(1)).
+		WillReturnRows(getJobRows(mockDBPool))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM jobs WHERE id = (.+)").
+		WithArgs(int64(1)).
+		WillReturnRows(getJobRows(mockDBPool, retried))
+	mockDBPool.ExpectQuery("UPDATE jobs SET status = 'pending', (.+) WHERE id = (.+) AND status = 'failed' RETURNING (.+)").
+		WithArgs(int64(2)).
+		WillReturnRows(getJobRows(mockDBPool))
+	mockDBPool.ExpectQuery("SELECT (.+) FROM jobs WHERE id = (.+)").
+		WithArgs(int64(2)).
+		WillReturnRows(getJobRows(mockDBPool))
+	h := admin.NewHandler(deps, mockAdminToken)
+	// exec list request
+	w := performAdminRequest(h, "GET", "/admin/jobs?status=failed", mockAdminToken, "")
+	failedBody := `{"id":1,"kind":"test.greet","payload":{"name":"pi"},"status":"failed","unique_key":null,"attempts":3,"max_attempts":3,` +
+		`"run_at":"2021-01-01T00:00:00Z","locked_until":null,"last_error":"boom","created_at":"2021-01-01T00:00:00Z",` +
+		`"updated_at":"2021-01-01T00:00:00Z","finished_at":"2021-01-01T00:00:00Z"}`
+	if expectedBody := `{"data":[` + failedBody + `]}`; strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	// exec get request
+	w = performAdminRequest(h, "GET", "/admin/jobs/1", mockAdminToken, "")
+	if expectedBody := `{"data":` + failedBody + `}`; strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	// exec retry requests
+	w = performAdminRequest(h, "POST", "/admin/jobs/1/retry", mockAdminToken, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"pending","unique_key":null,"attempts":0`) {
+		t.Errorf("Expected the job pending again, but got %d: %s", w.Code, w.Body.String())
+	}
+	if w := performAdminRequest(h, "POST", "/admin/jobs/1/retry", mockAdminToken, ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, but got %d", http.StatusConflict, w.Code)
+	}
+	if w := performAdminRequest(h, "POST", "/admin/jobs/2/retry", mockAdminToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminGetJobsValidatesQuery(t *testing.T) {
+	deps, _ := getMockDependencies()
+	h := admin.NewHandler(deps, mockAdminToken)
+	for _, path := range []string{"/admin/jobs?status=lost", "/admin/jobs?limit=0", "/admin/jobs?limit=101", "/admin/jobs/abc"} {
+		if w := performAdminRequest(h, "GET", path, mockAdminToken, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusBadRequest, path, w.Code)
+		}
+	}
+	if w := performAdminRequest(h, "GET", "/admin/jobs", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/admin"
+	"example-server/internal/logger"
+	"example-server/internal/middleware"
+)
+
+const mockAdminToken = "admin-secret"
+
+// HELPERS
+
+// restoreLevel resets the global log level after the test
+func restoreLevel(t *testing.T) {
+	t.Helper()
+	original := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(original) })
+}
+
+func performAdminRequest(h http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestLogFormatJSONAndConsole(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("LOG_FORMAT", logger.FormatJSON)
+	l := logger.NewLogger(&buf)
+	l.Info().Msg("json line")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("Expected a JSON line, but got %s", buf.String())
+	}
+	buf.Reset()
+	t.Setenv("LOG_FORMAT", logger.FormatConsole)
+	l = logger.NewLogger(&buf)
+	l.Info().Msg("console line")
+	if strings.HasPrefix(buf.String(), "{") || !strings.Contains(buf.String(), "console line") {
+		t.Errorf("Expected a console line, but got %s", buf.String())
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	for input, expected := range map[string]string{"json": logger.FormatJSON, "JSON": logger.FormatJSON, "Console": logger.FormatConsole} {
+		if format, err := logger.ParseFormat(input); err != nil || format != expected {
+			t.Errorf("Expected %q to parse as %q, but got %q: %v", input, expected, format, err)
+		}
+	}
+	for _, input := range []string{"jsonl", "text", ""} {
+		if _, err := logger.ParseFormat(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestLogFormatIsCaseInsensitive(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("LOG_FORMAT", "JSON")
+	l := logger.NewLogger(&buf)
+	l.Info().Msg("json line")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("Expected a JSON line, but got %s", buf.String())
+	}
+}
+
+func TestInvalidLogFormatFallsBackToDefault(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("IS_PROD", "true")
+	t.Setenv("LOG_FORMAT", "jsonl")
+	l := logger.NewLogger(&buf)
+	l.Info().Msg("json line")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("Expected the production default of JSON, but got %s", buf.String())
+	}
+}
+
+func TestLogSamplingKeepsInfoBurst(t *testing.T) {
+	restoreLevel(t)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	var buf bytes.Buffer
+	t.Setenv("LOG_FORMAT", logger.FormatJSON)
+	t.Setenv("LOG_SAMPLE_INFO_BURST", "2")
+	l := logger.NewLogger(&buf)
+	for i := 0; i < 5; i++ {
+		l.Info().Int("i", i).Msg("high volume")
+	}
+	l.Warn().Msg("not sampled")
+	lines := parseLogLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 2 info lines and 1 warn line, but got %v", lines)
+	}
+	if lines[2]["level"] != "warn" {
+		t.Errorf("Expected warn line to be kept, but got %v", lines[2])
+	}
+}
+
+func TestAdminLogLevelRequiresToken(t *testing.T) {
+	h := middleware.RequestID(admin.NewHandler(nil, mockAdminToken))
+	for _, token := range []string{"", "wrong"} {
+		w := performAdminRequest(h, "PUT", "/admin/loglevel", token, `{"level":"warn"}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+		}
+		if w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("Expected WWW-Authenticate header, but got %q", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAdminSetLogLevel(t *testing.T) {
+	restoreLevel(t)
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	buf := captureLogs(t)
+	// exec request
+	h := admin.NewHandler(nil, mockAdminToken)
+	w := performAdminRequest(h, "PUT", "/admin/loglevel", mockAdminToken, `{"level":"warn"}`)
+	expectedBody := `{"level":"warn","previous":"info"}`
+	if strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	// assert info lines are now dropped and warn lines kept
+	buf.Reset()
+	log.Info().Msg("dropped")
+	log.Warn().Msg("kept")
+	lines := parseLogLines(t, buf)
+	if len(lines) != 1 || lines[0]["message"] != "kept" {
+		t.Errorf("Expected only the warn line, but got %v", lines)
+	}
+	// assert GET reflects the new level
+	w = performAdminRequest(h, "GET", "/admin/loglevel", mockAdminToken, "")
+	expectedBody = `{"level":"warn"}`
+	if strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestAdminSetLogLevelInvalid(t *testing.T) {
+	restoreLevel(t)
+	h := middleware.RequestID(admin.NewHandler(nil, mockAdminToken))
+	w := performAdminRequest(h, "PUT", "/admin/loglevel", mockAdminToken, `{"level":"verbose"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"error":"Invalid log level"`) {
+		t.Errorf("Expected invalid log level error, but got %s", w.Body.String())
+	}
+}
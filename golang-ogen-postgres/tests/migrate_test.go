@@ -0,0 +1,281 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+
+	"example-server/internal/database"
+	"example-server/internal/health"
+	"example-server/internal/migrate"
+	"example-server/migrations"
+)
+
+// MOCKS
+
+var mockMigrations = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+	"000001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT)")},
+	"000002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	"README.md":                {Data: []byte("not a migration")},
+}
+
+// HELPERS
+
+func getMockMigrator(t *testing.T, mockDBPool pgxmock.PgxPoolIface) *migrate.Migrator {
+	t.Helper()
+	migrator, err := migrate.New(mockDBPool, mockMigrations)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %s", err)
+	}
+	return migrator
+}
+
+// expectSchemaVersion expects the schema version to be read, with no row
+// when version is 0
+func expectSchemaVersion(mockDBPool pgxmock.PgxPoolIface, version int64, dirty bool) {
+	query := mockDBPool.ExpectQuery("SELECT version, dirty FROM schema_migrations")
+	if version == 0 {
+		query.WillReturnError(pgx.ErrNoRows)
+		return
+	}
+	query.WillReturnRows(mockDBPool.NewRows([]string{"version", "dirty"}).AddRow(version, dirty))
+}
+
+// expectMigrationsLock expects the migrations lock to be taken and the schema
+// version read
+func expectMigrationsLock(mockDBPool pgxmock.PgxPoolIface, version int64, dirty bool) {
+	mockDBPool.ExpectBegin()
+	mockDBPool.ExpectExec("SELECT pg_advisory_xact_lock\\((.+)\\)").
+		WithArgs(database.LockMigrations).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mockDBPool.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	expectSchemaVersion(mockDBPool, version, dirty)
+}
+
+// expectSetSchemaVersion expects the schema_migrations row to be replaced
+func expectSetSchemaVersion(mockDBPool pgxmock.PgxPoolIface, version int, dirty bool) {
+	mockDBPool.ExpectBegin()
+	mockDBPool.ExpectExec("TRUNCATE schema_migrations").
+		WillReturnResult(pgxmock.NewResult("TRUNCATE TABLE", 0))
+	if version > 0 || dirty {
+		mockDBPool.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(version, dirty).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	}
+	mockDBPool.ExpectCommit()
+}
+
+// expectMigration expects the SQL of a migration to run, recording target as
+// the version
+func expectMigration(mockDBPool pgxmock.PgxPoolIface, target int, sql string) {
+	expectSetSchemaVersion(mockDBPool, target, true)
+	mockDBPool.ExpectExec(sql).WillReturnResult(pgxmock.NewResult("", 0))
+	expectSetSchemaVersion(mockDBPool, target, false)
+}
+
+func performReadinessRequest(t *testing.T, mockDBPool pgxmock.PgxPoolIface) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	(&health.Readiness{Migrator: getMockMigrator(t, mockDBPool)}).ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestEmbeddedMigrations(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	migrator, err := migrate.New(mockDBPool, migrations.FS)
+	if err != nil {
+		t.Fatalf("Expected the embedded migrations to load, but got %s", err)
+	}
+	if migrator.Latest() < 1 {
+		t.Errorf("Expected embedded migrations, but got latest version %d", migrator.Latest())
+	}
+}
+
+func TestMigrateRejectsInvalidMigrations(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	for name, fsys := range map[string]fstest.MapFS{
+		"no up file":     {"000001_create_a.down.sql": {Data: []byte("DROP TABLE a")}},
+		"version 0":      {"000000_create_a.up.sql": {Data: []byte("CREATE TABLE a (id INT)")}},
+		"shared version": {"000001_create_a.up.sql": {}, "000001_create_b.up.sql": {}},
+	} {
+		if _, err := migrate.New(mockDBPool, fsys); !errors.Is(err, migrate.ErrorInvalidMigration) {
+			t.Errorf("Expected %s for %s, but got %v", migrate.ErrorInvalidMigration, name, err)
+		}
+	}
+}
+
+func TestMigrateUp(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 0, false)
+	expectMigration(mockDBPool, 1, "CREATE TABLE a")
+	expectMigration(mockDBPool, 2, "CREATE TABLE b")
+	mockDBPool.ExpectCommit()
+	applied, err := getMockMigrator(t, mockDBPool).Up(context.Background(), 0)
+	if err != nil || applied != 2 {
+		t.Errorf("Expected 2 migrations applied, but got %d: %v", applied, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateUpN(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 0, false)
+	expectMigration(mockDBPool, 1, "CREATE TABLE a")
+	mockDBPool.ExpectCommit()
+	applied, err := getMockMigrator(t, mockDBPool).Up(context.Background(), 1)
+	if err != nil || applied != 1 {
+		t.Errorf("Expected 1 migration applied, but got %d: %v", applied, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateUpLeavesFailedMigrationDirty(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 1, false)
+	expectSetSchemaVersion(mockDBPool, 2, true)
+	mockDBPool.ExpectExec("CREATE TABLE b").WillReturnError(errors.New("syntax error"))
+	mockDBPool.ExpectRollback()
+	applied, err := getMockMigrator(t, mockDBPool).Up(context.Background(), 0)
+	if err == nil || applied != 0 {
+		t.Errorf("Expected the migration to fail, but got %d applied: %v", applied, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateRefusesDirtySchema(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 2, true)
+	mockDBPool.ExpectRollback()
+	if _, err := getMockMigrator(t, mockDBPool).Up(context.Background(), 0); !errors.Is(err, migrate.ErrorDirty) {
+		t.Errorf("Expected %s, but got %v", migrate.ErrorDirty, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 2, false)
+	expectMigration(mockDBPool, 1, "DROP TABLE b")
+	mockDBPool.ExpectCommit()
+	reverted, err := getMockMigrator(t, mockDBPool).Down(context.Background(), 1)
+	if err != nil || reverted != 1 {
+		t.Errorf("Expected 1 migration reverted, but got %d: %v", reverted, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateDownAll(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 2, false)
+	expectMigration(mockDBPool, 1, "DROP TABLE b")
+	// the migrate CLI records a dirty version 0 as -1
+	expectSetSchemaVersion(mockDBPool, -1, true)
+	mockDBPool.ExpectExec("DROP TABLE a").WillReturnResult(pgxmock.NewResult("", 0))
+	expectSetSchemaVersion(mockDBPool, 0, false)
+	mockDBPool.ExpectCommit()
+	reverted, err := getMockMigrator(t, mockDBPool).Down(context.Background(), 0)
+	if err != nil || reverted != 2 {
+		t.Errorf("Expected 2 migrations reverted, but got %d: %v", reverted, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestMigrateForce(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectMigrationsLock(mockDBPool, 2, true)
+	expectSetSchemaVersion(mockDBPool, 1, false)
+	mockDBPool.ExpectCommit()
+	migrator := getMockMigrator(t, mockDBPool)
+	if err := migrator.Force(context.Background(), 1); err != nil {
+		t.Errorf("Expected the version to be forced, but got %s", err)
+	}
+	if err := migrator.Force(context.Background(), 3); !errors.Is(err, migrate.ErrorUnknownVersion) {
+		t.Errorf("Expected %s, but got %v", migrate.ErrorUnknownVersion, err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name         string
+		expect       func(mockDBPool pgxmock.PgxPoolIface)
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "ready",
+			expect:       func(mockDBPool pgxmock.PgxPoolIface) { expectSchemaVersion(mockDBPool, 2, false) },
+			expectedCode: http.StatusOK,
+			expectedBody: `{"status":"ready","schema":{"version":2,"dirty":false,"latest":2}}` + "\n",
+		},
+		{
+			name:         "pending",
+			expect:       func(mockDBPool pgxmock.PgxPoolIface) { expectSchemaVersion(mockDBPool, 1, false) },
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"schema_pending","schema":{"version":1,"dirty":false,"latest":2}}` + "\n",
+		},
+		{
+			name:         "never migrated",
+			expect:       func(mockDBPool pgxmock.PgxPoolIface) { expectSchemaVersion(mockDBPool, 0, false) },
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"schema_pending","schema":{"version":0,"dirty":false,"latest":2}}` + "\n",
+		},
+		{
+			name:         "dirty",
+			expect:       func(mockDBPool pgxmock.PgxPoolIface) { expectSchemaVersion(mockDBPool, 2, true) },
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"schema_dirty","schema":{"version":2,"dirty":true,"latest":2}}` + "\n",
+		},
+		{
+			name: "database unavailable",
+			expect: func(mockDBPool pgxmock.PgxPoolIface) {
+				mockDBPool.ExpectQuery("SELECT version, dirty FROM schema_migrations").
+					WillReturnError(errors.New("connection refused"))
+			},
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: `{"status":"database_unavailable"}` + "\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, mockDBPool := getMockDependencies()
+			test.expect(mockDBPool)
+			w := performReadinessRequest(t, mockDBPool)
+			if w.Code != test.expectedCode {
+				t.Errorf("Expected status %d, but got %d", test.expectedCode, w.Code)
+			}
+			if w.Body.String() != test.expectedBody {
+				t.Errorf("Expected body %s, but got %s", test.expectedBody, w.Body.String())
+			}
+			if err := mockDBPool.ExpectationsWereMet(); err != nil {
+				t.Errorf("There were unfulfilled DB expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/ogen-go/ogen/ogenerrors"
+	"github.com/pashagolub/pgxmock/v4"
+
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/operations"
+)
+
+// MOCKS
+
+var mockOperationCreatedAt = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var mockImportInput = json.RawMessage(`{"on_conflict":"update","rows":[` +
+	`{"line":2,"name":"pi","price":3.14},{"line":3,"name":"e","price":2.71},{"line":4,"name":"tree-fiddy","price":3.5}],` +
+	`"errors":[{"line":5,"error":"invalid price"}]}`)
+
+var mockImportOperation = models.Operation{
+	ID:          1,
+	TenantID:    mockTenant,
+	Type:        models.OperationItemImport,
+	Status:      models.OperationQueued,
+	Input:       mockImportInput,
+	Total:       3,
+	MaxAttempts: 3,
+	CreatedAt:   mockOperationCreatedAt,
+	UpdatedAt:   mockOperationCreatedAt,
+}
+
+var mockBulkDeleteOperation = models.Operation{
+	ID:          2,
+	TenantID:    mockTenant,
+	Type:        models.OperationItemBulkDelete,
+	Status:      models.OperationQueued,
+	Input:       json.RawMessage(`{"ids":[1,2,3]}`),
+	Total:       3,
+	MaxAttempts: 3,
+	CreatedAt:   mockOperationCreatedAt,
+	UpdatedAt:   mockOperationCreatedAt,
+}
+
+// operationTokenSource authenticates the ogen client with a tenant token
+type operationTokenSource struct {
+	token string
+}
+
+func (s *operationTokenSource) BearerAuth(ctx context.Context, operationName ogen.OperationName) (ogen.BearerAuth, error) {
+	return ogen.BearerAuth{Token: s.token}, nil
+}
+
+func (s *operationTokenSource) ApiKeyAuth(ctx context.Context, operationName ogen.OperationName) (ogen.ApiKeyAuth, error) {
+	return ogen.ApiKeyAuth{}, ogenerrors.ErrSkipClientSecurity
+}
+
+func (s *operationTokenSource) ClientCertAuth(ctx context.Context, operationName ogen.OperationName, req *http.Request) error {
+	return ogenerrors.ErrSkipClientSecurity
+}
+
+// HELPERS
+
+func getOperationRows(mockDBPool pgxmock.PgxPoolIface, operations ...models.Operation) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{
+		"id", "tenant_id", "type", "status", "input", "total", "processed", "result", "error",
+		"attempts", "max_attempts", "created_at", "updated_at", "finished_at",
+	})
+	for _, o := range operations {
+		rows.AddRow(
+			o.ID, o.TenantID, o.Type, o.Status, o.Input, o.Total, o.Processed, o.Result, o.Error,
+			o.Attempts, o.MaxAttempts, o.CreatedAt, o.UpdatedAt, o.FinishedAt,
+		)
+	}
+	return rows
+}
+
+func getMockOperationsConfig() operations.Config {
+	return operations.Config{
+		Concurrency:  2,
+		PollInterval: time.Hour,
+		ChunkSize:    2,
+		Lease:        time.Minute,
+	}
+}
+
+func expectFetchOperation(mockDBPool pgxmock.PgxPoolIface, operationId int64, operations ...models.Operation) {
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM operations WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(operationId, mockTenant).
+		WillReturnRows(getOperationRows(mockDBPool, operations...))
+	if len(operations) == 0 {
+		mockDBPool.ExpectRollback()
+	} else {
+		mockDBPool.ExpectCommit()
+	}
+}
+
+func expectClaimOperations(mockDBPool pgxmock.PgxPoolIface, limit int, claimed ...models.Operation) {
+	expectAllTenantsTx(mockDBPool)
+	for i := range claimed {
+		claimed[i].Status = models.OperationRunning
+		claimed[i].Attempts++
+	}
+	mockDBPool.ExpectQuery("UPDATE operations SET status = 'running', attempts = attempts \\+ 1, (.+) FOR UPDATE SKIP LOCKED\\) RETURNING (.+)").
+		WithArgs(limit, float64(60)).
+		WillReturnRows(getOperationRows(mockDBPool, claimed...))
+	mockDBPool.ExpectCommit()
+}
+
+// expectOperationProgress expects progress of the claim on attempt to be
+// recorded, the operation having been canceled unless running
+func expectOperationProgress(mockDBPool pgxmock.PgxPoolIface, operationId int64, attempt, processed int, result string, running bool) {
+	expectAllTenantsTx(mockDBPool)
+	rowsAffected := int64(0)
+	if running {
+		rowsAffected = 1
+	}
+	mockDBPool.ExpectExec("UPDATE operations SET processed = (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(processed, []byte(result), float64(60), operationId, attempt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", rowsAffected))
+	if !running {
+		expectOperationAttempts(mockDBPool, operationId, attempt)
+	}
+	mockDBPool.ExpectCommit()
+}
+
+// expectOperationAttempts expects a fenced update that matched no row to look
+// up the attempts of the operation
+func expectOperationAttempts(mockDBPool pgxmock.PgxPoolIface, operationId int64, attempts int) {
+	mockDBPool.ExpectQuery("SELECT attempts FROM operations WHERE id = (.+)").
+		WithArgs(operationId).
+		WillReturnRows(mockDBPool.NewRows([]string{"attempts"}).AddRow(attempts))
+}
+
+func expectFinishOperation(mockDBPool pgxmock.PgxPoolIface, operationId int64, attempt int, status string, result []byte, errMsg *string) {
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE operations SET status = (.+), result = COALESCE\\((.+)\\), (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(status, result, errMsg, operationId, attempt).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mockDBPool.ExpectCommit()
+}
+
+// expectDeleteItems expects the deletion of itemIds, of which deleted exist
+func expectDeleteItems(mockDBPool pgxmock.PgxPoolIface, itemIds []int, deleted ...int) {
+	expectTenantTx(mockDBPool, mockTenant)
+	rows := mockDBPool.NewRows([]string{"id", "uuid", "created_at", "name", "price"})
+	for _, itemId := range deleted {
+		rows.AddRow(itemId, "550e8400-e29b-41d4-a716-446655440000", mockOperationCreatedAt, "pi", float32(3.14))
+	}
+	mockDBPool.ExpectQuery("DELETE FROM item WHERE tenant_id = (.+) AND id = ANY\\((.+)\\) RETURNING (.+)").
+		WithArgs(mockTenant, itemIds).
+		WillReturnRows(rows)
+	for range deleted {
+		expectItemChange(mockDBPool, mockTenant, models.WebhookEventItemDeleted)
+	}
+	mockDBPool.ExpectCommit()
+}
+
+func runMockOperations(t *testing.T, mockDBPool pgxmock.PgxPoolIface) {
+	t.Helper()
+	runner := operations.NewRunner(mockDBPool, getMockOperationsConfig())
+	if _, err := runner.RunDue(context.Background()); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	runner.Wait()
+}
+
+// TESTS
+
+func TestImportItemsAsyncQueuesOperation(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO operations (.+) VALUES (.+) RETURNING (.+)").
+		WithArgs(mockTenant, models.OperationItemImport, []byte(mockImportInput), 3).
+		WillReturnRows(getOperationRows(mockDBPool, mockImportOperation))
+	mockDBPool.ExpectCommit()
+	body := "name,price\n" +
+		"pi,3.14\n" +
+		"e,2.71\n" +
+		"tree-fiddy,3.50\n" +
+		"free,\n"
+	w := performImportRequest(t, getHandler(t, deps), "/items/import/async", "text/csv", body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != "/operations/1" {
+		t.Errorf("Expected Location /operations/1, but got %q", location)
+	}
+	expectedBody := `{"data":{"id":1,"type":"item.import","status":"queued","progress":0,"processed":0,"total":3,` +
+		`"error":null,"created_at":"2021-01-01T00:00:00Z","updated_at":"2021-01-01T00:00:00Z","finished_at":null}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestImportItemsAsyncRejectsInvalidFile(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	w := performImportRequest(t, getHandler(t, deps), "/items/import/async", "text/csv", "title,cost\npi,3.14\n")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestBulkDeleteItemsQueuesOperation(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	// repeated ids count once
+	mockDBPool.ExpectQuery("INSERT INTO operations (.+) VALUES (.+) RETURNING (.+)").
+		WithArgs(mockTenant, models.OperationItemBulkDelete, []byte(`{"ids":[1,2,3]}`), 3).
+		WillReturnRows(getOperationRows(mockDBPool, mockBulkDeleteOperation))
+	mockDBPool.ExpectCommit()
+	req, _ := http.NewRequest("POST", "/items/bulk-delete", strings.NewReader(`{"data":{"ids":[1,2,1,3]}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+getTenantToken(t, mockTenant, "items:delete"))
+	w := httptest.NewRecorder()
+	getHandler(t, deps).ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != "/operations/2" {
+		t.Errorf("Expected Location /operations/2, but got %q", location)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestBulkDeleteItemsRequiresDeleteScope(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	req, _ := http.NewRequest("POST", "/items/bulk-delete", strings.NewReader(`{"data":{"ids":[1]}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	w := httptest.NewRecorder()
+	getHandler(t, deps).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestGetOperationWithProgress(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	operation := mockImportOperation
+	operation.Status = models.OperationRunning
+	operation.Processed = 2
+	operation.Result = json.RawMessage(`{"inserted":1,"updated":1,"skipped":0,"errors":[{"line":5,"error":"invalid price"}]}`)
+	expectFetchOperation(mockDBPool, 1, operation)
+	w := performRequest(getHandler(t, deps), "GET", "/operations/1", map[string]string{
+		"Authorization": "Bearer " + getMockToken(t),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"id":1,"type":"item.import","status":"running","progress":66,"processed":2,"total":3,` +
+		`"result":{"inserted":1,"updated":1,"skipped":0,"errors":[{"line":5,"error":"invalid price"}]},` +
+		`"error":null,"created_at":"2021-01-01T00:00:00Z","updated_at":"2021-01-01T00:00:00Z","finished_at":null}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestGetOperationNotFound(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectFetchOperation(mockDBPool, 7)
+	w := performRequest(getHandler(t, deps), "GET", "/operations/7", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getMockToken(t),
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	expectedBody := `{"error":"Operation not found","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestCancelOperation(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	finishedAt := mockOperationCreatedAt.Add(time.Minute)
+	canceled := mockBulkDeleteOperation
+	canceled.Status = models.OperationCanceled
+	canceled.UpdatedAt = finishedAt
+	canceled.FinishedAt = &finishedAt
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT status FROM operations WHERE id = (.+) AND tenant_id = (.+) FOR UPDATE").
+		WithArgs(int64(2), mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"status"}).AddRow(models.OperationRunning))
+	mockDBPool.ExpectQuery("UPDATE operations SET status = (.+) WHERE id = (.+) RETURNING (.+)").
+		WithArgs(models.OperationCanceled, int64(2)).
+		WillReturnRows(getOperationRows(mockDBPool, canceled))
+	mockDBPool.ExpectCommit()
+	w := performRequest(getHandler(t, deps), "DELETE", "/operations/2", map[string]string{
+		"Authorization": "Bearer " + getMockToken(t),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":{"id":2,"type":"item.bulk_delete","status":"canceled","progress":0,"processed":0,"total":3,` +
+		`"error":null,"created_at":"2021-01-01T00:00:00Z","updated_at":"2021-01-01T00:01:00Z","finished_at":"2021-01-01T00:01:00Z"}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestCancelFinishedOperationReturns409(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT status FROM operations WHERE id = (.+) AND tenant_id = (.+) FOR UPDATE").
+		WithArgs(int64(2), mockTenant).
+		WillReturnRows(mockDBPool.NewRows([]string{"status"}).AddRow(models.OperationSucceeded))
+	mockDBPool.ExpectRollback()
+	w := performRequest(getHandler(t, deps), "DELETE", "/operations/2", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getMockToken(t),
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, but got %d", http.StatusConflict, w.Code)
+	}
+	expectedBody := `{"error":"Operation already finished","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerImportsInChunks(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimOperations(mockDBPool, 2, mockImportOperation)
+	expectImport(mockDBPool, "DO UPDATE", true, false)
+	expectOperationProgress(mockDBPool, 1, 1, 2,
+		`{"inserted":1,"updated":1,"skipped":0,"errors":[{"line":5,"error":"invalid price"}]}`, true)
+	expectImport(mockDBPool, "DO UPDATE", true)
+	result := `{"inserted":2,"updated":1,"skipped":0,"errors":[{"line":5,"error":"invalid price"}]}`
+	expectOperationProgress(mockDBPool, 1, 1, 3, result, true)
+	expectFinishOperation(mockDBPool, 1, 1, models.OperationSucceeded, []byte(result), nil)
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerResumesBulkDelete(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// another worker deleted 1 and 2 before its lease expired
+	operation := mockBulkDeleteOperation
+	operation.Status = models.OperationRunning
+	operation.Attempts = 1
+	operation.Processed = 2
+	operation.Result = json.RawMessage(`{"deleted":1,"not_found":[2]}`)
+	expectClaimOperations(mockDBPool, 2, operation)
+	expectDeleteItems(mockDBPool, []int{3})
+	result := `{"deleted":1,"not_found":[2,3]}`
+	expectOperationProgress(mockDBPool, 2, 2, 3, result, true)
+	expectFinishOperation(mockDBPool, 2, 2, models.OperationSucceeded, []byte(result), nil)
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerStopsCanceledOperation(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimOperations(mockDBPool, 2, mockBulkDeleteOperation)
+	expectDeleteItems(mockDBPool, []int{1, 2}, 1, 2)
+	// canceled meanwhile, so 3 is left alone and nothing is finished
+	expectOperationProgress(mockDBPool, 2, 1, 2, `{"deleted":2,"not_found":[]}`, false)
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerStopsOnLeaseLost(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimOperations(mockDBPool, 2, mockBulkDeleteOperation)
+	expectDeleteItems(mockDBPool, []int{1, 2}, 1, 2)
+	// the lease expired and another worker claimed the operation meanwhile,
+	// so 3 is left to it and nothing is finished
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectExec("UPDATE operations SET processed = (.+) WHERE id = (.+) AND status = 'running' AND attempts = (.+)").
+		WithArgs(2, []byte(`{"deleted":2,"not_found":[]}`), float64(60), int64(2), 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	expectOperationAttempts(mockDBPool, 2, 2)
+	mockDBPool.ExpectRollback()
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerFailsOperationOutOfAttempts(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// its worker died on the last attempt, so it is not run again
+	operation := mockBulkDeleteOperation
+	operation.Status = models.OperationRunning
+	operation.Attempts = 3
+	expectClaimOperations(mockDBPool, 2, operation)
+	errMsg := operations.ErrorLeaseExpired.Error()
+	expectFinishOperation(mockDBPool, 2, 4, models.OperationFailed, nil, &errMsg)
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestRunnerRecordsFailure(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	expectClaimOperations(mockDBPool, 2, mockBulkDeleteOperation)
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("DELETE FROM item WHERE tenant_id = (.+) AND id = ANY\\((.+)\\) RETURNING (.+)").
+		WithArgs(mockTenant, []int{1, 2}).
+		WillReturnError(pgx.ErrTxClosed)
+	mockDBPool.ExpectRollback()
+	errMsg := "Error deleting Item"
+	expectFinishOperation(mockDBPool, 2, 1, models.OperationFailed, nil, &errMsg)
+	runMockOperations(t, mockDBPool)
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestWaitPollsUntilFinished(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	running := mockBulkDeleteOperation
+	running.Status = models.OperationRunning
+	running.Processed = 2
+	running.Result = json.RawMessage(`{"deleted":2,"not_found":[]}`)
+	finishedAt := mockOperationCreatedAt.Add(time.Minute)
+	succeeded := running
+	succeeded.Status = models.OperationSucceeded
+	succeeded.Processed = 3
+	succeeded.Result = json.RawMessage(`{"deleted":2,"not_found":[3]}`)
+	succeeded.FinishedAt = &finishedAt
+	expectFetchOperation(mockDBPool, 2, running)
+	expectFetchOperation(mockDBPool, 2, succeeded)
+	server := httptest.NewServer(getHandler(t, deps))
+	defer server.Close()
+	client, err := ogen.NewClient(server.URL, &operationTokenSource{token: getMockToken(t)})
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+	var progress []int
+	operation, err := operations.Wait(context.Background(), client, 2, time.Millisecond, func(operation *ogen.Operation) {
+		progress = append(progress, operation.Progress)
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if len(progress) != 2 || progress[0] != 66 || progress[1] != 100 {
+		t.Errorf("Expected progress [66 100], but got %v", progress)
+	}
+	report, ok := operation.Result.Value.GetBulkDeleteReport()
+	if operation.Status != ogen.OperationStatusSucceeded || !ok || report.Deleted != 2 || len(report.NotFound) != 1 {
+		t.Errorf("Expected a succeeded bulk delete of 2 Items, but got %+v", operation)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
@@ -0,0 +1,288 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"example-server/internal/middleware"
+	"example-server/internal/openapi"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/ratelimit"
+)
+
+const mockRateLimits = `
+default:
+  rate: 2
+  period: 1m
+operations:
+  Ping:
+    rate: 3
+    period: 1m
+`
+
+// HELPERS
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+// getRateLimitHandler serves the items API without dependencies; requests
+// carry no tenant, so the ones let through by the limiter end in a 400
+func getRateLimitHandler(t *testing.T, store ratelimit.Store, config string) http.Handler {
+	t.Helper()
+	limits, err := ratelimit.ParseConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("Failed to parse limits: %s", err)
+	}
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	service := &openapi.ItemsService{}
+	limiter := ratelimit.NewLimiter(store, limits)
+	server, err := ogen.NewServer(
+		service,
+		getMockSecurityHandler(t),
+		ogen.WithMiddleware(
+			openapi.RateLimitMiddleware(limiter, trusted),
+			openapi.TenantMiddleware,
+		),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %s", err)
+	}
+	return middleware.RequestID(openapi.ClientIPRateLimit(ratelimit.WithResponseHeader(server), server, service, limiter, trusted))
+}
+
+func getSubjectToken(t *testing.T, subject string) string {
+	t.Helper()
+	claims := getMockClaims()
+	claims["sub"] = subject
+	// without a tenant requests stop with a 403 once rate limited
+	delete(claims, "tenant_id")
+	return signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", claims)
+}
+
+func performRequestFrom(h http.Handler, path, remoteAddr string, headers map[string]string) int {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+// TESTS
+
+func TestRateLimitRejectsWith429(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	headers := map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getSubjectToken(t, "user-1"),
+	}
+	for i := 0; i < 2; i++ {
+		w := performRequest(h, "GET", "/items/1", headers)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+		}
+		if w.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Expected RateLimit-Limit 2, but got %q", w.Header().Get("RateLimit-Limit"))
+		}
+	}
+	w := performRequest(h, "GET", "/items/1", headers)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	expectedBody := `{"error":"too many requests","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	expectedHeaders := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "30",
+	}
+	for header, expected := range expectedHeaders {
+		if w.Header().Get(header) != expected {
+			t.Errorf("Expected %s %q, but got %q", header, expected, w.Header().Get(header))
+		}
+	}
+}
+
+func TestRateLimitSeparatesClients(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	for _, subject := range []string{"user-1", "user-2"} {
+		headers := map[string]string{"Authorization": "Bearer " + getSubjectToken(t, subject)}
+		for i := 0; i < 2; i++ {
+			if code := performRequestFrom(h, "/items/1", "192.0.2.1:1234", headers); code != http.StatusForbidden {
+				t.Errorf("Expected status code %d for %s, but got %d", http.StatusForbidden, subject, code)
+			}
+		}
+		if code := performRequestFrom(h, "/items/1", "192.0.2.1:1234", headers); code != http.StatusTooManyRequests {
+			t.Errorf("Expected status code %d for %s, but got %d", http.StatusTooManyRequests, subject, code)
+		}
+	}
+}
+
+func TestRateLimitOperationOverrides(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), mockRateLimits)
+	for i := 0; i < 3; i++ {
+		if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, code)
+		}
+	}
+	if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, but got %d", http.StatusTooManyRequests, code)
+	}
+	if code := performRequestFrom(h, "/ping", "192.0.2.2:1234", nil); code != http.StatusOK {
+		t.Errorf("Expected another IP to have its own bucket, but got %d", code)
+	}
+}
+
+func TestRateLimitRefillsBucket(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), "default: {rate: 20, period: 1s, burst: 1}")
+	if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, code)
+	}
+	if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusOK {
+		t.Errorf("Expected refilled bucket to allow request, but got %d", code)
+	}
+}
+
+func TestRateLimitLimitsFailedAuthenticationByIP(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), mockRateLimits+"client_ip: {rate: 3, period: 1m}\n")
+	headers := map[string]string{"Authorization": "Bearer not-a-token"}
+	for i := 0; i < 3; i++ {
+		if code := performRequestFrom(h, "/items/1", "192.0.2.1:1234", headers); code != http.StatusUnauthorized {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusUnauthorized, code)
+		}
+	}
+	req, _ := http.NewRequest("GET", "/items/1", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusTooManyRequests, w.Code)
+	}
+	expectedBody := `{"error":"too many requests","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "20" {
+		t.Errorf("Expected Retry-After 20, but got %q", w.Header().Get("Retry-After"))
+	}
+	// valid credentials from the same IP are limited too
+	valid := map[string]string{"Authorization": "Bearer " + getSubjectToken(t, "user-1")}
+	if code := performRequestFrom(h, "/items/1", "192.0.2.1:1234", valid); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code %d, but got %d", http.StatusTooManyRequests, code)
+	}
+	if code := performRequestFrom(h, "/items/1", "192.0.2.2:1234", headers); code != http.StatusUnauthorized {
+		t.Errorf("Expected another IP to have its own bucket, but got %d", code)
+	}
+}
+
+func TestClientIPRateLimitSkipsUnlimitedOperations(t *testing.T) {
+	h := getRateLimitHandler(t, ratelimit.NewMemoryStore(), "operations: {Ping: {rate: 0}}\nclient_ip: {rate: 1, period: 1m}\n")
+	for i := 0; i < 3; i++ {
+		if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusOK {
+			t.Errorf("Expected status code %d, but got %d", http.StatusOK, code)
+		}
+	}
+}
+
+func TestRateLimitFailsOpenOnStoreErrors(t *testing.T) {
+	h := getRateLimitHandler(t, failingStore{}, mockRateLimits)
+	for i := 0; i < 5; i++ {
+		if code := performRequestFrom(h, "/ping", "192.0.2.1:1234", nil); code != http.StatusOK {
+			t.Errorf("Expected status code %d, but got %d", http.StatusOK, code)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"untrusted proxy", "192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"spoofed hops", "10.0.0.1:1234", "203.0.113.9, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{"only proxies", "10.0.0.1:1234", "10.0.0.2", "10.0.0.2"},
+		{"no header", "10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if ip := ratelimit.ClientIP(req, trusted); ip != tt.expected {
+			t.Errorf("%s: expected %s, but got %s", tt.name, tt.expected, ip)
+		}
+	}
+}
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	proxies, err := ratelimit.TrustedProxiesFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %s", err)
+	}
+	if len(proxies) != 2 || proxies[1].String() != "192.0.2.1/32" {
+		t.Errorf("Unexpected trusted proxies %v", proxies)
+	}
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if _, err := ratelimit.TrustedProxiesFromEnv(); !errors.Is(err, ratelimit.ErrorInvalidProxy) {
+		t.Errorf("Expected ErrorInvalidProxy, but got %v", err)
+	}
+}
+
+func TestDefaultRateLimitsParse(t *testing.T) {
+	t.Setenv("RATE_LIMIT_FILE", "")
+	limits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to load default limits: %s", err)
+	}
+	if limits.Default.Unlimited() {
+		t.Errorf("Expected a default limit")
+	}
+	if !limits.LimitFor(string(ogen.PingOperation)).Unlimited() {
+		t.Errorf("Expected Ping to be unlimited")
+	}
+	if limits.ClientIP.Unlimited() {
+		t.Errorf("Expected a client IP limit")
+	}
+}
+
+func TestParseRateLimitsRejectsInvalidFiles(t *testing.T) {
+	configs := map[string]string{
+		"malformed":       "default: [",
+		"negative burst":  "default: {rate: 10, burst: -1}",
+		"negative period": "operations: {GetItem: {rate: 10, period: -1s}}",
+		"negative client": "client_ip: {rate: 10, burst: -1}",
+	}
+	for name, config := range configs {
+		if _, err := ratelimit.ParseConfig([]byte(config)); !errors.Is(err, ratelimit.ErrorInvalidLimit) {
+			t.Errorf("%s: expected ErrorInvalidLimit, but got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"example-server/internal/logger"
+	"example-server/internal/openapi/ogen"
+)
+
+// MOCKS
+
+type mockCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Pin      string `json:"pin" log:"redact"`
+	Note     string `json:"note,omitempty"`
+}
+
+// HELPERS
+
+// getRedactLogger returns a logger without timestamps so lines can be snapshotted
+func getRedactLogger(t *testing.T) (zerolog.Logger, *bytes.Buffer) {
+	t.Helper()
+	original := zerolog.InterfaceMarshalFunc
+	zerolog.InterfaceMarshalFunc = logger.MarshalRedacted
+	t.Cleanup(func() { zerolog.InterfaceMarshalFunc = original })
+	var buf bytes.Buffer
+	return zerolog.New(logger.NewRedactWriter(&buf)), &buf
+}
+
+// TESTS
+
+func TestRedactSnapshots(t *testing.T) {
+	testCases := []struct {
+		name     string
+		log      func(l zerolog.Logger)
+		expected string
+	}{
+		{
+			name:     "untouched line keeps field order",
+			log:      func(l zerolog.Logger) { l.Info().Str("name", "pi").Float32("price", 3.14).Msg("Item created") },
+			expected: `{"level":"info","name":"pi","price":3.14,"message":"Item created"}`,
+		},
+		{
+			name: "denied fields",
+			log: func(l zerolog.Logger) {
+				l.Info().Str("Authorization", "Bearer abc.def").Str("api_key", "k1").Msg("headers")
+			},
+			expected: `{"level":"info","Authorization":"[REDACTED]","api_key":"[REDACTED]","message":"headers"}`,
+		},
+		{
+			name: "DSN password in error",
+			log: func(l zerolog.Logger) {
+				l.Error().Err(errors.New("cannot parse `postgres://app:s3cret@db:5432/items`")).Msg("Failed to parse database config")
+			},
+			expected: "{\"level\":\"error\",\"error\":\"cannot parse `postgres://app:[REDACTED]@db:5432/items`\",\"message\":\"Failed to parse database config\"}",
+		},
+		{
+			name:     "keyword DSN password in message",
+			log:      func(l zerolog.Logger) { l.Warn().Msg("connect host=db user=app password=s3cret dbname=items") },
+			expected: `{"level":"warn","message":"connect host=db user=app password=[REDACTED] dbname=items"}`,
+		},
+		{
+			name: "credentials in nested value",
+			log: func(l zerolog.Logger) {
+				l.Info().Interface("headers", map[string]string{"X-Forwarded": "Basic dXNlcjpwYXNz"}).Msg("request")
+			},
+			expected: `{"level":"info","headers":{"X-Forwarded":"Basic [REDACTED]"},"message":"request"}`,
+		},
+		{
+			name: "struct tags and denied struct fields",
+			log: func(l zerolog.Logger) {
+				l.Info().Interface("credentials", mockCredentials{Username: "app", Password: "s3cret", Pin: "1234"}).Msg("login")
+			},
+			expected: `{"level":"info","credentials":{"password":"[REDACTED]","pin":"[REDACTED]","username":"app"},"message":"login"}`,
+		},
+		{
+			name: "redacted line keeps field order, numbers and HTML characters",
+			log: func(l zerolog.Logger) {
+				l.Info().Uint64("id", 9007199254740993).Str("token", "abc").Float64("ratio", 1e-7).
+					Str("query", "a < b && c > d").Msg("connect postgres://app:s3cret@db/items")
+			},
+			expected: `{"level":"info","id":9007199254740993,"token":"[REDACTED]","ratio":1e-7,"query":"a < b && c > d","message":"connect postgres://app:[REDACTED]@db/items"}`,
+		},
+		{
+			name: "credentials in array",
+			log: func(l zerolog.Logger) {
+				l.Info().Strs("headers", []string{"Accept: */*", "Authorization: Bearer abc.def"}).Int("n", 2).Msg("headers")
+			},
+			expected: `{"level":"info","headers":["Accept: */*","Authorization: Bearer [REDACTED]"],"n":2,"message":"headers"}`,
+		},
+		{
+			name:     "allowed fields are verbatim",
+			log:      func(l zerolog.Logger) { l.Info().Str("request_id", "password=abc").Msg("allowed") },
+			expected: `{"level":"info","request_id":"password=abc","message":"allowed"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, buf := getRedactLogger(t)
+			tc.log(l)
+			if actual := strings.TrimSpace(buf.String()); actual != tc.expected {
+				t.Errorf("Expected %s, but got %s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRedactConfiguredFields(t *testing.T) {
+	t.Setenv("LOG_REDACT_FIELDS", "email")
+	t.Setenv("LOG_REDACT_ALLOW", "note")
+	l, buf := getRedactLogger(t)
+	l.Info().Str("email", "a@b.c").Str("note", "password=visible").Msg("configured")
+	expected := `{"level":"info","email":"[REDACTED]","note":"password=visible","message":"configured"}`
+	if actual := strings.TrimSpace(buf.String()); actual != expected {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestRedactAllowListIgnoresCase(t *testing.T) {
+	t.Setenv("LOG_REDACT_ALLOW", "Client-Note")
+	l, buf := getRedactLogger(t)
+	l.Info().Str("client_note", "password=visible").Str("Request-ID", "password=abc").Msg("allowed")
+	expected := `{"level":"info","client_note":"password=visible","Request-ID":"password=abc","message":"allowed"}`
+	if actual := strings.TrimSpace(buf.String()); actual != expected {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestRedactAppliesToNewLogger(t *testing.T) {
+	for _, format := range []string{logger.FormatJSON, logger.FormatConsole} {
+		var buf bytes.Buffer
+		t.Setenv("LOG_FORMAT", format)
+		l := logger.NewLogger(&buf)
+		l.Error().Str("token", "abc").Msg("connect postgres://app:s3cret@db/items")
+		if strings.Contains(buf.String(), "s3cret") || strings.Contains(buf.String(), "abc") {
+			t.Errorf("Expected %s output to be redacted, but got %s", format, buf.String())
+		}
+	}
+}
+
+func TestRedactOgenRequestSnapshot(t *testing.T) {
+	l, buf := getRedactLogger(t)
+	req := &ogen.ItemCreateRequest{Data: ogen.ItemIn{Name: "postgres://app:s3cret@db/items", Price: 3.14}}
+	l.Info().Interface("ItemCreateRequest", req).Msg("Handling item create request")
+	expected := `{"level":"info","ItemCreateRequest":{"data":{"name":"postgres://app:[REDACTED]@db/items","price":3.14}},"message":"Handling item create request"}`
+	if actual := strings.TrimSpace(buf.String()); actual != expected {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+}
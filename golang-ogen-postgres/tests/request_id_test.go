@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/middleware"
+	"example-server/internal/openapi"
+	"example-server/internal/openapi/ogen"
+)
+
+// MOCKS
+
+const mockTenant = "tenant-a"
+
+// HELPERS
+
+func getMockDependencies() (*dependencies.Dependencies, pgxmock.PgxPoolIface) {
+	// setup mock dependencies
+	mockDBPool, err := pgxmock.NewPool()
+	if err != nil {
+		panic(err)
+	}
+	deps := dependencies.NewDependencies(
+		mockDBPool,
+		nil,
+		nil,
+	)
+	return deps, mockDBPool
+}
+
+// getHandler returns the ogen server wrapped in the request ID and access log
+// middleware, accepting getMockToken tokens and the API keys of deps
+func getHandler(t *testing.T, deps *dependencies.Dependencies) http.Handler {
+	t.Helper()
+	security := getMockSecurityHandler(t)
+	if deps != nil {
+		security.APIKeys = deps.APIKeys
+	}
+	server, err := ogen.NewServer(
+		&openapi.ItemsService{Deps: deps},
+		security,
+		ogen.WithErrorHandler(openapi.ErrorHandler),
+		ogen.WithMiddleware(openapi.TenantMiddleware),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %s", err)
+	}
+	return middleware.RequestID(middleware.AccessLog(server, server))
+}
+
+// expectTenantTx expects the transaction and tenant setting every Item query runs in
+func expectTenantTx(mockDBPool pgxmock.PgxPoolIface, tenantID string) {
+	mockDBPool.ExpectBegin()
+	mockDBPool.ExpectExec("SELECT set_config\\('app.tenant_id', (.+), true\\)").
+		WithArgs(tenantID).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+}
+
+// expectWebhookEnqueue expects the webhook deliveries written along with an
+// Item change
+func expectWebhookEnqueue(mockDBPool pgxmock.PgxPoolIface, tenantID, event string) {
+	mockDBPool.ExpectExec("INSERT INTO webhook_deliveries (.+) SELECT (.+) FROM webhook_subscriptions").
+		WithArgs(tenantID, event, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+}
+
+// expectItemChange expects what an Item change writes in its transaction:
+// webhook deliveries and the outbox event
+func expectItemChange(mockDBPool pgxmock.PgxPoolIface, tenantID, event string) {
+	expectWebhookEnqueue(mockDBPool, tenantID, event)
+	mockDBPool.ExpectExec("INSERT INTO outbox (.+) VALUES (.+)").
+		WithArgs(tenantID, "item", pgxmock.AnyArg(), event, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+}
+
+func performRequest(h http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// captureLogs redirects the global logger to a buffer for the test duration
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	original := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = original })
+	return &buf
+}
+
+func parseLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, raw := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]interface{}
+		if err := json.Unmarshal(raw, &line); err != nil {
+			t.Fatalf("Failed to parse log line %s: %s", raw, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// TESTS
+
+func TestRequestIdGeneratedWhenMissing(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "GET", "/ping", nil)
+	requestId := w.Header().Get(middleware.RequestIdHeader)
+	if _, err := uuid.Parse(requestId); err != nil {
+		t.Errorf("Expected generated UUID request id, but got %q", requestId)
+	}
+}
+
+func TestRequestIdEchoedInHeaderAndErrorBody(t *testing.T) {
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
+	// exec request
+	h := getHandler(t, deps)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getMockToken(t),
+	})
+	// assert header and error body
+	if requestId := w.Header().Get(middleware.RequestIdHeader); requestId != "abc-123" {
+		t.Errorf("Expected request id abc-123, but got %q", requestId)
+	}
+	expectedBody := `{"error":"Error querying Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestRequestIdOnHandlerRepoAndAccessLogLines(t *testing.T) {
+	buf := captureLogs(t)
+	// setup mock dependencies and DB query expectations
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnError(&pgconn.PgError{Code: "12345"})
+	mockDBPool.ExpectRollback()
+	// exec request
+	h := getHandler(t, deps)
+	performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getMockToken(t),
+	})
+	// assert every line carries the request id
+	lines := parseLogLines(t, buf)
+	var accessLog map[string]interface{}
+	messages := map[string]bool{}
+	for _, line := range lines {
+		if line["request_id"] != "abc-123" {
+			t.Errorf("Expected request_id abc-123 on %v", line)
+		}
+		messages[line["message"].(string)] = true
+		if line["message"] == "Request served" {
+			accessLog = line
+		}
+	}
+	for _, msg := range []string{"Handling item get request", "Error querying Item", "Request served"} {
+		if !messages[msg] {
+			t.Errorf("Expected a %q log line, but got %v", msg, lines)
+		}
+	}
+	// assert access log fields
+	if accessLog == nil {
+		t.Fatalf("Expected an access log line")
+	}
+	expected := map[string]interface{}{
+		"level":  "error",
+		"method": "GET",
+		"route":  "/items/{itemId}",
+		"path":   "/items/1",
+		"status": float64(http.StatusInternalServerError),
+	}
+	for key, value := range expected {
+		if accessLog[key] != value {
+			t.Errorf("Expected access log %s=%v, but got %v", key, value, accessLog[key])
+		}
+	}
+	for _, key := range []string{"latency", "bytes", "client_ip"} {
+		if _, ok := accessLog[key]; !ok {
+			t.Errorf("Expected access log field %s", key)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"example-server/internal/admin"
+	"example-server/internal/database"
+	"example-server/internal/models"
+	"example-server/internal/scheduler"
+)
+
+// MOCKS
+
+const mockTaskName = "test.task"
+
+var mockTaskRunAt = time.Date(2021, time.January, 1, 3, 0, 0, 0, time.UTC)
+
+// HELPERS
+
+func getScheduledTaskRows(mockDBPool pgxmock.PgxPoolIface, tasks ...models.ScheduledTask) *pgxmock.Rows {
+	rows := mockDBPool.NewRows([]string{
+		"name", "schedule", "next_run_at", "last_run_at", "last_duration_ms", "last_outcome", "last_error", "updated_at",
+	})
+	for _, task := range tasks {
+		rows.AddRow(
+			task.Name, task.Schedule, task.NextRunAt, task.LastRunAt, task.LastDurationMs,
+			task.LastOutcome, task.LastError, task.UpdatedAt,
+		)
+	}
+	return rows
+}
+
+// getMockScheduler schedules run as mockTaskName every day at 03:00
+func getMockScheduler(t *testing.T, mockDBPool pgxmock.PgxPoolIface, reg *prometheus.Registry, run scheduler.Func) *scheduler.Scheduler {
+	t.Helper()
+	config, err := scheduler.ParseConfig([]byte("tasks:\n  " + mockTaskName + ": {schedule: \"0 3 * * *\", timeout: 1s}\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %s", err)
+	}
+	s, err := scheduler.New(mockDBPool, config, map[string]scheduler.Func{mockTaskName: run}, scheduler.NewMetrics(reg))
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %s", err)
+	}
+	return s
+}
+
+// expectScheduledTaskLock expects the task's advisory lock to be tried, and
+// taken unless another replica holds it
+func expectScheduledTaskLock(mockDBPool pgxmock.PgxPoolIface, locked bool) {
+	expectAllTenantsTx(mockDBPool)
+	mockDBPool.ExpectQuery("SELECT pg_try_advisory_xact_lock\\((.+)\\)").
+		WithArgs(database.ScheduledTaskLock(mockTaskName)).
+		WillReturnRows(mockDBPool.NewRows([]string{"locked"}).AddRow(locked))
+}
+
+// expectScheduledTaskState expects the locked task's state to be read
+func expectScheduledTaskState(mockDBPool pgxmock.PgxPoolIface, nextRunAt time.Time) {
+	mockDBPool.ExpectQuery("SELECT (.+) FROM scheduled_tasks WHERE name = (.+)").
+		WithArgs(mockTaskName).
+		WillReturnRows(getScheduledTaskRows(mockDBPool, models.ScheduledTask{
+			Name:      mockTaskName,
+			Schedule:  "0 3 * * *",
+			NextRunAt: nextRunAt,
+			UpdatedAt: nextRunAt,
+		}))
+}
+
+// expectScheduledTaskRun expects the outcome of a run to be recorded
+func expectScheduledTaskRun(mockDBPool pgxmock.PgxPoolIface, nextRunAt time.Time, outcome string, errMsg *string) {
+	durationMs := int64(10)
+	mockDBPool.ExpectQuery("UPDATE scheduled_tasks SET next_run_at = (.+) WHERE name = (.+) RETURNING (.+)").
+		WithArgs(mockTaskName, pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), outcome, errMsg).
+		WillReturnRows(getScheduledTaskRows(mockDBPool, models.ScheduledTask{
+			Name:           mockTaskName,
+			Schedule:       "0 3 * * *",
+			NextRunAt:      nextRunAt,
+			LastRunAt:      &mockTaskRunAt,
+			LastDurationMs: &durationMs,
+			LastOutcome:    &outcome,
+			LastError:      errMsg,
+			UpdatedAt:      mockTaskRunAt,
+		}))
+}
+
+// TESTS
+
+func TestScheduleNext(t *testing.T) {
+	// a Friday
+	from := time.Date(2021, time.January, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.January, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.January, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, time.January, 2, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * mar-may mon-fri", time.Date(2021, time.March, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 12 1-5/2 * *", time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)},
+		{"5,10 10 * * *", time.Date(2021, time.January, 1, 10, 10, 0, 0, time.UTC)},
+		// either day field matches when both are restricted
+		{"0 0 15 * mon", time.Date(2021, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := scheduler.ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("Expected %q to parse, but got %s", test.spec, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(test.expected) {
+			t.Errorf("Expected %q to run next at %s, but got %s", test.spec, test.expected, next)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "0 0 * foo *", "@sometimes"} {
+		if _, err := scheduler.ParseSchedule(spec); !errors.Is(err, scheduler.ErrorInvalidSchedule) {
+			t.Errorf("Expected %s for %q, but got %v", scheduler.ErrorInvalidSchedule, spec, err)
+		}
+	}
+}
+
+func TestParseScheduleConfig(t *testing.T) {
+	config, err := scheduler.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("Expected the built-in schedules to parse, but got %s", err)
+	}
+	_, mockDBPool := getMockDependencies()
+	if _, err := scheduler.New(mockDBPool, config, scheduler.Tasks(mockDBPool), scheduler.NewMetrics(prometheus.NewRegistry())); err != nil {
+		t.Errorf("Expected the built-in schedules to name known tasks, but got %s", err)
+	}
+	if _, err := scheduler.ParseConfig([]byte(`tasks: {test.task: {schedule: "0 0 31 2 *"}}`)); !errors.Is(err, scheduler.ErrorInvalidConfig) {
+		t.Errorf("Expected %s for a schedule that never runs, but got %v", scheduler.ErrorInvalidConfig, err)
+	}
+	config, _ = scheduler.ParseConfig([]byte(`tasks: {unknown.task: {schedule: "@daily"}}`))
+	if _, err := scheduler.New(mockDBPool, config, scheduler.Tasks(mockDBPool), scheduler.NewMetrics(prometheus.NewRegistry())); !errors.Is(err, scheduler.ErrorUnknownTask) {
+		t.Errorf("Expected %s, but got %v", scheduler.ErrorUnknownTask, err)
+	}
+}
+
+func TestSchedulerRunsDueTask(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	reg := prometheus.NewRegistry()
+	expectScheduledTaskLock(mockDBPool, true)
+	expectScheduledTaskState(mockDBPool, mockTaskRunAt)
+	nextRunAt := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	expectScheduledTaskRun(mockDBPool, nextRunAt, models.ScheduledTaskSucceeded, nil)
+	mockDBPool.ExpectCommit()
+	runs := 0
+	s := getMockScheduler(t, mockDBPool, reg, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("Expected the task to run with a timeout")
+		}
+		runs++
+		return nil
+	})
+	if ran := s.RunDue(context.Background()); ran != 1 || runs != 1 {
+		t.Errorf("Expected the task to run once, but it ran %d times (reported %d)", runs, ran)
+	}
+	labels := map[string]string{"task": mockTaskName, "outcome": models.ScheduledTaskSucceeded}
+	if value := getMetricValue(t, reg, "scheduled_task_runs_total", labels); value != 1 {
+		t.Errorf("Expected 1 succeeded run, but got %v", value)
+	}
+	if value := getMetricValue(t, reg, "scheduled_task_next_run_timestamp_seconds", map[string]string{"task": mockTaskName}); value != float64(nextRunAt.Unix()) {
+		t.Errorf("Expected next run at %v, but got %v", nextRunAt.Unix(), value)
+	}
+	// not due again until the next run
+	if ran := s.RunDue(context.Background()); ran != 0 {
+		t.Errorf("Expected no run, but got %d", ran)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestSchedulerRecordsFailedRun(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	reg := prometheus.NewRegistry()
+	errMsg := "context deadline exceeded"
+	expectScheduledTaskLock(mockDBPool, true)
+	expectScheduledTaskState(mockDBPool, mockTaskRunAt)
+	expectScheduledTaskRun(mockDBPool, time.Now().Add(24*time.Hour), models.ScheduledTaskFailed, &errMsg)
+	mockDBPool.ExpectCommit()
+	s := getMockScheduler(t, mockDBPool, reg, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.RunDue(context.Background())
+	labels := map[string]string{"task": mockTaskName, "outcome": models.ScheduledTaskFailed}
+	if value := getMetricValue(t, reg, "scheduled_task_runs_total", labels); value != 1 {
+		t.Errorf("Expected 1 failed run, but got %v", value)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestSchedulerSkipsTaskRunByAnotherReplica(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	// another replica runs it right now
+	expectScheduledTaskLock(mockDBPool, false)
+	mockDBPool.ExpectCommit()
+	// then it has run
+	expectScheduledTaskLock(mockDBPool, true)
+	expectScheduledTaskState(mockDBPool, time.Now().Add(time.Hour))
+	mockDBPool.ExpectCommit()
+	s := getMockScheduler(t, mockDBPool, prometheus.NewRegistry(), func(ctx context.Context) error {
+		t.Error("Expected the task not to run")
+		return nil
+	})
+	for range 3 {
+		if ran := s.RunDue(context.Background()); ran != 0 {
+			t.Errorf("Expected no run, but got %d", ran)
+		}
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestSchedulerSyncKeepsRecordedNextRun(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	nextRunAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	mockDBPool.ExpectQuery("INSERT INTO scheduled_tasks (.+) ON CONFLICT (.+) RETURNING (.+)").
+		WithArgs(mockTaskName, "0 3 * * *", pgxmock.AnyArg()).
+		WillReturnRows(getScheduledTaskRows(mockDBPool, models.ScheduledTask{
+			Name:      mockTaskName,
+			Schedule:  "0 3 * * *",
+			NextRunAt: nextRunAt,
+			UpdatedAt: nextRunAt,
+		}))
+	reg := prometheus.NewRegistry()
+	s := getMockScheduler(t, mockDBPool, reg, func(ctx context.Context) error {
+		t.Error("Expected the task not to run")
+		return nil
+	})
+	s.Sync(context.Background())
+	if ran := s.RunDue(context.Background()); ran != 0 {
+		t.Errorf("Expected no run, but got %d", ran)
+	}
+	if value := getMetricValue(t, reg, "scheduled_task_next_run_timestamp_seconds", map[string]string{"task": mockTaskName}); value != float64(nextRunAt.Unix()) {
+		t.Errorf("Expected next run at %v, but got %v", nextRunAt.Unix(), value)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestPruneWebhookDeliveriesTaskEnqueuesJob(t *testing.T) {
+	_, mockDBPool := getMockDependencies()
+	uniqueKey := "scheduled"
+	mockDBPool.ExpectQuery("INSERT INTO jobs (.+) ON CONFLICT (.+) DO NOTHING RETURNING (.+)").
+		WithArgs("webhook.prune_deliveries", json.RawMessage(`{"retention_days":30}`), &uniqueKey, (*time.Time)(nil), 3).
+		WillReturnRows(getJobRows(mockDBPool))
+	// a prune still queued is fine
+	if err := scheduler.Tasks(mockDBPool)["webhook.prune_deliveries"](context.Background()); err != nil {
+		t.Errorf("Expected no error, but got %s", err)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestAdminGetScheduledTasks(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	durationMs := int64(120)
+	outcome := models.ScheduledTaskSucceeded
+	mockDBPool.ExpectQuery("SELECT (.+) FROM scheduled_tasks ORDER BY name").
+		WillReturnRows(getScheduledTaskRows(mockDBPool, models.ScheduledTask{
+			Name:           "webhook.prune_deliveries",
+			Schedule:       "0 3 * * *",
+			NextRunAt:      mockTaskRunAt.Add(24 * time.Hour),
+			LastRunAt:      &mockTaskRunAt,
+			LastDurationMs: &durationMs,
+			LastOutcome:    &outcome,
+			UpdatedAt:      mockTaskRunAt,
+		}))
+	w := performAdminRequest(admin.NewHandler(deps, mockAdminToken), "GET", "/admin/scheduled-tasks", mockAdminToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectedBody := `{"data":[{"name":"webhook.prune_deliveries","schedule":"0 3 * * *",` +
+		`"next_run_at":"2021-01-02T03:00:00Z","last_run_at":"2021-01-01T03:00:00Z","last_duration_ms":120,` +
+		`"last_outcome":"succeeded","last_error":null,"updated_at":"2021-01-01T03:00:00Z"}]}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example-server/internal/middleware"
+	"example-server/internal/openapi"
+	"example-server/internal/openapi/ogen"
+)
+
+// HELPERS
+
+func getSecurityHandler(t *testing.T, cors middleware.CORSConfig, maxBodyBytes int64) http.Handler {
+	t.Helper()
+	server, err := ogen.NewServer(
+		&openapi.ItemsService{},
+		getMockSecurityHandler(t),
+		ogen.WithErrorHandler(openapi.ErrorHandler),
+		ogen.WithMiddleware(openapi.TenantMiddleware),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create server: %s", err)
+	}
+	var handler http.Handler = server
+	handler = middleware.MaxBodySize(handler, maxBodyBytes)
+	handler = middleware.CORS(handler, cors)
+	handler = middleware.SecurityHeaders(handler, time.Hour)
+	return middleware.RequestID(handler)
+}
+
+func getMockCORSConfig() middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{middleware.RequestIdHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+func expectHeaders(t *testing.T, w *httptest.ResponseRecorder, expectedHeaders map[string]string) {
+	t.Helper()
+	for header, expected := range expectedHeaders {
+		if w.Header().Get(header) != expected {
+			t.Errorf("Expected %s %q, but got %q", header, expected, w.Header().Get(header))
+		}
+	}
+}
+
+func performBodyRequest(t *testing.T, h http.Handler, body string, chunked bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/items", strings.NewReader(body))
+	if chunked {
+		// Hide the length, as the server sees a chunked body
+		req.Body = io.NopCloser(strings.NewReader(body))
+		req.ContentLength = -1
+	}
+	req.Header.Set(middleware.RequestIdHeader, "abc-123")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// TESTS
+
+func TestCORSPreflightAllowedOrigin(t *testing.T) {
+	h := getSecurityHandler(t, getMockCORSConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "OPTIONS", "/items/1", map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "Authorization",
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNoContent, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	})
+}
+
+func TestCORSPreflightRejectsOtherOrigins(t *testing.T) {
+	h := getSecurityHandler(t, getMockCORSConfig(), middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "OPTIONS", "/items/1", map[string]string{
+		"Origin":                        "https://evil.example.com",
+		"Access-Control-Request-Method": "GET",
+		middleware.RequestIdHeader:      "abc-123",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"Origin not allowed","request_id":"abc-123"}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestCORSSimpleRequests(t *testing.T) {
+	config := getMockCORSConfig()
+	config.AllowCredentials = true
+	h := getSecurityHandler(t, config, middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "GET", "/ping", map[string]string{"Origin": "https://app.example.com"})
+	expectHeaders(t, w, map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    middleware.RequestIdHeader,
+		"Vary":                             "Origin",
+	})
+	w = performRequest(h, "GET", "/ping", map[string]string{"Origin": "https://evil.example.com"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin header for other origins")
+	}
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_MAX_AGE", "1h")
+	config := middleware.CORSConfigFromEnv()
+	if len(config.AllowedOrigins) != 1 || config.MaxAge != time.Hour {
+		t.Errorf("Unexpected CORS config %+v", config)
+	}
+	if config.AllowCredentials {
+		t.Errorf("Expected credentials to be ignored with a wildcard origin")
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := getSecurityHandler(t, middleware.CORSConfig{}, middleware.DefaultMaxBodyBytes)
+	w := performRequest(h, "GET", "/ping", nil)
+	expectHeaders(t, w, map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "no-referrer",
+		"Strict-Transport-Security": "max-age=3600; includeSubDomains",
+	})
+}
+
+func TestMaxBodySizeRejectsDeclaredLength(t *testing.T) {
+	h := getSecurityHandler(t, middleware.CORSConfig{}, 16)
+	w := performBodyRequest(t, h, `{"data":{"name":"pi","price":3.14}}`, false)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestMaxBodySizeRejectsChunkedBody(t *testing.T) {
+	h := getSecurityHandler(t, middleware.CORSConfig{}, 16)
+	w := performBodyRequest(t, h, `{"data":{"name":"pi","price":3.14}}`, true)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	expectedBody := `{"error":"Request body too large","request_id":"abc-123"}` + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
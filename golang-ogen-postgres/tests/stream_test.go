@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example-server/internal/dependencies"
+	"example-server/internal/middleware"
+	"example-server/internal/models"
+	"example-server/internal/openapi"
+)
+
+const (
+	mockItemJSON  = `{"id":1,"uuid":"550e8400-e29b-41d4-a716-446655440000","created_at":"2021-01-01T00:00:00Z","name":"pi","price":3.14}`
+	mockItem2JSON = `{"id":2,"uuid":"550e8400-e29b-41d4-a716-446655440001","created_at":"2021-01-01T00:00:00Z","name":"tree-fiddy","price":3.5}`
+)
+
+// HELPERS
+
+func getStreamHandler(t *testing.T, deps *dependencies.Dependencies, maxRows int) http.Handler {
+	t.Helper()
+	return middleware.RequestID(&openapi.ItemStreamHandler{Guard: getStreamGuard(t, deps), MaxRows: maxRows})
+}
+
+func performStreamRequest(t *testing.T, h http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	headers["Authorization"] = "Bearer " + getMockToken(t)
+	headers[middleware.RequestIdHeader] = "abc-123"
+	return performRequest(h, "GET", path, headers)
+}
+
+// TESTS
+
+func TestStreamItemsJSON(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectCommit()
+	w := performStreamRequest(t, getStreamHandler(t, deps, 0), "/items/stream", map[string]string{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	expectedBody := `{"data":[` + mockItemJSON + `,` + mockItem2JSON + `],"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestStreamItemsJSONEmpty(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 20, 5).
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectCommit()
+	w := performStreamRequest(t, getStreamHandler(t, deps, 0), "/items/stream?offset=20&limit=5", map[string]string{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectedBody := `{"data":[],"meta":{}}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsNDJSONByIds(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) AND id = ANY(.+) ORDER BY id").
+		WithArgs(mockTenant, []int{2, 1}).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectCommit()
+	w := performStreamRequest(t, getStreamHandler(t, deps, 0), "/items/stream?item_ids=2&item_ids=1", map[string]string{
+		"Accept": "application/x-ndjson",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/x-ndjson"})
+	expectedBody := mockItemJSON + "\n" + mockItem2JSON + "\n"
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestStreamItemsCapsLimit(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	h := getStreamHandler(t, deps, 2)
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 2).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectCommit()
+	w := performStreamRequest(t, h, "/items/stream?limit=500", map[string]string{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	// Ids beyond the cap are rejected rather than dropped
+	w = performStreamRequest(t, h, "/items/stream?item_ids=1&item_ids=2&item_ids=3", map[string]string{})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"too many item ids","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsErrors(t *testing.T) {
+	deps, _ := getMockDependencies()
+	h := getStreamHandler(t, deps, 0)
+	tests := map[string]struct {
+		expectedCode int
+		expectedBody string
+	}{
+		"/items/stream?offset=-1": {http.StatusBadRequest, `{"error":"invalid query parameters","request_id":"abc-123"}`},
+		"/items/stream?limit=0":   {http.StatusBadRequest, `{"error":"invalid query parameters","request_id":"abc-123"}`},
+		"/items/stream?limit=ten": {http.StatusBadRequest, `{"error":"invalid query parameters","request_id":"abc-123"}`},
+		"/items/stream?item_ids=one": {
+			http.StatusBadRequest, `{"error":"invalid item id","request_id":"abc-123"}`,
+		},
+	}
+	for path, tt := range tests {
+		w := performStreamRequest(t, h, path, map[string]string{})
+		if w.Code != tt.expectedCode {
+			t.Errorf("%s: expected status code %d, but got %d", path, tt.expectedCode, w.Code)
+		}
+		if w.Body.String() != tt.expectedBody {
+			t.Errorf("%s: expected %s, but got %s", path, tt.expectedBody, w.Body.String())
+		}
+	}
+	// Unauthenticated requests are rejected before the query is parsed
+	w := performRequest(h, "GET", "/items/stream?limit=ten", map[string]string{middleware.RequestIdHeader: "abc-123"})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestStreamItemsQueryError(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnError(errors.New("connection reset"))
+	mockDBPool.ExpectRollback()
+	w := performStreamRequest(t, getStreamHandler(t, deps, 0), "/items/stream", map[string]string{})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusInternalServerError, w.Code)
+	}
+	expectHeaders(t, w, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	expectedBody := `{"error":"Error querying Items","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestStreamItemsFlushesInChunks(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	items := make([]models.Item, 1200)
+	for i := range items {
+		items[i] = mockItem
+		items[i].ID = i + 1
+	}
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockItemRows(mockDBPool, items...))
+	mockDBPool.ExpectCommit()
+	w := performStreamRequest(t, getStreamHandler(t, deps, 0), "/items/stream", map[string]string{
+		"Accept": "application/x-ndjson",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	if !w.Flushed {
+		t.Errorf("Expected the response to be flushed while streaming")
+	}
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines) != len(items) {
+		t.Fatalf("Expected %d lines, but got %d", len(items), len(lines))
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], `{"id":`+strconv.Itoa(len(items))+`,`) {
+		t.Errorf("Expected the last line to hold Item %d, but got %s", len(items), lines[len(lines)-1])
+	}
+}
+
+func TestStreamItemsStopsWhenClientGoesAway(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE tenant_id = (.+) ORDER BY id OFFSET (.+) LIMIT (.+)").
+		WithArgs(mockTenant, 0, 10000).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem, mockItem2))
+	mockDBPool.ExpectRollback()
+	req := httptest.NewRequest("GET", "/items/stream", nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	w := httptest.NewRecorder()
+	getStreamHandler(t, deps, 0).ServeHTTP(w, req)
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected nothing to be written, but got %s", w.Body.String())
+	}
+}
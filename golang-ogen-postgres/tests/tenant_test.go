@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"example-server/internal/auth"
+	"example-server/internal/middleware"
+	"example-server/internal/tenant"
+)
+
+// HELPERS
+
+func getTenantToken(t *testing.T, tenantID string, scope string) string {
+	t.Helper()
+	claims := getMockClaims()
+	claims["scope"] = scope
+	if tenantID == "" {
+		delete(claims, "tenant_id")
+	} else {
+		claims["tenant_id"] = tenantID
+	}
+	return signToken(t, jwt.SigningMethodHS256, []byte(mockHMACSecret), "", claims)
+}
+
+// TESTS
+
+func TestTenantCrossTenantReadReturns404(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	// item 1 belongs to tenant-a, so tenant-b's scoped query finds nothing
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	h := getHandler(t, deps)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getTenantToken(t, "tenant-b", "items:read"),
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, w.Code)
+	}
+	expectedBody := `{"error":"Item not found","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantCrossTenantDeleteReturns404(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockItemRows(mockDBPool))
+	mockDBPool.ExpectRollback()
+	h := getHandler(t, deps)
+	w := performRequest(h, "DELETE", "/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, "tenant-b", "items:delete"),
+	})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantHeaderIgnoredWithoutTenantClaim(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getTenantToken(t, "", "items:read"),
+		tenant.Header:              "tenant-b",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"credentials are not bound to a tenant","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestTenantFromHeaderWithCrossTenantScope(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	mockDBPool.ExpectCommit()
+	h := getHandler(t, deps)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		"Authorization": "Bearer " + getTenantToken(t, "", "items:read "+auth.CrossTenantScope),
+		tenant.Header:   "tenant-b",
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+}
+
+func TestTenantHeaderCannotOverrideTenantClaim(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getTenantToken(t, "tenant-a", "items:read"),
+		tenant.Header:              "tenant-b",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, w.Code)
+	}
+	expectedBody := `{"error":"tenant does not match credentials","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestTenantMissing(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "GET", "/items/1", map[string]string{
+		middleware.RequestIdHeader: "abc-123",
+		"Authorization":            "Bearer " + getTenantToken(t, "", "items:read "+auth.CrossTenantScope),
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, w.Code)
+	}
+	expectedBody := `{"error":"missing tenant","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}
+
+func TestTenantNotRequiredForPing(t *testing.T) {
+	h := getHandler(t, nil)
+	w := performRequest(h, "GET", "/ping", nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestTenantDuplicateNameReturns409(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("INSERT INTO item (.+) VALUES (.+) RETURNING id").
+		WithArgs(mockTenant, mockItem.Name, mockItem.Price).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mockDBPool.ExpectRollback()
+	h := getHandler(t, deps)
+	req, _ := http.NewRequest("POST", "/items", strings.NewReader(`{"data":{"name":"pi","price":3.14}}`))
+	req.Header.Set("Authorization", "Bearer "+getMockToken(t))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,294 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example-server/internal/middleware"
+	"example-server/internal/tlsconfig"
+)
+
+// HELPERS
+
+type mockCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var mockSerial int64
+
+func newMockCA(t *testing.T, name string) mockCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %s", err)
+	}
+	mockSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(mockSerial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return mockCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a server certificate for localhost, or a client certificate
+func (ca mockCA) issue(t *testing.T, subject pkix.Name, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	mockSerial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(mockSerial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeKeyPair writes cert as PEM files, returning their paths
+func writeKeyPair(t *testing.T, dir string, cert tls.Certificate) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %s", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %s", path, err)
+	}
+}
+
+// startTLSServer serves handler with config as serverd does
+func startTLSServer(t *testing.T, handler http.Handler, config tlsconfig.Config) (string, *tlsconfig.Reloader) {
+	t.Helper()
+	reloader, err := tlsconfig.NewReloader(config)
+	if err != nil {
+		t.Fatalf("Failed to load TLS config: %s", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	server := &http.Server{Handler: handler, TLSConfig: reloader.TLSConfig()}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return "https://" + listener.Addr().String(), reloader
+}
+
+func getTLSClient(ca mockCA, certs ...tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, ServerName: "localhost"},
+	}}
+}
+
+func getBody(t *testing.T, client *http.Client, url string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// writeMTLSFiles writes a localhost server certificate and the CA bundle
+func writeMTLSFiles(t *testing.T, ca mockCA) tlsconfig.Config {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, ca.issue(t, pkix.Name{CommonName: "localhost"}, true))
+	caFile := filepath.Join(dir, "ca.crt")
+	writeFile(t, caFile, ca.pem)
+	return tlsconfig.Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+}
+
+// TESTS
+
+func TestTLSReloadsChangedCertificate(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	dir := t.TempDir()
+	first := ca.issue(t, pkix.Name{CommonName: "localhost"}, true)
+	certFile, keyFile := writeKeyPair(t, dir, first)
+	url, reloader := startTLSServer(t, getHandler(t, nil), tlsconfig.Config{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx)
+	// keep a connection open across the reload
+	client := getTLSClient(ca)
+	resp, body := getBody(t, client, url+"/ping", nil)
+	if resp.StatusCode != http.StatusOK || resp.TLS.PeerCertificates[0].SerialNumber.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Fatalf("Expected the first certificate, got %d: %s", resp.StatusCode, body)
+	}
+	second := ca.issue(t, pkix.Name{CommonName: "localhost"}, true)
+	writeKeyPair(t, dir, second)
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, _ := getBody(t, getTLSClient(ca), url+"/ping", nil)
+		if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(second.Leaf.SerialNumber) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Certificate was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	resp, _ = getBody(t, client, url+"/ping", nil)
+	if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(first.Leaf.SerialNumber) != 0 {
+		t.Errorf("Expected the established connection to be kept")
+	}
+}
+
+func TestTLSKeepsCertificateOnInvalidReload(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	config := writeMTLSFiles(t, ca)
+	url, reloader := startTLSServer(t, getHandler(t, nil), config)
+	writeFile(t, config.ClientCAFile, []byte("not a bundle"))
+	if err := reloader.Reload(); !errors.Is(err, tlsconfig.ErrorInvalidClientCA) {
+		t.Errorf("Expected ErrorInvalidClientCA, but got %v", err)
+	}
+	clientCert := ca.issue(t, pkix.Name{CommonName: "billing-service"}, false)
+	if resp, _ := getBody(t, getTLSClient(ca, clientCert), url+"/ping", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the previous client CAs to be used, but got %d", resp.StatusCode)
+	}
+}
+
+func TestMTLSMapsClientCertificateToPrincipal(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	// the tenant comes from the certificate organization
+	expectTenantTx(mockDBPool, "tenant-b")
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, "tenant-b").
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	mockDBPool.ExpectCommit()
+	ca := newMockCA(t, "test-ca")
+	url, _ := startTLSServer(t, getHandler(t, deps), writeMTLSFiles(t, ca))
+	clientCert := ca.issue(t, pkix.Name{
+		CommonName:         "billing-service",
+		Organization:       []string{"tenant-b"},
+		OrganizationalUnit: []string{"items:read"},
+	}, false)
+	resp, body := getBody(t, getTLSClient(ca, clientCert), url+"/items/1", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	// Scopes come from the organizational units
+	req, _ := http.NewRequest("DELETE", url+"/items/1", nil)
+	resp, err := getTLSClient(ca, clientCert).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status code %d, but got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestMTLSRejectsMissingOrUntrustedCertificates(t *testing.T) {
+	ca := newMockCA(t, "test-ca")
+	url, _ := startTLSServer(t, getHandler(t, nil), writeMTLSFiles(t, ca))
+	otherCA := newMockCA(t, "other-ca")
+	for _, client := range []*http.Client{
+		getTLSClient(ca),
+		getTLSClient(ca, otherCA.issue(t, pkix.Name{CommonName: "intruder"}, false)),
+	} {
+		if resp, err := client.Get(url + "/ping"); err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected the handshake to fail, but got %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestMTLSOptionalClientCertificate(t *testing.T) {
+	deps, mockDBPool := getMockDependencies()
+	// the token's tenant wins over the certificate's
+	expectTenantTx(mockDBPool, mockTenant)
+	mockDBPool.ExpectQuery("SELECT (.+) FROM item WHERE id = (.+) AND tenant_id = (.+)").
+		WithArgs(1, mockTenant).
+		WillReturnRows(getMockItemRows(mockDBPool, mockItem))
+	mockDBPool.ExpectCommit()
+	ca := newMockCA(t, "test-ca")
+	config := writeMTLSFiles(t, ca)
+	config.ClientCertOptional = true
+	url, _ := startTLSServer(t, getHandler(t, deps), config)
+	clientCert := ca.issue(t, pkix.Name{
+		CommonName:         "billing-service",
+		Organization:       []string{"tenant-b"},
+		OrganizationalUnit: []string{"items:read"},
+	}, false)
+	resp, body := getBody(t, getTLSClient(ca, clientCert), url+"/items/1", map[string]string{
+		"Authorization": "Bearer " + getMockToken(t),
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	if err := mockDBPool.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled DB expectations: %s", err)
+	}
+	resp, _ = getBody(t, getTLSClient(ca), url+"/items/1", map[string]string{middleware.RequestIdHeader: "abc-123"})
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, but got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
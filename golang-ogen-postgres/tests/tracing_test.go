@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"example-server/internal/database"
+	"example-server/internal/openapi"
+	"example-server/internal/openapi/ogen"
+	"example-server/internal/tracing"
+)
+
+const (
+	mockTraceId     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	mockParentId    = "00f067aa0ba902b7"
+	mockTraceparent = "00-" + mockTraceId + "-" + mockParentId + "-01"
+)
+
+// HELPERS
+
+func getTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	// record spans in memory
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return tp, recorder
+}
+
+// TESTS
+
+func TestTracingOgenServerContinuesW3CTrace(t *testing.T) {
+	tp, recorder := getTracerProvider()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// setup ogen server with tracing
+	server, err := ogen.NewServer(&openapi.ItemsService{}, getMockSecurityHandler(t), ogen.WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("Failed to create server: %s", err)
+	}
+	handler := tracing.HTTPMiddleware(server)
+	// exec request with traceparent header
+	req, _ := http.NewRequest("GET", "/ping", nil)
+	req.Header.Set("traceparent", mockTraceparent)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	// assert operation span continues the incoming trace
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, but got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != ogen.PingOperation {
+		t.Errorf("Expected span name %s, but got %s", ogen.PingOperation, span.Name())
+	}
+	if span.SpanContext().TraceID().String() != mockTraceId {
+		t.Errorf("Expected trace id %s, but got %s", mockTraceId, span.SpanContext().TraceID())
+	}
+	if span.Parent().SpanID().String() != mockParentId {
+		t.Errorf("Expected parent span id %s, but got %s", mockParentId, span.Parent().SpanID())
+	}
+}
+
+func TestTracingQueryTracer(t *testing.T) {
+	tp, recorder := getTracerProvider()
+	tracer := database.NewQueryTracer(tp)
+	// trace an unnamed and a named query
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = database.WithQueryName(context.Background(), "item.update")
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "UPDATE item SET name = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	// assert span names
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+	if spans[0].Name() != "postgres.query" {
+		t.Errorf("Expected span name postgres.query, but got %s", spans[0].Name())
+	}
+	if spans[1].Name() != "item.update" {
+		t.Errorf("Expected span name item.update, but got %s", spans[1].Name())
+	}
+}
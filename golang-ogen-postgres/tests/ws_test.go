@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"example-server/internal/changefeed"
+	"example-server/internal/middleware"
+	"example-server/internal/openapi"
+	"example-server/internal/ws"
+)
+
+// HELPERS
+
+func getWebSocketHandler(t *testing.T, listener *changefeed.Listener) *openapi.WebSocketHandler {
+	t.Helper()
+	deps, _ := getMockDependencies()
+	deps.Changes = listener
+	return &openapi.WebSocketHandler{
+		Guard:  getStreamGuard(t, deps),
+		Config: ws.Config{SendBuffer: ws.DefaultSendBuffer, MaxSubscriptions: ws.DefaultMaxSubscriptions, Heartbeat: time.Hour},
+	}
+}
+
+// getWebSocketURL serves handler behind the response compressing middleware,
+// which must let the connection be hijacked, returning its ws:// URL
+func getWebSocketURL(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	handler = middleware.Compress(handler, middleware.CompressionConfig{Encodings: []string{middleware.EncodingGzip}})
+	server := httptest.NewServer(middleware.RequestID(handler))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func dialWebSocket(t *testing.T, url string) *ws.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := ws.Dial(ctx, url, http.Header{
+		"Authorization":   {"Bearer " + getMockToken(t)},
+		"Accept-Encoding": {"gzip"},
+	})
+	if err != nil {
+		t.Fatalf("Error dialing %s: %s", url, err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func expectMessage(t *testing.T, client *ws.Client, expected string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	message, err := client.Read(ctx)
+	if err != nil {
+		t.Fatalf("Error reading %s: %s", expected, err)
+	}
+	// Compare as sent over the wire
+	actual, _ := json.Marshal(message)
+	if string(actual) != expected {
+		t.Errorf("Expected %s, but got %s", expected, actual)
+	}
+}
+
+// TESTS
+
+func TestWebSocketSubscribe(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	client := dialWebSocket(t, getWebSocketURL(t, getWebSocketHandler(t, listener)))
+	client.Subscribe(1, 2)
+	expectMessage(t, client, `{"type":"subscribe","id":"1","item_ids":[1,2]}`)
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 3, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: "tenant-b"})
+	listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 2, TenantID: mockTenant})
+	expectMessage(t, client, `{"type":"event","event":{"op":"updated","id":2,"tenant_id":"tenant-a"}}`)
+	client.Unsubscribe(2)
+	expectMessage(t, client, `{"type":"unsubscribe","id":"2","item_ids":[1]}`)
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 2, TenantID: mockTenant})
+	listener.Publish(changefeed.Event{Op: changefeed.OpDeleted, ID: 1, TenantID: mockTenant})
+	expectMessage(t, client, `{"type":"event","event":{"op":"deleted","id":1,"tenant_id":"tenant-a"}}`)
+	client.Ping()
+	expectMessage(t, client, `{"type":"pong","id":"3"}`)
+	client.Subscribe()
+	expectMessage(t, client, `{"type":"error","id":"4","error":"missing item_ids"}`)
+}
+
+func TestWebSocketDisconnectsSlowConsumers(t *testing.T) {
+	listener := changefeed.NewListener(nil)
+	handler := getWebSocketHandler(t, listener)
+	handler.Config.SendBuffer = 1
+	client := dialWebSocket(t, getWebSocketURL(t, handler))
+	client.Subscribe(1)
+	expectMessage(t, client, `{"type":"subscribe","id":"1","item_ids":[1]}`)
+	// Publish faster than a single message queue drains
+	for i := 0; i < 1000; i++ {
+		listener.Publish(changefeed.Event{Op: changefeed.OpUpdated, ID: 1, TenantID: mockTenant})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		_, err := client.Read(ctx)
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+			t.Errorf("Expected close code %d, but got %v", websocket.ClosePolicyViolation, err)
+		}
+		return
+	}
+}
+
+func TestWebSocketAuthenticatesUpgrade(t *testing.T) {
+	url := getWebSocketURL(t, getWebSocketHandler(t, changefeed.NewListener(nil)))
+	for name, header := range map[string]http.Header{
+		"missing credentials": {},
+		"invalid token":       {"Authorization": {"Bearer not-a-token"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected a %d upgrade failure, but got %v", http.StatusUnauthorized, err)
+			}
+		})
+	}
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	handler := middleware.RequestID(getWebSocketHandler(t, changefeed.NewListener(nil)))
+	w := performRequest(handler, "GET", "/ws", map[string]string{
+		"Authorization":            "Bearer " + getMockToken(t),
+		middleware.RequestIdHeader: "abc-123",
+	})
+	if w.Code != http.StatusUpgradeRequired {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusUpgradeRequired, w.Code)
+	}
+	if w.Header().Get("Upgrade") != "websocket" {
+		t.Errorf("Expected Upgrade header websocket, but got %q", w.Header().Get("Upgrade"))
+	}
+	expectedBody := `{"error":"websocket upgrade required","request_id":"abc-123"}`
+	if w.Body.String() != expectedBody {
+		t.Errorf("Expected %s, but got %s", expectedBody, w.Body.String())
+	}
+}